@@ -1,7 +1,8 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
 
 	"github.com/adrianliechti/prism/pkg/config"
@@ -14,15 +15,21 @@ func main() {
 	cfg, err := config.New()
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
+	slog.SetDefault(cfg.Logger(os.Stderr))
+
 	srv, err := server.New(cfg)
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+
+	srv.Start(ctx)
+
 	err = shell.Run(shell.Options{
 		Title:   "Prism",
 		Handler: srv,
@@ -36,7 +43,17 @@ func main() {
 		Debug: os.Getenv("PRISM_DEBUG") != "",
 	})
 
+	// the window is closed: stop the background work, commit pending
+	// changes and clean up
+	cancel()
+	srv.Shutdown()
+
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 }
+
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/adrianliechti/prism/pkg/config"
+	"github.com/adrianliechti/prism/pkg/server"
+)
+
+// clientFlags are the flags of commands that work on the local data
+// directory or, with -instance, on a running instance.
+type clientFlags struct {
+	config    *string
+	dataDir   *string
+	workspace *string
+
+	instance *string
+	token    *string
+}
+
+func addClientFlags(flags *flag.FlagSet) *clientFlags {
+	return &clientFlags{
+		config:    flags.String("config", "", "configuration file (env PRISM_CONFIG, default prism.yaml of the working or data directory)"),
+		dataDir:   flags.String("data-dir", "", "directory for stored data (env PRISM_DATA_DIR)"),
+		workspace: flags.String("workspace", "", "workspace of the data directory or the instance (env PRISM_WORKSPACE)"),
+
+		instance: flags.String("instance", "", "URL of a running instance to use instead of the data directory (env PRISM_URL)"),
+		token:    flags.String("token", "", "access token of the running instance (env PRISM_TOKEN)"),
+	}
+}
+
+// loadConfig reads the configuration of a command; access logs of every
+// request would drown its output, so they are off unless asked for.
+func loadConfig(path, dataDir, workspace string) (*config.Config, error) {
+	cfg, err := config.Load(cmp.Or(path, os.Getenv("PRISM_CONFIG"), config.FindFile(dataDir)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dataDir != "" {
+		cfg.DataDir = dataDir
+	}
+
+	if workspace != "" {
+		cfg.Workspace = workspace
+	}
+
+	if os.Getenv("PRISM_LOG_LEVEL") == "" {
+		cfg.LogLevel = max(cfg.LogLevel, slog.LevelWarn)
+	}
+
+	slog.SetDefault(cfg.Logger(os.Stderr))
+
+	return cfg, nil
+}
+
+// apiClient calls the API of a running instance, or of a server on the
+// local data directory within the process.
+type apiClient struct {
+	base  string
+	token string
+
+	// workspace of the instance the requests work on, empty for the open one
+	workspace string
+
+	client *http.Client
+}
+
+func (f *clientFlags) client() (*apiClient, error) {
+	if url := cmp.Or(*f.instance, os.Getenv("PRISM_URL")); url != "" {
+		return &apiClient{
+			base:  strings.TrimSuffix(url, "/"),
+			token: cmp.Or(*f.token, os.Getenv("PRISM_TOKEN")),
+
+			workspace: cmp.Or(*f.workspace, os.Getenv("PRISM_WORKSPACE")),
+
+			client: &http.Client{CheckRedirect: keepRedirect},
+		}, nil
+	}
+
+	cfg, err := loadConfig(*f.config, *f.dataDir, *f.workspace)
+
+	if err != nil {
+		return nil, err
+	}
+
+	srv, err := server.New(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiClient{
+		base: "http://localhost",
+
+		client: &http.Client{Transport: handlerTransport{srv}, CheckRedirect: keepRedirect},
+	}, nil
+}
+
+// keepRedirect returns redirects as they are: those of sent requests are
+// responses to show, not to follow.
+func keepRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// do sends a request to the API; responses other than 2xx are errors
+// carrying the text of the body.
+func (c *apiClient) do(method, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	resp, err := c.send(method, path, body, header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+
+		return nil, responseError(method, path, resp)
+	}
+
+	return resp, nil
+}
+
+// send sends a request to the API and returns the response whatever its
+// status.
+func (c *apiClient) send(method, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.base+path, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	if c.workspace != "" {
+		req.Header.Set("X-Prism-Workspace", c.workspace)
+	}
+
+	return c.client.Do(req)
+}
+
+// responseError returns the error of a failed API response, the text of
+// its body or the message of an error of the proxy.
+func responseError(method, path string, resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var proxyErr server.ProxyError
+
+	if resp.Header.Get("X-Prism-Error") != "" && json.Unmarshal(data, &proxyErr) == nil && proxyErr.Message != "" {
+		return errors.New(proxyErr.Message)
+	}
+
+	if message := strings.TrimSpace(string(data)); message != "" {
+		return errors.New(message)
+	}
+
+	return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+}
+
+// handlerTransport serves requests with a handler of the process. The
+// response is returned once the handler writes its header and its body
+// streams through a pipe, so streamed responses arrive as they are written.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pr, pw := io.Pipe()
+
+	w := &pipeResponseWriter{
+		req: req,
+
+		header: http.Header{},
+		body:   pr,
+		pipe:   pw,
+
+		response: make(chan *http.Response, 1),
+	}
+
+	go func() {
+		defer pw.Close()
+
+		t.handler.ServeHTTP(w, req)
+		w.WriteHeader(http.StatusOK)
+	}()
+
+	return <-w.response, nil
+}
+
+// pipeResponseWriter is the http.ResponseWriter of handlerTransport.
+type pipeResponseWriter struct {
+	req *http.Request
+
+	header http.Header
+	body   *io.PipeReader
+	pipe   *io.PipeWriter
+
+	wroteHeader bool
+	response    chan *http.Response
+}
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.wroteHeader = true
+
+	w.response <- &http.Response{
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode: code,
+
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+
+		Header:        w.header.Clone(),
+		Body:          w.body,
+		ContentLength: -1,
+
+		Request: w.req,
+	}
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+
+	return w.pipe.Write(p)
+}
+
+// Flush is a no-op: writes reach the reader as they happen.
+func (w *pipeResponseWriter) Flush() {}
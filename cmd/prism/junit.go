@@ -0,0 +1,133 @@
+package main
+
+import (
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/adrianliechti/prism/pkg/server"
+)
+
+type junitSuites struct {
+	XMLName xml.Name `xml:"testsuites"`
+
+	Name     string  `xml:"name,attr"`
+	Tests    int     `xml:"tests,attr"`
+	Failures int     `xml:"failures,attr"`
+	Errors   int     `xml:"errors,attr"`
+	Time     float64 `xml:"time,attr"`
+
+	Suites []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string  `xml:"name,attr"`
+	Tests    int     `xml:"tests,attr"`
+	Failures int     `xml:"failures,attr"`
+	Errors   int     `xml:"errors,attr"`
+	Time     float64 `xml:"time,attr"`
+
+	Cases []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string  `xml:"name,attr"`
+	ClassName string  `xml:"classname,attr"`
+	Time      float64 `xml:"time,attr"`
+
+	Failure *junitFailure `xml:"failure,omitempty"`
+	Error   *junitFailure `xml:"error,omitempty"`
+
+	SystemOut string `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes result as JUnit XML: a test suite per iteration
+// and a test case per request. Requests without a response are errors,
+// those with failed assertions failures.
+func writeJUnitReport(w io.Writer, result *server.RunResult) error {
+	report := junitSuites{
+		Name:  "prism",
+		Tests: result.Requests,
+		Time:  seconds(result.Duration),
+	}
+
+	for _, iteration := range result.Results {
+		suite := junitSuite{
+			Name: "prism run",
+		}
+
+		var duration float64
+
+		if result.Iterations > 1 {
+			suite.Name = fmt.Sprintf("prism run, iteration %d", iteration.Iteration)
+		}
+
+		for _, r := range iteration.Requests {
+			c := junitCase{
+				Name:      cmp.Or(r.Name, r.ID),
+				ClassName: suite.Name,
+				Time:      seconds(r.Duration),
+
+				SystemOut: fmt.Sprintf("%s %s", r.Method, r.URL),
+			}
+
+			reasons := failureReasons(r)
+
+			switch {
+			case r.Error != "":
+				c.Error = &junitFailure{Message: r.Error, Type: "error", Text: strings.Join(reasons, "\n")}
+				suite.Errors++
+
+			case !r.Passed:
+				message := "request failed"
+
+				if len(reasons) > 0 {
+					message = reasons[0]
+				}
+
+				c.Failure = &junitFailure{Message: message, Type: "assertion", Text: strings.Join(reasons, "\n")}
+				suite.Failures++
+			}
+
+			suite.Tests++
+			duration += r.Duration
+
+			suite.Cases = append(suite.Cases, c)
+		}
+
+		suite.Time = seconds(duration)
+
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+
+		report.Suites = append(report.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// seconds converts milliseconds to seconds, rounded to milliseconds.
+func seconds(ms float64) float64 {
+	return math.Round(ms) / 1000
+}
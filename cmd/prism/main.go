@@ -1,71 +1,319 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/rand"
 	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"net"
+	"os"
 	"os/exec"
 	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 
+	"github.com/adrianliechti/prism"
 	"github.com/adrianliechti/prism/pkg/config"
 	"github.com/adrianliechti/prism/pkg/server"
 )
 
 func main() {
-	portFlag := flag.Int("port", 9999, "port to listen on (0 for random free port)")
-	serverFlag := flag.Bool("server", false, "start server without opening browser")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(runCommand(os.Args[2:]))
+		case "send":
+			os.Exit(sendCommand(os.Args[2:]))
+		case "export":
+			os.Exit(exportCommand(os.Args[2:]))
+		case "import":
+			os.Exit(importCommand(os.Args[2:]))
+		case "migrate":
+			os.Exit(migrateCommand(os.Args[2:]))
+		}
+	}
+
+	portFlag := flag.Int("port", config.DefaultPort, "port to listen on, 0 for a random free port (env PRISM_PORT)")
+	hostFlag := flag.String("host", config.DefaultHost, "interface to listen on (env PRISM_HOST)")
+	noBrowserFlag := flag.Bool("no-browser", false, "start server without opening browser (env PRISM_NO_BROWSER)")
+	serverFlag := flag.Bool("server", false, "same as -no-browser")
+	noUpdateCheckFlag := flag.Bool("no-update-check", false, "do not look for new releases (env PRISM_NO_UPDATE_CHECK)")
+	containerFlag := flag.Bool("container", false, "run a shared instance in a container: remote mode, data in /data, JSON logs to stdout (env PRISM_CONTAINER)")
+	dataDirFlag := flag.String("data-dir", "", "directory for stored data (env PRISM_DATA_DIR, default the platform's data directory)")
+	workspaceFlag := flag.String("workspace", "", "workspace to open, created when missing (env PRISM_WORKSPACE, default the data directory itself)")
+	storageFlag := flag.String("storage", "", "backend of the data stores: file or sqlite (env PRISM_STORAGE, default file)")
+	configFlag := flag.String("config", "", "configuration file (env PRISM_CONFIG, default prism.yaml of the working or data directory)")
+	remoteFlag := flag.Bool("remote", false, "serve other machines, requiring an access token (env PRISM_REMOTE)")
+	tokenFlag := flag.String("token", "", "access token of remote mode, generated when empty (env PRISM_TOKEN)")
+	tlsFlag := flag.Bool("tls", false, "serve HTTPS with a certificate of a local CA (env PRISM_TLS)")
+	tlsCertFlag := flag.String("tls-cert", "", "certificate file (PEM) of HTTPS instead of the local CA (env PRISM_TLS_CERT)")
+	tlsKeyFlag := flag.String("tls-key", "", "key file (PEM) of -tls-cert (env PRISM_TLS_KEY)")
+	tlsTrustFlag := flag.Bool("tls-trust", false, "install the local CA into the trust store of the user")
+	caCertFlag := flag.String("ca-cert", "", "CA file (PEM) trusted for upstream traffic besides the system roots (env PRISM_CA_CERT)")
+	logLevelFlag := flag.String("log-level", "", "log level: debug, info, warn or error (env PRISM_LOG_LEVEL, default info)")
+	logFormatFlag := flag.String("log-format", "", "log format: text or json (env PRISM_LOG_FORMAT, default text)")
+	versionFlag := flag.Bool("version", false, "print the version and exit")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: prism [flags]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       prism run [flags] [request ...]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       prism send [flags] request | -url url")
+		fmt.Fprintln(flag.CommandLine.Output(), "       prism export [flags] [entry ...]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       prism import [flags] archive ...")
+		fmt.Fprintln(flag.CommandLine.Output(), "       prism migrate [flags]")
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
 
-	cfg, err := config.New()
+	if *versionFlag {
+		fmt.Println(versionString())
+		return
+	}
+
+	// the file is looked for in the data directory of the flag, too
+	cfg, err := config.Load(cmp.Or(*configFlag, os.Getenv("PRISM_CONFIG"), config.FindFile(*dataDirFlag)))
 
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// flags take precedence over the environment and the file, also over
+	// the file reloaded by the server
+	applyFlags := func(cfg *config.Config) error {
+		var flagErr error
+
+		flag.Visit(func(f *flag.Flag) {
+			var err error
+
+			switch f.Name {
+			case "port":
+				cfg.Port = *portFlag
+			case "host":
+				cfg.Host = *hostFlag
+			case "no-browser":
+				cfg.NoBrowser = *noBrowserFlag
+			case "server":
+				cfg.NoBrowser = cfg.NoBrowser || *serverFlag
+			case "no-update-check":
+				cfg.NoUpdateCheck = *noUpdateCheckFlag
+			case "container":
+				cfg.Container = *containerFlag
+			case "data-dir":
+				cfg.DataDir = *dataDirFlag
+			case "workspace":
+				cfg.Workspace = *workspaceFlag
+			case "storage":
+				cfg.Storage, err = config.ParseStorage(*storageFlag)
+				flagErr = cmp.Or(flagErr, err)
+			case "remote":
+				cfg.Remote = *remoteFlag
+			case "token":
+				cfg.Token = *tokenFlag
+			case "tls":
+				cfg.TLS = *tlsFlag
+			case "tls-cert":
+				cfg.TLSCert = *tlsCertFlag
+			case "tls-key":
+				cfg.TLSKey = *tlsKeyFlag
+			case "tls-trust":
+				cfg.TLSTrust = *tlsTrustFlag
+			case "ca-cert":
+				cfg.CACert = *caCertFlag
+			case "log-level":
+				cfg.LogLevel, err = config.ParseLogLevel(*logLevelFlag)
+				flagErr = cmp.Or(flagErr, err)
+			case "log-format":
+				cfg.LogFormat, err = config.ParseLogFormat(*logFormatFlag)
+				flagErr = cmp.Or(flagErr, err)
+			}
+		})
+
+		return flagErr
+	}
+
+	if err := applyFlags(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	cfg.Override = func(next *config.Config) {
+		applyFlags(next)
+	}
+
+	logOutput := os.Stderr
+
+	// Container mode serves a shared instance, its data on a mounted
+	// volume and its logs collected from stdout.
+	if cfg.Container {
+		if cfg.DataDir == "" {
+			cfg.DataDir = "/data"
+		}
+
+		if cfg.LogFormat == "" {
+			cfg.LogFormat = "json"
+		}
+
+		cfg.Remote = true
+		cfg.NoUpdateCheck = true
+
+		logOutput = os.Stdout
+	}
+
+	slog.SetDefault(cfg.Logger(logOutput))
+
+	// a certificate, or trusting the local CA, implies HTTPS
+	if cfg.TLSCert != "" || cfg.TLSKey != "" || cfg.TLSTrust {
+		cfg.TLS = true
+	}
+
+	// Multi-user mode runs a gateway in front of a server for every user,
+	// which are started with PRISM_USER set.
+	users := len(cfg.Users) > 0 && cfg.User == ""
+
+	if users {
+		if cfg.TLS {
+			fatal(errors.New("multi-user mode serves HTTP only, terminate TLS in front of it"))
+		}
+
+		if cfg.Host == config.DefaultHost {
+			cfg.Host = ""
+		}
+
+		cfg.NoBrowser = true
+	} else if cfg.Remote || cfg.Token != "" {
+		// Remote mode, also implied by a configured token, listens on all
+		// interfaces unless a host is set, never opens a browser and
+		// generates a token when there is none.
+		if cfg.Host == config.DefaultHost {
+			cfg.Host = ""
+		}
+
+		if cfg.Token == "" {
+			cfg.Token = rand.Text()
+		}
+
+		cfg.NoBrowser = true
 	}
 
 	// Bind the port now and hand the listener to the server to avoid a TOCTOU race.
-	listener, err := listen("localhost", *portFlag)
+	listener, err := listen(cfg.Host, cfg.Port)
 
 	if err != nil {
-		panic(err)
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// a second signal ends the process without waiting for the drain
+	context.AfterFunc(ctx, stop)
+
+	if users {
+		fmt.Printf("Prism is serving %d users at %s\n", len(cfg.Users), serverURL(cfg.Host, listener.Addr().(*net.TCPAddr).Port, true, false))
+
+		if err := serveUsers(ctx, cfg, listener); err != nil {
+			fatal(err)
+		}
+
+		return
 	}
 
 	srv, err := server.New(cfg)
 
 	if err != nil {
-		panic(err)
+		fatal(err)
 	}
 
-	addr := listener.Addr().(*net.TCPAddr)
-	url := fmt.Sprintf("http://localhost:%d", addr.Port)
+	url := serverURL(cfg.Host, listener.Addr().(*net.TCPAddr).Port, cfg.Token != "", cfg.TLS)
 
-	if !*serverFlag {
+	if cfg.Token != "" {
+		url += "/?token=" + cfg.Token
+	}
+
+	if !cfg.NoBrowser {
 		openBrowser(url)
 	}
 	fmt.Printf("Prism is running at %s\n", url)
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
-
 	if err := srv.Serve(ctx, listener); err != nil {
-		panic(err)
+		fatal(err)
+	}
+}
+
+// versionString identifies the build, e.g.
+// "prism 1.2.3 (0123abc, 2026-01-02T15:04:05Z) go1.26.0 linux/amd64".
+func versionString() string {
+	build := prism.Version()
+
+	var details []string
+
+	if commit := prism.Commit(); commit != "" {
+		details = append(details, commit)
 	}
+
+	if date := prism.BuildDate(); date != "" {
+		details = append(details, date)
+	}
+
+	if len(details) > 0 {
+		build += " (" + strings.Join(details, ", ") + ")"
+	}
+
+	return fmt.Sprintf("prism %s %s %s/%s", build, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
+// serverURL is the address of the UI. Loopback listeners are reached
+// through localhost, which the server requires as Host; so are wildcard
+// listeners, except in remote mode, where they are reached by the name of
+// the machine.
+func serverURL(host string, port int, remote, secure bool) string {
+	ip := net.ParseIP(host)
+
+	if host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+
+		if name, err := os.Hostname(); err == nil && remote {
+			host = name
+		}
+	}
+
+	if ip != nil && ip.IsLoopback() {
+		host = "localhost"
+	}
+
+	scheme := "http"
+
+	if secure {
+		scheme = "https"
+	}
+
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
 }
 
-// listen binds to the requested port, falling back to a random free port if busy.
+// listen binds to the requested port. Only the default port falls back to
+// a random free port if busy; a configured one must be available.
 func listen(host string, port int) (net.Listener, error) {
 	if port > 0 {
-		l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
-		if err == nil {
-			return l, nil
+		l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err == nil || port != config.DefaultPort {
+			return l, err
 		}
 	}
 
-	l, err := net.Listen("tcp", fmt.Sprintf("%s:0", host))
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to bind a free port: %w", err)
 	}
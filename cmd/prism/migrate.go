@@ -0,0 +1,69 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+
+	"github.com/adrianliechti/prism/pkg/config"
+	"github.com/adrianliechti/prism/pkg/server"
+)
+
+// migrateCommand implements prism migrate, which copies the data stores of
+// all workspaces of the data directory from one storage to another.
+func migrateCommand(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: prism migrate [flags]")
+		fmt.Fprintln(flags.Output())
+		fmt.Fprintln(flags.Output(), "Copies the data stores of all workspaces to another storage, leaving the source as it is.")
+		fmt.Fprintln(flags.Output(), "Stop running instances first and start them with the new -storage afterwards.")
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+
+	configFlag := flags.String("config", "", "configuration file (env PRISM_CONFIG, default prism.yaml of the working or data directory)")
+	dataDirFlag := flags.String("data-dir", "", "directory for stored data (env PRISM_DATA_DIR)")
+
+	fromFlag := flags.String("from", config.StorageFile, "storage to copy from: file or sqlite")
+	toFlag := flags.String("to", config.StorageSQLite, "storage to copy to: file or sqlite")
+	overwriteFlag := flags.Bool("overwrite", false, "replace entries the target has already instead of keeping them")
+
+	flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	from, err := config.ParseStorage(*fromFlag)
+
+	if err != nil {
+		return commandError("migrate", err)
+	}
+
+	to, err := config.ParseStorage(*toFlag)
+
+	if err != nil {
+		return commandError("migrate", err)
+	}
+
+	cfg, err := loadConfig(*configFlag, *dataDirFlag, "")
+
+	if err != nil {
+		return commandError("migrate", err)
+	}
+
+	dataDir := cmp.Or(cfg.DataDir, config.DefaultDataDir())
+
+	count, err := server.MigrateStore(dataDir, from, to, *overwriteFlag)
+
+	if err != nil {
+		return commandError("migrate", err)
+	}
+
+	fmt.Printf("%s: %d entries copied from %s to %s\n", dataDir, count, from, to)
+
+	return 0
+}
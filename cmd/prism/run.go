@@ -0,0 +1,213 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adrianliechti/prism/pkg/server"
+)
+
+// runCommand implements prism run, which runs stored requests headlessly
+// and fails when one of them does, so collections can gate CI pipelines.
+// It returns the exit code: 1 for failed requests, 2 for errors.
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: prism run [flags] [request ...]")
+		fmt.Fprintln(flags.Output())
+		fmt.Fprintln(flags.Output(), "Runs the named requests (IDs or names), or else those of -folder, or else all.")
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+
+	configFlag := flags.String("config", "", "configuration file (env PRISM_CONFIG, default prism.yaml of the working or data directory)")
+	dataDirFlag := flags.String("data-dir", "", "directory for stored data (env PRISM_DATA_DIR)")
+	workspaceFlag := flags.String("workspace", "", "workspace of the data directory (env PRISM_WORKSPACE)")
+	envFlag := flags.String("env", "", "environment ID or name (default the active one)")
+	folderFlag := flags.String("folder", "", "folder ID or path of names, e.g. Users/Admin")
+	dataFlag := flags.String("data", "", "iteration data file (CSV or JSON), one iteration per row")
+	iterationsFlag := flags.Int("iterations", 1, "number of iterations without -data")
+	bailFlag := flags.Bool("bail", false, "stop at the first failed request")
+	timeoutFlag := flags.Duration("timeout", 0, "timeout of every request, e.g. 30s")
+	junitFlag := flags.String("junit", "", "write a JUnit XML report to this file")
+	jsonFlag := flags.String("json", "", "write a JSON report to this file")
+	quietFlag := flags.Bool("quiet", false, "print failures and the summary only")
+
+	flags.Parse(args)
+
+	req := server.RunRequest{
+		IDs: flags.Args(),
+
+		Environment: *envFlag,
+		Iterations:  *iterationsFlag,
+
+		StopOnFailure: *bailFlag,
+	}
+
+	if len(req.IDs) == 0 {
+		req.Folder = folderFlag
+	}
+
+	if *dataFlag != "" {
+		data, err := os.ReadFile(*dataFlag)
+
+		if err != nil {
+			return commandError("run", err)
+		}
+
+		req.Data = &server.RunData{
+			Document: string(data),
+			Format:   strings.TrimPrefix(strings.ToLower(filepath.Ext(*dataFlag)), "."),
+		}
+	}
+
+	cfg, err := loadConfig(*configFlag, *dataDirFlag, *workspaceFlag)
+
+	if err != nil {
+		return commandError("run", err)
+	}
+
+	srv, err := server.New(cfg)
+
+	if err != nil {
+		return commandError("run", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	result, err := srv.Run(ctx, req, *timeoutFlag)
+
+	if err != nil {
+		return commandError("run", err)
+	}
+
+	if result.Requests == 0 {
+		return commandError("run", errors.New("no requests to run"))
+	}
+
+	printRunResult(os.Stdout, result, *quietFlag)
+
+	if *junitFlag != "" {
+		if err := writeOutput(*junitFlag, func(w io.Writer) error { return writeJUnitReport(w, result) }); err != nil {
+			return commandError("run", err)
+		}
+	}
+
+	if *jsonFlag != "" {
+		if err := writeOutput(*jsonFlag, func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(result)
+		}); err != nil {
+			return commandError("run", err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return commandError("run", errors.New("run interrupted"))
+	}
+
+	if result.Failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// printRunResult prints a line per request, the reasons of failures below
+// it, and a summary.
+func printRunResult(w io.Writer, result *server.RunResult, quiet bool) {
+	for _, iteration := range result.Results {
+		if result.Iterations > 1 && !quiet {
+			fmt.Fprintf(w, "iteration %d\n", iteration.Iteration)
+		}
+
+		for _, r := range iteration.Requests {
+			if r.Passed && quiet {
+				continue
+			}
+
+			mark := "ok  "
+
+			if !r.Passed {
+				mark = "FAIL"
+			}
+
+			status := "---"
+
+			if r.Status != 0 {
+				status = fmt.Sprint(r.Status)
+			}
+
+			fmt.Fprintf(w, "%s %s %s %s %s (%s)\n", mark, cmp.Or(r.Name, r.ID), r.Method, r.URL, status, formatMillis(r.Duration))
+
+			for _, reason := range failureReasons(r) {
+				fmt.Fprintf(w, "     %s\n", reason)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d requests, %d passed, %d failed in %s\n", result.Requests, result.Passed, result.Failed, formatMillis(result.Duration))
+}
+
+// failureReasons explains why a request failed.
+func failureReasons(r server.RunRequestResult) []string {
+	var reasons []string
+
+	if r.Error != "" {
+		reasons = append(reasons, r.Error)
+	}
+
+	for _, a := range r.Assertions {
+		if a.Passed {
+			continue
+		}
+
+		reason := a.Message
+
+		if a.Actual != "" {
+			reason += ", got " + a.Actual
+		}
+
+		reasons = append(reasons, reason)
+	}
+
+	return reasons
+}
+
+func formatMillis(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond).String()
+}
+
+// writeOutput writes an output file of a command, "-" being stdout.
+func writeOutput(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
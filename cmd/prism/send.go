@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/adrianliechti/prism/pkg/server"
+)
+
+// headerFlags collects the repeated -H flags of prism send.
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("invalid header %q: expected Name: value", value)
+	}
+
+	*h = append(*h, value)
+	return nil
+}
+
+// sendCommand implements prism send, which sends a stored request, or an
+// ad-hoc one, like the UI does and prints the response. It returns the exit
+// code: 1 for failed assertions, 2 for errors.
+func sendCommand(args []string) int {
+	flags := flag.NewFlagSet("send", flag.ExitOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: prism send [flags] request")
+		fmt.Fprintln(flags.Output(), "       prism send [flags] -url url")
+		fmt.Fprintln(flags.Output())
+		fmt.Fprintln(flags.Output(), "Sends the stored request (ID or name), or an ad-hoc one, with the variables of the environment.")
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+
+	client := addClientFlags(flags)
+
+	var headers headerFlags
+
+	storeFlag := flags.String("store", "", "store of the request (default requests)")
+	envFlag := flags.String("env", "", "environment ID or name (default the active one)")
+	urlFlag := flags.String("url", "", "URL of an ad-hoc request, may use {{variables}}")
+	methodFlag := flags.String("X", "", "method of an ad-hoc request (default GET, or POST with -d)")
+	flags.Var(&headers, "H", "header of an ad-hoc request, e.g. \"Accept: application/json\" (repeatable)")
+	dataFlag := flags.String("d", "", "body of an ad-hoc request, @file to read it from a file or @- from stdin")
+	insecureFlag := flags.Bool("k", false, "skip TLS verification of an ad-hoc request")
+	redirectFlag := flags.Bool("L", false, "follow redirects of an ad-hoc request")
+	timeoutFlag := flags.Duration("timeout", 0, "timeout of the request, e.g. 30s")
+	includeFlag := flags.Bool("i", false, "print the status line and headers of the response")
+	prettyFlag := flags.Bool("pretty", false, "indent JSON bodies")
+	outputFlag := flags.String("o", "-", "write the body to this file")
+	silentFlag := flags.Bool("s", false, "do not print assertion results")
+
+	flags.Parse(args)
+
+	req := server.SendRequest{
+		Store:       *storeFlag,
+		Environment: *envFlag,
+	}
+
+	switch {
+	case *urlFlag != "" && flags.NArg() == 0:
+		settings, err := adHocRequest(*methodFlag, *urlFlag, headers, *dataFlag)
+
+		if err != nil {
+			return commandError("send", err)
+		}
+
+		settings.Options.Insecure = *insecureFlag
+		settings.Options.Redirect = *redirectFlag
+
+		req.HTTP = settings
+
+	case *urlFlag == "" && flags.NArg() == 1 && *methodFlag == "" && len(headers) == 0 && *dataFlag == "":
+		req.ID = flags.Arg(0)
+
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	c, err := client.client()
+
+	if err != nil {
+		return commandError("send", err)
+	}
+
+	body, err := json.Marshal(req)
+
+	if err != nil {
+		return commandError("send", err)
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+
+	if *timeoutFlag > 0 {
+		header.Set("X-Prism-Timeout", strconv.FormatInt(timeoutFlag.Milliseconds(), 10))
+	}
+
+	resp, err := c.send(http.MethodPost, "/send", bytes.NewReader(body), header)
+
+	if err != nil {
+		return commandError("send", err)
+	}
+
+	defer resp.Body.Close()
+
+	// only responses of the upstream carry the results of the assertions
+	report := resp.Header.Get("X-Prism-Assertions")
+
+	if report == "" {
+		return commandError("send", responseError(http.MethodPost, "/send", resp))
+	}
+
+	var assertions server.AssertionReport
+
+	if err := json.Unmarshal([]byte(report), &assertions); err != nil {
+		return commandError("send", fmt.Errorf("invalid assertion results: %w", err))
+	}
+
+	if *includeFlag {
+		printResponseHeader(os.Stdout, resp)
+	}
+
+	if err := writeOutput(*outputFlag, func(w io.Writer) error {
+		return writeResponseBody(w, resp, *prettyFlag)
+	}); err != nil {
+		return commandError("send", err)
+	}
+
+	if len(assertions.Results) > 0 && !*silentFlag {
+		printAssertions(os.Stderr, assertions.Results)
+	}
+
+	if !assertions.Passed {
+		return 1
+	}
+
+	return 0
+}
+
+// printAssertions prints the failed assertions and a summary.
+func printAssertions(w io.Writer, results []server.AssertionResult) {
+	passed := 0
+
+	for _, r := range results {
+		if r.Passed {
+			passed++
+			continue
+		}
+
+		message := r.Message
+
+		if r.Actual != "" {
+			message += ", got " + r.Actual
+		}
+
+		fmt.Fprintf(w, "FAIL %s\n", message)
+	}
+
+	fmt.Fprintf(w, "%d assertions, %d passed, %d failed\n", len(results), passed, len(results)-passed)
+}
+
+// adHocRequest returns the settings of a request given by flags, much like
+// those of curl.
+func adHocRequest(method, url string, headers []string, data string) (*server.HTTPSettings, error) {
+	settings := &server.HTTPSettings{
+		Method: strings.ToUpper(method),
+		URL:    url,
+
+		Body: server.RequestBody{Type: "none"},
+	}
+
+	for _, h := range headers {
+		key, value, _ := strings.Cut(h, ":")
+
+		settings.Headers = append(settings.Headers, server.KeyValue{
+			Enabled: true,
+			Key:     strings.TrimSpace(key),
+			Value:   strings.TrimSpace(value),
+		})
+	}
+
+	if data != "" {
+		if path, ok := strings.CutPrefix(data, "@"); ok {
+			content, err := readInput(path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			data = string(content)
+		}
+
+		settings.Body = server.RequestBody{Type: "raw", Content: data}
+	}
+
+	if settings.Method == "" {
+		settings.Method = http.MethodGet
+
+		if data != "" {
+			settings.Method = http.MethodPost
+		}
+	}
+
+	return settings, nil
+}
+
+// readInput reads a file, "-" being stdin.
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(path)
+}
+
+// printResponseHeader prints the status line and headers of the upstream:
+// the headers of Prism are left out and those it moved aside are restored.
+func printResponseHeader(w io.Writer, resp *http.Response) {
+	header := http.Header{}
+
+	for key, values := range resp.Header {
+		if strings.HasPrefix(key, "Access-Control-") {
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(key, "X-Prism-Upstream-"); ok {
+			header[name] = values
+			continue
+		}
+
+		if strings.HasPrefix(key, "X-Prism-") {
+			continue
+		}
+
+		header[key] = values
+	}
+
+	fmt.Fprintf(w, "%s %s\n", resp.Proto, resp.Status)
+
+	for _, key := range slices.Sorted(maps.Keys(header)) {
+		for _, value := range header[key] {
+			fmt.Fprintf(w, "%s: %s\n", key, value)
+		}
+	}
+
+	fmt.Fprintln(w)
+}
+
+// writeResponseBody copies the body of resp to w, indenting it with pretty
+// when it is JSON. Other bodies, streams among them, are copied as they
+// arrive.
+func writeResponseBody(w io.Writer, resp *http.Response, pretty bool) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	if !pretty || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		_, err := w.Write(data)
+		return err
+	}
+
+	buf.WriteByte('\n')
+
+	_, err = buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+// userCookie holds the token of a signed-in user of the multi-user mode.
+const userCookie = "prism_user"
+
+// userStartTimeout bounds how long the server of a user may take to start.
+const userStartTimeout = 30 * time.Second
+
+// userEnv lists the variables of the environment the servers of users get
+// (LC_* too): what the platform and outbound traffic need and the settings
+// of the server. The credentials of the gateway (the tokens of the users,
+// AI keys, VAULT_TOKEN) stay with it; the servers of users take AI and
+// secret providers from the configuration file only.
+var userEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "TMPDIR", "TZ", "LANG",
+	"SYSTEMROOT", "WINDIR", "TEMP", "TMP", "USERPROFILE", "APPDATA", "LOCALAPPDATA",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "SSL_CERT_FILE", "SSL_CERT_DIR",
+	"PRISM_PROXY", "PRISM_CA_CERT", "PRISM_MAX_RESPONSE_SIZE", "PRISM_MAX_REQUEST_SIZE",
+	"PRISM_MAX_CONCURRENT_REQUESTS", "PRISM_RATE_LIMIT", "PRISM_ALLOW_TARGETS", "PRISM_DENY_TARGETS",
+	"PRISM_AUDIT", "PRISM_AUDIT_BODIES",
+}
+
+// userGateway serves the multi-user mode: users sign in with their token
+// and get a prism process of their own on a data directory of their own,
+// started on first use and proxied to. Separate processes keep workspaces,
+// unlocked secrets and monitors of users apart.
+type userGateway struct {
+	cfg  *config.Config
+	root string
+
+	mu      sync.Mutex
+	servers map[string]*userServer
+}
+
+// userServer is the prism process of a user, listening on loopback and
+// requiring token.
+type userServer struct {
+	url   *url.URL
+	token string
+
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// serveUsers runs the gateway on listener until ctx is cancelled, then
+// stops the servers of the users.
+func serveUsers(ctx context.Context, cfg *config.Config, listener net.Listener) error {
+	g := &userGateway{
+		cfg:  cfg,
+		root: filepath.Join(cmp.Or(cfg.DataDir, config.DefaultDataDir()), "users"),
+
+		servers: map[string]*userServer{},
+	}
+
+	defer g.stop()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	mux.Handle("/", g)
+
+	srv := &http.Server{
+		Handler:  mux,
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelDebug),
+	}
+
+	serverErr := make(chan error, 1)
+
+	go func() {
+		serverErr <- srv.Serve(listener)
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		return err
+	}
+
+	slog.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	return nil
+}
+
+func (g *userGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if query := r.URL.Query(); query.Has("token") && r.Method == http.MethodGet {
+		if g.user(query.Get("token")) == nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:  userCookie,
+			Value: query.Get("token"),
+			Path:  "/",
+
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+
+		query.Del("token")
+
+		target := *r.URL
+		target.RawQuery = query.Encode()
+
+		http.Redirect(w, r, target.RequestURI(), http.StatusSeeOther)
+		return
+	}
+
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if cookie, err := r.Cookie(userCookie); err == nil && token == "" {
+		token = cookie.Value
+	}
+
+	user := g.user(token)
+
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	srv, err := g.server(user)
+
+	if err != nil {
+		slog.Error("failed to start the server of a user", "user", user.Name, "error", err)
+		http.Error(w, "server unavailable", http.StatusBadGateway)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+
+		// streamed responses such as events pass as they are written
+		FlushInterval: -1,
+
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(srv.url)
+
+			// the audit of the server records the client address
+			pr.SetXForwarded()
+
+			// the origin checks of the server compare with the Host of
+			// the browser
+			pr.Out.Host = pr.In.Host
+
+			pr.Out.Header.Set("Authorization", "Bearer "+srv.token)
+
+			cookies := pr.Out.Cookies()
+			pr.Out.Header.Del("Cookie")
+
+			for _, cookie := range cookies {
+				if cookie.Name != userCookie {
+					pr.Out.AddCookie(cookie)
+				}
+			}
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+}
+
+// user returns the user of token, nil when there is none.
+func (g *userGateway) user(token string) *config.UserConfig {
+	if token == "" {
+		return nil
+	}
+
+	var found *config.UserConfig
+
+	// compare with every token, so the time taken tells nothing
+	for i, user := range g.cfg.Users {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(user.Token)) == 1 {
+			found = &g.cfg.Users[i]
+		}
+	}
+
+	return found
+}
+
+// server returns the running server of user, starting it if needed.
+func (g *userGateway) server(user *config.UserConfig) (*userServer, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if srv, ok := g.servers[user.Name]; ok {
+		select {
+		case <-srv.done:
+			// exited, start it again
+		default:
+			return srv, nil
+		}
+	}
+
+	srv, err := g.start(user)
+
+	if err != nil {
+		delete(g.servers, user.Name)
+		return nil, err
+	}
+
+	g.servers[user.Name] = srv
+
+	return srv, nil
+}
+
+// start runs the prism binary for user on loopback and waits until it
+// announces its address. The server runs in remote mode, requiring its
+// token, which it gets by the environment rather than the command line
+// other users of the machine can read, and denies private targets unless
+// the configuration decides otherwise.
+func (g *userGateway) start(user *config.UserConfig) (*userServer, error) {
+	exe, err := os.Executable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	token := rand.Text()
+
+	args := []string{
+		"-host", "127.0.0.1",
+		"-port", "0",
+		"-data-dir", filepath.Join(g.root, user.Name),
+		"-remote",
+		"-no-browser",
+		"-no-update-check",
+		"-log-level", g.cfg.LogLevel.String(),
+	}
+
+	if g.cfg.File != "" {
+		args = append(args, "-config", g.cfg.File)
+	}
+
+	if g.cfg.LogFormat != "" {
+		args = append(args, "-log-format", g.cfg.LogFormat)
+	}
+
+	if g.cfg.Storage != "" {
+		args = append(args, "-storage", g.cfg.Storage)
+	}
+
+	denyPrivate := g.cfg.DenyPrivate == nil || *g.cfg.DenyPrivate
+
+	cmd := exec.Command(exe, args...)
+
+	// PRISM_USER makes the process a server of a user, not a gateway
+	cmd.Env = append(userEnviron(),
+		"PRISM_USER="+user.Name,
+		"PRISM_TOKEN="+token,
+		"PRISM_DENY_PRIVATE="+strconv.FormatBool(denyPrivate),
+	)
+
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	announced := make(chan string, 1)
+	done := make(chan struct{})
+
+	// the address is announced on stdout, which is passed on otherwise
+	go func() {
+		defer close(done)
+
+		scanner := bufio.NewScanner(stdout)
+
+		for scanner.Scan() {
+			if address, ok := strings.CutPrefix(scanner.Text(), "Prism is running at "); ok {
+				select {
+				case announced <- address:
+				default:
+				}
+
+				continue
+			}
+
+			fmt.Println(scanner.Text())
+		}
+
+		cmd.Wait()
+
+		slog.Info("server of user exited", "user", user.Name)
+	}()
+
+	timer := time.NewTimer(userStartTimeout)
+	defer timer.Stop()
+
+	select {
+	case address := <-announced:
+		u, err := url.Parse(address)
+
+		if err != nil {
+			cmd.Process.Kill()
+			return nil, err
+		}
+
+		slog.Info("server of user started", "user", user.Name, "pid", cmd.Process.Pid)
+
+		return &userServer{
+			url:   &url.URL{Scheme: u.Scheme, Host: u.Host},
+			token: token,
+
+			cmd:  cmd,
+			done: done,
+		}, nil
+
+	case <-done:
+		return nil, errors.New("exited while starting")
+
+	case <-timer.C:
+		cmd.Process.Kill()
+		return nil, errors.New("timed out starting")
+	}
+}
+
+// userEnviron returns the variables of the environment of userEnv.
+func userEnviron() []string {
+	var env []string
+
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+
+		// names are case-insensitive on Windows, http_proxy & co are common
+		if strings.HasPrefix(name, "LC_") || slices.ContainsFunc(userEnv, func(allowed string) bool {
+			return strings.EqualFold(name, allowed)
+		}) {
+			env = append(env, variable)
+		}
+	}
+
+	return env
+}
+
+// stop ends the servers of the users, waiting for them to drain.
+func (g *userGateway) stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, srv := range g.servers {
+		if runtime.GOOS == "windows" {
+			srv.cmd.Process.Kill()
+		} else {
+			srv.cmd.Process.Signal(os.Interrupt)
+		}
+	}
+
+	for _, srv := range g.servers {
+		select {
+		case <-srv.done:
+		case <-time.After(15 * time.Second):
+			srv.cmd.Process.Kill()
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUserEnviron(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("https_proxy", "http://proxy:3128")
+	t.Setenv("LC_ALL", "C")
+	t.Setenv("PRISM_ALLOW_TARGETS", "example.com")
+	t.Setenv("PRISM_TOKEN", "secret")
+	t.Setenv("PRISM_USERS", "users.yaml")
+	t.Setenv("OPENAI_API_KEY", "sk-secret")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	env := userEnviron()
+
+	tests := []struct {
+		variable string
+		kept     bool
+	}{
+		{"PATH=/usr/bin", true},
+		{"https_proxy=http://proxy:3128", true},
+		{"LC_ALL=C", true},
+		{"PRISM_ALLOW_TARGETS=example.com", true},
+		{"PRISM_TOKEN=secret", false},
+		{"PRISM_USERS=users.yaml", false},
+		{"OPENAI_API_KEY=sk-secret", false},
+		{"AWS_SECRET_ACCESS_KEY=secret", false},
+	}
+
+	for _, test := range tests {
+		if kept := slices.Contains(env, test.variable); kept != test.kept {
+			t.Errorf("userEnviron() keeps %s = %v, want %v", test.variable, kept, test.kept)
+		}
+	}
+}
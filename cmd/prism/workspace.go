@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrianliechti/prism/pkg/server"
+)
+
+// exportCommand implements prism export, which writes the workspace, some
+// of its stores, a folder or some entries to a workspace archive.
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: prism export [flags] [entry ...]")
+		fmt.Fprintln(flags.Output())
+		fmt.Fprintln(flags.Output(), "Exports the workspace, or the named entries (IDs or names) of -store, to a zip archive.")
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+
+	client := addClientFlags(flags)
+
+	storeFlag := flags.String("store", "", "comma-separated stores to export, e.g. requests,environments")
+	folderFlag := flags.String("folder", "", "folder ID or path of names to export, of a single -store")
+	outputFlag := flags.String("o", "", "archive file, - for stdout (default the suggested name in the current directory)")
+
+	flags.Parse(args)
+
+	query := url.Values{}
+
+	if *storeFlag != "" {
+		for store := range strings.SplitSeq(*storeFlag, ",") {
+			query.Add("store", strings.TrimSpace(store))
+		}
+	}
+
+	if *folderFlag != "" {
+		query.Set("folder", *folderFlag)
+	}
+
+	for _, entry := range flags.Args() {
+		query.Add("id", entry)
+	}
+
+	c, err := client.client()
+
+	if err != nil {
+		return commandError("export", err)
+	}
+
+	resp, err := c.do(http.MethodGet, "/export/workspace?"+query.Encode(), nil, nil)
+
+	if err != nil {
+		return commandError("export", err)
+	}
+
+	defer resp.Body.Close()
+
+	output := *outputFlag
+
+	if output == "" {
+		output = "prism-workspace.zip"
+
+		if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			output = filepath.Base(params["filename"])
+		}
+	}
+
+	if err := writeOutput(output, func(w io.Writer) error {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}); err != nil {
+		return commandError("export", err)
+	}
+
+	if output != "-" {
+		fmt.Fprintln(os.Stderr, "exported to", output)
+	}
+
+	return 0
+}
+
+// importCommand implements prism import, which restores workspace
+// archives written by prism export or the UI.
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: prism import [flags] archive ...")
+		fmt.Fprintln(flags.Output())
+		fmt.Fprintln(flags.Output(), "Imports workspace archives, - reading one from stdin.")
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+
+	client := addClientFlags(flags)
+
+	overwriteFlag := flags.Bool("overwrite", false, "replace existing entries instead of keeping them")
+
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	strategy := "merge"
+
+	if *overwriteFlag {
+		strategy = "overwrite"
+	}
+
+	c, err := client.client()
+
+	if err != nil {
+		return commandError("import", err)
+	}
+
+	for _, path := range flags.Args() {
+		result, err := importArchive(c, path, strategy)
+
+		if err != nil {
+			return commandError("import", fmt.Errorf("%s: %w", path, err))
+		}
+
+		fmt.Printf("%s: %d created, %d overwritten, %d skipped (%s)\n", path, result.Created, result.Overwritten, result.Skipped, strings.Join(result.Stores, ", "))
+	}
+
+	return 0
+}
+
+func importArchive(c *apiClient, path, strategy string) (*server.WorkspaceImportResult, error) {
+	var body io.Reader = os.Stdin
+
+	if path != "-" {
+		f, err := os.Open(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
+
+		body = f
+	}
+
+	header := http.Header{"Content-Type": {"application/zip"}}
+
+	resp, err := c.do(http.MethodPost, "/import/workspace?strategy="+strategy, body, header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var result server.WorkspaceImportResult
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func commandError(command string, err error) int {
+	fmt.Fprintf(os.Stderr, "prism %s: %v\n", command, err)
+	return 2
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Types of AIProviderConfig.
+const (
+	AIProviderOpenAI    = "openai"
+	AIProviderAzure     = "azure"
+	AIProviderAnthropic = "anthropic"
+	AIProviderOllama    = "ollama"
+	AIProviderGemini    = "gemini"
+)
+
+// providerName keeps provider names usable in headers and logs.
+var providerName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// aiProviderEnv names the environment variables configuring the provider of
+// a type, which is named like it. Setting any but the model enables it.
+var aiProviderEnv = []struct {
+	typ string
+
+	url, token, model, apiVersion string
+}{
+	{typ: AIProviderOpenAI, url: "OPENAI_BASE_URL", token: "OPENAI_API_KEY", model: "OPENAI_MODEL"},
+	{typ: AIProviderAzure, url: "AZURE_OPENAI_ENDPOINT", token: "AZURE_OPENAI_API_KEY", model: "AZURE_OPENAI_DEPLOYMENT", apiVersion: "AZURE_OPENAI_API_VERSION"},
+	{typ: AIProviderAnthropic, url: "ANTHROPIC_BASE_URL", token: "ANTHROPIC_API_KEY", model: "ANTHROPIC_MODEL"},
+	{typ: AIProviderOllama, url: "OLLAMA_HOST", model: "OLLAMA_MODEL"},
+	{typ: AIProviderGemini, url: "GEMINI_BASE_URL", token: "GEMINI_API_KEY", model: "GEMINI_MODEL"},
+}
+
+// AIProvider returns the provider called name, the default one if name is
+// empty; nil if there is none.
+func (c *Config) AIProvider(name string) *AIProviderConfig {
+	if name == "" {
+		if len(c.AIProviders) == 0 {
+			return nil
+		}
+
+		return &c.AIProviders[0]
+	}
+
+	for i := range c.AIProviders {
+		if c.AIProviders[i].Name == name {
+			return &c.AIProviders[i]
+		}
+	}
+
+	return nil
+}
+
+// applyAIConfig merges the providers of the environment into those of the
+// configuration file, fills in the defaults of their types and moves the
+// one named by PRISM_AI_PROVIDER, else aiProvider of the file, first.
+func applyAIConfig(cfg *Config) error {
+	for _, env := range aiProviderEnv {
+		baseURL, token := os.Getenv(env.url), ""
+
+		if env.token != "" {
+			token = os.Getenv(env.token)
+		}
+
+		if baseURL == "" && token == "" {
+			continue
+		}
+
+		i := slices.IndexFunc(cfg.AIProviders, func(p AIProviderConfig) bool { return p.Name == env.typ })
+
+		if i < 0 {
+			cfg.AIProviders = append(cfg.AIProviders, AIProviderConfig{Name: env.typ, Type: env.typ})
+			i = len(cfg.AIProviders) - 1
+		}
+
+		p := &cfg.AIProviders[i]
+
+		p.URL = cmp.Or(baseURL, p.URL)
+		p.Token = cmp.Or(token, p.Token)
+		p.Model = cmp.Or(os.Getenv(env.model), p.Model)
+
+		if env.apiVersion != "" {
+			p.APIVersion = cmp.Or(os.Getenv(env.apiVersion), p.APIVersion)
+		}
+	}
+
+	// as before the list of providers, openai takes a URL or a token
+	cfg.AIProviders = slices.DeleteFunc(cfg.AIProviders, func(p AIProviderConfig) bool {
+		return p.Name == AIProviderOpenAI && p.Type == AIProviderOpenAI && p.URL == "" && p.Token == ""
+	})
+
+	for i := range cfg.AIProviders {
+		if err := completeAIProvider(&cfg.AIProviders[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := validateAIProviders(cfg.AIProviders); err != nil {
+		return err
+	}
+
+	name := cmp.Or(os.Getenv("PRISM_AI_PROVIDER"), cfg.DefaultAIProvider)
+
+	if name == "" {
+		return nil
+	}
+
+	i := slices.IndexFunc(cfg.AIProviders, func(p AIProviderConfig) bool { return p.Name == name })
+
+	if i < 0 {
+		return fmt.Errorf("unknown AI provider %q", name)
+	}
+
+	provider := cfg.AIProviders[i]
+
+	cfg.AIProviders = slices.Insert(slices.Delete(cfg.AIProviders, i, i+1), 0, provider)
+	cfg.DefaultAIProvider = name
+
+	return nil
+}
+
+// completeAIProvider fills in the defaults of the type of p: its name, the
+// base URL of its OpenAI-compatible API and a model.
+func completeAIProvider(p *AIProviderConfig) error {
+	p.Type = cmp.Or(strings.ToLower(p.Type), AIProviderOpenAI)
+	p.Name = cmp.Or(p.Name, p.Type)
+
+	switch p.Type {
+	case AIProviderOpenAI:
+		p.URL = cmp.Or(p.URL, "https://api.openai.com/v1")
+
+		// Without a model the UI hides the AI panel entirely, so always
+		// default one — also for custom gateways.
+		p.Model = cmp.Or(p.Model, "gpt-5.2")
+
+	case AIProviderAzure:
+		if p.URL == "" {
+			return fmt.Errorf("AI provider %q: missing endpoint", p.Name)
+		}
+
+		// deployments are named by their owner
+		if p.Model == "" {
+			return fmt.Errorf("AI provider %q: missing model (the deployment)", p.Name)
+		}
+
+		// the endpoint of the resource serves the v1 API below /openai/v1
+		if u, err := url.Parse(p.URL); err == nil && strings.Trim(u.Path, "/") == "" {
+			p.URL = strings.TrimSuffix(p.URL, "/") + "/openai/v1"
+		}
+
+	case AIProviderAnthropic:
+		p.URL = cmp.Or(p.URL, "https://api.anthropic.com/v1")
+		p.Model = cmp.Or(p.Model, "claude-sonnet-4-5")
+
+	case AIProviderOllama:
+		p.URL = cmp.Or(p.URL, "http://localhost:11434")
+
+		// OLLAMA_HOST is commonly given as host:port
+		if !strings.Contains(p.URL, "://") {
+			p.URL = "http://" + p.URL
+		}
+
+		if u, err := url.Parse(p.URL); err == nil && strings.Trim(u.Path, "/") == "" {
+			p.URL = strings.TrimSuffix(p.URL, "/") + "/v1"
+		}
+
+		p.Model = cmp.Or(p.Model, "llama3.2")
+
+	case AIProviderGemini:
+		p.URL = cmp.Or(p.URL, "https://generativelanguage.googleapis.com/v1beta/openai")
+		p.Model = cmp.Or(p.Model, "gemini-2.5-flash")
+
+	default:
+		return fmt.Errorf("AI provider %q: unknown type %q", p.Name, p.Type)
+	}
+
+	return nil
+}
+
+// validateAIProviders checks that providers have valid, distinct names and
+// absolute base URLs.
+func validateAIProviders(providers []AIProviderConfig) error {
+	for i, p := range providers {
+		if !providerName.MatchString(p.Name) {
+			return fmt.Errorf("invalid AI provider name %q", p.Name)
+		}
+
+		if slices.ContainsFunc(providers[:i], func(other AIProviderConfig) bool { return other.Name == p.Name }) {
+			return fmt.Errorf("duplicate AI provider %q", p.Name)
+		}
+
+		u, err := url.Parse(p.URL)
+
+		if err != nil {
+			return fmt.Errorf("AI provider %q: %w", p.Name, err)
+		}
+
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("AI provider %q: invalid URL %q", p.Name, p.URL)
+		}
+	}
+
+	return nil
+}
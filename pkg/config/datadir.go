@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// DefaultDataDir is the platform's location for application data:
+// %AppData%\prism on Windows, ~/Library/Application Support/prism on macOS
+// and $XDG_DATA_HOME/prism (~/.local/share/prism) elsewhere.
+func DefaultDataDir() string {
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		if dir, err := os.UserConfigDir(); err == nil {
+			return filepath.Join(dir, "prism")
+		}
+
+	default:
+		if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+			return filepath.Join(dir, "prism")
+		}
+
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".local", "share", "prism")
+		}
+	}
+
+	return "data"
+}
+
+// LegacyDataDir is where earlier versions kept the data on every
+// platform, or "" when it cannot be determined.
+func LegacyDataDir() string {
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".local", "share", "prism")
+}
@@ -0,0 +1,388 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileNames are the names FindFile looks for.
+var fileNames = []string{"prism.yaml", "prism.yml", "prism.json"}
+
+// FindFile returns the configuration file of the working directory, or
+// else of dataDir (PRISM_DATA_DIR or DefaultDataDir when empty), or "" when
+// there is none.
+func FindFile(dataDir string) string {
+	if dataDir == "" {
+		dataDir = os.Getenv("PRISM_DATA_DIR")
+	}
+
+	if dataDir == "" {
+		dataDir = DefaultDataDir()
+	}
+
+	for _, dir := range []string{".", dataDir} {
+		for _, name := range fileNames {
+			path := filepath.Join(dir, name)
+
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path
+			}
+		}
+	}
+
+	return ""
+}
+
+// configFile is the layout of a configuration file (YAML, or JSON as its
+// subset). Fields left out keep their defaults.
+type configFile struct {
+	Host      string `yaml:"host"`
+	Port      *int   `yaml:"port"`
+	DataDir   string `yaml:"dataDir"`
+	Workspace string `yaml:"workspace"`
+	Storage   string `yaml:"storage"`
+	NoBrowser *bool  `yaml:"noBrowser"`
+	Remote    *bool  `yaml:"remote"`
+	Token     string `yaml:"token"`
+
+	Users []struct {
+		Name  string `yaml:"name"`
+		Token string `yaml:"token"`
+	} `yaml:"users"`
+
+	NoUpdateCheck *bool `yaml:"noUpdateCheck"`
+	Container     *bool `yaml:"container"`
+
+	TLS     *bool  `yaml:"tls"`
+	TLSCert string `yaml:"tlsCert"`
+	TLSKey  string `yaml:"tlsKey"`
+
+	OpenAI *struct {
+		URL   string `yaml:"url"`
+		Token string `yaml:"token"`
+		Model string `yaml:"model"`
+	} `yaml:"openai"`
+
+	AIProviders []struct {
+		Name       string `yaml:"name"`
+		Type       string `yaml:"type"`
+		URL        string `yaml:"url"`
+		Token      string `yaml:"token"`
+		Model      string `yaml:"model"`
+		APIVersion string `yaml:"apiVersion"`
+	} `yaml:"aiProviders"`
+
+	AIProvider string `yaml:"aiProvider"`
+
+	Proxy           string `yaml:"proxy"`
+	MaxResponseSize *int64 `yaml:"maxResponseSize"`
+	CACert          string `yaml:"caCert"`
+
+	MaxRequestSize        *int64   `yaml:"maxRequestSize"`
+	MaxConcurrentRequests *int     `yaml:"maxConcurrentRequests"`
+	RateLimit             *float64 `yaml:"rateLimit"`
+
+	AllowTargets []string `yaml:"allowTargets"`
+	DenyTargets  []string `yaml:"denyTargets"`
+	DenyPrivate  *bool    `yaml:"denyPrivate"`
+
+	Audit       *bool `yaml:"audit"`
+	AuditBodies *bool `yaml:"auditBodies"`
+
+	McpServers []struct {
+		Name    string            `yaml:"name"`
+		URL     string            `yaml:"url"`
+		Headers map[string]string `yaml:"headers"`
+	} `yaml:"mcpServers"`
+
+	Secrets *struct {
+		Vault *struct {
+			Address   string `yaml:"address"`
+			Token     string `yaml:"token"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"vault"`
+
+		OnePassword *struct {
+			Account string `yaml:"account"`
+		} `yaml:"onePassword"`
+
+		Env *struct {
+			Allow []string `yaml:"allow"`
+		} `yaml:"env"`
+	} `yaml:"secrets"`
+
+	LogLevel  string `yaml:"logLevel"`
+	LogFormat string `yaml:"logFormat"`
+}
+
+func applyConfigFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	var file configFile
+
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if file.Host != "" {
+		cfg.Host = file.Host
+	}
+
+	if file.Port != nil {
+		if *file.Port < 0 || *file.Port > 65535 {
+			return fmt.Errorf("%s: invalid port %d", path, *file.Port)
+		}
+
+		cfg.Port = *file.Port
+	}
+
+	if file.DataDir != "" {
+		cfg.DataDir = filePath(path, file.DataDir)
+	}
+
+	if file.Workspace != "" {
+		cfg.Workspace = file.Workspace
+	}
+
+	if file.Storage != "" {
+		storage, err := ParseStorage(file.Storage)
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		cfg.Storage = storage
+	}
+
+	if file.NoBrowser != nil {
+		cfg.NoBrowser = *file.NoBrowser
+	}
+
+	if file.NoUpdateCheck != nil {
+		cfg.NoUpdateCheck = *file.NoUpdateCheck
+	}
+
+	if file.Container != nil {
+		cfg.Container = *file.Container
+	}
+
+	if file.Remote != nil {
+		cfg.Remote = *file.Remote
+	}
+
+	if file.Token != "" {
+		cfg.Token = file.Token
+	}
+
+	if len(file.Users) > 0 {
+		var users []UserConfig
+
+		for _, user := range file.Users {
+			users = append(users, UserConfig{Name: user.Name, Token: user.Token})
+		}
+
+		if err := validateUsers(users); err != nil {
+			return fmt.Errorf("%s: users: %w", path, err)
+		}
+
+		cfg.Users = users
+	}
+
+	if file.TLS != nil {
+		cfg.TLS = *file.TLS
+	}
+
+	if file.TLSCert != "" {
+		cfg.TLSCert = filePath(path, file.TLSCert)
+	}
+
+	if file.TLSKey != "" {
+		cfg.TLSKey = filePath(path, file.TLSKey)
+	}
+
+	// openai predates the list of providers and is the first of them
+	if file.OpenAI != nil {
+		cfg.AIProviders = append(cfg.AIProviders, AIProviderConfig{
+			Name:  AIProviderOpenAI,
+			Type:  AIProviderOpenAI,
+			URL:   file.OpenAI.URL,
+			Token: file.OpenAI.Token,
+			Model: file.OpenAI.Model,
+		})
+	}
+
+	for _, provider := range file.AIProviders {
+		cfg.AIProviders = append(cfg.AIProviders, AIProviderConfig{
+			Name:       provider.Name,
+			Type:       provider.Type,
+			URL:        provider.URL,
+			Token:      provider.Token,
+			Model:      provider.Model,
+			APIVersion: provider.APIVersion,
+		})
+	}
+
+	if file.AIProvider != "" {
+		cfg.DefaultAIProvider = file.AIProvider
+	}
+
+	if file.Proxy != "" {
+		proxyURL, err := ParseProxy(file.Proxy)
+
+		if err != nil {
+			return fmt.Errorf("%s: proxy: %w", path, err)
+		}
+
+		cfg.Proxy = proxyURL
+	}
+
+	if file.MaxResponseSize != nil {
+		if *file.MaxResponseSize < 0 {
+			return fmt.Errorf("%s: invalid maxResponseSize %d", path, *file.MaxResponseSize)
+		}
+
+		cfg.MaxResponseSize = *file.MaxResponseSize
+	}
+
+	if file.MaxRequestSize != nil {
+		if *file.MaxRequestSize < 0 {
+			return fmt.Errorf("%s: invalid maxRequestSize %d", path, *file.MaxRequestSize)
+		}
+
+		cfg.MaxRequestSize = *file.MaxRequestSize
+	}
+
+	if file.MaxConcurrentRequests != nil {
+		if *file.MaxConcurrentRequests < 0 {
+			return fmt.Errorf("%s: invalid maxConcurrentRequests %d", path, *file.MaxConcurrentRequests)
+		}
+
+		cfg.MaxConcurrentRequests = *file.MaxConcurrentRequests
+	}
+
+	if file.RateLimit != nil {
+		if *file.RateLimit < 0 || math.IsInf(*file.RateLimit, 0) || math.IsNaN(*file.RateLimit) {
+			return fmt.Errorf("%s: invalid rateLimit %v", path, *file.RateLimit)
+		}
+
+		cfg.RateLimit = *file.RateLimit
+	}
+
+	for _, value := range file.AllowTargets {
+		rule, err := ParseTargetRule(value)
+
+		if err != nil {
+			return fmt.Errorf("%s: allowTargets: %w", path, err)
+		}
+
+		cfg.AllowTargets = append(cfg.AllowTargets, rule)
+	}
+
+	for _, value := range file.DenyTargets {
+		rule, err := ParseTargetRule(value)
+
+		if err != nil {
+			return fmt.Errorf("%s: denyTargets: %w", path, err)
+		}
+
+		cfg.DenyTargets = append(cfg.DenyTargets, rule)
+	}
+
+	if file.DenyPrivate != nil {
+		cfg.DenyPrivate = file.DenyPrivate
+	}
+
+	if file.Audit != nil {
+		cfg.Audit = file.Audit
+	}
+
+	if file.AuditBodies != nil {
+		cfg.AuditBodies = *file.AuditBodies
+	}
+
+	if file.CACert != "" {
+		cfg.CACert = filePath(path, file.CACert)
+	}
+
+	for _, server := range file.McpServers {
+		u, err := url.Parse(server.URL)
+
+		if server.Name == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s: mcpServers: expected a name and an http(s) URL", path)
+		}
+
+		if slices.ContainsFunc(cfg.McpServers, func(s McpServerConfig) bool { return s.Name == server.Name }) {
+			return fmt.Errorf("%s: mcpServers: duplicate name %q", path, server.Name)
+		}
+
+		cfg.McpServers = append(cfg.McpServers, McpServerConfig{
+			Name:    server.Name,
+			URL:     server.URL,
+			Headers: server.Headers,
+		})
+	}
+
+	if file.Secrets != nil {
+		var secrets SecretsConfig
+
+		if vault := file.Secrets.Vault; vault != nil {
+			secrets.Vault = &VaultConfig{Address: vault.Address, Token: vault.Token, Namespace: vault.Namespace}
+		}
+
+		if op := file.Secrets.OnePassword; op != nil {
+			secrets.OnePassword = &OnePasswordConfig{Account: op.Account}
+		}
+
+		if env := file.Secrets.Env; env != nil {
+			secrets.EnvAllow = env.Allow
+		}
+
+		if err := validateSecrets(&secrets); err != nil {
+			return fmt.Errorf("%s: secrets: %w", path, err)
+		}
+
+		cfg.Secrets = secrets
+	}
+
+	if file.LogLevel != "" {
+		level, err := ParseLogLevel(file.LogLevel)
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		cfg.LogLevel = level
+	}
+
+	if file.LogFormat != "" {
+		format, err := ParseLogFormat(file.LogFormat)
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		cfg.LogFormat = format
+	}
+
+	return nil
+}
+
+// filePath resolves a path of the configuration file relative to the file,
+// not the working directory.
+func filePath(file, value string) string {
+	if filepath.IsAbs(value) {
+		return value
+	}
+
+	return filepath.Join(filepath.Dir(file), value)
+}
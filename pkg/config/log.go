@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// ParseLogLevel parses debug, info, warn or error.
+func ParseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", value)
+	}
+
+	return level, nil
+}
+
+// ParseLogFormat parses text or json.
+func ParseLogFormat(value string) (string, error) {
+	switch format := strings.ToLower(value); format {
+	case "text", "json":
+		return format, nil
+	}
+
+	return "", fmt.Errorf("unknown log format %q", value)
+}
+
+// Logger returns a logger writing to w at the configured level and format.
+func (c *Config) Logger(w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: c.LogLevel,
+	}
+
+	if c.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+
+	return slog.New(slog.NewTextHandler(w, opts))
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// SecretsConfig configures the external secret providers requests may
+// reference; a provider left out cannot be referenced. It belongs to the
+// server, not the workspace, since the providers act with the credentials
+// of the server.
+type SecretsConfig struct {
+	// Vault resolves {{vault:path#field}} from HashiCorp Vault (KV v1 or
+	// v2, e.g. {{vault:kv/data/ci#token}}).
+	Vault *VaultConfig
+
+	// OnePassword resolves {{op:vault/item[/section]/field}} through the
+	// 1Password CLI, which must be signed in.
+	OnePassword *OnePasswordConfig
+
+	// EnvAllow lists the variables {{env:NAME}} may read from the
+	// environment of the server; a trailing * matches a prefix ("CI_*").
+	EnvAllow []string
+}
+
+// VaultConfig defaults to VAULT_ADDR, VAULT_TOKEN (or ~/.vault-token) and
+// VAULT_NAMESPACE.
+type VaultConfig struct {
+	Address   string
+	Token     string
+	Namespace string
+}
+
+type OnePasswordConfig struct {
+	Account string
+}
+
+var envPatternRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\*?$|^\*$`)
+
+// validateSecrets checks the addresses and patterns of the providers.
+func validateSecrets(secrets *SecretsConfig) error {
+	if secrets.Vault != nil && secrets.Vault.Address != "" {
+		u, err := url.Parse(secrets.Vault.Address)
+
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("vault: invalid address %q", secrets.Vault.Address)
+		}
+	}
+
+	for _, pattern := range secrets.EnvAllow {
+		if !envPatternRegex.MatchString(pattern) {
+			return fmt.Errorf("env: invalid pattern %q", strings.TrimSpace(pattern))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// StorageFile keeps each entry in a JSON file of its store directory,
+	// which git and remote sync work on.
+	StorageFile = "file"
+
+	// StorageSQLite keeps the stores in one SQLite database of the data
+	// directory.
+	StorageSQLite = "sqlite"
+)
+
+// ParseStorage parses file or sqlite.
+func ParseStorage(value string) (string, error) {
+	switch storage := strings.ToLower(value); storage {
+	case StorageFile, StorageSQLite:
+		return storage, nil
+	}
+
+	return "", fmt.Errorf("unknown storage %q", value)
+}
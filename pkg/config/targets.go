@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"strings"
+)
+
+// TargetRule matches upstream targets by address, a CIDR range or single
+// IP, or by hostname pattern, "*" standing for any characters as in
+// *.internal.
+type TargetRule struct {
+	Prefix  netip.Prefix
+	Pattern string
+}
+
+// ParseTargetRule parses a CIDR range, an IP or a hostname pattern.
+func ParseTargetRule(value string) (TargetRule, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if value == "" {
+		return TargetRule{}, fmt.Errorf("empty target rule")
+	}
+
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return TargetRule{Prefix: prefix.Masked()}, nil
+	}
+
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return TargetRule{Prefix: netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())}, nil
+	}
+
+	if strings.ContainsAny(value, "/:[]") {
+		return TargetRule{}, fmt.Errorf("invalid target rule %q", value)
+	}
+
+	if _, err := path.Match(value, ""); err != nil {
+		return TargetRule{}, fmt.Errorf("invalid target rule %q", value)
+	}
+
+	return TargetRule{Pattern: value}, nil
+}
+
+// ParseTargetRules parses a comma-separated list of target rules.
+func ParseTargetRules(value string) ([]TargetRule, error) {
+	var rules []TargetRule
+
+	for item := range strings.SplitSeq(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+
+		rule, err := ParseTargetRule(item)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// Matches tells whether the rule matches the target host (lower case)
+// or one of its addresses.
+func (r TargetRule) Matches(host string, addrs []netip.Addr) bool {
+	if r.Pattern != "" {
+		ok, _ := path.Match(r.Pattern, host)
+		return ok
+	}
+
+	for _, addr := range addrs {
+		if r.Prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// userName keeps user names usable as directory names.
+var userName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// ParseUsers parses a comma-separated list of name:token pairs.
+func ParseUsers(value string) ([]UserConfig, error) {
+	var users []UserConfig
+
+	for item := range strings.SplitSeq(value, ",") {
+		name, token, ok := strings.Cut(strings.TrimSpace(item), ":")
+
+		if !ok {
+			return nil, fmt.Errorf("expected name:token, got %q", item)
+		}
+
+		users = append(users, UserConfig{Name: name, Token: token})
+	}
+
+	return users, validateUsers(users)
+}
+
+// validateUsers checks that users have valid, distinct names and distinct
+// tokens.
+func validateUsers(users []UserConfig) error {
+	for i, user := range users {
+		if !userName.MatchString(user.Name) {
+			return fmt.Errorf("invalid user name %q", user.Name)
+		}
+
+		if user.Token == "" {
+			return fmt.Errorf("user %q: missing token", user.Name)
+		}
+
+		others := users[:i]
+
+		if slices.ContainsFunc(others, func(u UserConfig) bool { return strings.EqualFold(u.Name, user.Name) }) {
+			return fmt.Errorf("duplicate user %q", user.Name)
+		}
+
+		if slices.ContainsFunc(others, func(u UserConfig) bool { return u.Token == user.Token }) {
+			return fmt.Errorf("user %q: token of another user", user.Name)
+		}
+	}
+
+	return nil
+}
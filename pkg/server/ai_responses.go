@@ -0,0 +1,686 @@
+package server
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+// responsesRequest is what translates of a request of the Responses API to
+// chat completions.
+type responsesRequest struct {
+	Model        string          `json:"model"`
+	Instructions string          `json:"instructions"`
+	Input        json.RawMessage `json:"input"`
+
+	Tools      []responsesTool `json:"tools"`
+	ToolChoice json.RawMessage `json:"tool_choice"`
+
+	Stream          bool     `json:"stream"`
+	Temperature     *float64 `json:"temperature"`
+	TopP            *float64 `json:"top_p"`
+	MaxOutputTokens int      `json:"max_output_tokens"`
+}
+
+type responsesTool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+	Strict      *bool           `json:"strict"`
+}
+
+// responsesInput is an item of the input of a Responses request: a
+// message, a function call of the model or its output.
+type responsesInput struct {
+	Type    string          `json:"type"`
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+
+	CallID    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"`
+}
+
+// responsesPart is a part of the content of a message of the input.
+type responsesPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL string `json:"image_url"`
+	Detail   string `json:"detail"`
+}
+
+// chatChunk is a chunk of a streamed chat completion, or with Message a
+// whole one.
+type chatChunk struct {
+	Model string `json:"model"`
+
+	Choices []struct {
+		Delta   chatDelta `json:"delta"`
+		Message chatDelta `json:"message"`
+
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type chatDelta struct {
+	Content string `json:"content"`
+
+	ToolCalls []struct {
+		Index *int   `json:"index"`
+		ID    string `json:"id"`
+
+		Function struct {
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		} `json:"function"`
+	} `json:"tool_calls"`
+}
+
+// handleResponses handles POST /openai/v1/responses for a provider serving
+// chat completions only: the request is translated to one, the completion
+// back to a response, streamed as the events of the Responses API if asked
+// to. Errors of the provider pass as they are, shaped alike.
+func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request, provider *config.AIProviderConfig) {
+	var req responsesRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	body, err := chatCompletionRequest(&req, provider)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := json.Marshal(body)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	upstream, err := newAIRequest(r.Context(), provider, "/chat/completions", data)
+
+	if err != nil {
+		writeProxyError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp, err := s.targetClient(s.baseUpstreamOptions(), 0).Do(upstream)
+
+	if err != nil {
+		writeProxyError(w, upstreamStatus(err), err)
+		return
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		w.WriteHeader(resp.StatusCode)
+
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	t := &responsesTranslation{
+		id:      strings.ToLower(rand.Text()),
+		model:   cmp.Or(req.Model, provider.Model),
+		created: time.Now().Unix(),
+
+		message: -1,
+		calls:   map[int]int{},
+	}
+
+	if !req.Stream {
+		var chunk chatChunk
+
+		if err := json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+			writeProxyError(w, http.StatusBadGateway, fmt.Errorf("invalid completion response: %w", err))
+			return
+		}
+
+		t.add(&chunk)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.finish())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	setStreamHeaders(w.Header())
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+
+	t.emit = func(event string, data []byte) {
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		rc.Flush()
+	}
+
+	t.send("response.created", map[string]any{"response": t.response("in_progress")})
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+
+		if !ok {
+			continue
+		}
+
+		data = strings.TrimSpace(data)
+
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk chatChunk
+
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.fail("invalid completion chunk")
+			return
+		}
+
+		if chunk.Error != nil {
+			t.fail(chunk.Error.Message)
+			return
+		}
+
+		t.add(&chunk)
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.fail(err.Error())
+		return
+	}
+
+	t.finish()
+}
+
+// chatCompletionRequest translates req to the body of a chat completion.
+func chatCompletionRequest(req *responsesRequest, provider *config.AIProviderConfig) (map[string]any, error) {
+	var messages []map[string]any
+
+	if req.Instructions != "" {
+		messages = append(messages, map[string]any{
+			"role":    "system",
+			"content": req.Instructions,
+		})
+	}
+
+	input, err := responsesInputItems(req.Input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range input {
+		switch cmp.Or(item.Type, "message") {
+		case "message":
+			message, err := chatMessage(&item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// the text of a turn completes its function calls
+			if last := len(messages) - 1; message["role"] == "assistant" && last >= 0 && messages[last]["role"] == "assistant" && messages[last]["content"] == nil {
+				messages[last]["content"] = message["content"]
+				continue
+			}
+
+			messages = append(messages, message)
+
+		case "function_call":
+			call := map[string]any{
+				"id":   item.CallID,
+				"type": "function",
+				"function": map[string]any{
+					"name":      item.Name,
+					"arguments": item.Arguments,
+				},
+			}
+
+			// calls of a turn are one message
+			if last := len(messages) - 1; last >= 0 && messages[last]["tool_calls"] != nil {
+				messages[last]["tool_calls"] = append(messages[last]["tool_calls"].([]map[string]any), call)
+				continue
+			}
+
+			messages = append(messages, map[string]any{
+				"role":       "assistant",
+				"tool_calls": []map[string]any{call},
+			})
+
+		case "function_call_output":
+			messages = append(messages, map[string]any{
+				"role":         "tool",
+				"tool_call_id": item.CallID,
+				"content":      responsesText(item.Output),
+			})
+
+		default:
+			return nil, fmt.Errorf("input of type %q is not supported by AI provider %q", item.Type, provider.Name)
+		}
+	}
+
+	body := map[string]any{
+		"model":    cmp.Or(req.Model, provider.Model),
+		"messages": messages,
+	}
+
+	var tools []map[string]any
+
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("tools of type %q are not supported by AI provider %q", tool.Type, provider.Name)
+		}
+
+		function := map[string]any{
+			"name": tool.Name,
+		}
+
+		if tool.Description != "" {
+			function["description"] = tool.Description
+		}
+
+		if len(tool.Parameters) > 0 {
+			function["parameters"] = tool.Parameters
+		}
+
+		if tool.Strict != nil {
+			function["strict"] = *tool.Strict
+		}
+
+		tools = append(tools, map[string]any{
+			"type":     "function",
+			"function": function,
+		})
+	}
+
+	if len(tools) > 0 {
+		body["tools"] = tools
+	}
+
+	if len(req.ToolChoice) > 0 {
+		var choice struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		}
+
+		if json.Unmarshal(req.ToolChoice, &choice) == nil && choice.Type == "function" {
+			body["tool_choice"] = map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": choice.Name},
+			}
+		} else {
+			body["tool_choice"] = req.ToolChoice
+		}
+	}
+
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+
+	if req.TopP != nil {
+		body["top_p"] = *req.TopP
+	}
+
+	if req.MaxOutputTokens > 0 {
+		body["max_tokens"] = req.MaxOutputTokens
+	}
+
+	if req.Stream {
+		body["stream"] = true
+		body["stream_options"] = map[string]any{"include_usage": true}
+	}
+
+	return body, nil
+}
+
+// responsesInputItems returns the items of input, a text being the message
+// of a user.
+func responsesInputItems(input json.RawMessage) ([]responsesInput, error) {
+	var text string
+
+	if json.Unmarshal(input, &text) == nil {
+		content, _ := json.Marshal(text)
+		return []responsesInput{{Type: "message", Role: "user", Content: content}}, nil
+	}
+
+	var items []responsesInput
+
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+
+	return items, nil
+}
+
+// chatMessage translates a message of the input; the developer role is the
+// system one of chat completions.
+func chatMessage(item *responsesInput) (map[string]any, error) {
+	role := item.Role
+
+	if role == "developer" {
+		role = "system"
+	}
+
+	var text string
+
+	if json.Unmarshal(item.Content, &text) == nil || role != "user" {
+		if text == "" {
+			text = responsesText(item.Content)
+		}
+
+		return map[string]any{"role": role, "content": text}, nil
+	}
+
+	var parts []responsesPart
+
+	if err := json.Unmarshal(item.Content, &parts); err != nil {
+		return nil, fmt.Errorf("invalid message content: %w", err)
+	}
+
+	var content []map[string]any
+
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text":
+			content = append(content, map[string]any{"type": "text", "text": part.Text})
+
+		case "input_image":
+			image := map[string]any{"url": part.ImageURL}
+
+			if part.Detail != "" {
+				image["detail"] = part.Detail
+			}
+
+			content = append(content, map[string]any{"type": "image_url", "image_url": image})
+
+		default:
+			return nil, fmt.Errorf("content of type %q is not supported", part.Type)
+		}
+	}
+
+	return map[string]any{"role": role, "content": content}, nil
+}
+
+// responsesText returns content, a text or parts, as text, joining the
+// text of the parts.
+func responsesText(content json.RawMessage) string {
+	var text string
+
+	if json.Unmarshal(content, &text) == nil {
+		return text
+	}
+
+	var parts []responsesPart
+
+	if json.Unmarshal(content, &parts) != nil {
+		return string(content)
+	}
+
+	var b strings.Builder
+
+	for _, part := range parts {
+		b.WriteString(part.Text)
+	}
+
+	return b.String()
+}
+
+// responsesTranslation builds a response of the Responses API from the
+// chunks of a chat completion, emitting its events while streaming.
+type responsesTranslation struct {
+	// emit writes an event, nil unless streaming
+	emit func(event string, data []byte)
+	seq  int
+
+	id      string
+	model   string
+	created int64
+
+	output []map[string]any
+
+	message int // index of the message in output, -1 until text
+	text    strings.Builder
+	calls   map[int]int // indexes of function calls in output by tool call
+
+	usage        map[string]any
+	finishReason string
+}
+
+func (t *responsesTranslation) add(chunk *chatChunk) {
+	t.model = cmp.Or(chunk.Model, t.model)
+
+	if chunk.Usage != nil {
+		t.usage = map[string]any{
+			"input_tokens":  chunk.Usage.PromptTokens,
+			"output_tokens": chunk.Usage.CompletionTokens,
+			"total_tokens":  chunk.Usage.TotalTokens,
+		}
+	}
+
+	if len(chunk.Choices) == 0 {
+		return
+	}
+
+	choice := chunk.Choices[0]
+	t.finishReason = cmp.Or(choice.FinishReason, t.finishReason)
+
+	delta := choice.Delta
+
+	if choice.Message.Content != "" || len(choice.Message.ToolCalls) > 0 {
+		delta = choice.Message
+	}
+
+	if delta.Content != "" {
+		if t.message < 0 {
+			t.message = t.open(map[string]any{
+				"type":    "message",
+				"id":      "msg_" + t.id,
+				"status":  "in_progress",
+				"role":    "assistant",
+				"content": []any{},
+			})
+
+			t.send("response.content_part.added", map[string]any{
+				"item_id":       "msg_" + t.id,
+				"output_index":  t.message,
+				"content_index": 0,
+				"part":          outputText(""),
+			})
+		}
+
+		t.text.WriteString(delta.Content)
+
+		t.send("response.output_text.delta", map[string]any{
+			"item_id":       "msg_" + t.id,
+			"output_index":  t.message,
+			"content_index": 0,
+			"delta":         delta.Content,
+		})
+	}
+
+	for i, call := range delta.ToolCalls {
+		// some providers send whole calls without an index
+		index := i
+
+		if call.Index != nil {
+			index = *call.Index
+		}
+
+		n, ok := t.calls[index]
+
+		if !ok {
+			id := cmp.Or(call.ID, fmt.Sprintf("call_%s_%d", t.id, index))
+
+			n = t.open(map[string]any{
+				"type":      "function_call",
+				"id":        id,
+				"call_id":   id,
+				"name":      call.Function.Name,
+				"arguments": "",
+				"status":    "in_progress",
+			})
+
+			t.calls[index] = n
+		}
+
+		if call.Function.Arguments == "" {
+			continue
+		}
+
+		item := t.output[n]
+		item["arguments"] = item["arguments"].(string) + call.Function.Arguments
+
+		t.send("response.function_call_arguments.delta", map[string]any{
+			"item_id":      item["id"],
+			"output_index": n,
+			"delta":        call.Function.Arguments,
+		})
+	}
+}
+
+// open adds item to the output, returning its index.
+func (t *responsesTranslation) open(item map[string]any) int {
+	t.output = append(t.output, item)
+	index := len(t.output) - 1
+
+	t.send("response.output_item.added", map[string]any{
+		"output_index": index,
+		"item":         item,
+	})
+
+	return index
+}
+
+// finish completes the items of the output and returns the response,
+// incomplete if the completion was cut short.
+func (t *responsesTranslation) finish() map[string]any {
+	for index, item := range t.output {
+		item["status"] = "completed"
+
+		if index == t.message {
+			text := t.text.String()
+			item["content"] = []any{outputText(text)}
+
+			t.send("response.output_text.done", map[string]any{
+				"item_id":       item["id"],
+				"output_index":  index,
+				"content_index": 0,
+				"text":          text,
+			})
+
+			t.send("response.content_part.done", map[string]any{
+				"item_id":       item["id"],
+				"output_index":  index,
+				"content_index": 0,
+				"part":          outputText(text),
+			})
+		} else {
+			t.send("response.function_call_arguments.done", map[string]any{
+				"item_id":      item["id"],
+				"output_index": index,
+				"arguments":    item["arguments"],
+			})
+		}
+
+		t.send("response.output_item.done", map[string]any{
+			"output_index": index,
+			"item":         item,
+		})
+	}
+
+	var response map[string]any
+
+	switch t.finishReason {
+	case "length":
+		response = t.response("incomplete")
+		response["incomplete_details"] = map[string]any{"reason": "max_output_tokens"}
+
+	case "content_filter":
+		response = t.response("incomplete")
+		response["incomplete_details"] = map[string]any{"reason": "content_filter"}
+
+	default:
+		response = t.response("completed")
+	}
+
+	t.send("response."+response["status"].(string), map[string]any{"response": response})
+
+	return response
+}
+
+// fail ends a stream with the failure of the completion.
+func (t *responsesTranslation) fail(message string) {
+	response := t.response("failed")
+	response["error"] = map[string]any{"code": "server_error", "message": message}
+
+	t.send("response.failed", map[string]any{"response": response})
+}
+
+func (t *responsesTranslation) response(status string) map[string]any {
+	return map[string]any{
+		"id":         "resp_" + t.id,
+		"object":     "response",
+		"created_at": t.created,
+		"status":     status,
+		"model":      t.model,
+		"output":     append([]map[string]any{}, t.output...),
+		"usage":      t.usage,
+	}
+}
+
+// send emits an event while streaming.
+func (t *responsesTranslation) send(event string, data map[string]any) {
+	if t.emit == nil {
+		return
+	}
+
+	data["type"] = event
+	data["sequence_number"] = t.seq
+	t.seq++
+
+	payload, err := json.Marshal(data)
+
+	if err != nil {
+		payload, _ = json.Marshal(map[string]any{"type": "error", "message": err.Error()})
+	}
+
+	t.emit(event, payload)
+}
+
+func outputText(text string) map[string]any {
+	return map[string]any{
+		"type":        "output_text",
+		"text":        text,
+		"annotations": []any{},
+	}
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxAssertionActual bounds the actual value reported with a result.
+const maxAssertionActual = 256
+
+// assertionResponse is the response assertions are evaluated against.
+// Body is nil when it was not available (e.g. streamed or too large).
+type assertionResponse struct {
+	status   int
+	header   http.Header
+	body     []byte
+	duration float64
+}
+
+// needsBody reports whether any assertion inspects the response body.
+func needsBody(assertions []Assertion) bool {
+	for _, a := range assertions {
+		if a.Type == "body" || a.Type == "json" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// responseHeader looks up a response header; CORS headers and cookies of
+// proxied responses are moved aside as X-Prism-Upstream-<Name>.
+func responseHeader(header http.Header, name string) ([]string, bool) {
+	values, ok := header[http.CanonicalHeaderKey(name)]
+
+	if !ok {
+		values, ok = header[http.CanonicalHeaderKey("X-Prism-Upstream-"+name)]
+	}
+
+	return values, ok
+}
+
+// evaluateAssertions checks every assertion against resp.
+func evaluateAssertions(assertions []Assertion, resp *assertionResponse) AssertionReport {
+	report := AssertionReport{
+		Passed: true,
+
+		Results: []AssertionResult{},
+	}
+
+	var doc any
+	var docErr error
+
+	parsed := false
+
+	for _, a := range assertions {
+		result := AssertionResult{Assertion: a}
+
+		if result.Operator == "" {
+			result.Operator = "equals"
+
+			if a.Type == "duration" {
+				result.Operator = "lessThan"
+			}
+		}
+
+		var actual string
+		var exists bool
+		var err error
+
+		switch a.Type {
+		case "status":
+			actual, exists = strconv.Itoa(resp.status), true
+
+		case "header":
+			values, ok := responseHeader(resp.header, a.Name)
+			actual, exists = strings.Join(values, ", "), ok
+
+		case "body":
+			if resp.body == nil {
+				err = errors.New("response body not available")
+				break
+			}
+
+			actual, exists = string(resp.body), true
+
+		case "json":
+			if resp.body == nil {
+				err = errors.New("response body not available")
+				break
+			}
+
+			if !parsed {
+				docErr = json.Unmarshal(resp.body, &doc)
+				parsed = true
+			}
+
+			if docErr != nil {
+				err = fmt.Errorf("response body is not JSON: %w", docErr)
+				break
+			}
+
+			var value any
+
+			value, exists, err = evalJSONPath(doc, a.Path)
+
+			if exists {
+				actual = jsonPathString(value)
+			}
+
+		case "duration":
+			actual, exists = strconv.FormatFloat(resp.duration, 'f', -1, 64), true
+
+		default:
+			err = fmt.Errorf("unknown assertion type %q", a.Type)
+		}
+
+		if err == nil {
+			result.Passed, err = compareAssertion(a.Type, result.Operator, actual, exists, a.Value)
+		}
+
+		if exists {
+			result.Actual = shorten(actual, maxAssertionActual)
+		}
+
+		switch {
+		case err != nil:
+			result.Passed = false
+			result.Message = err.Error()
+
+		case !result.Passed:
+			result.Message = assertionMessage(result.Assertion, exists)
+		}
+
+		report.Passed = report.Passed && result.Passed
+		report.Results = append(report.Results, result)
+	}
+
+	return report
+}
+
+// compareAssertion applies operator to the actual value. Ordering
+// operators compare numerically.
+func compareAssertion(kind, operator, actual string, exists bool, expected string) (bool, error) {
+	switch operator {
+	case "exists":
+		return exists, nil
+	case "notExists":
+		return !exists, nil
+	}
+
+	if !exists {
+		return operator == "notEquals" || operator == "notContains", nil
+	}
+
+	switch operator {
+	case "equals":
+		return matchesExpected(kind, actual, expected), nil
+
+	case "notEquals":
+		return !matchesExpected(kind, actual, expected), nil
+
+	case "contains":
+		return strings.Contains(actual, expected), nil
+
+	case "notContains":
+		return !strings.Contains(actual, expected), nil
+
+	case "matches":
+		re, err := regexp.Compile(expected)
+
+		if err != nil {
+			return false, fmt.Errorf("invalid pattern: %w", err)
+		}
+
+		return re.MatchString(actual), nil
+
+	case "lessThan", "lessThanOrEqual", "greaterThan", "greaterThanOrEqual":
+		a, err := strconv.ParseFloat(actual, 64)
+
+		if err != nil {
+			return false, fmt.Errorf("%q is not a number", shorten(actual, 64))
+		}
+
+		b, err := strconv.ParseFloat(expected, 64)
+
+		if err != nil {
+			return false, fmt.Errorf("invalid value %q: expected a number", expected)
+		}
+
+		switch operator {
+		case "lessThan":
+			return a < b, nil
+		case "lessThanOrEqual":
+			return a <= b, nil
+		case "greaterThan":
+			return a > b, nil
+		default:
+			return a >= b, nil
+		}
+	}
+
+	return false, fmt.Errorf("unknown operator %q", operator)
+}
+
+// matchesExpected compares for equality; statuses also match a class
+// ("2xx").
+func matchesExpected(kind, actual, expected string) bool {
+	if kind == "status" && len(expected) == 3 && strings.HasSuffix(strings.ToLower(expected), "xx") {
+		return len(actual) == 3 && actual[0] == expected[0]
+	}
+
+	return actual == expected
+}
+
+// assertionMessage explains a failed assertion; a.Operator is set.
+func assertionMessage(a Assertion, exists bool) string {
+	subject := a.Type
+
+	switch a.Type {
+	case "header":
+		subject = "header " + a.Name
+	case "json":
+		subject = a.Path
+	}
+
+	switch a.Operator {
+	case "exists":
+		return subject + " does not exist"
+	case "notExists":
+		return subject + " exists"
+	}
+
+	if !exists {
+		return subject + " does not exist"
+	}
+
+	return fmt.Sprintf("expected %s %s %q", subject, a.Operator, a.Value)
+}
+
+// jsonPathString renders a JSON value for comparison: strings as they are,
+// everything else as JSON.
+func jsonPathString(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// evalJSONPath evaluates a JSONPath subset against doc: member access by
+// dot (.name) or bracket (['name']) and array indexes ([0], [-1] from the
+// end). The leading $ is optional.
+func evalJSONPath(doc any, path string) (any, bool, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+
+	value := doc
+
+	for rest != "" {
+		var key string
+		var index int
+		var isIndex bool
+
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+
+			key, rest = rest[:end], rest[end:]
+
+			if key == "" {
+				return nil, false, fmt.Errorf("invalid path %q", path)
+			}
+
+		case strings.HasPrefix(rest, "['"), strings.HasPrefix(rest, `["`):
+			quote := rest[1:2]
+			end := strings.Index(rest[2:], quote+"]")
+
+			if end < 0 {
+				return nil, false, fmt.Errorf("invalid path %q", path)
+			}
+
+			key, rest = rest[2:2+end], rest[2+end+2:]
+
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+
+			if end < 0 {
+				return nil, false, fmt.Errorf("invalid path %q", path)
+			}
+
+			n, err := strconv.Atoi(strings.TrimSpace(rest[1:end]))
+
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid path %q: unsupported selector %s", path, rest[:end+1])
+			}
+
+			index, isIndex, rest = n, true, rest[end+1:]
+
+		default:
+			return nil, false, fmt.Errorf("invalid path %q", path)
+		}
+
+		if isIndex {
+			items, ok := value.([]any)
+
+			if !ok {
+				return nil, false, nil
+			}
+
+			if index < 0 {
+				index += len(items)
+			}
+
+			if index < 0 || index >= len(items) {
+				return nil, false, nil
+			}
+
+			value = items[index]
+			continue
+		}
+
+		object, ok := value.(map[string]any)
+
+		if !ok {
+			return nil, false, nil
+		}
+
+		if value, ok = object[key]; !ok {
+			return nil, false, nil
+		}
+	}
+
+	return value, true, nil
+}
+
+func shorten(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	s = s[:n]
+
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+
+	return s + "…"
+}
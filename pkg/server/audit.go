@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// auditDir holds the audit trail as JSON lines, a file per day (UTC).
+	// Records are only ever appended; it is neither synced nor committed.
+	auditDir = ".audit"
+
+	// auditBodyLimit bounds the body excerpts recorded with AuditBodies.
+	auditBodyLimit = 4 << 10
+)
+
+// auditCredentials redact the values of JSON fields and form parameters
+// named like credentials in body excerpts.
+var auditCredentials = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{
+		regexp.MustCompile(`(?i)("[^"]*(?:password|passwd|secret|token|api_?key|authorization|credential|private_?key|cookie)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"?`),
+		`${1}"` + redactedValue + `"`,
+	},
+	{
+		regexp.MustCompile(`(?i)((?:^|&)[^=&\s]*(?:password|passwd|secret|token|api_?key|credential)[^=&\s]*=)[^&\s]*`),
+		`${1}` + redactedValue,
+	},
+}
+
+// auditing tells whether proxied requests are recorded: as configured,
+// else in remote mode.
+func (s *Server) auditing() bool {
+	cfg := s.config.Load()
+
+	if cfg.Audit != nil {
+		return *cfg.Audit
+	}
+
+	return cfg.Remote || cfg.Token != ""
+}
+
+// recordAudit appends entry to the audit trail of its day.
+func (s *Server) recordAudit(entry AuditEntry) {
+	data, err := json.Marshal(entry)
+
+	if err != nil {
+		s.logger.Error("audit record failed", "error", err)
+		return
+	}
+
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+
+	if err := appendAudit(entry.Time, append(data, '\n')); err != nil {
+		s.logger.Error("audit record failed", "error", err)
+	}
+}
+
+func appendAudit(t time.Time, line []byte) error {
+	dir := filepath.Join(dataRoot(), auditDir)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, auditFile(t)), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// auditFile is the name of the audit trail of the day of t.
+func auditFile(t time.Time) string {
+	return t.UTC().Format(time.DateOnly) + ".jsonl"
+}
+
+// clientKey is the context key of the address of the client a request
+// came from.
+type clientKey struct{}
+
+// withClient notes the address of the client in the context, so requests
+// the server derives from it, such as those of runs, are accounted to it.
+// Behind the gateway of multi-user mode, that is the address it forwards.
+func (s *Server) withClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+
+		if err != nil {
+			client = r.RemoteAddr
+		}
+
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 && s.config.Load().User != "" {
+			// the gateway appends the address it was connected from
+			addrs := strings.Split(forwarded[len(forwarded)-1], ",")
+			client = strings.TrimSpace(addrs[len(addrs)-1])
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, client)))
+	})
+}
+
+// contextClient returns the client address withClient stored in ctx,
+// empty for requests of the server itself such as those of monitors.
+func contextClient(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+// bodyExcerpt keeps the beginning of a body.
+type bodyExcerpt struct {
+	mu sync.Mutex
+
+	data      []byte
+	truncated bool
+}
+
+func (e *bodyExcerpt) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	n := min(len(p), auditBodyLimit-len(e.data))
+
+	e.data = append(e.data, p[:n]...)
+	e.truncated = e.truncated || n < len(p)
+
+	return len(p), nil
+}
+
+// String returns the excerpt as text with credentials redacted, a
+// placeholder for binary content.
+func (e *bodyExcerpt) String() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	data := e.data
+
+	// the limit may have split a character
+	for i := 0; i < utf8.UTFMax-1 && e.truncated && len(data) > 0 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return "[binary]"
+	}
+
+	text := string(data)
+
+	for _, credentials := range auditCredentials {
+		text = credentials.pattern.ReplaceAllString(text, credentials.replacement)
+	}
+
+	if e.truncated {
+		text += fmt.Sprintf("… [truncated at %d bytes]", auditBodyLimit)
+	}
+
+	return text
+}
+
+// excerptBody copies what is read of a request body into an excerpt.
+type excerptBody struct {
+	io.ReadCloser
+	excerpt *bodyExcerpt
+}
+
+func (b *excerptBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.excerpt.Write(p[:n])
+
+	return n, err
+}
@@ -0,0 +1,348 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+// certDir holds the local CA and the server certificate it issues. The dot
+// keeps it out of the data store names.
+const certDir = ".certs"
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 825 * 24 * time.Hour // the maximum Apple platforms accept
+
+	// certRenewal is how long before expiry the server certificate is
+	// issued anew.
+	certRenewal = 30 * 24 * time.Hour
+)
+
+// serverTLSConfig returns the TLS configuration of the server: the
+// configured certificate, or one issued by the local CA for the names the
+// server is reached by.
+func serverTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+
+		if err != nil {
+			return nil, fmt.Errorf("tls certificate: %w", err)
+		}
+
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+
+	dir := filepath.Join(getDataDir(context.Background()), certDir)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	ca, caKey, err := loadLocalCA(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.TLSTrust {
+		if err := trustLocalCA(ca, filepath.Join(dir, "ca.crt")); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := loadServerCertificate(dir, ca, caKey, certificateNames(cfg.Host))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// certificateNames returns the names the server certificate covers:
+// loopback, the machine and the listen host.
+func certificateNames(host string) []string {
+	names := []string{"localhost", "127.0.0.1", "::1"}
+
+	if name, err := os.Hostname(); err == nil && name != "" {
+		names = append(names, name)
+	}
+
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) && !slices.Contains(names, host) {
+		names = append(names, host)
+	}
+
+	return names
+}
+
+// loadLocalCA reads the local CA from dir, generating it on first use.
+func loadLocalCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPath := filepath.Join(dir, "ca.crt")
+	keyPath := filepath.Join(dir, "ca.key")
+
+	if cert, key, err := readKeyPair(certPath, keyPath); err == nil && time.Now().Before(cert.NotAfter) {
+		return cert, key, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := "Prism Local CA"
+
+	// several users of a machine each have their own
+	if u, err := user.Current(); err == nil {
+		name += " (" + u.Username + ")"
+	}
+
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   name,
+			Organization: []string{"Prism"},
+		},
+
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(caValidity),
+
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	cert, err := createCertificate(template, template, key, key)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeKeyPair(certPath, keyPath, cert, key); err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// loadServerCertificate reads the server certificate from dir, issuing it
+// anew when it is missing, about to expire, not signed by ca or lacks one
+// of names.
+func loadServerCertificate(dir string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, names []string) (tls.Certificate, error) {
+	certPath := filepath.Join(dir, "server.crt")
+	keyPath := filepath.Join(dir, "server.key")
+
+	if cert, _, err := readKeyPair(certPath, keyPath); err == nil && validServerCertificate(cert, ca, names) {
+		return tls.LoadX509KeyPair(certPath, keyPath)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   "localhost",
+			Organization: []string{"Prism"},
+		},
+
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(certValidity),
+
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	cert, err := createCertificate(template, ca, key, caKey)
+
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if err := writeKeyPair(certPath, keyPath, cert, key); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.LoadX509KeyPair(certPath, keyPath)
+}
+
+func validServerCertificate(cert, ca *x509.Certificate, names []string) bool {
+	if time.Now().Add(certRenewal).After(cert.NotAfter) {
+		return false
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	for _, name := range names {
+		opts := x509.VerifyOptions{
+			DNSName: name,
+			Roots:   roots,
+
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+
+		if _, err := cert.Verify(opts); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// trustLocalCA installs the local CA into the trust store of the user,
+// unless the system already trusts it.
+func trustLocalCA(ca *x509.Certificate, path string) error {
+	if _, err := ca.Verify(x509.VerifyOptions{}); err == nil {
+		return nil
+	}
+
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		home, err := os.UserHomeDir()
+
+		if err != nil {
+			return err
+		}
+
+		cmd = exec.Command("security", "add-trusted-cert", "-r", "trustRoot", "-k", filepath.Join(home, "Library", "Keychains", "login.keychain-db"), path)
+
+	case "windows":
+		cmd = exec.Command("certutil", "-user", "-addstore", "Root", path)
+
+	case "linux":
+		// browsers read the NSS database; the system store needs root
+		home, err := os.UserHomeDir()
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := exec.LookPath("certutil"); err != nil {
+			return fmt.Errorf("certutil (NSS tools) not found, add %s to the trusted certificates manually", path)
+		}
+
+		nssdb := filepath.Join(home, ".pki", "nssdb")
+
+		if err := os.MkdirAll(nssdb, 0700); err != nil {
+			return err
+		}
+
+		cmd = exec.Command("certutil", "-d", "sql:"+nssdb, "-A", "-t", "C,,", "-n", ca.Subject.CommonName, "-i", path)
+
+	default:
+		return fmt.Errorf("installing certificates is not supported on %s, add %s to the trusted certificates manually", runtime.GOOS, path)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		message := string(bytes.TrimSpace(output))
+
+		if message == "" {
+			message = err.Error()
+		}
+
+		return fmt.Errorf("trusting %s: %s", path, message)
+	}
+
+	return nil
+}
+
+func createCertificate(template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+
+	if err != nil {
+		return nil, err
+	}
+
+	template.SerialNumber = serial
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+func readKeyPair(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("invalid PEM data")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// writeKeyPair writes the key first, so a certificate never lacks its key.
+func writeKeyPair(certPath, keyPath string, cert *x509.Certificate, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644)
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minScheduleInterval is the shortest @every interval.
+const minScheduleInterval = 10 * time.Second
+
+// schedule is a parsed cron expression: five fields (minute, hour, day of
+// month, month, day of week) or a descriptor such as @hourly or @every 5m.
+// Times are in the local time zone.
+type schedule struct {
+	every time.Duration
+
+	minute, hour, dom, month, dow uint64
+
+	// restricted day fields match either day, as in cron
+	domAny, dowAny bool
+}
+
+var scheduleDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseSchedule parses a cron expression. Fields take *, values, ranges
+// (1-5), lists (1,15) and steps (*/10, 0-30/5); months and weekdays also
+// take names (jan, mon). Sunday is 0 or 7.
+func parseSchedule(expr string) (*schedule, error) {
+	expr = strings.TrimSpace(expr)
+
+	if value, ok := strings.CutPrefix(expr, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(value))
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+
+		if every < minScheduleInterval {
+			return nil, fmt.Errorf("invalid schedule %q: interval must be at least %s", expr, minScheduleInterval)
+		}
+
+		return &schedule{every: every}, nil
+	}
+
+	if descriptor, ok := scheduleDescriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	}
+
+	fields := strings.Fields(expr)
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields", expr)
+	}
+
+	s := &schedule{
+		domAny: fields[2] == "*" || fields[2] == "?",
+		dowAny: fields[4] == "*" || fields[4] == "?",
+	}
+
+	var err error
+
+	parsers := []struct {
+		target      *uint64
+		first, last int
+		names       []string
+	}{
+		{&s.minute, 0, 59, nil},
+		{&s.hour, 0, 23, nil},
+		{&s.dom, 1, 31, nil},
+		{&s.month, 1, 12, monthNames},
+		{&s.dow, 0, 7, weekdayNames},
+	}
+
+	for i, p := range parsers {
+		if *p.target, err = parseScheduleField(fields[i], p.first, p.last, p.names); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+	}
+
+	// 7 is another Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	if s.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid schedule %q: never fires", expr)
+	}
+
+	return s, nil
+}
+
+func parseScheduleField(field string, first, last int, names []string) (uint64, error) {
+	var bits uint64
+
+	for part := range strings.SplitSeq(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+
+			step = n
+		}
+
+		lo, hi := first, last
+
+		switch {
+		case rangePart == "*" || rangePart == "?":
+
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+
+			var err error
+
+			if lo, err = parseScheduleValue(a, first, last, names); err != nil {
+				return 0, err
+			}
+
+			if hi, err = parseScheduleValue(b, first, last, names); err != nil {
+				return 0, err
+			}
+
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+
+		default:
+			value, err := parseScheduleValue(rangePart, first, last, names)
+
+			if err != nil {
+				return 0, err
+			}
+
+			// a single value with a step runs from there to the end
+			lo, hi = value, value
+
+			if hasStep {
+				hi = last
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	if bits == 0 {
+		return 0, errors.New("empty field")
+	}
+
+	return bits, nil
+}
+
+func parseScheduleValue(value string, first, last int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(value, name) {
+			if first == 1 {
+				return i + 1, nil
+			}
+
+			return i, nil
+		}
+	}
+
+	n, err := strconv.Atoi(value)
+
+	if err != nil || n < first || n > last {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+
+	return n, nil
+}
+
+// next returns the first time after t the schedule fires.
+func (s *schedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every).Truncate(time.Second)
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// a matching minute is within a few years unless the day fields can
+	// never match (e.g. February 30)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+
+	return dom || dow
+}
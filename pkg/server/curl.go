@@ -0,0 +1,645 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// curlShortFlags maps curl's single-letter options to their long names.
+var curlShortFlags = map[byte]string{
+	'X': "request",
+	'H': "header",
+	'd': "data",
+	'F': "form",
+	'u': "user",
+	'k': "insecure",
+	'L': "location",
+	'G': "get",
+	'I': "head",
+	'A': "user-agent",
+	'e': "referer",
+	'b': "cookie",
+	'c': "cookie-jar",
+	'T': "upload-file",
+	'o': "output",
+	'D': "dump-header",
+	'K': "config",
+	'm': "max-time",
+	'x': "proxy",
+	'U': "proxy-user",
+	'w': "write-out",
+	'E': "cert",
+	'r': "range",
+	'C': "continue-at",
+	'y': "speed-time",
+	'Y': "speed-limit",
+	'z': "time-cond",
+	'Q': "quote",
+	'P': "ftp-port",
+	't': "telnet-option",
+}
+
+// curlArgFlags lists the long options that consume an argument; any other
+// option is treated as a switch and ignored unless handled below.
+var curlArgFlags = map[string]bool{
+	"request": true, "header": true, "url": true, "url-query": true,
+	"data": true, "data-raw": true, "data-ascii": true, "data-binary": true, "data-urlencode": true, "json": true,
+	"form": true, "form-string": true, "upload-file": true,
+	"user": true, "oauth2-bearer": true, "user-agent": true, "referer": true, "cookie": true, "cookie-jar": true,
+	"output": true, "output-dir": true, "dump-header": true, "config": true, "write-out": true, "stderr": true,
+	"trace": true, "trace-ascii": true, "max-time": true, "connect-timeout": true, "expect100-timeout": true,
+	"retry": true, "retry-delay": true, "retry-max-time": true, "max-redirs": true, "max-filesize": true,
+	"proxy": true, "proxy-user": true, "proxy-header": true, "noproxy": true, "socks5": true, "socks5-hostname": true,
+	"preproxy": true, "resolve": true, "connect-to": true, "interface": true, "unix-socket": true, "abstract-unix-socket": true,
+	"cert": true, "cert-type": true, "key": true, "key-type": true, "pass": true, "cacert": true, "capath": true,
+	"ciphers": true, "pinnedpubkey": true, "aws-sigv4": true, "range": true, "continue-at": true, "limit-rate": true,
+	"speed-time": true, "speed-limit": true, "time-cond": true, "quote": true, "ftp-port": true, "telnet-option": true,
+	"variable": true, "happy-eyeballs-timeout-ms": true, "keepalive-time": true, "dns-servers": true,
+}
+
+// curlCommand collects the options of a parsed curl invocation.
+type curlCommand struct {
+	method  string
+	url     string
+	headers []KeyValue
+	query   []KeyValue
+
+	data     []string
+	dataFile string
+	json     bool
+	form     []FormField
+
+	get        bool
+	head       bool
+	uploadFile string
+
+	insecure bool
+	location bool
+}
+
+// parseCurl converts a curl command line into a Request.
+func parseCurl(command string) (*Request, error) {
+	args, err := splitShellWords(command)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 || path.Base(args[0]) != "curl" {
+		return nil, errors.New("not a curl command")
+	}
+
+	cmd := &curlCommand{}
+
+	if err := cmd.parse(args[1:]); err != nil {
+		return nil, err
+	}
+
+	if cmd.url == "" {
+		return nil, errors.New("missing URL")
+	}
+
+	return cmd.request()
+}
+
+func (c *curlCommand) parse(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		next := func(name string) (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("option --%s: argument expected", name)
+			}
+
+			i++
+			return args[i], nil
+		}
+
+		switch {
+		case arg == "--":
+			for _, rest := range args[i+1:] {
+				c.setURL(rest)
+			}
+
+			return nil
+
+		case strings.HasPrefix(arg, "--"):
+			name := strings.TrimPrefix(arg, "--")
+			value := ""
+
+			if curlArgFlags[name] {
+				v, err := next(name)
+
+				if err != nil {
+					return err
+				}
+
+				value = v
+			}
+
+			c.apply(name, value)
+
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// short options may be clustered (-sSL) and take their argument
+			// attached (-XPOST) or as the next word
+			for j := 1; j < len(arg); j++ {
+				name, ok := curlShortFlags[arg[j]]
+
+				if !ok {
+					continue
+				}
+
+				value := ""
+
+				if curlArgFlags[name] {
+					if rest := arg[j+1:]; rest != "" {
+						value = rest
+					} else {
+						v, err := next(name)
+
+						if err != nil {
+							return err
+						}
+
+						value = v
+					}
+
+					j = len(arg)
+				}
+
+				c.apply(name, value)
+			}
+
+		default:
+			c.setURL(arg)
+		}
+	}
+
+	return nil
+}
+
+func (c *curlCommand) setURL(value string) {
+	// curl takes several URLs; only the first becomes the request
+	if c.url == "" {
+		c.url = value
+	}
+}
+
+func (c *curlCommand) addHeader(key, value string) {
+	c.headers = append(c.headers, KeyValue{ID: newRequestID(), Enabled: true, Key: key, Value: value})
+}
+
+func (c *curlCommand) header(key string) (string, bool) {
+	for _, h := range c.headers {
+		if strings.EqualFold(h.Key, key) {
+			return h.Value, true
+		}
+	}
+
+	return "", false
+}
+
+func (c *curlCommand) removeHeader(key string) {
+	headers := c.headers[:0]
+
+	for _, h := range c.headers {
+		if !strings.EqualFold(h.Key, key) {
+			headers = append(headers, h)
+		}
+	}
+
+	c.headers = headers
+}
+
+func (c *curlCommand) apply(name, value string) {
+	switch name {
+	case "request":
+		c.method = strings.ToUpper(value)
+
+	case "url":
+		c.setURL(value)
+
+	case "url-query":
+		key, val, _ := strings.Cut(value, "=")
+		c.query = append(c.query, KeyValue{ID: newRequestID(), Enabled: true, Key: key, Value: val})
+
+	case "header":
+		key, val, ok := strings.Cut(value, ":")
+
+		if !ok {
+			// "X-Foo;" sends an empty header, "@file" reads headers from a file
+			if key, ok := strings.CutSuffix(value, ";"); ok {
+				c.addHeader(strings.TrimSpace(key), "")
+			}
+
+			return
+		}
+
+		// "X-Foo:" removes a header in curl; there is nothing to remove here
+		if val = strings.TrimSpace(val); val != "" {
+			c.addHeader(strings.TrimSpace(key), val)
+		}
+
+	case "user-agent":
+		c.addHeader("User-Agent", value)
+
+	case "referer":
+		c.addHeader("Referer", strings.TrimSuffix(value, ";auto"))
+
+	case "cookie":
+		// without "=" the value names a cookie file
+		if strings.Contains(value, "=") {
+			c.addHeader("Cookie", value)
+		}
+
+	case "user":
+		user, password, _ := strings.Cut(value, ":")
+		c.addHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+
+	case "oauth2-bearer":
+		c.addHeader("Authorization", "Bearer "+value)
+
+	case "data", "data-ascii", "data-binary":
+		if file, ok := strings.CutPrefix(value, "@"); ok {
+			c.dataFile = file
+		}
+
+		c.data = append(c.data, value)
+
+	case "data-raw":
+		c.data = append(c.data, value)
+
+	case "data-urlencode":
+		c.data = append(c.data, curlURLEncode(value))
+
+	case "json":
+		c.json = true
+
+		if file, ok := strings.CutPrefix(value, "@"); ok {
+			c.dataFile = file
+		}
+
+		c.data = append(c.data, value)
+
+	case "form", "form-string":
+		key, val, _ := strings.Cut(value, "=")
+		field := FormField{ID: newRequestID(), Enabled: true, Key: key, Type: "text", Value: val}
+
+		if name == "form" && (strings.HasPrefix(val, "@") || strings.HasPrefix(val, "<")) {
+			// drop ";type=...;filename=..." modifiers
+			file, _, _ := strings.Cut(val[1:], ";")
+
+			field.Type = "file"
+			field.Value = ""
+			field.FileName = path.Base(file)
+		}
+
+		c.form = append(c.form, field)
+
+	case "upload-file":
+		c.uploadFile = value
+
+	case "get":
+		c.get = true
+
+	case "head":
+		c.head = true
+
+	case "insecure":
+		c.insecure = true
+
+	case "location", "location-trusted":
+		c.location = true
+	}
+}
+
+// curlURLEncode implements the --data-urlencode forms "content", "=content"
+// and "name=content". File references ("@file", "name@file") are kept as-is.
+func curlURLEncode(value string) string {
+	if i := strings.IndexAny(value, "=@"); i >= 0 && value[i] == '@' {
+		return value
+	}
+
+	name, content, ok := strings.Cut(value, "=")
+
+	if !ok {
+		return url.QueryEscape(value)
+	}
+
+	if name == "" {
+		return url.QueryEscape(content)
+	}
+
+	return name + "=" + url.QueryEscape(content)
+}
+
+func (c *curlCommand) request() (*Request, error) {
+	target := c.url
+
+	if !strings.Contains(target, "://") {
+		// curl assumes http:// for scheme-less URLs
+		target = "http://" + target
+	}
+
+	u, err := url.Parse(target)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	query := append(splitQuery(u.RawQuery), c.query...)
+
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	body := RequestBody{Type: "none"}
+	data := strings.Join(c.data, "&")
+
+	switch {
+	case c.get:
+		// -G moves the data into the query string
+		query = append(query, splitQuery(data)...)
+
+	case len(c.form) > 0:
+		// the multipart boundary is generated when sending
+		if ct, _ := c.header("Content-Type"); strings.HasPrefix(strings.ToLower(ct), "multipart/") {
+			c.removeHeader("Content-Type")
+		}
+
+		body = RequestBody{Type: "form-data", Data: c.form}
+
+	case c.uploadFile != "":
+		body = RequestBody{Type: "binary", FileName: path.Base(c.uploadFile)}
+
+	case len(c.data) > 0:
+		body = c.dataBody(data)
+	}
+
+	method := c.method
+
+	if method == "" {
+		switch {
+		case c.head:
+			method = "HEAD"
+		case c.get:
+			method = "GET"
+		case c.uploadFile != "":
+			method = "PUT"
+		case body.Type != "none":
+			method = "POST"
+		default:
+			method = "GET"
+		}
+	}
+
+	headers := c.headers
+
+	if headers == nil {
+		headers = []KeyValue{}
+	}
+
+	return &Request{
+		ID:   newRequestID(),
+		Name: method + " " + u.Host + u.Path,
+
+		Variables: []Variable{},
+
+		CreationTime: time.Now().UnixMilli(),
+
+		HTTP: &HTTPSettings{
+			Method: method,
+			URL:    u.String(),
+
+			Query:   query,
+			Headers: headers,
+			Body:    body,
+
+			Options: HTTPOptions{
+				Insecure: c.insecure,
+				Redirect: c.location,
+			},
+		},
+	}, nil
+}
+
+// dataBody picks the body type for -d style data based on Content-Type.
+func (c *curlCommand) dataBody(data string) RequestBody {
+	if c.dataFile != "" && len(c.data) == 1 {
+		return RequestBody{Type: "binary", FileName: path.Base(c.dataFile)}
+	}
+
+	if c.json {
+		if _, ok := c.header("Content-Type"); !ok {
+			c.addHeader("Content-Type", "application/json")
+		}
+
+		if _, ok := c.header("Accept"); !ok {
+			c.addHeader("Accept", "application/json")
+		}
+	}
+
+	ct, ok := c.header("Content-Type")
+	ct = strings.ToLower(ct)
+
+	switch {
+	case strings.Contains(ct, "json"):
+		return RequestBody{Type: "json", Content: data}
+
+	case strings.Contains(ct, "xml"):
+		return RequestBody{Type: "xml", Content: data}
+
+	case ok && !strings.HasPrefix(ct, "application/x-www-form-urlencoded"):
+		return RequestBody{Type: "raw", Content: data}
+
+	case !ok && (strings.HasPrefix(data, "{") || strings.HasPrefix(data, "[")) && json.Valid([]byte(data)):
+		// JSON sent without a Content-Type is almost always meant as JSON
+		return RequestBody{Type: "json", Content: data}
+	}
+
+	for part := range strings.SplitSeq(data, "&") {
+		if key, _, found := strings.Cut(part, "="); !found || key == "" {
+			// not a key=value form; keep the bytes as curl would send them
+			if !ok {
+				c.addHeader("Content-Type", "application/x-www-form-urlencoded")
+			}
+
+			return RequestBody{Type: "raw", Content: data}
+		}
+	}
+
+	var fields []FormField
+
+	for _, pair := range splitQuery(data) {
+		fields = append(fields, FormField{ID: pair.ID, Enabled: true, Key: pair.Key, Value: pair.Value})
+	}
+
+	return RequestBody{Type: "form-urlencoded", Data: fields}
+}
+
+// splitQuery splits a query or form string into ordered, unescaped pairs.
+func splitQuery(value string) []KeyValue {
+	pairs := []KeyValue{}
+
+	for part := range strings.SplitSeq(value, "&") {
+		if part == "" {
+			continue
+		}
+
+		key, val, _ := strings.Cut(part, "=")
+
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+
+		if v, err := url.QueryUnescape(val); err == nil {
+			val = v
+		}
+
+		pairs = append(pairs, KeyValue{ID: newRequestID(), Enabled: true, Key: key, Value: val})
+	}
+
+	return pairs
+}
+
+// newRequestID returns a short random ID like the UI's generateId.
+func newRequestID() string {
+	return strings.ToLower(rand.Text()[:8])
+}
+
+// splitShellWords splits a POSIX shell command line into words, handling
+// quotes, backslash escapes, line continuations and $'...' strings.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+
+		switch {
+		case ch == '\\' && i+1 < len(s) && (s[i+1] == '\n' || s[i+1] == '\r'):
+			// line continuation
+			i++
+
+			if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+
+		case ch == '\\':
+			inWord = true
+
+			if i+1 < len(s) {
+				i++
+				word.WriteByte(s[i])
+			}
+
+		case ch == '\'':
+			inWord = true
+
+			end := strings.IndexByte(s[i+1:], '\'')
+
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+
+		case ch == '$' && i+1 < len(s) && s[i+1] == '\'':
+			inWord = true
+
+			n, err := readANSIQuoted(s[i+2:], &word)
+
+			if err != nil {
+				return nil, err
+			}
+
+			i += n + 1
+
+		case ch == '"':
+			inWord = true
+
+			closed := false
+
+			for i++; i < len(s); i++ {
+				if s[i] == '"' {
+					closed = true
+					break
+				}
+
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+
+					if s[i] == '\n' {
+						continue
+					}
+				}
+
+				word.WriteByte(s[i])
+			}
+
+			if !closed {
+				return nil, errors.New("unterminated double quote")
+			}
+
+		default:
+			inWord = true
+			word.WriteByte(ch)
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// readANSIQuoted decodes the body of a $'...' string up to the closing quote
+// and returns the number of bytes consumed, including the quote.
+func readANSIQuoted(s string, w *strings.Builder) (int, error) {
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+
+		if ch == '\'' {
+			return i + 1, nil
+		}
+
+		if ch != '\\' || i+1 >= len(s) {
+			w.WriteByte(ch)
+			continue
+		}
+
+		i++
+
+		switch s[i] {
+		case 'n':
+			w.WriteByte('\n')
+		case 't':
+			w.WriteByte('\t')
+		case 'r':
+			w.WriteByte('\r')
+		case '0':
+			w.WriteByte(0)
+		default:
+			w.WriteByte(s[i])
+		}
+	}
+
+	return 0, errors.New("unterminated $' quote")
+}
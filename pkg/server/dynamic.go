@@ -0,0 +1,334 @@
+package server
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dynamicVariables generate a fresh value per reference ({{$name}} or
+// {{$name(args)}}).
+var dynamicVariables = map[string]func(args []string) (string, error){
+	"$uuid":       dynamicUUID,
+	"$guid":       dynamicUUID,
+	"$randomUUID": dynamicUUID,
+
+	"$timestamp": func(args []string) (string, error) {
+		return strconv.FormatInt(time.Now().Unix(), 10), noArgs(args)
+	},
+
+	"$timestampMs": func(args []string) (string, error) {
+		return strconv.FormatInt(time.Now().UnixMilli(), 10), noArgs(args)
+	},
+
+	"$isoDatetime": func(args []string) (string, error) {
+		return time.Now().UTC().Format(time.RFC3339), noArgs(args)
+	},
+
+	"$isoTimestamp": func(args []string) (string, error) {
+		return time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"), noArgs(args)
+	},
+
+	"$date": func(args []string) (string, error) {
+		return time.Now().Format(time.DateOnly), noArgs(args)
+	},
+
+	"$randomInt": func(args []string) (string, error) {
+		lo, hi, err := intRange(args, 0, 1000)
+
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.FormatInt(lo+randomInt(hi-lo+1), 10), nil
+	},
+
+	"$randomFloat": func(args []string) (string, error) {
+		lo, hi, err := floatRange(args, 0, 1)
+
+		if err != nil {
+			return "", err
+		}
+
+		value := lo + float64(randomInt(1<<53))/(1<<53)*(hi-lo)
+
+		return strconv.FormatFloat(value, 'f', 2, 64), nil
+	},
+
+	"$randomBoolean": func(args []string) (string, error) {
+		return strconv.FormatBool(randomInt(2) == 1), noArgs(args)
+	},
+
+	"$randomString": func(args []string) (string, error) {
+		n, err := lengthArg(args, 10)
+
+		if err != nil {
+			return "", err
+		}
+
+		return randomText(n, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"), nil
+	},
+
+	"$randomAlphaNumeric": func(args []string) (string, error) {
+		n, err := lengthArg(args, 1)
+
+		if err != nil {
+			return "", err
+		}
+
+		return randomText(n, "abcdefghijklmnopqrstuvwxyz0123456789"), nil
+	},
+
+	"$randomHexadecimal": func(args []string) (string, error) {
+		n, err := lengthArg(args, 1)
+
+		if err != nil {
+			return "", err
+		}
+
+		return randomText(n, "0123456789abcdef"), nil
+	},
+
+	"$randomFirstName": func(args []string) (string, error) {
+		return randomItem(firstNames), noArgs(args)
+	},
+
+	"$randomLastName": func(args []string) (string, error) {
+		return randomItem(lastNames), noArgs(args)
+	},
+
+	"$randomFullName": func(args []string) (string, error) {
+		return randomItem(firstNames) + " " + randomItem(lastNames), noArgs(args)
+	},
+
+	"$randomUserName": func(args []string) (string, error) {
+		return randomUserName(), noArgs(args)
+	},
+
+	"$randomEmail": func(args []string) (string, error) {
+		return randomUserName() + "@" + randomItem(emailDomains), noArgs(args)
+	},
+
+	"$randomWord": func(args []string) (string, error) {
+		return randomItem(words), noArgs(args)
+	},
+
+	"$randomWords": func(args []string) (string, error) {
+		n, err := lengthArg(args, 3)
+
+		if err != nil {
+			return "", err
+		}
+
+		result := make([]string, n)
+
+		for i := range result {
+			result[i] = randomItem(words)
+		}
+
+		return strings.Join(result, " "), nil
+	},
+
+	"$randomCity": func(args []string) (string, error) {
+		return randomItem(cities), noArgs(args)
+	},
+
+	"$randomColor": func(args []string) (string, error) {
+		return randomItem(colors), noArgs(args)
+	},
+
+	"$randomHexColor": func(args []string) (string, error) {
+		return "#" + randomText(6, "0123456789abcdef"), noArgs(args)
+	},
+
+	"$randomIP": func(args []string) (string, error) {
+		return fmt.Sprintf("%d.%d.%d.%d", 1+randomInt(254), randomInt(256), randomInt(256), 1+randomInt(254)), noArgs(args)
+	},
+
+	"$randomPhoneNumber": func(args []string) (string, error) {
+		return fmt.Sprintf("%03d-%03d-%04d", 200+randomInt(800), randomInt(1000), randomInt(10000)), noArgs(args)
+	},
+
+	"$randomUrl": func(args []string) (string, error) {
+		return "https://" + randomItem(words) + "." + randomItem(emailDomains), noArgs(args)
+	},
+}
+
+var (
+	firstNames   = []string{"Ada", "Alan", "Alice", "Bob", "Carol", "Dave", "Eve", "Frank", "Grace", "Heidi", "Ivan", "Judy", "Linus", "Mallory", "Margaret", "Niklaus", "Olivia", "Peggy", "Sybil", "Trent", "Victor", "Walter"}
+	lastNames    = []string{"Baker", "Brown", "Clark", "Davis", "Evans", "Garcia", "Hopper", "Johnson", "Keller", "Lovelace", "Miller", "Moore", "Nguyen", "Smith", "Taylor", "Turing", "Walker", "Weber", "Wilson", "Wirth"}
+	emailDomains = []string{"example.com", "example.org", "example.net"}
+	words        = []string{"alpha", "anchor", "bridge", "canvas", "cedar", "comet", "delta", "ember", "falcon", "harbor", "island", "lantern", "maple", "meadow", "nova", "orbit", "pepper", "prism", "quartz", "river", "signal", "summit", "timber", "vector", "willow"}
+	cities       = []string{"Amsterdam", "Berlin", "Lisbon", "London", "Madrid", "Montreal", "Oslo", "Paris", "Prague", "Seoul", "Sydney", "Tokyo", "Vienna", "Zurich"}
+	colors       = []string{"black", "blue", "cyan", "gold", "gray", "green", "indigo", "magenta", "orange", "pink", "purple", "red", "teal", "white", "yellow"}
+)
+
+// dynamicValue resolves a dynamic variable reference such as $uuid or
+// $randomInt(1,10); false for unknown names and invalid arguments.
+func dynamicValue(ref string) (string, bool) {
+	// references in URLs may be percent-encoded
+	if strings.Contains(ref, "%") {
+		unescaped, err := url.PathUnescape(ref)
+
+		if err != nil {
+			return "", false
+		}
+
+		ref = unescaped
+	}
+
+	name, rest, hasArgs := strings.Cut(ref, "(")
+
+	var args []string
+
+	if hasArgs {
+		inner, ok := strings.CutSuffix(rest, ")")
+
+		if !ok {
+			return "", false
+		}
+
+		if inner = strings.TrimSpace(inner); inner != "" {
+			for arg := range strings.SplitSeq(inner, ",") {
+				args = append(args, strings.TrimSpace(arg))
+			}
+		}
+	}
+
+	fn, ok := dynamicVariables[name]
+
+	if !ok {
+		return "", false
+	}
+
+	value, err := fn(args)
+
+	if err != nil {
+		return "", false
+	}
+
+	return value, true
+}
+
+func noArgs(args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+
+	return nil
+}
+
+// intRange reads (min,max) arguments, both inclusive.
+func intRange(args []string, lo, hi int64) (int64, int64, error) {
+	if len(args) != 0 && len(args) != 2 {
+		return 0, 0, errors.New("expected min and max")
+	}
+
+	if len(args) == 2 {
+		var err error
+
+		if lo, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+			return 0, 0, err
+		}
+
+		if hi, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// hi-lo+1 must not overflow
+	if lo > hi || hi-lo < 0 || hi-lo == math.MaxInt64 {
+		return 0, 0, errors.New("invalid range")
+	}
+
+	return lo, hi, nil
+}
+
+func floatRange(args []string, lo, hi float64) (float64, float64, error) {
+	if len(args) != 0 && len(args) != 2 {
+		return 0, 0, errors.New("expected min and max")
+	}
+
+	if len(args) == 2 {
+		var err error
+
+		if lo, err = strconv.ParseFloat(args[0], 64); err != nil {
+			return 0, 0, err
+		}
+
+		if hi, err = strconv.ParseFloat(args[1], 64); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if lo > hi {
+		return 0, 0, errors.New("invalid range")
+	}
+
+	return lo, hi, nil
+}
+
+// lengthArg reads an optional length argument of at most 1024.
+func lengthArg(args []string, fallback int) (int, error) {
+	switch len(args) {
+	case 0:
+		return fallback, nil
+
+	case 1:
+		n, err := strconv.Atoi(args[0])
+
+		if err != nil || n < 1 || n > 1024 {
+			return 0, fmt.Errorf("invalid length %q", args[0])
+		}
+
+		return n, nil
+	}
+
+	return 0, errors.New("expected a length")
+}
+
+// randomInt returns a uniform random number in [0, n).
+func randomInt(n int64) int64 {
+	value, _ := rand.Int(rand.Reader, big.NewInt(n))
+	return value.Int64()
+}
+
+func randomItem(items []string) string {
+	return items[randomInt(int64(len(items)))]
+}
+
+func randomText(n int, alphabet string) string {
+	var b strings.Builder
+
+	for range n {
+		b.WriteByte(alphabet[randomInt(int64(len(alphabet)))])
+	}
+
+	return b.String()
+}
+
+func randomUserName() string {
+	return strings.ToLower(randomItem(firstNames)) + "." + strings.ToLower(randomItem(lastNames)) + strconv.FormatInt(randomInt(100), 10)
+}
+
+func dynamicUUID(args []string) (string, error) {
+	return newUUID(), noArgs(args)
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+
+	rand.Read(b[:])
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
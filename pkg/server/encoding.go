@@ -0,0 +1,150 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decodedBody closes both the decoder and the underlying upstream body.
+type decodedBody struct {
+	io.Reader
+
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var err error
+
+	for _, c := range b.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// newDecoder returns a streaming decoder for a single content coding.
+func newDecoder(coding string, r io.Reader) (io.ReadCloser, error) {
+	switch coding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// HTTP "deflate" is zlib-wrapped
+		return zlib.NewReader(r)
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		d, err := zstd.NewReader(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return d.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported content encoding %q", coding)
+}
+
+func supportedEncoding(coding string) bool {
+	switch coding {
+	case "gzip", "x-gzip", "deflate", "br", "zstd", "identity":
+		return true
+	}
+
+	return false
+}
+
+// decodeResponse replaces a compressed body with its decoded stream. The
+// original coding is reported as X-Prism-Content-Encoding; the returned
+// counter tracks the compressed bytes consumed (nil if nothing was decoded).
+// Bodies using any unsupported coding are passed through untouched.
+func decodeResponse(resp *http.Response) (*countingReader, error) {
+	value := resp.Header.Get("Content-Encoding")
+
+	if value == "" {
+		return nil, nil
+	}
+
+	var codings []string
+
+	for _, coding := range strings.Split(value, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		if !supportedEncoding(coding) {
+			return nil, nil
+		}
+
+		if coding != "identity" {
+			codings = append(codings, coding)
+		}
+	}
+
+	counter := &countingReader{r: resp.Body}
+
+	body := &decodedBody{
+		Reader:  counter,
+		closers: []io.Closer{resp.Body},
+	}
+
+	// codings are listed in the order they were applied
+	for i := len(codings) - 1; i >= 0; i-- {
+		d, err := newDecoder(codings[i], body.Reader)
+
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+
+		body.Reader = d
+		body.closers = append([]io.Closer{d}, body.closers...)
+	}
+
+	resp.Body = body
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	resp.Header.Set("X-Prism-Content-Encoding", value)
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+
+	return counter, nil
+}
+
+// rawEncoding hides Content-Encoding from the browser (which would decode it
+// transparently) so the UI receives the compressed bytes as sent.
+func rawEncoding(resp *http.Response) {
+	value := resp.Header.Get("Content-Encoding")
+
+	if value == "" {
+		return
+	}
+
+	resp.Header.Set("X-Prism-Content-Encoding", value)
+	resp.Header.Del("Content-Encoding")
+
+	if resp.ContentLength >= 0 {
+		resp.Header.Set("X-Prism-Encoded-Size", strconv.FormatInt(resp.ContentLength, 10))
+	}
+}
@@ -0,0 +1,457 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// extractValues evaluates extractors against resp. Results are in order;
+// Found is set for the values that could be extracted.
+func extractValues(extractors []Extractor, resp *assertionResponse) []ExtractionResult {
+	results := []ExtractionResult{}
+
+	var doc any
+	var docErr error
+
+	parsed := false
+
+	for _, ex := range extractors {
+		result := ExtractionResult{Variable: ex.Variable}
+
+		var err error
+
+		switch {
+		case ex.Variable == "":
+			err = errors.New("missing variable")
+
+		case ex.Type == "header":
+			var values []string
+
+			values, result.Found = responseHeader(resp.header, ex.Expression)
+			result.Value = strings.Join(values, ", ")
+
+		case resp.body == nil:
+			err = errors.New("response body not available")
+
+		case ex.Type == "json":
+			if !parsed {
+				docErr = json.Unmarshal(resp.body, &doc)
+				parsed = true
+			}
+
+			if docErr != nil {
+				err = fmt.Errorf("response body is not JSON: %w", docErr)
+				break
+			}
+
+			var value any
+
+			if value, result.Found, err = evalJSONPath(doc, ex.Expression); result.Found {
+				result.Value = jsonPathString(value)
+			}
+
+		case ex.Type == "xpath":
+			result.Value, result.Found, err = evalXPath(resp.body, ex.Expression)
+
+		case ex.Type == "regex":
+			var re *regexp.Regexp
+
+			if re, err = regexp.Compile(ex.Expression); err != nil {
+				err = fmt.Errorf("invalid pattern: %w", err)
+				break
+			}
+
+			// the first capture group, or else the whole match
+			if match := re.FindSubmatch(resp.body); match != nil {
+				result.Value, result.Found = string(match[min(1, len(match)-1)]), true
+			}
+
+		default:
+			err = fmt.Errorf("unknown extractor type %q", ex.Type)
+		}
+
+		switch {
+		case err != nil:
+			result.Found = false
+			result.Message = err.Error()
+
+		case !result.Found:
+			result.Message = "no match"
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// xmlNode is an element of a parsed XML document; the document itself is
+// a node without name.
+type xmlNode struct {
+	name  string
+	attrs []xml.Attr
+
+	children []*xmlNode
+
+	// character data and child elements in document order, for the
+	// string value
+	content []any
+}
+
+// text returns the string value of the node: all character data of the
+// node and its descendants.
+func (n *xmlNode) text() string {
+	var b strings.Builder
+
+	var walk func(*xmlNode)
+
+	walk = func(n *xmlNode) {
+		for _, c := range n.content {
+			switch c := c.(type) {
+			case string:
+				b.WriteString(c)
+			case *xmlNode:
+				walk(c)
+			}
+		}
+	}
+
+	walk(n)
+
+	return b.String()
+}
+
+func (n *xmlNode) attr(name string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// descendants returns the elements nested in n in document order.
+func (n *xmlNode) descendants() []*xmlNode {
+	var result []*xmlNode
+
+	for _, c := range n.children {
+		result = append(result, c)
+		result = append(result, c.descendants()...)
+	}
+
+	return result
+}
+
+func parseXMLDocument(data []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	doc := &xmlNode{}
+	stack := []*xmlNode{doc}
+
+	for {
+		token, err := decoder.Token()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+
+			parent.children = append(parent.children, node)
+			parent.content = append(parent.content, node)
+
+			stack = append(stack, node)
+
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case xml.CharData:
+			parent.content = append(parent.content, string(t))
+		}
+	}
+
+	if len(doc.children) == 0 {
+		return nil, errors.New("no root element")
+	}
+
+	return doc, nil
+}
+
+// evalXPath evaluates an XPath subset against an XML document and returns
+// the string value of the first match. Supported are child (/) and
+// descendant (//) steps with element names or *, the predicates [n],
+// [last()], [@attr], [@attr='value'] and [child='value'], and a final
+// @attr or text() step.
+func evalXPath(data []byte, expr string) (string, bool, error) {
+	doc, err := parseXMLDocument(data)
+
+	if err != nil {
+		return "", false, fmt.Errorf("response body is not XML: %w", err)
+	}
+
+	nodes := []*xmlNode{doc}
+
+	rest := strings.TrimSpace(expr)
+
+	if rest == "" {
+		return "", false, fmt.Errorf("invalid xpath %q", expr)
+	}
+
+	for rest != "" {
+		descendant := false
+
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			descendant, rest = true, rest[2:]
+		case strings.HasPrefix(rest, "/"):
+			rest = rest[1:]
+		}
+
+		step, remaining, err := cutXPathStep(rest)
+
+		if err != nil {
+			return "", false, fmt.Errorf("invalid xpath %q: %w", expr, err)
+		}
+
+		rest = remaining
+
+		switch {
+		case strings.HasPrefix(step, "@"):
+			if rest != "" {
+				return "", false, fmt.Errorf("invalid xpath %q: attribute step must be last", expr)
+			}
+
+			for _, node := range xpathAxis(nodes, descendant, true) {
+				if value, ok := node.attr(step[1:]); ok {
+					return value, true, nil
+				}
+			}
+
+			return "", false, nil
+
+		case step == "text()":
+			if rest != "" {
+				return "", false, fmt.Errorf("invalid xpath %q: text() must be last", expr)
+			}
+
+			for _, node := range xpathAxis(nodes, descendant, true) {
+				if node.name != "" {
+					return node.text(), true, nil
+				}
+			}
+
+			return "", false, nil
+		}
+
+		name, predicates, err := splitXPathPredicates(step)
+
+		if err != nil {
+			return "", false, fmt.Errorf("invalid xpath %q: %w", expr, err)
+		}
+
+		var next []*xmlNode
+
+		for _, node := range nodes {
+			var candidates []*xmlNode
+
+			for _, c := range xpathAxis([]*xmlNode{node}, descendant, false) {
+				if name == "*" || c.name == name {
+					candidates = append(candidates, c)
+				}
+			}
+
+			for _, predicate := range predicates {
+				if candidates, err = applyXPathPredicate(candidates, predicate); err != nil {
+					return "", false, fmt.Errorf("invalid xpath %q: %w", expr, err)
+				}
+			}
+
+			next = append(next, candidates...)
+		}
+
+		if nodes = next; len(nodes) == 0 {
+			return "", false, nil
+		}
+	}
+
+	return nodes[0].text(), true, nil
+}
+
+// xpathAxis returns the children of nodes, or all their descendants; with
+// self the nodes themselves come first.
+func xpathAxis(nodes []*xmlNode, descendant, self bool) []*xmlNode {
+	var result []*xmlNode
+
+	for _, node := range nodes {
+		if self {
+			result = append(result, node)
+
+			if !descendant {
+				continue
+			}
+		}
+
+		if descendant {
+			result = append(result, node.descendants()...)
+		} else {
+			result = append(result, node.children...)
+		}
+	}
+
+	return result
+}
+
+// cutXPathStep splits the next step off an expression, keeping slashes
+// inside predicates.
+func cutXPathStep(expr string) (string, string, error) {
+	depth := 0
+	quote := byte(0)
+
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '/' && depth == 0:
+			if i == 0 {
+				return "", "", errors.New("empty step")
+			}
+
+			return expr[:i], expr[i:], nil
+		}
+	}
+
+	if expr == "" {
+		return "", "", errors.New("empty step")
+	}
+
+	return expr, "", nil
+}
+
+// splitXPathPredicates splits "name[p1][p2]" into the name and the
+// predicate expressions.
+func splitXPathPredicates(step string) (string, []string, error) {
+	name, rest, _ := strings.Cut(step, "[")
+
+	if name == "" || strings.ContainsAny(name, "]()@=") {
+		return "", nil, fmt.Errorf("invalid step %q", step)
+	}
+
+	rest = step[len(name):]
+
+	var predicates []string
+
+	for rest != "" {
+		if rest[0] != '[' {
+			return "", nil, fmt.Errorf("invalid step %q", step)
+		}
+
+		end := strings.Index(rest, "]")
+
+		if end < 0 {
+			return "", nil, fmt.Errorf("unterminated predicate in %q", step)
+		}
+
+		predicates = append(predicates, strings.TrimSpace(rest[1:end]))
+
+		rest = rest[end+1:]
+	}
+
+	return name, predicates, nil
+}
+
+func applyXPathPredicate(nodes []*xmlNode, predicate string) ([]*xmlNode, error) {
+	if predicate == "last()" {
+		if len(nodes) == 0 {
+			return nil, nil
+		}
+
+		return nodes[len(nodes)-1:], nil
+	}
+
+	if n, err := strconv.Atoi(predicate); err == nil {
+		if n < 1 || n > len(nodes) {
+			return nil, nil
+		}
+
+		return nodes[n-1 : n], nil
+	}
+
+	left, right, hasValue := strings.Cut(predicate, "=")
+
+	left = strings.TrimSpace(left)
+	right = strings.TrimSpace(right)
+
+	if hasValue {
+		unquoted, ok := unquoteXPath(right)
+
+		if !ok {
+			return nil, fmt.Errorf("unsupported predicate [%s]", predicate)
+		}
+
+		right = unquoted
+	}
+
+	var result []*xmlNode
+
+	for _, node := range nodes {
+		var values []string
+
+		if attr, ok := strings.CutPrefix(left, "@"); ok {
+			if value, ok := node.attr(attr); ok {
+				values = append(values, value)
+			}
+		} else {
+			for _, c := range node.children {
+				if c.name == left {
+					values = append(values, c.text())
+				}
+			}
+		}
+
+		for _, value := range values {
+			if !hasValue || value == right {
+				result = append(result, node)
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func unquoteXPath(value string) (string, bool) {
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1], true
+	}
+
+	return "", false
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// harFile is an HTTP Archive as exported by browser DevTools; only the
+// request side of each entry is read.
+type harFile struct {
+	Log *struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+
+	Request harRequest `json:"request"`
+}
+
+type harRequest struct {
+	Method  string    `json:"method"`
+	URL     string    `json:"url"`
+	Headers []harPair `json:"headers"`
+
+	PostData *struct {
+		MimeType string    `json:"mimeType"`
+		Text     string    `json:"text"`
+		Params   []harPair `json:"params"`
+	} `json:"postData"`
+}
+
+type harPair struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	FileName string `json:"fileName"`
+}
+
+// harSkippedHeaders are set by the transport when the request is sent.
+var harSkippedHeaders = map[string]bool{
+	"host":              true,
+	"content-length":    true,
+	"connection":        true,
+	"transfer-encoding": true,
+}
+
+// parseHAR converts the http(s) requests of a HAR file; other entries
+// (data: URLs, extensions, WebSockets) are counted as skipped.
+func parseHAR(data []byte) ([]*Request, int, error) {
+	var har harFile
+
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, 0, fmt.Errorf("invalid HAR: %w", err)
+	}
+
+	if har.Log == nil {
+		return nil, 0, errors.New("invalid HAR: missing log")
+	}
+
+	requests := []*Request{}
+	skipped := 0
+
+	for _, entry := range har.Log.Entries {
+		request, ok := harToRequest(&entry)
+
+		if !ok {
+			skipped++
+			continue
+		}
+
+		requests = append(requests, request)
+	}
+
+	return requests, skipped, nil
+}
+
+func harToRequest(entry *harEntry) (*Request, bool) {
+	u, err := url.Parse(entry.Request.URL)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, false
+	}
+
+	for _, h := range entry.Request.Headers {
+		if strings.EqualFold(h.Name, "Upgrade") {
+			return nil, false
+		}
+	}
+
+	query := splitQuery(u.RawQuery)
+
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	method := strings.ToUpper(entry.Request.Method)
+
+	if method == "" {
+		method = "GET"
+	}
+
+	body := RequestBody{Type: "none"}
+
+	if pd := entry.Request.PostData; pd != nil {
+		body = harRequestBody(pd.MimeType, pd.Text, pd.Params)
+	}
+
+	headers := []KeyValue{}
+
+	for _, h := range entry.Request.Headers {
+		name := strings.ToLower(h.Name)
+
+		// HTTP/2 pseudo headers and transport-managed headers
+		if strings.HasPrefix(name, ":") || harSkippedHeaders[name] {
+			continue
+		}
+
+		// the multipart boundary is generated when sending
+		if body.Type == "form-data" && name == "content-type" {
+			continue
+		}
+
+		headers = append(headers, KeyValue{ID: newRequestID(), Enabled: true, Key: h.Name, Value: h.Value})
+	}
+
+	created := entry.StartedDateTime
+
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	return &Request{
+		ID:   newRequestID(),
+		Name: method + " " + u.Host + u.Path,
+
+		Variables: []Variable{},
+
+		CreationTime: created.UnixMilli(),
+
+		HTTP: &HTTPSettings{
+			Method: method,
+			URL:    u.String(),
+
+			Query:   query,
+			Headers: headers,
+			Body:    body,
+
+			Options: HTTPOptions{Redirect: true},
+		},
+	}, true
+}
+
+// harRequestBody picks the body type for post data based on its MIME type.
+func harRequestBody(mimeType, text string, params []harPair) RequestBody {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		var fields []FormField
+
+		if len(params) == 0 {
+			for _, pair := range splitQuery(text) {
+				fields = append(fields, FormField{ID: pair.ID, Enabled: true, Key: pair.Key, Value: pair.Value})
+			}
+		}
+
+		for _, p := range params {
+			fields = append(fields, FormField{ID: newRequestID(), Enabled: true, Key: p.Name, Value: p.Value})
+		}
+
+		return RequestBody{Type: "form-urlencoded", Data: fields}
+
+	case mediaType == "multipart/form-data" && len(params) > 0:
+		var fields []FormField
+
+		for _, p := range params {
+			field := FormField{ID: newRequestID(), Enabled: true, Key: p.Name, Type: "text", Value: p.Value}
+
+			// browsers don't record file contents
+			if p.FileName != "" {
+				field.Type = "file"
+				field.Value = ""
+				field.FileName = path.Base(strings.ReplaceAll(p.FileName, `\`, "/"))
+			}
+
+			fields = append(fields, field)
+		}
+
+		return RequestBody{Type: "form-data", Data: fields}
+
+	case text == "":
+		return RequestBody{Type: "none"}
+
+	case strings.Contains(mediaType, "json"):
+		return RequestBody{Type: "json", Content: text}
+
+	case strings.Contains(mediaType, "xml"):
+		return RequestBody{Type: "xml", Content: text}
+	}
+
+	return RequestBody{Type: "raw", Content: text}
+}
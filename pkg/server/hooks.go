@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// redactedValue replaces the values of redacted headers.
+const redactedValue = "[redacted]"
+
+// loadHooks returns the enabled hooks of the workspace, validated.
+func loadHooks(ctx context.Context) ([]Hook, error) {
+	settings, err := loadWorkspaceSettings(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []Hook
+
+	for i, hook := range settings.Hooks {
+		if hook.Disabled {
+			continue
+		}
+
+		if err := validateHook(&hook); err != nil {
+			name := hook.Name
+
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+
+			return nil, fmt.Errorf("hook %s: %w", name, err)
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, nil
+}
+
+func validateHook(hook *Hook) error {
+	switch hook.Phase {
+	case "":
+		hook.Phase = "request"
+	case "request", "response":
+	default:
+		return fmt.Errorf("invalid phase %q", hook.Phase)
+	}
+
+	switch hook.Action {
+	case "setHeader", "removeHeader", "redactHeader":
+		if hook.Header == "" {
+			return fmt.Errorf("%s requires a header", hook.Action)
+		}
+
+	case "rewriteHost":
+		if hook.Phase != "request" {
+			return fmt.Errorf("rewriteHost applies to requests only")
+		}
+
+		if hook.Value == "" || strings.ContainsAny(hook.Value, "/?#@ ") {
+			return fmt.Errorf("invalid host %q", hook.Value)
+		}
+
+	default:
+		return fmt.Errorf("unknown action %q", hook.Action)
+	}
+
+	return nil
+}
+
+// matches tells whether the hook applies to requests for host.
+func (hook *Hook) matches(host string) bool {
+	if hook.Match == "" {
+		return true
+	}
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	host = strings.ToLower(host)
+	pattern := strings.ToLower(hook.Match)
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+
+	return host == pattern
+}
+
+// redactedHeaders returns the headers the hooks of phase redact for host.
+func redactedHeaders(hooks []Hook, phase, host string) []string {
+	var names []string
+
+	for _, hook := range hooks {
+		if hook.Action == "redactHeader" && hook.Phase == phase && hook.matches(host) {
+			name := http.CanonicalHeaderKey(hook.Header)
+
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// redactHeader returns a copy of header with the values of names masked.
+func redactHeader(header http.Header, names []string) http.Header {
+	if len(names) == 0 {
+		return header
+	}
+
+	header = header.Clone()
+
+	for _, name := range names {
+		if values := header.Values(name); len(values) > 0 {
+			header[http.CanonicalHeaderKey(name)] = slices.Repeat([]string{redactedValue}, len(values))
+		}
+	}
+
+	return header
+}
+
+// hookTransport runs the hooks around every round trip, redirect hops
+// and retries included.
+type hookTransport struct {
+	base  http.RoundTripper
+	hooks []Hook
+}
+
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	req = req.Clone(req.Context())
+
+	for _, hook := range t.hooks {
+		if hook.Phase != "request" || !hook.matches(host) {
+			continue
+		}
+
+		switch hook.Action {
+		case "setHeader":
+			req.Header.Set(hook.Header, expandVariables(hook.Value, nil, nil, nil))
+
+		case "removeHeader":
+			req.Header.Del(hook.Header)
+
+		case "rewriteHost":
+			// an explicit Host header is kept
+			if req.Host == "" || req.Host == req.URL.Host {
+				req.Host = hook.Value
+			}
+
+			req.URL.Host = hook.Value
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range t.hooks {
+		if hook.Phase != "response" || !hook.matches(host) {
+			continue
+		}
+
+		switch hook.Action {
+		case "setHeader":
+			resp.Header.Set(hook.Header, expandVariables(hook.Value, nil, nil, nil))
+
+		case "removeHeader":
+			resp.Header.Del(hook.Header)
+
+		case "redactHeader":
+			resp.Header = redactHeader(resp.Header, []string{hook.Header})
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,482 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// insomniaExport is an Insomnia v4 export file; resources are told apart by
+// their _type.
+type insomniaExport struct {
+	Type   string `json:"_type"`
+	Format int    `json:"__export_format"`
+
+	Resources []insomniaResource `json:"resources"`
+}
+
+type insomniaResource struct {
+	ID       string `json:"_id"`
+	ParentID string `json:"parentId"`
+	Type     string `json:"_type"`
+	Name     string `json:"name"`
+
+	// request and grpc_request
+	Method     string         `json:"method"`
+	URL        string         `json:"url"`
+	Body       insomniaBody   `json:"body"`
+	Parameters []insomniaPair `json:"parameters"`
+	Headers    []insomniaPair `json:"headers"`
+	Auth       insomniaAuth   `json:"authentication"`
+	Metadata   []insomniaPair `json:"metadata"`
+
+	ProtoMethodName string `json:"protoMethodName"`
+
+	// environment and request_group
+	Data        map[string]any `json:"data"`
+	Environment map[string]any `json:"environment"`
+}
+
+type insomniaBody struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	FileName string         `json:"fileName"`
+	Params   []insomniaPair `json:"params"`
+}
+
+type insomniaPair struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled"`
+
+	// multipart params
+	Type     string `json:"type"`
+	FileName string `json:"fileName"`
+}
+
+type insomniaAuth struct {
+	Type     string `json:"type"`
+	Disabled bool   `json:"disabled"`
+
+	Token  string `json:"token"`
+	Prefix string `json:"prefix"`
+
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	AddTo string `json:"addTo"`
+}
+
+// insomniaGRPC mirrors the stored gRPC settings (GrpcSettings in
+// src/lib/data.ts).
+type insomniaGRPC struct {
+	URL      string     `json:"url"`
+	Body     string     `json:"body"`
+	Metadata []KeyValue `json:"metadata"`
+}
+
+// insomniaTemplateRegex matches {{ _.name }} and legacy {{ name }} variable
+// tags; other Nunjucks tags ({% ... %}) are left alone.
+var insomniaTemplateRegex = regexp.MustCompile(`\{\{\s*(?:_\.)?([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+// insomniaImport converts the resources of an Insomnia export into requests
+// and folders. Environment variables are substituted: the base environment,
+// overlaid with the sub environment named environment (if any) and the
+// environments of the enclosing request groups.
+type insomniaImport struct {
+	resources map[string]*insomniaResource
+
+	// variables of the base and selected sub environment
+	variables map[string]string
+
+	Requests []*Request
+	Folders  []DataFolder
+
+	// folder ID keyed by request ID
+	Entries map[string]string
+
+	Items []InsomniaImportItem
+}
+
+func parseInsomnia(data []byte, environment string) (*insomniaImport, error) {
+	var export insomniaExport
+
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid export: %w", err)
+	}
+
+	if export.Type != "export" || export.Format != 4 {
+		return nil, errors.New("not an Insomnia v4 export")
+	}
+
+	imp := &insomniaImport{
+		resources: map[string]*insomniaResource{},
+		variables: map[string]string{},
+
+		Requests: []*Request{},
+		Folders:  []DataFolder{},
+		Entries:  map[string]string{},
+		Items:    []InsomniaImportItem{},
+	}
+
+	for i := range export.Resources {
+		res := &export.Resources[i]
+		imp.resources[res.ID] = res
+	}
+
+	if err := imp.selectEnvironment(export.Resources, environment); err != nil {
+		return nil, err
+	}
+
+	// folder ID keyed by request group ID, assigned upfront so parents
+	// listed after their children resolve
+	folderIDs := map[string]string{}
+
+	for _, res := range export.Resources {
+		if res.Type == "request_group" {
+			folderIDs[res.ID] = newRequestID()
+		}
+	}
+
+	for _, res := range export.Resources {
+		item := InsomniaImportItem{
+			ID:   res.ID,
+			Type: res.Type,
+			Name: res.Name,
+
+			Status: "imported",
+		}
+
+		switch res.Type {
+		case "workspace", "environment":
+			// environments were applied by selectEnvironment
+			continue
+
+		case "request_group":
+			imp.Folders = append(imp.Folders, DataFolder{
+				ID:     folderIDs[res.ID],
+				Name:   res.Name,
+				Parent: folderIDs[res.ParentID],
+			})
+
+		case "request", "grpc_request":
+			request, notes := imp.request(&res)
+
+			item.RequestID = request.ID
+			item.Notes = notes
+
+			imp.Requests = append(imp.Requests, request)
+
+			if folder := folderIDs[res.ParentID]; folder != "" {
+				imp.Entries[request.ID] = folder
+			}
+
+		default:
+			item.Status = "skipped"
+			item.Notes = []string{"unsupported resource type"}
+		}
+
+		imp.Items = append(imp.Items, item)
+	}
+
+	return imp, nil
+}
+
+// selectEnvironment collects the variables of the base environments and of
+// the sub environment named name.
+func (imp *insomniaImport) selectEnvironment(resources []insomniaResource, name string) error {
+	var base, selected []*insomniaResource
+
+	for i := range resources {
+		res := &resources[i]
+
+		if res.Type != "environment" {
+			continue
+		}
+
+		if parent := imp.resources[res.ParentID]; parent != nil && parent.Type == "environment" {
+			if name != "" && res.Name == name {
+				selected = append(selected, res)
+			}
+
+			continue
+		}
+
+		base = append(base, res)
+	}
+
+	if name != "" && len(selected) == 0 {
+		return fmt.Errorf("environment %q not found", name)
+	}
+
+	for _, env := range slices.Concat(base, selected) {
+		flattenInsomniaVariables(imp.variables, "", env.Data)
+	}
+
+	return nil
+}
+
+// flattenInsomniaVariables adds the values of data keyed by their dotted
+// path ("api.host").
+func flattenInsomniaVariables(variables map[string]string, prefix string, data map[string]any) {
+	for key, value := range data {
+		name := key
+
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]any:
+			flattenInsomniaVariables(variables, name, v)
+
+		case string:
+			variables[name] = v
+
+		case float64:
+			variables[name] = strconv.FormatFloat(v, 'f', -1, 64)
+
+		case nil:
+			variables[name] = ""
+
+		default:
+			data, _ := json.Marshal(v)
+			variables[name] = string(data)
+		}
+	}
+}
+
+// requestVariables returns the variables in effect for a request: the
+// selected environment overlaid with those of its request groups.
+func (imp *insomniaImport) requestVariables(res *insomniaResource) map[string]string {
+	var groups []*insomniaResource
+
+	for parent := imp.resources[res.ParentID]; parent != nil && parent.Type == "request_group"; parent = imp.resources[parent.ParentID] {
+		if slices.Contains(groups, parent) {
+			break
+		}
+
+		groups = append(groups, parent)
+	}
+
+	variables := maps.Clone(imp.variables)
+
+	// outermost group first, so inner groups win
+	for _, group := range slices.Backward(groups) {
+		flattenInsomniaVariables(variables, "", group.Environment)
+	}
+
+	return variables
+}
+
+// request converts a request or grpc_request resource; notes list what
+// could not be carried over.
+func (imp *insomniaImport) request(res *insomniaResource) (*Request, []string) {
+	var notes []string
+
+	variables := imp.requestVariables(res)
+
+	unresolved := map[string]bool{}
+
+	render := func(s string) string {
+		return insomniaTemplateRegex.ReplaceAllStringFunc(s, func(match string) string {
+			name := insomniaTemplateRegex.FindStringSubmatch(match)[1]
+
+			if value, ok := variables[name]; ok {
+				return value
+			}
+
+			unresolved[name] = true
+			return match
+		})
+	}
+
+	pairs := func(items []insomniaPair) []KeyValue {
+		result := []KeyValue{}
+
+		for _, p := range items {
+			if p.Name == "" && p.Value == "" {
+				continue
+			}
+
+			result = append(result, KeyValue{ID: newRequestID(), Enabled: !p.Disabled, Key: render(p.Name), Value: render(p.Value)})
+		}
+
+		return result
+	}
+
+	request := &Request{
+		ID:   newRequestID(),
+		Name: res.Name,
+
+		Variables: []Variable{},
+
+		CreationTime: time.Now().UnixMilli(),
+	}
+
+	if res.Type == "grpc_request" {
+		target := render(res.URL)
+
+		if !strings.Contains(target, "://") {
+			target = "grpc://" + target
+		}
+
+		settings, _ := json.Marshal(insomniaGRPC{
+			URL:      strings.TrimSuffix(target, "/") + "/" + strings.TrimPrefix(res.ProtoMethodName, "/"),
+			Body:     render(res.Body.Text),
+			Metadata: pairs(res.Metadata),
+		})
+
+		request.GRPC = settings
+	} else {
+		target := render(res.URL)
+
+		query := []KeyValue{}
+
+		if base, rawQuery, ok := strings.Cut(target, "?"); ok {
+			target = base
+			query = splitQuery(rawQuery)
+		}
+
+		headers := pairs(res.Headers)
+
+		method := strings.ToUpper(res.Method)
+
+		if method == "" {
+			method = "GET"
+		}
+
+		body, bodyNotes := insomniaRequestBody(res.Body, render)
+		notes = append(notes, bodyNotes...)
+
+		if res.Body.MimeType == "application/graphql" && !slices.ContainsFunc(headers, func(h KeyValue) bool {
+			return strings.EqualFold(h.Key, "Content-Type")
+		}) {
+			headers = append(headers, KeyValue{ID: newRequestID(), Enabled: true, Key: "Content-Type", Value: "application/json"})
+		}
+
+		auth, inQuery, authNote := insomniaAuthentication(res.Auth, render)
+
+		switch {
+		case authNote != "":
+			notes = append(notes, authNote)
+		case auth == nil:
+		case inQuery:
+			query = append(query, *auth)
+		default:
+			headers = append(headers, *auth)
+		}
+
+		request.HTTP = &HTTPSettings{
+			Method: method,
+			URL:    target,
+
+			Query:   append(query, pairs(res.Parameters)...),
+			Headers: headers,
+			Body:    body,
+
+			Options: HTTPOptions{Redirect: true},
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(unresolved)) {
+		notes = append(notes, fmt.Sprintf("variable %q not defined", name))
+	}
+
+	return request, notes
+}
+
+// insomniaRequestBody converts an Insomnia body by its MIME type. GraphQL
+// bodies are already the JSON document ({"query": ..., "variables": ...})
+// sent over the wire.
+func insomniaRequestBody(body insomniaBody, render func(string) string) (RequestBody, []string) {
+	mimeType := strings.ToLower(body.MimeType)
+
+	switch {
+	case mimeType == "" && body.Text == "":
+		return RequestBody{Type: "none"}, nil
+
+	case mimeType == "application/x-www-form-urlencoded":
+		var fields []FormField
+
+		for _, p := range body.Params {
+			fields = append(fields, FormField{ID: newRequestID(), Enabled: !p.Disabled, Key: render(p.Name), Value: render(p.Value)})
+		}
+
+		return RequestBody{Type: "form-urlencoded", Data: fields}, nil
+
+	case mimeType == "multipart/form-data":
+		var fields []FormField
+		var notes []string
+
+		for _, p := range body.Params {
+			field := FormField{ID: newRequestID(), Enabled: !p.Disabled, Key: render(p.Name), Type: "text", Value: render(p.Value)}
+
+			if p.Type == "file" {
+				field.Type = "file"
+				field.Value = ""
+				field.FileName = path.Base(p.FileName)
+
+				notes = append(notes, fmt.Sprintf("file of form field %q must be selected again", p.Name))
+			}
+
+			fields = append(fields, field)
+		}
+
+		return RequestBody{Type: "form-data", Data: fields}, notes
+
+	case body.FileName != "":
+		return RequestBody{Type: "binary", FileName: path.Base(body.FileName)}, []string{"body file must be selected again"}
+
+	case mimeType == "application/graphql" || strings.Contains(mimeType, "json"):
+		return RequestBody{Type: "json", Content: render(body.Text)}, nil
+
+	case strings.Contains(mimeType, "xml"):
+		return RequestBody{Type: "xml", Content: render(body.Text)}, nil
+	}
+
+	return RequestBody{Type: "raw", Content: render(body.Text)}, nil
+}
+
+// insomniaAuthentication converts the supported authentication types into
+// a header, or a query parameter for API keys added to the query. For other
+// types it returns a note instead.
+func insomniaAuthentication(auth insomniaAuth, render func(string) string) (*KeyValue, bool, string) {
+	if auth.Type == "" || auth.Type == "none" || auth.Disabled {
+		return nil, false, ""
+	}
+
+	pair := func(key, value string) *KeyValue {
+		return &KeyValue{ID: newRequestID(), Enabled: true, Key: key, Value: value}
+	}
+
+	switch auth.Type {
+	case "bearer":
+		prefix := auth.Prefix
+
+		if prefix == "" {
+			prefix = "Bearer"
+		}
+
+		return pair("Authorization", prefix+" "+render(auth.Token)), false, ""
+
+	case "basic":
+		credentials := render(auth.Username) + ":" + render(auth.Password)
+		return pair("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials))), false, ""
+
+	case "apikey":
+		return pair(render(auth.Key), render(auth.Value)), auth.AddTo == "queryParams", ""
+	}
+
+	return nil, false, fmt.Sprintf("%s authentication not supported", auth.Type)
+}
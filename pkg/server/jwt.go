@@ -0,0 +1,477 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// jwtToken is a compact JWS split into its parts.
+type jwtToken struct {
+	header    map[string]any
+	rawHeader []byte
+	rawClaims []byte
+	signature []byte
+
+	// signingInput is "header.claims" as it appears in the token
+	signingInput string
+}
+
+func parseJWT(token string) (*jwtToken, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+
+	if len(parts) != 3 {
+		return nil, errors.New("token must have three dot-separated parts")
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid header encoding: %w", err)
+	}
+
+	var header map[string]any
+
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims encoding: %w", err)
+	}
+
+	if !json.Valid(rawClaims) {
+		return nil, errors.New("claims are not JSON")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	return &jwtToken{
+		header:    header,
+		rawHeader: rawHeader,
+		rawClaims: rawClaims,
+		signature: signature,
+
+		signingInput: parts[0] + "." + parts[1],
+	}, nil
+}
+
+func (t *jwtToken) algorithm() string {
+	alg, _ := t.header["alg"].(string)
+	return alg
+}
+
+func (t *jwtToken) keyID() string {
+	kid, _ := t.header["kid"].(string)
+	return kid
+}
+
+// jwtHash returns the digest an algorithm signs with.
+func jwtHash(alg string) (crypto.Hash, error) {
+	if alg == "EdDSA" {
+		return 0, nil
+	}
+
+	if len(alg) != 5 {
+		return 0, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	switch alg[:2] {
+	case "HS", "RS", "PS", "ES":
+	default:
+		return 0, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, nil
+	case "384":
+		return crypto.SHA384, nil
+	case "512":
+		return crypto.SHA512, nil
+	}
+
+	return 0, fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+func digest(hash crypto.Hash, data string) []byte {
+	h := hash.New()
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+// verifyJWS checks signature over input with key, which is a []byte secret
+// for HS* or a public key otherwise.
+func verifyJWS(alg, input string, signature []byte, key any) error {
+	hash, err := jwtHash(alg)
+
+	if err != nil {
+		return err
+	}
+
+	errSignature := errors.New("signature does not match")
+
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+
+		if !ok {
+			return errors.New("HMAC algorithms need a shared secret")
+		}
+
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(input))
+
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errSignature
+		}
+
+		return nil
+
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+
+		if !ok {
+			return fmt.Errorf("%s needs an RSA key", alg)
+		}
+
+		if alg[0] == 'P' {
+			err = rsa.VerifyPSS(pub, hash, digest(hash, input), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		} else {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest(hash, input), signature)
+		}
+
+		if err != nil {
+			return errSignature
+		}
+
+		return nil
+
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+
+		if !ok {
+			return fmt.Errorf("%s needs an EC key", alg)
+		}
+
+		size := (pub.Curve.Params().BitSize + 7) / 8
+
+		if len(signature) != 2*size {
+			return errSignature
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		if !ecdsa.Verify(pub, digest(hash, input), r, s) {
+			return errSignature
+		}
+
+		return nil
+	}
+
+	// EdDSA
+	pub, ok := key.(ed25519.PublicKey)
+
+	if !ok {
+		return errors.New("EdDSA needs an Ed25519 key")
+	}
+
+	if !ed25519.Verify(pub, []byte(input), signature) {
+		return errSignature
+	}
+
+	return nil
+}
+
+// signJWS signs input with key, which is a []byte secret for HS* or a
+// private key otherwise.
+func signJWS(alg, input string, key any) ([]byte, error) {
+	hash, err := jwtHash(alg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+
+		if !ok {
+			return nil, errors.New("HMAC algorithms need a shared secret")
+		}
+
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(input))
+
+		return mac.Sum(nil), nil
+
+	case "RS", "PS":
+		priv, ok := key.(*rsa.PrivateKey)
+
+		if !ok {
+			return nil, fmt.Errorf("%s needs an RSA private key", alg)
+		}
+
+		if alg[0] == 'P' {
+			return rsa.SignPSS(rand.Reader, priv, hash, digest(hash, input), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+
+		return rsa.SignPKCS1v15(rand.Reader, priv, hash, digest(hash, input))
+
+	case "ES":
+		priv, ok := key.(*ecdsa.PrivateKey)
+
+		if !ok {
+			return nil, fmt.Errorf("%s needs an EC private key", alg)
+		}
+
+		if bits := priv.Curve.Params().BitSize; min(bits, 512) != hash.Size()*8 {
+			return nil, fmt.Errorf("%s cannot be used with a P-%d key", alg, bits)
+		}
+
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest(hash, input))
+
+		if err != nil {
+			return nil, err
+		}
+
+		// JWS uses the fixed-size r || s form, not ASN.1
+		size := (priv.Curve.Params().BitSize + 7) / 8
+		signature := make([]byte, 2*size)
+
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+
+		return signature, nil
+	}
+
+	// EdDSA
+	priv, ok := key.(ed25519.PrivateKey)
+
+	if !ok {
+		return nil, errors.New("EdDSA needs an Ed25519 private key")
+	}
+
+	return ed25519.Sign(priv, []byte(input)), nil
+}
+
+// parsePEMKey reads the first key or certificate of a PEM bundle and
+// returns a public key, or a private key when private is set.
+func parsePEMKey(data string, private bool) (any, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(data)))
+
+	if block == nil {
+		return nil, errors.New("key is neither PEM nor JWK")
+	}
+
+	var key any
+	var err error
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if signer, ok := key.(crypto.Signer); ok && !private {
+		return signer.Public(), nil
+	}
+
+	if private {
+		if _, ok := key.(crypto.Signer); !ok {
+			return nil, errors.New("a private key is required for signing")
+		}
+	}
+
+	return key, nil
+}
+
+// jwk is a JSON Web Key (RFC 7517) with the members needed for verifying.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	// oct
+	K string `json:"k"`
+}
+
+// publicKey converts the JWK into a verification key.
+func (k *jwk) publicKey() (any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+
+		e, err := decode(k.E)
+
+		if err != nil || len(e) > 4 {
+			return nil, errors.New("invalid exponent")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decode(k.X)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+
+		y, err := decode(k.Y)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid coordinate length")
+		}
+
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decode(k.X)
+
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+
+	case "oct":
+		return decode(k.K)
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// parseJWKs accepts a JWK set or a single JWK.
+func parseJWKs(data []byte) ([]jwk, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %w", err)
+	}
+
+	if set.Keys != nil {
+		return set.Keys, nil
+	}
+
+	var key jwk
+
+	if err := json.Unmarshal(data, &key); err != nil || key.Kty == "" {
+		return nil, errors.New("invalid JWK: missing kty")
+	}
+
+	return []jwk{key}, nil
+}
+
+// jwkMatches reports whether a key may verify a token with alg and kid.
+func jwkMatches(k *jwk, alg, kid string) bool {
+	if kid != "" && k.Kid != "" && k.Kid != kid {
+		return false
+	}
+
+	if k.Use != "" && k.Use != "sig" {
+		return false
+	}
+
+	if k.Alg != "" && k.Alg != alg {
+		return false
+	}
+
+	switch k.Kty {
+	case "RSA":
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case "EC":
+		return strings.HasPrefix(alg, "ES")
+	case "OKP":
+		return alg == "EdDSA"
+	case "oct":
+		return strings.HasPrefix(alg, "HS")
+	}
+
+	return false
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// keychainService names the entries of prism in the OS credential store.
+const keychainService = "prism"
+
+// keychainMaxValue bounds a keychain value; Windows Credential Manager
+// takes at most 2560 bytes.
+const keychainMaxValue = 2560
+
+var errKeychainUnavailable = errors.New("no OS keychain available")
+
+// secretProvider stores secrets outside the data directory. get fails with
+// errSecretNotFound for unknown names.
+type secretProvider interface {
+	available() bool
+
+	get(name string) (string, error)
+	set(name, value string) error
+	delete(name string) error
+}
+
+// keychain is the credential store of the operating system (macOS
+// Keychain, Windows Credential Manager, libsecret); requests reference its
+// values as {{keychain:name}}.
+var keychain secretProvider = osKeychain{}
+
+// noKeychain stands in for the keychain where it must not be used.
+type noKeychain struct{}
+
+func (noKeychain) available() bool {
+	return false
+}
+
+func (noKeychain) get(name string) (string, error) {
+	return "", errKeychainUnavailable
+}
+
+func (noKeychain) set(name, value string) error {
+	return errKeychainUnavailable
+}
+
+func (noKeychain) delete(name string) error {
+	return errKeychainUnavailable
+}
+
+// userKeychain returns the keychain of the server. Serving other machines or
+// users, there is none: the OS keychain belongs to the account the server
+// runs as, and its entries would be shared by everyone.
+func (s *Server) userKeychain() secretProvider {
+	if cfg := s.config.Load(); cfg.Remote || cfg.User != "" {
+		return noKeychain{}
+	}
+
+	return keychain
+}
+
+// checkKeychainValue rejects values the credential stores cannot hold.
+func checkKeychainValue(value string) error {
+	if len(value) > keychainMaxValue {
+		return errors.New("value too large for the keychain")
+	}
+
+	if !utf8.ValidString(value) {
+		return errors.New("value is not valid UTF-8")
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// osKeychain keeps generic passwords in the login keychain through the
+// security tool. Values are written through its interactive mode, hex
+// encoded, so they never show up in the process list.
+type osKeychain struct{}
+
+func (osKeychain) available() bool {
+	_, err := exec.LookPath("security")
+	return err == nil
+}
+
+func (k osKeychain) get(name string) (string, error) {
+	out, err := k.run(nil, "find-generic-password", "-s", keychainService, "-a", name, "-w")
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func (k osKeychain) set(name, value string) error {
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", keychainService, name, hex.EncodeToString([]byte(value)))
+
+	_, err := k.run(strings.NewReader(command), "-i")
+	return err
+}
+
+func (k osKeychain) delete(name string) error {
+	_, err := k.run(nil, "delete-generic-password", "-s", keychainService, "-a", name)
+	return err
+}
+
+func (osKeychain) run(stdin *strings.Reader, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil, errKeychainUnavailable
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("security", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+
+		if strings.Contains(message, "could not be found") {
+			return nil, errSecretNotFound
+		}
+
+		if message == "" {
+			message = err.Error()
+		}
+
+		return nil, errors.New("keychain: " + message)
+	}
+
+	// the interactive mode exits cleanly and reports failures on stderr
+	if message := strings.TrimSpace(stderr.String()); message != "" && stdin != nil {
+		return nil, errors.New("keychain: " + message)
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// osKeychain keeps secrets in the Secret Service (GNOME Keyring, KWallet)
+// through the secret-tool of libsecret. Values are passed on stdin so they
+// never show up in the process list.
+type osKeychain struct{}
+
+func (osKeychain) available() bool {
+	_, err := exec.LookPath("secret-tool")
+	return err == nil
+}
+
+func (k osKeychain) get(name string) (string, error) {
+	out, err := k.run(nil, "lookup", "service", keychainService, "name", name)
+
+	if err != nil {
+		return "", err
+	}
+
+	// lookup succeeds without output for unknown attributes on older
+	// versions
+	if len(out) == 0 {
+		return "", errSecretNotFound
+	}
+
+	return string(out), nil
+}
+
+func (k osKeychain) set(name, value string) error {
+	_, err := k.run(strings.NewReader(value), "store", "--label", keychainService+": "+name, "service", keychainService, "name", name)
+	return err
+}
+
+func (k osKeychain) delete(name string) error {
+	if _, err := k.get(name); err != nil {
+		return err
+	}
+
+	_, err := k.run(nil, "clear", "service", keychainService, "name", name)
+	return err
+}
+
+func (osKeychain) run(stdin io.Reader, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, errKeychainUnavailable
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+
+		// lookup exits with 1 and no message for unknown attributes
+		if message == "" && args[0] == "lookup" {
+			return nil, errSecretNotFound
+		}
+
+		if message == "" {
+			message = err.Error()
+		}
+
+		return nil, errors.New("keychain: " + message)
+	}
+
+	return stdout.Bytes(), nil
+}
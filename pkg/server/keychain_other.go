@@ -0,0 +1,23 @@
+//go:build !darwin && !linux && !windows
+
+package server
+
+// osKeychain is unavailable on platforms without a supported credential
+// store.
+type osKeychain struct{}
+
+func (osKeychain) available() bool {
+	return false
+}
+
+func (osKeychain) get(name string) (string, error) {
+	return "", errKeychainUnavailable
+}
+
+func (osKeychain) set(name, value string) error {
+	return errKeychainUnavailable
+}
+
+func (osKeychain) delete(name string) error {
+	return errKeychainUnavailable
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32 = syscall.NewLazyDLL("advapi32.dll")
+
+	procCredReadW   = advapi32.NewProc("CredReadW")
+	procCredWriteW  = advapi32.NewProc("CredWriteW")
+	procCredDeleteW = advapi32.NewProc("CredDeleteW")
+	procCredFree    = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errCredNotFound         = syscall.Errno(1168)
+)
+
+// credential is the CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// osKeychain keeps generic credentials named prism:<name> in the Windows
+// Credential Manager.
+type osKeychain struct{}
+
+func (osKeychain) available() bool {
+	return advapi32.Load() == nil
+}
+
+func (osKeychain) get(name string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(keychainService + ":" + name)
+
+	if err != nil {
+		return "", err
+	}
+
+	var cred *credential
+
+	if r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); r == 0 {
+		return "", keychainError(err)
+	}
+
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func (osKeychain) set(name, value string) error {
+	target, err := syscall.UTF16PtrFromString(keychainService + ":" + name)
+
+	if err != nil {
+		return err
+	}
+
+	user, err := syscall.UTF16PtrFromString(name)
+
+	if err != nil {
+		return err
+	}
+
+	cred := credential{
+		Type:       credTypeGeneric,
+		TargetName: target,
+		UserName:   user,
+		Persist:    credPersistLocalMachine,
+	}
+
+	blob := []byte(value)
+
+	if len(blob) > 0 {
+		cred.CredentialBlobSize = uint32(len(blob))
+		cred.CredentialBlob = &blob[0]
+	}
+
+	if r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); r == 0 {
+		return keychainError(err)
+	}
+
+	return nil
+}
+
+func (osKeychain) delete(name string) error {
+	target, err := syscall.UTF16PtrFromString(keychainService + ":" + name)
+
+	if err != nil {
+		return err
+	}
+
+	if r, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); r == 0 {
+		return keychainError(err)
+	}
+
+	return nil
+}
+
+func keychainError(err error) error {
+	if errors.Is(err, errCredNotFound) {
+		return errSecretNotFound
+	}
+
+	return errors.New("keychain: " + err.Error())
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// withRequestLimit rejects bodies of /proxy and /data requests beyond the
+// configured MaxRequestSize; larger bodies are staged with POST /uploads.
+func (s *Server) withRequestLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := s.config.Load().MaxRequestSize
+
+		proxied := strings.HasPrefix(r.URL.Path, "/proxy/")
+
+		if limit <= 0 || r.Body == nil || (!proxied && !strings.HasPrefix(r.URL.Path, "/data/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > limit {
+			message := fmt.Sprintf("request body exceeds %d bytes", limit)
+
+			if proxied {
+				setCORSHeaders(w.Header())
+				writeProxyError(w, http.StatusRequestEntityTooLarge, errors.New(message+", stage it with POST /uploads"))
+				return
+			}
+
+			http.Error(w, message, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// proxyTransport returns the transport of proxied HTTP requests: that of
+// opts, restricted to the allowed targets and bounded by the configured
+// MaxConcurrentRequests and RateLimit.
+func (s *Server) proxyTransport(opts upstreamOptions) http.RoundTripper {
+	return &targetTransport{
+		base: &limitTransport{
+			base:   s.transport(opts),
+			server: s,
+		},
+
+		server: s,
+		opts:   opts,
+	}
+}
+
+// limitTransport paces requests by host and holds a slot of the concurrent
+// requests until the response body is closed. Every round trip counts, so
+// redirects and retries do, too.
+type limitTransport struct {
+	base   http.RoundTripper
+	server *Server
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.server.waitRateLimit(req.Context(), req.URL.Host); err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	release, err := t.server.acquireOutbound(req.Context())
+
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	// upgraded connections need their body to stay an io.ReadWriteCloser
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		release()
+		return resp, nil
+	}
+
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: sync.OnceFunc(release)}
+
+	return resp, nil
+}
+
+// releaseBody releases the slot of its request once closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// closeRequestBody closes the body of a request a RoundTripper fails
+// without sending, as RoundTrip must.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// acquireOutbound waits for a slot of the concurrent outbound requests and
+// returns the func releasing it.
+func (s *Server) acquireOutbound(ctx context.Context) (func(), error) {
+	if s.outbound == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case s.outbound <- struct{}{}:
+		return func() { <-s.outbound }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitRateLimit waits until a request to host fits the configured
+// RateLimit.
+func (s *Server) waitRateLimit(ctx context.Context, host string) error {
+	rate := s.config.Load().RateLimit
+
+	if rate <= 0 {
+		return nil
+	}
+
+	value, _ := s.rateLimits.LoadOrStore(strings.ToLower(host), &tokenBucket{})
+	bucket := value.(*tokenBucket)
+
+	delay := bucket.reserve(rate, time.Now())
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		bucket.cancel()
+		return ctx.Err()
+	}
+}
+
+// tokenBucket refills at rate tokens per second, holding up to a second's
+// worth (at least one), so short bursts pass unpaced.
+type tokenBucket struct {
+	mu sync.Mutex
+
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token and returns how long to wait for it; waiting
+// requests queue up behind each other.
+func (b *tokenBucket) reserve(rate float64, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	burst := max(rate, 1)
+
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// cancel returns the token of a reservation not waited for.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens++
+}
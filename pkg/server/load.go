@@ -0,0 +1,258 @@
+package server
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBucketBase is the ratio between neighbouring histogram buckets.
+const latencyBucketBase = 1.01
+
+// latencyHistogram records latencies in logarithmic buckets about 1% wide,
+// so percentiles take constant memory however long a test runs.
+type latencyHistogram struct {
+	counts map[int]int64
+
+	count         int64
+	sum, min, max float64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: map[int]int64{}}
+}
+
+// record adds a latency in milliseconds.
+func (h *latencyHistogram) record(ms float64) {
+	micros := max(ms*1000, 1)
+
+	h.counts[int(math.Ceil(math.Log(micros)/math.Log(latencyBucketBase)))]++
+
+	if h.count == 0 || ms < h.min {
+		h.min = ms
+	}
+
+	if ms > h.max {
+		h.max = ms
+	}
+
+	h.count++
+	h.sum += ms
+}
+
+// summary returns the recorded latencies; a percentile is the upper bound
+// of its bucket.
+func (h *latencyHistogram) summary() LoadTestLatency {
+	if h.count == 0 {
+		return LoadTestLatency{}
+	}
+
+	buckets := make([]int, 0, len(h.counts))
+
+	for bucket := range h.counts {
+		buckets = append(buckets, bucket)
+	}
+
+	slices.Sort(buckets)
+
+	percentile := func(p float64) float64 {
+		rank := int64(math.Ceil(p / 100 * float64(h.count)))
+
+		var seen int64
+
+		for _, bucket := range buckets {
+			if seen += h.counts[bucket]; seen >= rank {
+				return min(math.Round(math.Pow(latencyBucketBase, float64(bucket)))/1000, h.max)
+			}
+		}
+
+		return h.max
+	}
+
+	return LoadTestLatency{
+		Min:  h.min,
+		Mean: math.Round(h.sum/float64(h.count)*1000) / 1000,
+		P50:  percentile(50),
+		P95:  percentile(95),
+		P99:  percentile(99),
+		Max:  h.max,
+	}
+}
+
+// loadStats aggregates the outcomes of a load test's requests.
+type loadStats struct {
+	mu sync.Mutex
+
+	start time.Time
+
+	requests int64
+	failed   int64
+
+	latency *latencyHistogram
+
+	statuses map[string]int64
+	failures map[string]int64
+
+	steps []*loadStepStats
+
+	// requests and time of the last progress snapshot
+	lastRequests int64
+	lastTime     time.Time
+}
+
+type loadStepStats struct {
+	id   string
+	name string
+
+	requests int64
+	failed   int64
+
+	latency *latencyHistogram
+}
+
+func newLoadStats(entries []runEntry) *loadStats {
+	stats := &loadStats{
+		latency: newLatencyHistogram(),
+
+		statuses: map[string]int64{},
+		failures: map[string]int64{},
+	}
+
+	for _, entry := range entries {
+		stats.steps = append(stats.steps, &loadStepStats{
+			id:   entry.id,
+			name: entry.name,
+
+			latency: newLatencyHistogram(),
+		})
+	}
+
+	return stats
+}
+
+// begin marks the start of the test.
+func (s *loadStats) begin(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.start = now
+	s.lastTime = now
+}
+
+// record adds the outcome of request step of the scenario. Requests
+// without response, with an error status or failed assertions count as
+// failed.
+func (s *loadStats) record(step int, result *RunRequestResult) {
+	reason := loadFailure(result)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stepStats := s.steps[step]
+
+	s.requests++
+	stepStats.requests++
+
+	if result.Status != 0 {
+		s.statuses[strconv.Itoa(result.Status)]++
+	}
+
+	if reason != "" {
+		s.failed++
+		stepStats.failed++
+
+		s.failures[reason]++
+	}
+
+	// latencies of requests without response would skew the percentiles
+	if result.Error == "" {
+		s.latency.record(result.Duration)
+		stepStats.latency.record(result.Duration)
+	}
+}
+
+// loadFailure names why a request failed, empty when it did not.
+func loadFailure(result *RunRequestResult) string {
+	if result.Error != "" {
+		return "error: " + shorten(result.Error, 120)
+	}
+
+	for _, assertion := range result.Assertions {
+		if !assertion.Passed {
+			return "assertion: " + assertion.Message
+		}
+	}
+
+	if result.Status >= 400 {
+		return "status: " + strconv.Itoa(result.Status)
+	}
+
+	return ""
+}
+
+// snapshot returns the statistics so far with the throughput since the
+// last snapshot.
+func (s *loadStats) snapshot(now time.Time) LoadTestStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.statsLocked(now)
+
+	if interval := now.Sub(s.lastTime).Seconds(); interval > 0 {
+		stats.Throughput = float64(s.requests-s.lastRequests) / interval
+	}
+
+	s.lastRequests = s.requests
+	s.lastTime = now
+
+	return stats
+}
+
+// report returns the final statistics with the overall throughput.
+func (s *loadStats) report(now time.Time) LoadTestReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := LoadTestReport{
+		LoadTestStats: s.statsLocked(now),
+
+		Steps: []LoadTestStep{},
+	}
+
+	if report.Elapsed > 0 {
+		report.Throughput = float64(s.requests) / report.Elapsed
+	}
+
+	for _, step := range s.steps {
+		report.Steps = append(report.Steps, LoadTestStep{
+			ID:   step.id,
+			Name: step.name,
+
+			Requests: step.requests,
+			Failed:   step.failed,
+
+			Latency: step.latency.summary(),
+		})
+	}
+
+	return report
+}
+
+func (s *loadStats) statsLocked(now time.Time) LoadTestStats {
+	stats := LoadTestStats{
+		Elapsed: now.Sub(s.start).Seconds(),
+
+		Requests: s.requests,
+		Failed:   s.failed,
+
+		Latency: s.latency.summary(),
+
+		Statuses: maps.Clone(s.statuses),
+		Failures: maps.Clone(s.failures),
+	}
+
+	return stats
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bufio"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// withAccessLog logs the proxied requests with their target and duration,
+// and records them in the audit trail while auditing. Paths and queries are
+// left out as they may carry credentials.
+func (s *Server) withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || !(strings.HasPrefix(r.URL.Path, "/proxy/") || strings.HasPrefix(r.URL.Path, "/openai/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// handlers rewrite the URL in place
+		path := r.URL.Path
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		audit := s.auditing()
+
+		var request *bodyExcerpt
+
+		if audit && s.config.Load().AuditBodies {
+			request, rec.body = &bodyExcerpt{}, &bodyExcerpt{}
+
+			if r.Body != nil {
+				r.Body = &excerptBody{ReadCloser: r.Body, excerpt: request}
+			}
+		}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelWarn
+		}
+
+		s.logger.LogAttrs(r.Context(), level, "proxy",
+			slog.String("method", r.Method),
+			slog.String("protocol", proxyProtocol(path)),
+			slog.String("target", proxyTarget(path)),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+		)
+
+		if audit {
+			entry := AuditEntry{
+				Time:   start,
+				User:   s.config.Load().User,
+				Client: contextClient(r.Context()),
+
+				Method:   r.Method,
+				Protocol: proxyProtocol(path),
+				Target:   proxyTarget(path),
+
+				Status:   rec.status,
+				Bytes:    rec.bytes,
+				Duration: float64(time.Since(start).Microseconds()) / 1000,
+			}
+
+			if request != nil {
+				entry.RequestBody = request.String()
+				entry.ResponseBody = rec.body.String()
+			}
+
+			s.recordAudit(entry)
+		}
+	})
+}
+
+// proxyProtocol returns the protocol of a proxy path: http, grpc, mcp,
+// jsonrpc or openai.
+func proxyProtocol(path string) string {
+	if strings.HasPrefix(path, "/openai/") {
+		return "openai"
+	}
+
+	switch segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/proxy/"), "/"); segment {
+	case "grpc", "mcp", "jsonrpc":
+		return segment
+	}
+
+	return "http"
+}
+
+// proxyTarget returns scheme://host of a proxy path,
+// /proxy/[protocol/][ws/]{scheme}/{host}/...
+func proxyTarget(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/proxy/"), "/")
+
+	if len(segments) > 0 && proxyProtocol(path) != "http" {
+		segments = segments[1:]
+
+		if len(segments) > 0 && segments[0] == "ws" {
+			segments = segments[1:]
+		}
+	}
+
+	if len(segments) < 2 {
+		return ""
+	}
+
+	host, err := url.PathUnescape(segments[1])
+
+	if err != nil {
+		host = segments[1]
+	}
+
+	return segments[0] + "://" + host
+}
+
+// statusRecorder notes the status and size of a response. Flushing and
+// hijacking pass through for streams and WebSockets.
+type statusRecorder struct {
+	http.ResponseWriter
+
+	status int
+	bytes  int64
+
+	// excerpt of the body for the audit trail, nil if not recorded
+	body *bodyExcerpt
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	// informational responses precede the final one
+	if r.status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+
+	if r.body != nil {
+		r.body.Write(p[:n])
+	}
+
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
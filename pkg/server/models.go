@@ -1,13 +1,1359 @@
 package server
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
 
 type Config struct {
 	AI *AIConfig `json:"ai,omitempty"`
 }
 
 type AIConfig struct {
+	// Model is the model of the default provider.
 	Model string `json:"model,omitempty"`
+
+	// Provider names the default provider; requests to /openai/v1/ select
+	// another with X-Prism-AI-Provider.
+	Provider string `json:"provider,omitempty"`
+
+	Providers []AIProvider `json:"providers,omitempty"`
+}
+
+// AIProvider is a configured provider of the AI features, its credentials
+// left out.
+type AIProvider struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Model string `json:"model"`
+}
+
+// WorkspaceSettings holds workspace-wide defaults, stored as the
+// "workspace" entry of the settings data store.
+type WorkspaceSettings struct {
+	// Resolve pins hosts to addresses for all requests, curl --resolve
+	// style ("example.com:443:10.0.0.1", port "*" matches any port).
+	Resolve []string `json:"resolve,omitempty"`
+
+	// Defaults apply to every HTTP, gRPC and MCP request.
+	Defaults *WorkspaceDefaults `json:"defaults,omitempty"`
+
+	// Hooks change every proxied HTTP request and response, in order.
+	Hooks []Hook `json:"hooks,omitempty"`
+}
+
+// Hook is a step of the middleware chain of proxied HTTP requests. Phase is
+// "request" (default) or "response"; Match limits the hook to target hosts
+// ("api.example.com", "*.example.com"), empty matches all. Actions:
+//
+//   - setHeader: sets Header to Value, which may use dynamic variables
+//     ({{$uuid}} for a correlation ID)
+//   - removeHeader: removes Header
+//   - redactHeader: masks Header in captures and previews and lists it in
+//     X-Prism-Redacted so clients keep it out of their history; response
+//     headers are masked outright
+//   - rewriteHost: sends requests for the matched hosts to Value
+//     ("localhost:8080"), request phase only
+type Hook struct {
+	Name     string `json:"name,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+
+	Phase  string `json:"phase,omitempty"`
+	Match  string `json:"match,omitempty"`
+	Action string `json:"action"`
+
+	Header string `json:"header,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+// WorkspaceDefaults are applied to requests before they are dispatched;
+// a request opts out of Headers and Timeout with X-Prism-Defaults: false
+// (or the noDefaults option of a stored request).
+type WorkspaceDefaults struct {
+	// BaseURL is the {{baseUrl}} variable unless the environment defines
+	// one, and the base of relative URLs ("/users") of run requests.
+	// BaseURLs overrides it per environment ID.
+	BaseURL  string            `json:"baseUrl,omitempty"`
+	BaseURLs map[string]string `json:"baseUrls,omitempty"`
+
+	// Headers are added to requests that do not set them, e.g. a tenant
+	// ID or tracing header; values may reference variables.
+	Headers []KeyValue `json:"headers,omitempty"`
+
+	// Timeout in milliseconds applies to requests without X-Prism-Timeout.
+	Timeout int64 `json:"timeout,omitempty"`
+}
+
+// DataFolder groups entries of a data store; Parent is the ID of the
+// enclosing folder, empty at the root.
+type DataFolder struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Parent string `json:"parent,omitempty"`
+}
+
+// DataFolderRequest creates a folder (Name required) or renames and/or
+// moves one; fields left out are unchanged, Parent "" moves to the root.
+type DataFolderRequest struct {
+	Name   *string `json:"name,omitempty"`
+	Parent *string `json:"parent,omitempty"`
+}
+
+// DataFolderMove moves entries into Folder ("" for the root).
+type DataFolderMove struct {
+	Entries []string `json:"entries"`
+	Folder  string   `json:"folder"`
+}
+
+// DataEntryMeta describes an entry. Type ("http", "grpc", "mcp", "ws" or
+// "openai") is detected from the content when the entry is saved unless set
+// explicitly.
+type DataEntryMeta struct {
+	Type        string   `json:"type,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// DataEntryMetaUpdate changes the metadata of an entry; fields left out
+// are unchanged.
+type DataEntryMetaUpdate struct {
+	Type        *string   `json:"type,omitempty"`
+	Tags        *[]string `json:"tags,omitempty"`
+	Description *string   `json:"description,omitempty"`
+}
+
+// DataEntryTarget is where an entry is duplicated or moved to. Store
+// defaults to the entry's store; Folder ("" for the root) defaults to the
+// entry's folder within the same store and to the root of another store.
+type DataEntryTarget struct {
+	Store  string  `json:"store,omitempty"`
+	Folder *string `json:"folder,omitempty"`
+}
+
+// DataSearchResult is an entry matching a search (GET /data/search).
+type DataSearchResult struct {
+	Store string `json:"store"`
+	ID    string `json:"id"`
+
+	Updated *time.Time `json:"updated,omitempty"`
+
+	Snippets []DataSearchSnippet `json:"snippets"`
+}
+
+// DataSearchSnippet shows a match in the field at Path (a JSON path such
+// as "http.url", or "id" for the entry ID) with the text around it.
+type DataSearchSnippet struct {
+	Path string `json:"path"`
+
+	Before string `json:"before"`
+	Match  string `json:"match"`
+	After  string `json:"after"`
+}
+
+// Headers is a multi-valued header map. For compatibility it also accepts
+// plain string values ({"X-Foo": "bar"}) when decoding.
+type Headers map[string][]string
+
+func (h *Headers) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	result := make(Headers, len(raw))
+
+	for key, value := range raw {
+		var single string
+
+		if err := json.Unmarshal(value, &single); err == nil {
+			result[key] = []string{single}
+			continue
+		}
+
+		var multi []string
+
+		if err := json.Unmarshal(value, &multi); err != nil {
+			return fmt.Errorf("header %q: expected string or array of strings", key)
+		}
+
+		result[key] = multi
+	}
+
+	*h = result
+	return nil
+}
+
+// Request types mirror the stored format of the "requests" data store (see
+// SerializedRequest in src/lib/data.ts). Only HTTP settings are modeled;
+// other protocols are carried through untouched.
+
+type Request struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	Variables []Variable `json:"variables"`
+
+	CreationTime  int64  `json:"creationTime"`
+	ExecutionTime *int64 `json:"executionTime"`
+
+	HTTP   *HTTPSettings   `json:"http,omitempty"`
+	GRPC   json.RawMessage `json:"grpc,omitempty"`
+	MCP    json.RawMessage `json:"mcp,omitempty"`
+	OpenAI json.RawMessage `json:"openai,omitempty"`
+}
+
+type Variable struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+type HTTPSettings struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+
+	Query   []KeyValue  `json:"query"`
+	Headers []KeyValue  `json:"headers"`
+	Body    RequestBody `json:"body"`
+	Options HTTPOptions `json:"options"`
+
+	Response json.RawMessage `json:"response,omitempty"`
+
+	// Assertions are checked when the request is run (POST /runs).
+	Assertions []Assertion `json:"assertions,omitempty"`
+
+	// Extract captures response values into variables for the requests
+	// that follow in a run.
+	Extract []Extractor `json:"extract,omitempty"`
+
+	// Script is JavaScript run before the request is sent, once its
+	// variables are substituted: it may change the request, compute
+	// signatures and set variables, which fill the references still open
+	// and are seen by the requests that follow in a run.
+	Script string `json:"script,omitempty"`
+}
+
+type KeyValue struct {
+	ID      string `json:"id"`
+	Enabled bool   `json:"enabled"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+}
+
+// RequestBody is "none", "json", "xml", "raw" (Content), "form-urlencoded",
+// "form-data" (Data) or "binary" (FileName).
+type RequestBody struct {
+	Type string `json:"type"`
+
+	Content  string      `json:"content,omitempty"`
+	Data     []FormField `json:"data,omitempty"`
+	FileName string      `json:"fileName,omitempty"`
+}
+
+// FormField is a form body entry; Type ("text" or "file") is only set for
+// form-data bodies.
+type FormField struct {
+	ID       string `json:"id"`
+	Enabled  bool   `json:"enabled"`
+	Key      string `json:"key"`
+	Type     string `json:"type,omitempty"`
+	Value    string `json:"value"`
+	FileName string `json:"fileName,omitempty"`
+}
+
+type HTTPOptions struct {
+	Insecure bool `json:"insecure"`
+	Redirect bool `json:"redirect"`
+
+	// NoDefaults skips the headers and timeout of the workspace defaults.
+	NoDefaults bool `json:"noDefaults,omitempty"`
+}
+
+// CurlImport converts a curl command line into a Request, optionally saving
+// it to Store.
+type CurlImport struct {
+	Command string `json:"command"`
+
+	Name  string `json:"name,omitempty"`
+	Store string `json:"store,omitempty"`
+}
+
+// VersionInfo identifies the build of the server (GET /version). Commit
+// and Date are empty when unknown.
+type VersionInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	Date    string `json:"date,omitempty"`
+
+	Go   string `json:"go"`
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+}
+
+// UpdateCheck compares the version of this build with the latest release
+// (GET /version/check). Builds of no release are "dev" and never
+// Available. URL is the page of the release, Downloads are its files for
+// the platform of this build.
+type UpdateCheck struct {
+	Current string `json:"current"`
+	Latest  string `json:"latest,omitempty"`
+
+	Available bool `json:"available"`
+
+	URL       string           `json:"url,omitempty"`
+	Downloads []UpdateDownload `json:"downloads,omitempty"`
+
+	Published *time.Time `json:"published,omitempty"`
+	Checked   *time.Time `json:"checked,omitempty"`
+}
+
+type UpdateDownload struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Size int64  `json:"size"`
+}
+
+// UpdateInstall is the outcome of installing an update (POST
+// /version/update): Version replaced the executable or app bundle at Path
+// and runs once Prism is restarted.
+type UpdateInstall struct {
+	Version string `json:"version"`
+	Path    string `json:"path"`
+
+	Restart bool `json:"restart"`
+}
+
+// Workspace is a data root of its own: requests, environments, settings
+// and secrets are kept apart from those of the other workspaces. The
+// "default" workspace is the data directory itself.
+type Workspace struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+
+	Active bool `json:"active,omitempty"`
+}
+
+// WorkspaceSelection names the workspace to create (POST /workspaces) or
+// to switch to (PUT /workspaces/active).
+type WorkspaceSelection struct {
+	Name string `json:"name"`
+}
+
+// WorkspaceImportResult counts the entries of an imported workspace archive;
+// Skipped are existing entries kept by the merge strategy and files that
+// are no store entries.
+type WorkspaceImportResult struct {
+	Stores []string `json:"stores"`
+
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
+}
+
+// GitSyncStatus is the state of the git repository in the data directory
+// (GET /sync/git). Ahead and Behind count commits relative to the upstream
+// branch as of the last fetch; Conflicts lists files left unmerged by a
+// pull.
+type GitSyncStatus struct {
+	Initialized bool `json:"initialized"`
+
+	Branch string `json:"branch,omitempty"`
+	Remote string `json:"remote,omitempty"`
+
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+
+	AutoCommit bool `json:"autoCommit"`
+
+	Changes   []GitChange `json:"changes"`
+	Conflicts []string    `json:"conflicts"`
+
+	LastCommit *GitCommit `json:"lastCommit,omitempty"`
+}
+
+// GitChange is an uncommitted change: Status is "added", "modified",
+// "deleted", "renamed" or "untracked".
+type GitChange struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+type GitCommit struct {
+	Hash    string    `json:"hash"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// GitSyncSettings configures the repository (POST /sync/git/init, PATCH
+// /sync/git); fields left out are unchanged, Remote "" removes the remote.
+// With AutoCommit, changes to the data store are committed automatically.
+type GitSyncSettings struct {
+	Remote     *string `json:"remote,omitempty"`
+	AutoCommit *bool   `json:"autoCommit,omitempty"`
+}
+
+// GitCloneRequest clones URL into the (empty) data directory.
+type GitCloneRequest struct {
+	URL string `json:"url"`
+}
+
+type GitCommitRequest struct {
+	Message string `json:"message,omitempty"`
+}
+
+// RemoteSyncConfig mirrors the data directory to a WebDAV collection
+// (Provider "webdav", URL of the collection) or an S3-compatible bucket
+// (Provider "s3", URL of the endpoint, AWS when empty). Username and
+// Password are the WebDAV credentials or the S3 access key ID and secret
+// key; they may be secret references ({{secret:name}}). Literal
+// credentials are never returned, and are kept when updated with empty
+// ones.
+type RemoteSyncConfig struct {
+	Provider string `json:"provider"`
+	URL      string `json:"url,omitempty"`
+
+	Bucket string `json:"bucket,omitempty"`
+	Region string `json:"region,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// RemoteSyncStatus is the remote sync state (GET /sync/remote); Files
+// counts the files tracked since the last sync.
+type RemoteSyncStatus struct {
+	Configured bool `json:"configured"`
+
+	Config *RemoteSyncConfig `json:"config,omitempty"`
+
+	LastSync *time.Time `json:"lastSync,omitempty"`
+	Files    int        `json:"files"`
+}
+
+// RemoteSyncResult lists the files transferred by a push or pull, and
+// those changed on both sides since the last sync, which are left alone
+// unless forced.
+type RemoteSyncResult struct {
+	Uploaded   []string `json:"uploaded"`
+	Downloaded []string `json:"downloaded"`
+	Deleted    []string `json:"deleted"`
+
+	Conflicts []RemoteSyncConflict `json:"conflicts"`
+}
+
+type RemoteSyncConflict struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Environment is a set of variables stored under /data/environments.
+// Requests reference them as {{name}}; the active environment (or the one
+// named by X-Prism-Environment) is substituted server-side. Dynamic
+// variables such as {{$uuid}} or {{$randomInt(1,10)}} need no environment.
+type Environment struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+
+	Variables []EnvironmentVariable `json:"variables,omitempty"`
+}
+
+// EnvironmentVariable is a variable of an environment; its value may hold
+// secret references. Disabled variables are not substituted.
+type EnvironmentVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// EnvironmentSelection selects the active environment (GET/PUT
+// /environments/active); an empty ID deactivates it.
+type EnvironmentSelection struct {
+	ID string `json:"id"`
+}
+
+// EnvironmentResolveRequest substitutes the variables of Environment (the
+// active one when empty) in Text (POST /environments/resolve).
+type EnvironmentResolveRequest struct {
+	Environment string `json:"environment,omitempty"`
+
+	Text string `json:"text"`
+}
+
+// EnvironmentResolveResult is Text with the variables substituted, along
+// with the names of the variables found and of those without a value.
+type EnvironmentResolveResult struct {
+	Environment string `json:"environment,omitempty"`
+
+	Text string `json:"text"`
+
+	Variables  []string `json:"variables"`
+	Unresolved []string `json:"unresolved"`
+}
+
+// SecretsStatus describes the secrets store (GET /secrets). Values are
+// never listed; requests reference them as {{secret:name}}.
+type SecretsStatus struct {
+	Initialized bool `json:"initialized"`
+	Unlocked    bool `json:"unlocked"`
+
+	Secrets []SecretInfo `json:"secrets"`
+}
+
+type SecretInfo struct {
+	Name    string    `json:"name"`
+	Updated time.Time `json:"updated"`
+}
+
+// SecretsUnlock unlocks the secrets store, creating it with Passphrase if
+// there is none yet. With NewPassphrase (POST /secrets/passphrase) the
+// store is re-encrypted under the new passphrase.
+type SecretsUnlock struct {
+	Passphrase    string `json:"passphrase"`
+	NewPassphrase string `json:"newPassphrase,omitempty"`
+}
+
+type SecretValue struct {
+	Value string `json:"value"`
+}
+
+// KeychainStatus tells whether the OS credential store is available (GET
+// /keychain). Its entries cannot be listed; requests reference them as
+// {{keychain:name}}.
+type KeychainStatus struct {
+	Available bool `json:"available"`
+}
+
+// OpenAPISource names an OpenAPI 3.x document by exactly one of Document
+// (JSON or YAML text), URL or Upload (an ID from POST /uploads).
+type OpenAPISource struct {
+	Document string `json:"document,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Upload   string `json:"upload,omitempty"`
+}
+
+// HARImport converts the requests of a HAR file (Document, URL or Upload).
+// With a Store they are saved, grouped into a folder per host if asked to.
+type HARImport struct {
+	OpenAPISource
+
+	Store       string `json:"store,omitempty"`
+	GroupByHost bool   `json:"groupByHost,omitempty"`
+}
+
+// HARImportResult lists the converted requests; Skipped counts entries that
+// are no http(s) requests.
+type HARImportResult struct {
+	Requests []Request    `json:"requests"`
+	Folders  []DataFolder `json:"folders,omitempty"`
+
+	Skipped int `json:"skipped"`
+}
+
+// InsomniaImport converts an Insomnia v4 export (Document, URL or Upload)
+// into requests, substituting the variables of the base environment and of
+// the sub environment named Environment. With a Store the requests are
+// saved and request groups become folders.
+type InsomniaImport struct {
+	OpenAPISource
+
+	Environment string `json:"environment,omitempty"`
+	Store       string `json:"store,omitempty"`
+}
+
+type InsomniaImportResult struct {
+	Items []InsomniaImportItem `json:"items"`
+
+	Requests []Request    `json:"requests"`
+	Folders  []DataFolder `json:"folders"`
+}
+
+// InsomniaImportItem reports the import of one Insomnia resource. Status is
+// "imported" or "skipped"; Notes list what was not carried over.
+type InsomniaImportItem struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+
+	Status string   `json:"status"`
+	Notes  []string `json:"notes,omitempty"`
+
+	RequestID string `json:"requestId,omitempty"`
+}
+
+type OpenAPIImport struct {
+	OpenAPISource
+
+	// Materialize builds a Request per operation (limited to Operations if
+	// given) against BaseURL or the first server; Store also saves them.
+	Materialize bool     `json:"materialize,omitempty"`
+	Operations  []string `json:"operations,omitempty"`
+	BaseURL     string   `json:"baseUrl,omitempty"`
+	Store       string   `json:"store,omitempty"`
+}
+
+type OpenAPIImportResult struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+
+	Servers []string     `json:"servers"`
+	Tags    []OpenAPITag `json:"tags"`
+
+	Requests []Request `json:"requests,omitempty"`
+}
+
+type OpenAPITag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	Operations []OpenAPIOperation `json:"operations"`
+}
+
+// OpenAPIOperation is an operation with all local $refs resolved. ID is the
+// operationId, or "METHOD /path" when the document has none.
+type OpenAPIOperation struct {
+	ID     string `json:"id"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+
+	Summary     string   `json:"summary,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Deprecated  bool     `json:"deprecated,omitempty"`
+	Servers     []string `json:"servers,omitempty"`
+
+	Parameters    []OpenAPIParameter   `json:"parameters"`
+	RequestBodies []OpenAPIRequestBody `json:"requestBodies,omitempty"`
+	Responses     []OpenAPIResponse    `json:"responses"`
+	Security      []OpenAPISecurity    `json:"security"`
+}
+
+type OpenAPIParameter struct {
+	Name string `json:"name"`
+
+	// In is "path", "query", "header" or "cookie".
+	In string `json:"in"`
+
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+
+	Schema  any `json:"schema,omitempty"`
+	Example any `json:"example,omitempty"`
+}
+
+type OpenAPIRequestBody struct {
+	ContentType string `json:"contentType"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+
+	Schema  any `json:"schema,omitempty"`
+	Example any `json:"example,omitempty"`
+}
+
+type OpenAPIResponse struct {
+	Status      string `json:"status"`
+	Description string `json:"description,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+
+	Schema any `json:"schema,omitempty"`
+}
+
+// OpenAPISecurity is one security scheme an operation accepts.
+type OpenAPISecurity struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Scheme string   `json:"scheme,omitempty"`
+	In     string   `json:"in,omitempty"`
+	Param  string   `json:"param,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// ResponseValidation checks a response body against Schema (a JSON Schema)
+// or against the response OpenAPI defines for Operation and Status.
+type ResponseValidation struct {
+	Body        string `json:"body"`
+	ContentType string `json:"contentType,omitempty"`
+	Status      int    `json:"status,omitempty"`
+
+	Schema json.RawMessage `json:"schema,omitempty"`
+
+	OpenAPI *OpenAPISource `json:"openapi,omitempty"`
+
+	// Operation is an operationId or "METHOD /path", where the path may also
+	// be a concrete request path or URL ("GET https://api/v1/pets/42").
+	Operation string `json:"operation,omitempty"`
+}
+
+type ResponseValidationResult struct {
+	Valid bool `json:"valid"`
+
+	// Operation, Status and ContentType identify the OpenAPI response
+	// definition the body was checked against.
+	Operation   string `json:"operation,omitempty"`
+	Status      string `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+
+	Violations []SchemaViolation `json:"violations"`
+}
+
+type SchemaViolation struct {
+	// Path is a JSON pointer into the body ("" for the body itself).
+	Path    string `json:"path"`
+	Keyword string `json:"keyword"`
+	Message string `json:"message"`
+}
+
+// RequestGeneration asks an AI provider for a request body doing what Intent
+// tells. The body is described by one of Schema (a JSON Schema, such as the
+// input schema of an MCP tool), OpenAPI with Operation, or GRPC.
+type RequestGeneration struct {
+	Intent string `json:"intent"`
+
+	Schema json.RawMessage `json:"schema,omitempty"`
+
+	OpenAPI *OpenAPISource `json:"openapi,omitempty"`
+
+	// Operation is an operationId or "METHOD /path", as of
+	// ResponseValidation.
+	Operation string `json:"operation,omitempty"`
+
+	GRPC *RequestGenerationGRPC `json:"grpc,omitempty"`
+
+	// Provider names the AI provider, the default one if empty.
+	Provider string `json:"provider,omitempty"`
+}
+
+// RequestGenerationGRPC names the method whose input message is generated.
+// Its descriptors are taken from Protos or DescriptorSet, or else are those
+// known of Target (scheme://host): reflected before or uploaded.
+type RequestGenerationGRPC struct {
+	GRPCDescriptorUpload
+
+	Target string `json:"target,omitempty"`
+
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+// GeneratedRequest is a request body written by an AI provider and checked
+// against the schema; the provider is asked to correct violations. When it
+// keeps failing, Valid is false and Violations tell why.
+type GeneratedRequest struct {
+	// Body is the JSON written, null if it is none.
+	Body json.RawMessage `json:"body"`
+
+	Valid      bool              `json:"valid"`
+	Violations []SchemaViolation `json:"violations"`
+
+	// Operation identifies the OpenAPI operation or gRPC method.
+	Operation string `json:"operation,omitempty"`
+
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Attempts int    `json:"attempts"`
+}
+
+// Assertion is a check of a response. Type selects what is checked:
+// "status", "header" (Name), "body", "json" (the value at Path, a JSONPath
+// such as $.items[0].id) or "duration" (milliseconds). Operator is one of
+// equals (default; "2xx" matches a status class), notEquals, contains,
+// notContains, matches (a regular expression), exists, notExists,
+// lessThan, lessThanOrEqual, greaterThan and greaterThanOrEqual; duration
+// defaults to lessThan.
+type Assertion struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+
+	Operator string `json:"operator,omitempty"`
+	Value    string `json:"value,omitempty"`
+}
+
+// AssertionResult is the outcome of an assertion; Actual is the checked
+// value (shortened), Message explains a failure.
+type AssertionResult struct {
+	Assertion
+
+	Passed  bool   `json:"passed"`
+	Actual  string `json:"actual,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// AssertionRequest evaluates Assertions against a response received
+// elsewhere (POST /tools/assert), e.g. a gRPC or MCP result. Proxied HTTP
+// requests carry their assertions as X-Prism-Assert instead and get the
+// results as X-Prism-Assertions.
+type AssertionRequest struct {
+	Status   int     `json:"status,omitempty"`
+	Headers  Headers `json:"headers,omitempty"`
+	Body     string  `json:"body,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+
+	Assertions []Assertion `json:"assertions"`
+}
+
+type AssertionReport struct {
+	Passed bool `json:"passed"`
+
+	Results []AssertionResult `json:"results"`
+}
+
+// Extractor captures a value of a response into Variable. Type selects
+// how Expression is read: "json" (a JSONPath such as $.token), "xpath"
+// (e.g. //session/@id), "regex" (the first capture group, or else the
+// whole match) or "header" (a header name).
+type Extractor struct {
+	Variable string `json:"variable"`
+
+	Type       string `json:"type"`
+	Expression string `json:"expression"`
+}
+
+// ExtractionResult is the outcome of an extractor; Message explains why
+// nothing was found.
+type ExtractionResult struct {
+	Variable string `json:"variable"`
+
+	Value   string `json:"value,omitempty"`
+	Found   bool   `json:"found"`
+	Message string `json:"message,omitempty"`
+}
+
+// RunRequest runs stored HTTP requests in order (POST /runs): the entries
+// IDs of Store ("requests" when empty), or else those in Folder and its
+// subfolders ("" for the whole store) ordered by name. With Data, the
+// requests run once per data row, its fields overriding the variables of
+// Environment (the active one when empty); otherwise Iterations times.
+// Values extracted by a request are variables of the requests after it,
+// also in later iterations (data fields still win), but are not saved to
+// the environment.
+// Assertions apply to every request in addition to its own.
+type RunRequest struct {
+	Store  string   `json:"store,omitempty"`
+	IDs    []string `json:"ids,omitempty"`
+	Folder *string  `json:"folder,omitempty"`
+
+	Environment string   `json:"environment,omitempty"`
+	Data        *RunData `json:"data,omitempty"`
+	Iterations  int      `json:"iterations,omitempty"`
+
+	Assertions    []Assertion `json:"assertions,omitempty"`
+	StopOnFailure bool        `json:"stopOnFailure,omitempty"`
+}
+
+// SendRequest sends the stored request ID (or name) of Store ("requests"
+// when empty), or else the ad-hoc HTTP settings, with the variables of
+// Environment (ID or name; the active one when empty) (POST /send).
+type SendRequest struct {
+	Store string `json:"store,omitempty"`
+	ID    string `json:"id,omitempty"`
+
+	HTTP *HTTPSettings `json:"http,omitempty"`
+
+	Environment string `json:"environment,omitempty"`
+}
+
+// RunData is an iteration data file given as Document or Upload (an ID
+// from POST /uploads): CSV with a header row, or a JSON array of objects.
+// Format ("csv" or "json") is detected when empty.
+type RunData struct {
+	Document string `json:"document,omitempty"`
+	Upload   string `json:"upload,omitempty"`
+	Format   string `json:"format,omitempty"`
+}
+
+// RunResult aggregates a run; a request passes when it got a response and
+// all its assertions passed. Duration is in milliseconds.
+type RunResult struct {
+	Iterations int `json:"iterations"`
+
+	Requests int `json:"requests"`
+	Passed   int `json:"passed"`
+	Failed   int `json:"failed"`
+
+	Duration float64 `json:"duration"`
+
+	Results []RunIteration `json:"results"`
+}
+
+type RunIteration struct {
+	Iteration int               `json:"iteration"`
+	Data      map[string]string `json:"data,omitempty"`
+
+	Requests []RunRequestResult `json:"requests"`
+}
+
+// RunRequestResult is the outcome of one request of an iteration; Error
+// is set when no response was received.
+type RunRequestResult struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+
+	Status   int     `json:"status,omitempty"`
+	Size     int64   `json:"size"`
+	Duration float64 `json:"duration"`
+
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+
+	Assertions []AssertionResult  `json:"assertions"`
+	Extracted  []ExtractionResult `json:"extracted,omitempty"`
+}
+
+// LoadTestRequest fires Request, or else the stored requests IDs of Store
+// ("requests" when empty) in order as a scenario, from Concurrency virtual
+// users for Duration (e.g. "30s") or until MaxRequests were sent (POST
+// /run/load). Rate caps the requests per second across all users; zero is
+// unlimited. Values extracted by a request of the scenario are variables
+// of the user's later requests.
+type LoadTestRequest struct {
+	Store   string        `json:"store,omitempty"`
+	IDs     []string      `json:"ids,omitempty"`
+	Request *HTTPSettings `json:"request,omitempty"`
+
+	Environment string      `json:"environment,omitempty"`
+	Assertions  []Assertion `json:"assertions,omitempty"`
+
+	Concurrency int     `json:"concurrency,omitempty"`
+	Rate        float64 `json:"rate,omitempty"`
+	Duration    string  `json:"duration,omitempty"`
+	MaxRequests int     `json:"maxRequests,omitempty"`
+
+	// Interval between progress events when streamed (default "1s").
+	Interval string `json:"interval,omitempty"`
+}
+
+// LoadTestStats are the statistics of a load test so far. Throughput is in
+// requests per second: over the last interval while running, over the
+// whole test in the report. Failures counts failed requests by reason
+// (error, HTTP status or assertion); Statuses counts responses by status.
+type LoadTestStats struct {
+	Elapsed float64 `json:"elapsed"`
+
+	Requests   int64   `json:"requests"`
+	Failed     int64   `json:"failed"`
+	Throughput float64 `json:"throughput"`
+
+	Latency LoadTestLatency `json:"latency"`
+
+	Statuses map[string]int64 `json:"statuses"`
+	Failures map[string]int64 `json:"failures"`
+}
+
+// LoadTestLatency summarizes response times in milliseconds; percentiles
+// are accurate to about 1%.
+type LoadTestLatency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// LoadTestReport is the final result of a load test, with the statistics
+// of every request of the scenario in Steps.
+type LoadTestReport struct {
+	LoadTestStats
+
+	Steps []LoadTestStep `json:"steps"`
+}
+
+type LoadTestStep struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	Requests int64 `json:"requests"`
+	Failed   int64 `json:"failed"`
+
+	Latency LoadTestLatency `json:"latency"`
+}
+
+// Monitor runs stored requests on a schedule; monitors are stored under
+// /data/monitors. Schedule is a cron expression (minute, hour, day of
+// month, month, day of week) in local time, or a descriptor such as
+// @hourly or @every 5m. Run selects the requests like POST /runs (the
+// active environment when Environment is empty). Webhook is POSTed a
+// MonitorEvent when a run fails.
+type Monitor struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+
+	Schedule string `json:"schedule"`
+	Disabled bool   `json:"disabled,omitempty"`
+
+	Run     RunRequest `json:"run"`
+	Webhook string     `json:"webhook,omitempty"`
+}
+
+// MonitorResult is a recorded run of a monitor. It passed when every
+// request passed; Error is set when the run could not start.
+type MonitorResult struct {
+	Time     time.Time `json:"time"`
+	Duration float64   `json:"duration"`
+
+	Passed   bool `json:"passed"`
+	Requests int  `json:"requests"`
+	Failed   int  `json:"failed"`
+
+	Error        string `json:"error,omitempty"`
+	WebhookError string `json:"webhookError,omitempty"`
+
+	Results []RunIteration `json:"results,omitempty"`
+}
+
+// MonitorStatus is a monitor with its scheduling state and the statistics
+// of its history. Error is set when the schedule is invalid.
+type MonitorStatus struct {
+	Monitor
+
+	Error   string     `json:"error,omitempty"`
+	Running bool       `json:"running,omitempty"`
+	Next    *time.Time `json:"next,omitempty"`
+
+	Last  *MonitorResult `json:"last,omitempty"`
+	Stats MonitorStats   `json:"stats"`
+}
+
+// MonitorStats summarizes the runs within Window (e.g. "24h"). Uptime is
+// the share of passed runs in percent; Latency is the mean duration of a
+// request in milliseconds.
+type MonitorStats struct {
+	Window string `json:"window"`
+
+	Runs   int `json:"runs"`
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+
+	Uptime  float64 `json:"uptime"`
+	Latency float64 `json:"latency"`
+
+	LastFailure *time.Time `json:"lastFailure,omitempty"`
+}
+
+// MonitorEvent is the webhook payload of a failed monitor run, and the
+// data of the "monitor.result" event of every run.
+type MonitorEvent struct {
+	Monitor string `json:"monitor"`
+	Name    string `json:"name,omitempty"`
+
+	Result MonitorResult `json:"result"`
+}
+
+type SnippetRequest struct {
+	// Language is a snippet language ID (see GET /export/snippet).
+	Language string `json:"language"`
+
+	Request Request `json:"request"`
+}
+
+type Snippet struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+// RetryPolicy configures retries of proxied HTTP requests (X-Prism-Retry).
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, including the first.
+	Attempts int `json:"attempts"`
+
+	// Backoff is "constant", "linear" or "exponential" (default).
+	Backoff    string `json:"backoff,omitempty"`
+	DelayMS    int    `json:"delayMs,omitempty"`
+	MaxDelayMS int    `json:"maxDelayMs,omitempty"`
+
+	// Statuses to retry on; defaults to 429, 502, 503 and 504.
+	Statuses []int `json:"statuses,omitempty"`
+
+	// Network retries transport errors (connection refused, resets, ...).
+	Network bool `json:"network,omitempty"`
+
+	IgnoreRetryAfter bool `json:"ignoreRetryAfter,omitempty"`
+}
+
+type RetryAttempt struct {
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+	DelayMS    int64  `json:"delayMs,omitempty"`
+}
+
+// Capture holds the raw wire exchanges of a proxied request (X-Prism-Capture).
+type Capture struct {
+	ID string `json:"id"`
+
+	Exchanges []CaptureExchange `json:"exchanges"`
+}
+
+// CaptureExchange is one upstream round trip in HTTP/1.1 wire format
+// (base64 in JSON). Bodies are cut after 1 MiB, flagged by Truncated.
+type CaptureExchange struct {
+	Request  []byte `json:"request"`
+	Response []byte `json:"response,omitempty"`
+
+	Error     string `json:"error,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Preview is the upstream request a proxied call would send
+// (X-Prism-Dry-Run). Body is base64-encoded when BodyEncoding says so and is
+// cut after 1 MiB, flagged by Truncated.
+type Preview struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"`
+	Query  map[string][]string `json:"query"`
+
+	Headers Headers `json:"headers"`
+
+	Body         string `json:"body,omitempty"`
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+	BodySize     int64  `json:"bodySize"`
+	Truncated    bool   `json:"truncated,omitempty"`
+
+	// Proxy and Resolve are the connection settings the request would use.
+	Proxy    string   `json:"proxy,omitempty"`
+	Resolve  []string `json:"resolve,omitempty"`
+	Insecure bool     `json:"insecure,omitempty"`
+}
+
+// Download describes an upstream response body spooled to disk.
+type Download struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+
+	Status     string `json:"status"`
+	StatusCode int    `json:"statusCode"`
+
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	SHA256      string `json:"sha256"`
+}
+
+// Upload describes a request body staged on disk.
+type Upload struct {
+	ID string `json:"id"`
+
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+	SHA256      string `json:"sha256"`
+}
+
+// TLSCredential is named TLS material stored in the tls data store and
+// referenced via X-Prism-TLS. All certificates and keys are PEM.
+type TLSCredential struct {
+	// CA holds certificates trusted in addition to the system roots.
+	CA string `json:"ca,omitempty"`
+
+	// Certificate (chain) and Key authenticate the client (mutual TLS).
+	Certificate string `json:"certificate,omitempty"`
+	Key         string `json:"key,omitempty"`
+
+	// ServerName overrides the name used for SNI and verification.
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// OAuth2 types
+
+// OAuth2Credential is a named OAuth2 client stored in the oauth2 data store.
+// Its current token is kept by the server apart from the data store.
+type OAuth2Credential struct {
+	// Grant is "authorization_code" (with PKCE) or "client_credentials".
+	Grant string `json:"grant"`
+
+	AuthURL  string `json:"authUrl,omitempty"`
+	TokenURL string `json:"tokenUrl"`
+
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+type OAuth2Status struct {
+	Name  string `json:"name"`
+	Grant string `json:"grant"`
+
+	Scopes []string `json:"scopes,omitempty"`
+
+	Authorized  bool       `json:"authorized"`
+	Refreshable bool       `json:"refreshable"`
+	Expiry      *time.Time `json:"expiry,omitempty"`
+}
+
+type OAuth2Authorization struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	RedirectURL      string `json:"redirectUrl"`
+}
+
+// GRPCDescriptorUpload supplies descriptors for a server without reflection:
+// .proto sources keyed by file name, or a binary FileDescriptorSet.
+type GRPCDescriptorUpload struct {
+	Protos        map[string]string `json:"protos,omitempty"`
+	DescriptorSet []byte            `json:"descriptorSet,omitempty"`
+}
+
+// GRPCDescriptors summarizes the descriptors stored for a host.
+type GRPCDescriptors struct {
+	Host string `json:"host"`
+
+	Files    []string `json:"files"`
+	Services []string `json:"services"`
+
+	Updated *time.Time `json:"updated,omitempty"`
+}
+
+// GRPCHealth is the result of a health probe; Serving is set when every
+// probed service is SERVING.
+type GRPCHealth struct {
+	Serving  bool                `json:"serving"`
+	Services []GRPCServiceHealth `json:"services"`
+}
+
+// GRPCServiceHealth is the health of one service ("" is the server as a
+// whole): SERVING, NOT_SERVING, UNKNOWN or SERVICE_UNKNOWN, or an Error
+// when the probe failed. Updates lists the statuses seen while watching.
+type GRPCServiceHealth struct {
+	Service string   `json:"service"`
+	Status  string   `json:"status,omitempty"`
+	Updates []string `json:"updates,omitempty"`
+	Error   string   `json:"error,omitempty"`
+
+	DurationMS int64 `json:"durationMs"`
+}
+
+// GRPCProbe reports a connection attempt to a gRPC target: the connectivity
+// states it went through and, when it failed, the Stage it failed in
+// (network, tls or protocol).
+type GRPCProbe struct {
+	Target string `json:"target"`
+	State  string `json:"state"`
+
+	Transitions []GRPCStateTransition `json:"transitions"`
+
+	RemoteAddr string        `json:"remoteAddr,omitempty"`
+	TLS        *GRPCProbeTLS `json:"tls,omitempty"`
+
+	Stage string `json:"stage,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	ConnectMS  int64 `json:"connectMs,omitempty"`
+	DurationMS int64 `json:"durationMs"`
+}
+
+type GRPCStateTransition struct {
+	State string `json:"state"`
+	AtMS  int64  `json:"atMs"`
+}
+
+// GRPCProbeTLS describes the negotiated TLS session and the certificates
+// the server presented, leaf first.
+type GRPCProbeTLS struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipherSuite"`
+	ALPN        string `json:"alpn,omitempty"`
+	ServerName  string `json:"serverName,omitempty"`
+	Resumed     bool   `json:"resumed,omitempty"`
+
+	Certificates []GRPCProbeCertificate `json:"certificates,omitempty"`
+
+	HandshakeMS int64 `json:"handshakeMs"`
+}
+
+type GRPCProbeCertificate struct {
+	Subject  string   `json:"subject"`
+	Issuer   string   `json:"issuer"`
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// GRPCSample is a request skeleton for a method. Enums lists the allowed
+// values of each enum field, keyed by the dotted JSON path of the field.
+type GRPCSample struct {
+	Service   string `json:"service"`
+	Method    string `json:"method"`
+	InputType string `json:"inputType"`
+
+	Message json.RawMessage     `json:"message"`
+	Enums   map[string][]string `json:"enums,omitempty"`
+}
+
+// GRPCResponse is the JSON envelope of a gRPC call (X-Prism-Envelope): the
+// response message, or Messages of a server stream, together with the header
+// metadata and the final status (which carries the trailers). Encoding is
+// the compression of the responses ("identity" when uncompressed).
+type GRPCResponse struct {
+	Message   json.RawMessage   `json:"message,omitempty"`
+	Messages  []json.RawMessage `json:"messages,omitempty"`
+	Truncated bool              `json:"truncated,omitempty"`
+
+	Encoding string `json:"encoding,omitempty"`
+
+	Header map[string][]string `json:"header,omitempty"`
+	Status *GRPCStatus         `json:"status"`
+}
+
+// ProxyError is the body of a failed call of the proxy endpoints, marked by
+// the X-Prism-Error header carrying Code (e.g. dns_not_found, tls_certificate,
+// timeout, connection_refused, target_denied or invalid_request). Category
+// groups the codes: dns, tls, timeout, connection, protocol, denied,
+// canceled, request or internal. Retriable tells whether sending the call
+// again may succeed.
+type ProxyError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Category  string `json:"category"`
+	Retriable bool   `json:"retriable"`
+}
+
+// GRPCStatus is the outcome of a gRPC call: the body of a failed call, and
+// the end of a server stream relayed as Server-Sent Events ("status" event).
+// Error carries the rendered status details of a failed call.
+type GRPCStatus struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	// Category and Retriable classify a failed call like ProxyError.
+	Category  string `json:"category,omitempty"`
+	Retriable bool   `json:"retriable,omitempty"`
+
+	// Details are the decoded google.rpc.Status details, each with "@type".
+	Details []json.RawMessage `json:"details,omitempty"`
+
+	// DeadlineExceeded is set when the call ran out of its own deadline
+	// (X-Prism-Deadline or X-Prism-Timeout).
+	DeadlineExceeded bool `json:"deadlineExceeded,omitempty"`
+
+	Trailers map[string][]string `json:"trailers,omitempty"`
+}
+
+// GRPCStreamFrame is a message of the gRPC WebSocket bridge. Clients send an
+// optional "start" first (carrying Metadata), then "message" and finally
+// "end" to half-close; the server answers with "header", "message", "error"
+// (a client message that was rejected) and a final "status".
+type GRPCStreamFrame struct {
+	Type string `json:"type"`
+
+	Message  json.RawMessage     `json:"message,omitempty"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+
+	Status *GRPCStatus `json:"status,omitempty"`
+	Error  string      `json:"error,omitempty"`
 }
 
 type Reflection struct {
@@ -21,12 +1367,122 @@ type ServiceReflection struct {
 
 type MethodReflection struct {
 	Name            string                 `json:"name"`
+	InputType       string                 `json:"inputType,omitempty"`
+	OutputType      string                 `json:"outputType,omitempty"`
 	Schema          map[string]interface{} `json:"schema,omitempty"`
 	OutputSchema    map[string]interface{} `json:"outputSchema,omitempty"`
 	ClientStreaming bool                   `json:"clientStreaming,omitempty"`
 	ServerStreaming bool                   `json:"serverStreaming,omitempty"`
 }
 
+// JSON-RPC types
+
+// JsonRpcRequest lists the calls to send; several calls (or Batch) are sent
+// as one batch request.
+type JsonRpcRequest struct {
+	Calls []JsonRpcCall `json:"calls"`
+	Batch bool          `json:"batch,omitempty"`
+}
+
+type JsonRpcCall struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+
+	// Notification sends the call without an ID; no reply is expected.
+	Notification bool `json:"notification,omitempty"`
+}
+
+type JsonRpcResponse struct {
+	Status     string `json:"status"`
+	StatusCode int    `json:"statusCode"`
+
+	// Request is the envelope (or batch) as sent.
+	Request json.RawMessage `json:"request"`
+
+	Results []JsonRpcResult `json:"results"`
+
+	// Error and Body report a reply that is not valid JSON-RPC.
+	Error string `json:"error,omitempty"`
+	Body  string `json:"body,omitempty"`
+
+	DurationMS int64 `json:"durationMs"`
+}
+
+type JsonRpcResult struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *JsonRpcError   `json:"error,omitempty"`
+}
+
+type JsonRpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// JWT types
+
+type JWTDecode struct {
+	Token string `json:"token"`
+}
+
+// JWT is a decoded token; the times are read from the registered claims.
+type JWT struct {
+	Token string `json:"token,omitempty"`
+
+	Header    json.RawMessage `json:"header"`
+	Claims    json.RawMessage `json:"claims"`
+	Signature string          `json:"signature"`
+
+	Algorithm string `json:"algorithm,omitempty"`
+	KeyID     string `json:"keyId,omitempty"`
+
+	IssuedAt  *time.Time `json:"issuedAt,omitempty"`
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Expired   bool       `json:"expired"`
+}
+
+// JWTVerify checks a token against a shared Secret, a Key (PEM public key or
+// certificate, or a JWK / JWK set) or the keys published at JWKSURL.
+type JWTVerify struct {
+	Token string `json:"token"`
+
+	Secret       string `json:"secret,omitempty"`
+	SecretBase64 bool   `json:"secretBase64,omitempty"`
+
+	Key     string `json:"key,omitempty"`
+	JWKSURL string `json:"jwksUrl,omitempty"`
+
+	// Leeway is the clock skew in seconds tolerated for exp and nbf.
+	Leeway int64 `json:"leeway,omitempty"`
+}
+
+type JWTVerifyResult struct {
+	JWT
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// JWTSign mints a token from a claims template. iat defaults to now and
+// ExpiresIn (seconds) sets exp; Secret (HS*) or Key (PEM private key) signs.
+type JWTSign struct {
+	Algorithm string `json:"algorithm"`
+
+	Secret       string `json:"secret,omitempty"`
+	SecretBase64 bool   `json:"secretBase64,omitempty"`
+
+	Key   string `json:"key,omitempty"`
+	KeyID string `json:"keyId,omitempty"`
+
+	Header map[string]any  `json:"header,omitempty"`
+	Claims json.RawMessage `json:"claims,omitempty"`
+
+	ExpiresIn int64 `json:"expiresIn,omitempty"`
+}
+
 // MCP types
 
 type McpFeature struct {
@@ -47,18 +1503,177 @@ type McpListFeaturesResponse struct {
 }
 
 type McpListFeaturesRequest struct {
-	Headers map[string]string `json:"headers,omitempty"`
+	Headers Headers `json:"headers,omitempty"`
+}
+
+// McpServerInfo is what an MCP server reported when initializing. Sampling
+// tells whether Prism offers the sampling capability to the server.
+type McpServerInfo struct {
+	Name    string `json:"name,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Version string `json:"version,omitempty"`
+
+	ProtocolVersion string `json:"protocolVersion"`
+	Instructions    string `json:"instructions,omitempty"`
+
+	Capabilities *mcp.ServerCapabilities `json:"capabilities"`
+	Sampling     bool                    `json:"sampling"`
 }
 
 type McpCallToolRequest struct {
-	Name      string            `json:"name"`
-	Arguments map[string]any    `json:"arguments,omitempty"`
-	Headers   map[string]string `json:"headers,omitempty"`
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+	Headers   Headers        `json:"headers,omitempty"`
 }
 
 type McpReadResourceRequest struct {
-	URI     string            `json:"uri"`
-	Headers map[string]string `json:"headers,omitempty"`
+	URI     string  `json:"uri"`
+	Headers Headers `json:"headers,omitempty"`
+}
+
+// McpCompleteRequest asks for completions of Argument, given its partial
+// Value, of either a prompt or a resource template (URI). Arguments holds
+// the values already entered for the other arguments.
+type McpCompleteRequest struct {
+	Prompt string `json:"prompt,omitempty"`
+	URI    string `json:"uri,omitempty"`
+
+	Argument  string            `json:"argument"`
+	Value     string            `json:"value"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+
+	Headers Headers `json:"headers,omitempty"`
+}
+
+// McpServerDefinition is an MCP server of the configuration file (GET
+// /mcp/servers). Headers names the headers sent to it, their values staying
+// on the server.
+type McpServerDefinition struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	Headers []string `json:"headers"`
+}
+
+// McpSessionRequest opens a persistent MCP session (POST /mcp/sessions).
+// Server is a URL or the name of a configured server.
+type McpSessionRequest struct {
+	Server  string  `json:"server"`
+	Headers Headers `json:"headers,omitempty"`
+}
+
+// McpSession is a persistent MCP session. Its ID, sent as
+// X-Prism-Mcp-Session, routes the /proxy/mcp calls through it; sessions
+// idle for IdleTimeout seconds are closed.
+type McpSession struct {
+	ID     string `json:"id"`
+	Server string `json:"server"`
+
+	ServerName    string `json:"serverName,omitempty"`
+	ServerVersion string `json:"serverVersion,omitempty"`
+
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"lastUsed"`
+
+	IdleTimeout int64 `json:"idleTimeout"`
+}
+
+// ServerEvent is an event of GET /events: "run.started", "run.progress"
+// and "run.finished" (a RunEvent), "monitor.result" (a MonitorEvent),
+// "download.ready" (a Download), "mcp" (an McpSessionEvent), "data" (a
+// DataChange) or "config" (the Config of GET /config.json, after the
+// configuration file was reloaded).
+type ServerEvent struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	// workspace of data, run and monitor events, empty for those of the
+	// server
+	Workspace string `json:"workspace,omitempty"`
+
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// RunEvent reports the progress of a run started with POST /runs; Run is
+// its X-Prism-Request-Id. Progress events carry the Result of the request
+// just completed, Completed counting it.
+type RunEvent struct {
+	Run string `json:"run"`
+
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+
+	Iteration int               `json:"iteration,omitempty"`
+	Result    *RunRequestResult `json:"result,omitempty"`
+}
+
+// McpSessionEvent is a notification of the persistent MCP session Session.
+type McpSessionEvent struct {
+	Session string `json:"session"`
+
+	McpEvent
+}
+
+// DataChange tells that an entry of the data store was "saved" or
+// "deleted"; "folders" changes the folders of Store, "activated" the active
+// environment (ID, empty when none) and "reloaded" (without Store) replaces
+// the workspace, e.g. by an import or a git pull. "reloaded" with Store
+// tells of entries changed on disk by others.
+type DataChange struct {
+	Store  string `json:"store,omitempty"`
+	ID     string `json:"id,omitempty"`
+	Action string `json:"action"`
+}
+
+// McpEvent is a server notification relayed to the browser: "log",
+// "toolsChanged", "resourcesChanged", "promptsChanged" or "resourceUpdated"
+// with the notification params as Data, "progress" (an McpProgress),
+// "sampling" (an McpSamplingRequest) or "elicitation" (an
+// McpElicitationRequest). Streamed tool calls end with "result"
+// (the CallToolResult) or "error".
+type McpEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// McpProgress is the data of a "progress" event. Percent is only set when
+// the server reports a total.
+type McpProgress struct {
+	Token    any      `json:"token"`
+	Progress float64  `json:"progress"`
+	Total    float64  `json:"total,omitempty"`
+	Percent  *float64 `json:"percent,omitempty"`
+	Message  string   `json:"message,omitempty"`
+}
+
+// McpSamplingRequest is the data of a "sampling" event: an MCP server asks
+// for a completion, which is only sent once approved via
+// POST /mcp/sampling/{id}.
+type McpSamplingRequest struct {
+	ID     string                   `json:"id"`
+	Params *mcp.CreateMessageParams `json:"params"`
+}
+
+type McpSamplingDecision struct {
+	Approve bool `json:"approve"`
+}
+
+// McpElicitationRequest is the data of an "elicitation" event: an MCP
+// server asks for input matching Params.RequestedSchema, answered via
+// POST /mcp/elicitation/{id}.
+type McpElicitationRequest struct {
+	ID     string            `json:"id"`
+	Params *mcp.ElicitParams `json:"params"`
+}
+
+// McpElicitationResponse answers an elicitation: Action is "accept" (with
+// Content), "decline" or "cancel".
+type McpElicitationResponse struct {
+	Action  string         `json:"action"`
+	Content map[string]any `json:"content,omitempty"`
 }
 
 type McpResourceContent struct {
@@ -67,3 +1682,26 @@ type McpResourceContent struct {
 	Text     string `json:"text,omitempty"`
 	Blob     string `json:"blob,omitempty"`
 }
+
+// AuditEntry is a proxied request in the audit trail. User is the user of
+// multi-user mode and Client the address the request came from, empty for
+// requests of the server itself such as those of monitors. Target is
+// scheme://host, as paths and queries may carry credentials; Duration is
+// in milliseconds. The body excerpts, with credentials redacted, are only
+// recorded with AuditBodies.
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user,omitempty"`
+	Client string    `json:"client,omitempty"`
+
+	Method   string `json:"method"`
+	Protocol string `json:"protocol"`
+	Target   string `json:"target"`
+
+	Status   int     `json:"status"`
+	Bytes    int64   `json:"bytes"`
+	Duration float64 `json:"duration"`
+
+	RequestBody  string `json:"requestBody,omitempty"`
+	ResponseBody string `json:"responseBody,omitempty"`
+}
@@ -0,0 +1,873 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openapiMethods are the operation keys of a path item, in display order.
+var openapiMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+const (
+	// maxExampleDepth stops example generation for deeply nested schemas.
+	maxExampleDepth = 8
+
+	maxOpenAPISize = 16 << 20
+)
+
+type openapiDocument struct {
+	OpenAPI string `json:"openapi"`
+	Swagger string `json:"swagger"`
+
+	Info struct {
+		Title       string `json:"title"`
+		Version     string `json:"version"`
+		Description string `json:"description"`
+	} `json:"info"`
+
+	Servers []openapiServer `json:"servers"`
+
+	Tags []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	} `json:"tags"`
+
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+
+	Components struct {
+		SecuritySchemes map[string]openapiSecurityScheme `json:"securitySchemes"`
+	} `json:"components"`
+
+	Security []map[string][]string `json:"security"`
+}
+
+type openapiServer struct {
+	URL string `json:"url"`
+
+	Variables map[string]struct {
+		Default string `json:"default"`
+	} `json:"variables"`
+}
+
+type openapiOperation struct {
+	OperationID string   `json:"operationId"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Deprecated  bool     `json:"deprecated"`
+
+	Parameters  []openapiParameter     `json:"parameters"`
+	RequestBody *openapiRequestBody    `json:"requestBody"`
+	Responses   map[string]openapiBody `json:"responses"`
+
+	Security *[]map[string][]string `json:"security"`
+	Servers  []openapiServer        `json:"servers"`
+}
+
+type openapiParameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Deprecated  bool   `json:"deprecated"`
+
+	Schema   any                       `json:"schema"`
+	Example  any                       `json:"example"`
+	Examples map[string]openapiExample `json:"examples"`
+}
+
+type openapiRequestBody struct {
+	Description string                      `json:"description"`
+	Required    bool                        `json:"required"`
+	Content     map[string]openapiMediaType `json:"content"`
+}
+
+// openapiBody is a response object.
+type openapiBody struct {
+	Description string                      `json:"description"`
+	Content     map[string]openapiMediaType `json:"content"`
+}
+
+type openapiMediaType struct {
+	Schema   any                       `json:"schema"`
+	Example  any                       `json:"example"`
+	Examples map[string]openapiExample `json:"examples"`
+}
+
+type openapiExample struct {
+	Value any `json:"value"`
+}
+
+type openapiSecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat"`
+	In           string `json:"in"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+}
+
+// parseOpenAPI decodes an OpenAPI 3.x document (JSON or YAML) with all local
+// $refs resolved; recursive references are left in place.
+func parseOpenAPI(data []byte) (*openapiDocument, map[string]any, error) {
+	var raw any
+
+	// YAML is a superset of JSON, so one decoder handles both
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	root, ok := normalizeYAML(raw).(map[string]any)
+
+	if !ok {
+		return nil, nil, errors.New("invalid document: expected an object")
+	}
+
+	if _, ok := root["swagger"]; ok {
+		return nil, nil, errors.New("swagger 2.0 is not supported; convert the document to OpenAPI 3.x")
+	}
+
+	if version, _ := root["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, nil, errors.New("not an OpenAPI 3.x document")
+	}
+
+	resolver := &openapiResolver{
+		root:     root,
+		resolved: make(map[string]any),
+		active:   make(map[string]bool),
+	}
+
+	resolved := resolver.resolve(root).(map[string]any)
+
+	encoded, err := json.Marshal(resolved)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var doc openapiDocument
+
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	return &doc, root, nil
+}
+
+// normalizeYAML converts YAML maps with non-string keys (e.g. unquoted
+// response codes) into JSON-compatible maps.
+func normalizeYAML(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = normalizeYAML(value)
+		}
+
+		return v
+
+	case map[any]any:
+		result := make(map[string]any, len(v))
+
+		for key, value := range v {
+			result[fmt.Sprint(key)] = normalizeYAML(value)
+		}
+
+		return result
+
+	case []any:
+		for i, value := range v {
+			v[i] = normalizeYAML(value)
+		}
+
+		return v
+	}
+
+	return v
+}
+
+// openapiResolver inlines local JSON pointer references ("#/components/...").
+type openapiResolver struct {
+	root map[string]any
+
+	resolved map[string]any
+	active   map[string]bool
+}
+
+func (r *openapiResolver) resolve(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok && strings.HasPrefix(ref, "#/") {
+			return r.resolveRef(ref)
+		}
+
+		result := make(map[string]any, len(v))
+
+		for key, value := range v {
+			result[key] = r.resolve(value)
+		}
+
+		return result
+
+	case []any:
+		result := make([]any, len(v))
+
+		for i, value := range v {
+			result[i] = r.resolve(value)
+		}
+
+		return result
+	}
+
+	return v
+}
+
+func (r *openapiResolver) resolveRef(ref string) any {
+	if value, ok := r.resolved[ref]; ok {
+		return value
+	}
+
+	if r.active[ref] {
+		// recursive schema: keep the reference
+		return map[string]any{"$ref": ref}
+	}
+
+	target, ok := lookupPointer(r.root, ref)
+
+	if !ok {
+		return map[string]any{"$ref": ref}
+	}
+
+	r.active[ref] = true
+	value := r.resolve(target)
+	delete(r.active, ref)
+
+	r.resolved[ref] = value
+	return value
+}
+
+// lookupPointer evaluates a "#/a/b" JSON pointer against root.
+func lookupPointer(root any, ref string) (any, bool) {
+	current := root
+
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+		m, ok := current.(map[string]any)
+
+		if !ok {
+			return nil, false
+		}
+
+		if current, ok = m[token]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// openapiOperations flattens the document into sorted operations.
+func openapiOperations(doc *openapiDocument) ([]OpenAPIOperation, error) {
+	var operations []OpenAPIOperation
+
+	paths := make([]string, 0, len(doc.Paths))
+
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		item := doc.Paths[path]
+
+		var shared []openapiParameter
+
+		if raw, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(raw, &shared); err != nil {
+				return nil, fmt.Errorf("%s: invalid parameters: %w", path, err)
+			}
+		}
+
+		var servers []openapiServer
+
+		if raw, ok := item["servers"]; ok {
+			json.Unmarshal(raw, &servers)
+		}
+
+		for _, method := range openapiMethods {
+			raw, ok := item[method]
+
+			if !ok {
+				continue
+			}
+
+			var op openapiOperation
+
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+
+			if len(op.Servers) == 0 {
+				op.Servers = servers
+			}
+
+			operations = append(operations, convertOpenAPIOperation(doc, strings.ToUpper(method), path, &op, shared))
+		}
+	}
+
+	return operations, nil
+}
+
+func convertOpenAPIOperation(doc *openapiDocument, method, path string, op *openapiOperation, shared []openapiParameter) OpenAPIOperation {
+	result := OpenAPIOperation{
+		ID:     op.OperationID,
+		Method: method,
+		Path:   path,
+
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Deprecated:  op.Deprecated,
+
+		Parameters: []OpenAPIParameter{},
+		Responses:  []OpenAPIResponse{},
+		Security:   []OpenAPISecurity{},
+	}
+
+	if result.ID == "" {
+		result.ID = method + " " + path
+	}
+
+	for _, s := range op.Servers {
+		result.Servers = append(result.Servers, openapiServerURL(s))
+	}
+
+	// operation parameters override path-level ones with the same name+in
+	params := slices.Clone(op.Parameters)
+
+	for _, p := range shared {
+		if !slices.ContainsFunc(params, func(o openapiParameter) bool { return o.Name == p.Name && o.In == p.In }) {
+			params = append(params, p)
+		}
+	}
+
+	for _, p := range params {
+		param := OpenAPIParameter{
+			Name:        p.Name,
+			In:          p.In,
+			Description: p.Description,
+			Required:    p.Required || p.In == "path",
+			Deprecated:  p.Deprecated,
+			Schema:      p.Schema,
+		}
+
+		if example, ok := openapiExampleValue(p.Example, p.Examples); ok {
+			param.Example = example
+		}
+
+		result.Parameters = append(result.Parameters, param)
+	}
+
+	if body := op.RequestBody; body != nil {
+		for _, contentType := range sortedKeys(body.Content) {
+			media := body.Content[contentType]
+
+			rb := OpenAPIRequestBody{
+				ContentType: contentType,
+				Description: body.Description,
+				Required:    body.Required,
+				Schema:      media.Schema,
+			}
+
+			if example, ok := openapiExampleValue(media.Example, media.Examples); ok {
+				rb.Example = example
+			} else if media.Schema != nil {
+				rb.Example = exampleFromSchema(media.Schema, 0)
+			}
+
+			result.RequestBodies = append(result.RequestBodies, rb)
+		}
+	}
+
+	for _, status := range sortedKeys(op.Responses) {
+		response := op.Responses[status]
+
+		if len(response.Content) == 0 {
+			result.Responses = append(result.Responses, OpenAPIResponse{Status: status, Description: response.Description})
+			continue
+		}
+
+		for _, contentType := range sortedKeys(response.Content) {
+			result.Responses = append(result.Responses, OpenAPIResponse{
+				Status:      status,
+				Description: response.Description,
+				ContentType: contentType,
+				Schema:      response.Content[contentType].Schema,
+			})
+		}
+	}
+
+	// an explicit empty list on the operation disables global security
+	requirements := doc.Security
+
+	if op.Security != nil {
+		requirements = *op.Security
+	}
+
+	for _, requirement := range requirements {
+		for _, name := range sortedKeys(requirement) {
+			scheme := doc.Components.SecuritySchemes[name]
+
+			result.Security = append(result.Security, OpenAPISecurity{
+				Name:   name,
+				Type:   scheme.Type,
+				Scheme: scheme.Scheme,
+				In:     scheme.In,
+				Param:  scheme.Name,
+				Scopes: requirement[name],
+			})
+		}
+	}
+
+	return result
+}
+
+// openapiServerURL expands server variables with their defaults.
+func openapiServerURL(s openapiServer) string {
+	result := s.URL
+
+	for name, variable := range s.Variables {
+		result = strings.ReplaceAll(result, "{"+name+"}", variable.Default)
+	}
+
+	return result
+}
+
+// openapiTags groups operations by their first tag, keeping the document's
+// tag order; untagged operations go last under "default".
+func openapiTags(doc *openapiDocument, operations []OpenAPIOperation) []OpenAPITag {
+	var tags []OpenAPITag
+
+	index := make(map[string]int)
+
+	add := func(name, description string) {
+		if _, ok := index[name]; !ok {
+			index[name] = len(tags)
+			tags = append(tags, OpenAPITag{Name: name, Description: description, Operations: []OpenAPIOperation{}})
+		}
+	}
+
+	for _, tag := range doc.Tags {
+		add(tag.Name, tag.Description)
+	}
+
+	for _, op := range operations {
+		name := "default"
+
+		if len(op.Tags) > 0 {
+			name = op.Tags[0]
+		}
+
+		add(name, "")
+		tags[index[name]].Operations = append(tags[index[name]].Operations, op)
+	}
+
+	// drop declared tags without operations
+	return slices.DeleteFunc(tags, func(t OpenAPITag) bool { return len(t.Operations) == 0 })
+}
+
+func openapiExampleValue(example any, examples map[string]openapiExample) (any, bool) {
+	if example != nil {
+		return example, true
+	}
+
+	for _, name := range sortedKeys(examples) {
+		if value := examples[name].Value; value != nil {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+// exampleFromSchema builds a sample value for a (resolved) JSON schema,
+// preferring declared examples, defaults and enum values.
+func exampleFromSchema(schema any, depth int) any {
+	s, ok := schema.(map[string]any)
+
+	if !ok || depth > maxExampleDepth {
+		return nil
+	}
+
+	if example, ok := s["example"]; ok {
+		return example
+	}
+
+	if examples, ok := s["examples"].([]any); ok && len(examples) > 0 {
+		return examples[0]
+	}
+
+	if value, ok := s["default"]; ok {
+		return value
+	}
+
+	if value, ok := s["const"]; ok {
+		return value
+	}
+
+	if values, ok := s["enum"].([]any); ok && len(values) > 0 {
+		return values[0]
+	}
+
+	if all, ok := s["allOf"].([]any); ok {
+		merged := map[string]any{}
+
+		for _, part := range all {
+			if object, ok := exampleFromSchema(part, depth+1).(map[string]any); ok {
+				for key, value := range object {
+					merged[key] = value
+				}
+			}
+		}
+
+		return merged
+	}
+
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if variants, ok := s[key].([]any); ok && len(variants) > 0 {
+			return exampleFromSchema(variants[0], depth+1)
+		}
+	}
+
+	typ, _ := s["type"].(string)
+
+	// 3.1 allows type arrays such as ["string", "null"]
+	if types, ok := s["type"].([]any); ok {
+		for _, t := range types {
+			if t, ok := t.(string); ok && t != "null" {
+				typ = t
+				break
+			}
+		}
+	}
+
+	if typ == "" {
+		switch {
+		case s["properties"] != nil:
+			typ = "object"
+		case s["items"] != nil:
+			typ = "array"
+		}
+	}
+
+	switch typ {
+	case "object":
+		result := map[string]any{}
+
+		properties, _ := s["properties"].(map[string]any)
+
+		for name, property := range properties {
+			if p, ok := property.(map[string]any); ok && p["readOnly"] == true {
+				continue
+			}
+
+			// recursive references yield nil and are left out
+			if value := exampleFromSchema(property, depth+1); value != nil {
+				result[name] = value
+			}
+		}
+
+		return result
+
+	case "array":
+		if item := exampleFromSchema(s["items"], depth+1); item != nil {
+			return []any{item}
+		}
+
+		return []any{}
+
+	case "string":
+		switch s["format"] {
+		case "date-time":
+			return "2024-01-01T00:00:00Z"
+		case "date":
+			return "2024-01-01"
+		case "time":
+			return "00:00:00"
+		case "email":
+			return "user@example.com"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		case "uri", "url":
+			return "https://example.com"
+		case "hostname":
+			return "example.com"
+		case "ipv4":
+			return "192.0.2.1"
+		case "ipv6":
+			return "2001:db8::1"
+		case "byte":
+			return "c3RyaW5n"
+		}
+
+		return "string"
+
+	case "integer", "number":
+		if minimum, ok := s["minimum"].(float64); ok {
+			return minimum
+		}
+
+		return 0
+
+	case "boolean":
+		return false
+	}
+
+	return nil
+}
+
+// openapiRequest materializes an operation as a stored Request against
+// baseURL. Path parameters without an example stay as {name} placeholders.
+func openapiRequest(op *OpenAPIOperation, baseURL string, schemes map[string]openapiSecurityScheme) *Request {
+	path := op.Path
+
+	query := []KeyValue{}
+	headers := []KeyValue{}
+
+	for _, p := range op.Parameters {
+		value := ""
+
+		if p.Example != nil {
+			value = exampleString(p.Example)
+		}
+
+		switch p.In {
+		case "path":
+			if value != "" {
+				path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(value))
+			}
+
+		case "query":
+			query = append(query, KeyValue{ID: newRequestID(), Enabled: p.Required, Key: p.Name, Value: value})
+
+		case "header":
+			headers = append(headers, KeyValue{ID: newRequestID(), Enabled: p.Required, Key: p.Name, Value: value})
+
+		case "cookie":
+			headers = append(headers, KeyValue{ID: newRequestID(), Enabled: p.Required, Key: "Cookie", Value: p.Name + "=" + value})
+		}
+	}
+
+	for _, sec := range op.Security {
+		switch scheme := schemes[sec.Name]; {
+		case scheme.Type == "http" && strings.EqualFold(scheme.Scheme, "bearer"):
+			headers = append(headers, KeyValue{ID: newRequestID(), Enabled: true, Key: "Authorization", Value: "Bearer "})
+
+		case scheme.Type == "http" && strings.EqualFold(scheme.Scheme, "basic"):
+			headers = append(headers, KeyValue{ID: newRequestID(), Enabled: true, Key: "Authorization", Value: "Basic "})
+
+		case scheme.Type == "apiKey" && scheme.In == "header":
+			headers = append(headers, KeyValue{ID: newRequestID(), Enabled: true, Key: scheme.Name, Value: ""})
+
+		case scheme.Type == "apiKey" && scheme.In == "query":
+			query = append(query, KeyValue{ID: newRequestID(), Enabled: true, Key: scheme.Name, Value: ""})
+
+		case scheme.Type == "oauth2" || scheme.Type == "openIdConnect":
+			headers = append(headers, KeyValue{ID: newRequestID(), Enabled: true, Key: "Authorization", Value: "Bearer "})
+		}
+	}
+
+	body := RequestBody{Type: "none"}
+
+	if rb := preferredRequestBody(op.RequestBodies); rb != nil {
+		var contentTypeHeader bool
+
+		body, contentTypeHeader = openapiBodyFor(rb)
+
+		if contentTypeHeader {
+			headers = append(headers, KeyValue{ID: newRequestID(), Enabled: true, Key: "Content-Type", Value: rb.ContentType})
+		}
+	}
+
+	name := op.Summary
+
+	if name == "" {
+		name = op.ID
+	}
+
+	return &Request{
+		ID:   newRequestID(),
+		Name: name,
+
+		Variables: []Variable{},
+
+		HTTP: &HTTPSettings{
+			Method: op.Method,
+			URL:    strings.TrimSuffix(baseURL, "/") + path,
+
+			Query:   query,
+			Headers: headers,
+			Body:    body,
+
+			Options: HTTPOptions{Redirect: true},
+		},
+	}
+}
+
+// preferredRequestBody picks JSON over form encodings over anything else.
+func preferredRequestBody(bodies []OpenAPIRequestBody) *OpenAPIRequestBody {
+	rank := func(contentType string) int {
+		switch mediaType := strings.ToLower(contentType); {
+		case mediaType == "application/json":
+			return 0
+		case strings.HasSuffix(mediaType, "+json"):
+			return 1
+		case mediaType == "application/x-www-form-urlencoded":
+			return 2
+		case mediaType == "multipart/form-data":
+			return 3
+		}
+
+		return 4
+	}
+
+	var best *OpenAPIRequestBody
+
+	for i := range bodies {
+		if best == nil || rank(bodies[i].ContentType) < rank(best.ContentType) {
+			best = &bodies[i]
+		}
+	}
+
+	return best
+}
+
+// openapiBodyFor converts an example request body into the stored body
+// format; the flag asks for an explicit Content-Type header when the UI
+// would not derive the right one from the body type.
+func openapiBodyFor(rb *OpenAPIRequestBody) (RequestBody, bool) {
+	mediaType := strings.ToLower(rb.ContentType)
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		content, _ := json.MarshalIndent(rb.Example, "", "  ")
+		return RequestBody{Type: "json", Content: string(content)}, mediaType != "application/json"
+
+	case mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data":
+		body := RequestBody{Type: "form-urlencoded"}
+
+		if mediaType == "multipart/form-data" {
+			body.Type = "form-data"
+		}
+
+		example, _ := rb.Example.(map[string]any)
+		properties, _ := schemaProperties(rb.Schema)
+
+		for _, name := range sortedKeys(example) {
+			field := FormField{ID: newRequestID(), Enabled: true, Key: name, Value: exampleString(example[name])}
+
+			if body.Type == "form-data" {
+				field.Type = "text"
+
+				if p, ok := properties[name].(map[string]any); ok && (p["format"] == "binary" || p["contentMediaType"] != nil) {
+					field.Type = "file"
+					field.Value = ""
+				}
+			}
+
+			body.Data = append(body.Data, field)
+		}
+
+		return body, false
+
+	case strings.Contains(mediaType, "xml"):
+		return RequestBody{Type: "xml"}, mediaType != "application/xml"
+
+	case strings.HasPrefix(mediaType, "text/"):
+		return RequestBody{Type: "raw", Content: exampleString(rb.Example)}, mediaType != "text/plain"
+
+	case mediaType == "application/octet-stream" || strings.HasPrefix(mediaType, "image/") ||
+		strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/"):
+		return RequestBody{Type: "binary"}, true
+	}
+
+	return RequestBody{Type: "raw", Content: exampleString(rb.Example)}, true
+}
+
+func schemaProperties(schema any) (map[string]any, bool) {
+	s, ok := schema.(map[string]any)
+
+	if !ok {
+		return nil, false
+	}
+
+	properties, ok := s["properties"].(map[string]any)
+	return properties, ok
+}
+
+// exampleString renders an example value as a parameter or form value.
+func exampleString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]any, []any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	return fmt.Sprint(v)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// fetchOpenAPI downloads a document through the upstream transport.
+func fetchOpenAPI(client *http.Client, documentURL string) ([]byte, error) {
+	resp, err := client.Get(documentURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching document: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOpenAPISize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxOpenAPISize {
+		return nil, errors.New("document too large")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// protoMessageSchema returns a JSON Schema of the protojson form of md. Its
+// messages are defined under $defs by full name, so recursive ones refer to
+// themselves; comments of the proto files become descriptions.
+func protoMessageSchema(md protoreflect.MessageDescriptor) map[string]any {
+	defs := map[string]any{}
+
+	schema := protoTypeSchema(md, defs)
+	schema["$defs"] = defs
+
+	return schema
+}
+
+// protoTypeSchema returns the schema of a message field of type md: a
+// $ref to its definition, or the JSON form of a well-known type.
+func protoTypeSchema(md protoreflect.MessageDescriptor, defs map[string]any) map[string]any {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return map[string]any{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return map[string]any{"type": "string", "pattern": `^-?[0-9]+(\.[0-9]+)?s$`}
+	case "google.protobuf.FieldMask":
+		return map[string]any{"type": "string"}
+	case "google.protobuf.Struct":
+		return map[string]any{"type": "object"}
+	case "google.protobuf.ListValue":
+		return map[string]any{"type": "array"}
+	case "google.protobuf.Value":
+		return map[string]any{}
+	case "google.protobuf.Any":
+		return map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"@type": map[string]any{"type": "string"}},
+			"required":   []any{"@type"},
+		}
+	case "google.protobuf.BoolValue":
+		return map[string]any{"type": "boolean"}
+	case "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return map[string]any{"type": "string"}
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value":
+		return map[string]any{"type": "integer"}
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return map[string]any{"type": []any{"string", "integer"}}
+	case "google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return map[string]any{"type": "number"}
+	}
+
+	name := string(md.FullName())
+	ref := map[string]any{"$ref": "#/$defs/" + name}
+
+	if _, ok := defs[name]; ok {
+		return ref
+	}
+
+	// claimed before the fields, which may refer to md
+	definition := map[string]any{"type": "object"}
+	defs[name] = definition
+
+	properties := map[string]any{}
+	var required []any
+
+	fields := md.Fields()
+
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+
+		schema := protoFieldSchema(fd, defs)
+
+		if comment := protoComment(fd); comment != "" {
+			schema["description"] = comment
+		}
+
+		properties[fd.JSONName()] = schema
+
+		if fd.Cardinality() == protoreflect.Required {
+			required = append(required, fd.JSONName())
+		}
+	}
+
+	definition["properties"] = properties
+	definition["additionalProperties"] = false
+
+	if len(required) > 0 {
+		definition["required"] = required
+	}
+
+	if comment := protoComment(md); comment != "" {
+		definition["description"] = comment
+	}
+
+	return ref
+}
+
+// protoFieldSchema returns the schema of the value of fd: an array for
+// repeated fields, an object keyed by strings for maps.
+func protoFieldSchema(fd protoreflect.FieldDescriptor, defs map[string]any) map[string]any {
+	switch {
+	case fd.IsMap():
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": protoValueSchema(fd.MapValue(), defs),
+		}
+
+	case fd.IsList():
+		return map[string]any{
+			"type":  "array",
+			"items": protoValueSchema(fd, defs),
+		}
+	}
+
+	return protoValueSchema(fd, defs)
+}
+
+// protoValueSchema returns the schema of a single value of fd. 64-bit
+// integers are strings in protojson, which takes numbers as well.
+func protoValueSchema(fd protoreflect.FieldDescriptor, defs map[string]any) map[string]any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]any{"type": "boolean"}
+
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]any{"type": "integer"}
+
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]any{"type": []any{"string", "integer"}}
+
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return map[string]any{"type": "number"}
+
+	case protoreflect.StringKind:
+		return map[string]any{"type": "string"}
+
+	case protoreflect.BytesKind:
+		return map[string]any{"type": "string", "contentEncoding": "base64"}
+
+	case protoreflect.EnumKind:
+		ed := fd.Enum()
+
+		if ed.FullName() == "google.protobuf.NullValue" {
+			return map[string]any{"type": "null"}
+		}
+
+		var names []any
+
+		values := ed.Values()
+
+		for i := range values.Len() {
+			names = append(names, string(values.Get(i).Name()))
+		}
+
+		return map[string]any{"type": "string", "enum": names}
+
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return protoTypeSchema(fd.Message(), defs)
+	}
+
+	return map[string]any{}
+}
+
+// protoComment returns the leading comment of d in its proto file, empty
+// when the descriptors carry no source info, as reflected ones usually do.
+func protoComment(d protoreflect.Descriptor) string {
+	location := d.ParentFile().SourceLocations().ByDescriptor(d)
+	return strings.TrimSpace(location.LeadingComments)
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Categories of ProxyError.
+const (
+	errorCategoryDNS        = "dns"
+	errorCategoryTLS        = "tls"
+	errorCategoryTimeout    = "timeout"
+	errorCategoryConnection = "connection"
+	errorCategoryProtocol   = "protocol"
+	errorCategoryDenied     = "denied"
+	errorCategoryCanceled   = "canceled"
+	errorCategoryRequest    = "request"
+	errorCategoryInternal   = "internal"
+)
+
+// writeProxyError answers a failed call of a proxy endpoint with code and
+// the JSON of ProxyError, classifying err; X-Prism-Error carries its code,
+// so clients tell these errors from upstream responses of the same status.
+func writeProxyError(w http.ResponseWriter, code int, err error) {
+	result := classifyError(code, err)
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("X-Prism-Error", result.Code)
+
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(result)
+}
+
+// classifyError tells what failed by the type of err, or else by the status
+// code it is answered with.
+func classifyError(code int, err error) *ProxyError {
+	result := &ProxyError{
+		Message: err.Error(),
+	}
+
+	var (
+		sizeErr   *http.MaxBytesError
+		dnsErr    *net.DNSError
+		certErr   *tls.CertificateVerificationError
+		authErr   x509.UnknownAuthorityError
+		hostErr   x509.HostnameError
+		invalid   x509.CertificateInvalidError
+		recordErr tls.RecordHeaderError
+		alertErr  tls.AlertError
+		netErr    net.Error
+		opErr     *net.OpError
+		grpcErr   interface{ GRPCStatus() *status.Status }
+	)
+
+	switch {
+	case errors.Is(err, errTargetDenied):
+		result.Code, result.Category = "target_denied", errorCategoryDenied
+
+	case code == statusClientClosedRequest || errors.Is(err, errRequestCanceled):
+		result.Code, result.Category, result.Retriable = "canceled", errorCategoryCanceled, true
+
+	// the call itself is at fault
+	case code < http.StatusInternalServerError:
+		switch {
+		case code == http.StatusRequestEntityTooLarge || errors.As(err, &sizeErr):
+			result.Code = "request_too_large"
+		case errors.Is(err, errSecretsLocked):
+			result.Code = "secrets_locked"
+		case code == http.StatusNotFound:
+			result.Code = "not_found"
+		default:
+			result.Code = "invalid_request"
+		}
+
+		result.Category = errorCategoryRequest
+
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsNotFound {
+			result.Code, result.Category = "dns_not_found", errorCategoryDNS
+		} else {
+			result.Code, result.Category, result.Retriable = "dns_failure", errorCategoryDNS, true
+		}
+
+	case errors.As(err, &certErr) || errors.As(err, &authErr) || errors.As(err, &hostErr) || errors.As(err, &invalid):
+		result.Code, result.Category = "tls_certificate", errorCategoryTLS
+
+	case errors.As(err, &recordErr) || errors.As(err, &alertErr):
+		result.Code, result.Category = "tls_handshake", errorCategoryTLS
+
+	case code == http.StatusGatewayTimeout || errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		result.Code, result.Category, result.Retriable = "timeout", errorCategoryTimeout, true
+
+	case errors.Is(err, context.Canceled):
+		result.Code, result.Category, result.Retriable = "canceled", errorCategoryCanceled, true
+
+	case errors.Is(err, syscall.ECONNREFUSED):
+		result.Code, result.Category, result.Retriable = "connection_refused", errorCategoryConnection, true
+
+	case errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+		result.Code, result.Category, result.Retriable = "connection_reset", errorCategoryConnection, true
+
+	case errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH):
+		result.Code, result.Category, result.Retriable = "unreachable", errorCategoryConnection, true
+
+	case errors.As(err, &opErr):
+		result.Code, result.Category, result.Retriable = "connection_failed", errorCategoryConnection, true
+
+	case errors.As(err, &grpcErr):
+		result.Code = "upstream_error"
+		result.Category, result.Retriable = grpcErrorCategory(grpcErr.GRPCStatus())
+
+	case code == http.StatusBadGateway:
+		result.Code, result.Category = "upstream_error", errorCategoryProtocol
+
+	case code == http.StatusNotImplemented:
+		result.Code, result.Category = "not_implemented", errorCategoryRequest
+
+	default:
+		result.Code, result.Category = "internal", errorCategoryInternal
+	}
+
+	return result
+}
+
+// describedError words err for the user, keeping it for classifyError.
+type describedError struct {
+	text string
+	err  error
+}
+
+func (e *describedError) Error() string {
+	return e.text
+}
+
+func (e *describedError) Unwrap() error {
+	return e.err
+}
+
+// grpcErrorCategory is the category of a failed gRPC call, with whether
+// retrying may succeed. Failures to connect surface as Unavailable, told
+// apart by their message.
+func grpcErrorCategory(st *status.Status) (string, bool) {
+	switch st.Code() {
+	case codes.DeadlineExceeded:
+		return errorCategoryTimeout, true
+
+	case codes.Canceled:
+		return errorCategoryCanceled, true
+
+	case codes.Unavailable:
+		message := st.Message()
+
+		switch {
+		case strings.Contains(message, "x509:") || strings.Contains(message, "tls:"):
+			return errorCategoryTLS, false
+		case strings.Contains(message, "no such host") || strings.Contains(message, "name resolver"):
+			return errorCategoryDNS, false
+		}
+
+		return errorCategoryConnection, true
+
+	case codes.ResourceExhausted, codes.Aborted:
+		return errorCategoryProtocol, true
+	}
+
+	return errorCategoryProtocol, false
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	maxRetryAttempts = 10
+	maxRetryBodySize = 64 << 20
+)
+
+// parseRetryPolicy reads the X-Prism-Retry header (a JSON RetryPolicy) and
+// applies defaults. It returns nil when retries are not requested.
+func parseRetryPolicy(r *http.Request) (*RetryPolicy, error) {
+	value := r.Header.Get("X-Prism-Retry")
+
+	if value == "" {
+		return nil, nil
+	}
+
+	var policy RetryPolicy
+
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		return nil, fmt.Errorf("invalid X-Prism-Retry: %w", err)
+	}
+
+	if policy.Attempts <= 1 {
+		return nil, nil
+	}
+
+	policy.Attempts = min(policy.Attempts, maxRetryAttempts)
+
+	switch policy.Backoff {
+	case "":
+		policy.Backoff = "exponential"
+	case "constant", "linear", "exponential":
+	default:
+		return nil, fmt.Errorf("invalid X-Prism-Retry: unknown backoff %q", policy.Backoff)
+	}
+
+	if policy.DelayMS <= 0 {
+		policy.DelayMS = 250
+	}
+
+	if policy.MaxDelayMS <= 0 {
+		policy.MaxDelayMS = 30_000
+	}
+
+	if policy.Statuses == nil {
+		policy.Statuses = []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		}
+	}
+
+	return &policy, nil
+}
+
+// retryTransport wraps a RoundTripper to retry failed attempts according to
+// a RetryPolicy, recording every attempt.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy *RetryPolicy
+
+	mu       sync.Mutex
+	attempts []RetryAttempt
+}
+
+// bufferRetryBody makes the request body replayable for retries.
+func bufferRetryBody(r *http.Request) error {
+	if r.GetBody != nil || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRetryBodySize+1))
+
+	r.Body.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if len(data) > maxRetryBodySize {
+		return fmt.Errorf("request body too large to retry")
+	}
+
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	r.Body, _ = r.GetBody()
+	r.ContentLength = int64(len(data))
+
+	return nil
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		out := req
+
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+
+			if err != nil {
+				return nil, err
+			}
+
+			out = req.Clone(req.Context())
+			out.Body = body
+		}
+
+		start := time.Now()
+		resp, err := t.base.RoundTrip(out)
+
+		record := RetryAttempt{
+			Attempt:    attempt,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+
+		if err != nil {
+			record.Error = err.Error()
+		} else {
+			record.StatusCode = resp.StatusCode
+		}
+
+		last := attempt >= t.policy.Attempts || req.Context().Err() != nil
+		retry := false
+
+		switch {
+		case err != nil:
+			retry = t.policy.Network && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		default:
+			retry = slices.Contains(t.policy.Statuses, resp.StatusCode)
+		}
+
+		if !retry || last {
+			t.record(record)
+			return resp, err
+		}
+
+		delay := t.delay(attempt, resp)
+		record.DelayMS = delay.Milliseconds()
+		t.record(record)
+
+		if resp != nil {
+			// drain a little so the connection can be reused
+			io.CopyN(io.Discard, resp.Body, 64<<10)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// delay computes the backoff before the next attempt, honoring Retry-After
+// unless disabled.
+func (t *retryTransport) delay(attempt int, resp *http.Response) time.Duration {
+	base := time.Duration(t.policy.DelayMS) * time.Millisecond
+	maxDelay := time.Duration(t.policy.MaxDelayMS) * time.Millisecond
+
+	d := base
+
+	switch t.policy.Backoff {
+	case "linear":
+		d = base * time.Duration(attempt)
+	case "exponential":
+		d = base << min(attempt-1, 20)
+	}
+
+	if resp != nil && !t.policy.IgnoreRetryAfter {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			d = after
+		}
+	}
+
+	return min(d, maxDelay)
+}
+
+func (t *retryTransport) record(a RetryAttempt) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.attempts = append(t.attempts, a)
+}
+
+// writeHeaders reports all attempts as X-Prism-Attempts (JSON).
+func (t *retryTransport) writeHeaders(h http.Header) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.attempts) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(t.attempts)
+
+	if err != nil {
+		return
+	}
+
+	h.Set("X-Prism-Attempts", string(data))
+}
+
+// parseRetryAfter accepts delta-seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+
+	return 0, false
+}
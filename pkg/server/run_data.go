@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxRunDataSize bounds iteration data files.
+const maxRunDataSize = 16 << 20
+
+// parseRunData reads the rows of an iteration data file: CSV with a
+// header row naming the fields, or a JSON array of objects whose non-string
+// values are kept as JSON (null fields are left out).
+func parseRunData(data []byte, format string) ([]map[string]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	if format == "" {
+		format = "csv"
+
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			format = "json"
+		}
+	}
+
+	switch format {
+	case "csv":
+		return parseRunCSV(data)
+	case "json":
+		return parseRunJSON(data)
+	}
+
+	return nil, fmt.Errorf("unknown data format %q", format)
+}
+
+func parseRunCSV(data []byte) ([]map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var rows []map[string]string
+
+	for {
+		record, err := reader.Read()
+
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("csv: %w", err)
+		}
+
+		// blank lines are skipped by the reader; lone empty fields too
+		if len(record) == 1 && record[0] == "" {
+			continue
+		}
+
+		row := map[string]string{}
+
+		for i, name := range header {
+			if name == "" || i >= len(record) {
+				continue
+			}
+
+			row[name] = record[i]
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+func parseRunJSON(data []byte) ([]map[string]string, error) {
+	var items []map[string]any
+
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("json: expected an array of objects: %w", err)
+	}
+
+	rows := make([]map[string]string, 0, len(items))
+
+	for _, item := range items {
+		row := map[string]string{}
+
+		for name, value := range item {
+			if value != nil {
+				row[name] = jsonPathString(value)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Run runs stored requests headlessly like POST /runs, for the prism run
+// command. Requests and the environment may be named by ID or by name, the
+// folder also by its path ("Users/Admin"); without an environment the
+// active one applies. timeout bounds every request, zero keeps the default.
+func (s *Server) Run(ctx context.Context, req RunRequest, timeout time.Duration) (*RunResult, error) {
+	defer s.flushGitCommit()
+
+	store := cmp.Or(req.Store, runStore)
+
+	if !validName(store) {
+		return nil, errors.New("invalid store")
+	}
+
+	env, err := currentEnvironment(ctx)
+
+	if req.Environment != "" {
+		env, err = findEnvironment(ctx, req.Environment)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if env != nil {
+		req.Environment = env.ID
+	}
+
+	ids := make([]string, len(req.IDs))
+
+	for i, ref := range req.IDs {
+		if ids[i], err = findEntry(ctx, store, ref); err != nil {
+			return nil, fmt.Errorf("request %q: %w", ref, err)
+		}
+	}
+
+	req.IDs = ids
+
+	if req.Folder != nil && *req.Folder != "" {
+		id, err := findFolder(ctx, store, *req.Folder)
+
+		if err != nil {
+			return nil, err
+		}
+
+		req.Folder = &id
+	}
+
+	var ms string
+
+	if timeout > 0 {
+		ms = strconv.FormatInt(timeout.Milliseconds(), 10)
+	}
+
+	return s.executeRun(ctx, &req, env, ms, "")
+}
+
+// findEnvironment returns the environment with ID or else name ref.
+func findEnvironment(ctx context.Context, ref string) (*Environment, error) {
+	env, err := loadEnvironment(ctx, ref)
+
+	if !errors.Is(err, errEnvironmentNotFound) {
+		return env, err
+	}
+
+	id, err := findByName(ctx, environmentsStore, ref)
+
+	if err != nil {
+		return nil, fmt.Errorf("environment %q: %w", ref, err)
+	}
+
+	return loadEnvironment(ctx, id)
+}
+
+// findEntry returns the ID of the entry of store with ID or else name ref.
+func findEntry(ctx context.Context, store, ref string) (string, error) {
+	if validName(ref) {
+		if _, err := dataStore(ctx).Stat(store, ref); err == nil {
+			return ref, nil
+		}
+	}
+
+	return findByName(ctx, store, ref)
+}
+
+// findByName returns the ID of the single entry of store named name,
+// compared case-insensitively.
+func findByName(ctx context.Context, store, name string) (string, error) {
+	entries, err := dataStore(ctx).List(store)
+
+	if err != nil {
+		return "", err
+	}
+
+	var found []string
+
+	for _, stat := range entries {
+		if !validName(stat.ID) {
+			continue
+		}
+
+		var entry struct {
+			Name string `json:"name"`
+		}
+
+		if err := loadEntry(ctx, store, stat.ID, &entry); err != nil {
+			continue
+		}
+
+		if strings.EqualFold(entry.Name, name) {
+			found = append(found, stat.ID)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", errors.New("not found")
+	case 1:
+		return found[0], nil
+	}
+
+	return "", fmt.Errorf("ambiguous name, use one of the IDs %s", strings.Join(found, ", "))
+}
+
+// findFolder returns the ID of the folder with ID ref, or else the folder
+// at path ref of names separated by slashes.
+func findFolder(ctx context.Context, store, ref string) (string, error) {
+	index, err := loadFolderIndex(ctx, store)
+
+	if err != nil {
+		return "", err
+	}
+
+	if index.folder(ref) != nil {
+		return ref, nil
+	}
+
+	parent := ""
+
+	for name := range strings.SplitSeq(strings.Trim(ref, "/"), "/") {
+		var found []string
+
+		for _, f := range index.Folders {
+			if f.Parent == parent && strings.EqualFold(f.Name, name) {
+				found = append(found, f.ID)
+			}
+		}
+
+		if len(found) == 0 {
+			return "", fmt.Errorf("folder %q not found", ref)
+		}
+
+		if len(found) > 1 {
+			return "", fmt.Errorf("folder %q: ambiguous name %q", ref, name)
+		}
+
+		parent = found[0]
+	}
+
+	return parent, nil
+}
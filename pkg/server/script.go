@@ -0,0 +1,449 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	// scriptTimeout bounds the run of a pre-request script.
+	scriptTimeout = 5 * time.Second
+
+	// scriptMaxSize is the largest pre-request script accepted.
+	scriptMaxSize = 64 << 10
+)
+
+var errScript = errors.New("script failed")
+
+// variableNameRegex matches the names a script may set, those a {{name}}
+// reference can stand for.
+var variableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,127}$`)
+
+// scriptScope is what a run shares with the pre-request scripts of its
+// requests: the variables they read beyond the environment, and the ones
+// they set, which the run hands on to the requests that follow.
+type scriptScope struct {
+	variables map[string]string
+	set       map[string]string
+}
+
+// scriptScopeKey is the context key of the scriptScope of a request sent
+// on behalf of the server (runs, POST /send).
+type scriptScopeKey struct{}
+
+// withScriptScope returns ctx carrying scope for the script of a request.
+func withScriptScope(ctx context.Context, scope *scriptScope) context.Context {
+	return context.WithValue(ctx, scriptScopeKey{}, scope)
+}
+
+// applyScript runs the pre-request script of X-Prism-Script (base64) on a
+// proxied HTTP request whose variables are substituted already. Variables
+// set by the script fill the references still open afterwards.
+func applyScript(r *http.Request, environment map[string]string) error {
+	encoded := r.Header.Get("X-Prism-Script")
+
+	r.Header.Del("X-Prism-Script")
+
+	if !strings.HasPrefix(r.URL.Path, "/proxy/http/") && !strings.HasPrefix(r.URL.Path, "/proxy/https/") {
+		return fmt.Errorf("%w: scripts apply to HTTP requests only", errScript)
+	}
+
+	source, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return fmt.Errorf("%w: invalid X-Prism-Script", errScript)
+	}
+
+	if len(source) > scriptMaxSize {
+		return fmt.Errorf("%w: script too large", errScript)
+	}
+
+	scope, _ := r.Context().Value(scriptScopeKey{}).(*scriptScope)
+
+	variables := maps.Clone(environment)
+
+	if scope != nil {
+		maps.Copy(variables, scope.variables)
+	}
+
+	set, err := runScript(r.Context(), string(source), r, environment, variables)
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", errScript, err)
+	}
+
+	if scope != nil {
+		maps.Copy(scope.set, set)
+	}
+
+	if len(set) == 0 {
+		return nil
+	}
+
+	return applyVariables(r, set)
+}
+
+// runScript runs a pre-request script on r, returning the variables it set.
+// Scripts see:
+//
+//   - request: method, url and body (read and write) and headers.get, set
+//     and remove
+//   - variables: get, set, has and replaceIn over all variables
+//   - environment: get over the variables of the environment
+//   - crypto: hmac(alg, key, data, enc), hash(alg, data, enc) and
+//     randomUUID(); alg is md5, sha1, sha256, sha384 or sha512, enc hex
+//     (default), base64 or base64url
+//   - btoa, atob and console.log
+func runScript(ctx context.Context, source string, r *http.Request, environment, variables map[string]string) (map[string]string, error) {
+	vm := goja.New()
+
+	timer := time.AfterFunc(scriptTimeout, func() {
+		vm.Interrupt("script timed out")
+	})
+
+	defer timer.Stop()
+
+	stop := context.AfterFunc(ctx, func() {
+		vm.Interrupt(ctx.Err())
+	})
+
+	defer stop()
+
+	throw := func(format string, args ...any) {
+		panic(vm.NewTypeError(fmt.Sprintf(format, args...)))
+	}
+
+	set := map[string]string{}
+
+	lookup := func(name string) (string, bool) {
+		if value, ok := set[name]; ok {
+			return value, true
+		}
+
+		value, ok := variables[name]
+		return value, ok
+	}
+
+	// request
+
+	request := vm.NewObject()
+
+	request.DefineAccessorProperty("method", vm.ToValue(func() string {
+		return r.Method
+	}), vm.ToValue(func(method string) {
+		if method == "" || strings.ContainsAny(method, " \t\r\n") {
+			throw("invalid method %q", method)
+		}
+
+		r.Method = strings.ToUpper(method)
+	}), goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	request.DefineAccessorProperty("url", vm.ToValue(func() string {
+		return scriptURL(r)
+	}), vm.ToValue(func(value string) {
+		if err := setScriptURL(r, value); err != nil {
+			throw("%v", err)
+		}
+	}), goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	request.DefineAccessorProperty("body", vm.ToValue(func() string {
+		body, err := scriptBody(r)
+
+		if err != nil {
+			throw("%v", err)
+		}
+
+		return body
+	}), vm.ToValue(func(body string) {
+		setScriptBody(r, body)
+	}), goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	headers := vm.NewObject()
+
+	// headers are smuggled as X-Prism-Header-<name> like the UI does, so
+	// those win over the plain ones
+	headers.Set("get", func(name string) goja.Value {
+		for _, key := range []string{"X-Prism-Header-" + name, name} {
+			if values := r.Header.Values(key); len(values) > 0 {
+				return vm.ToValue(values[0])
+			}
+		}
+
+		return goja.Null()
+	})
+
+	headers.Set("set", func(name, value string) {
+		if name == "" || strings.HasPrefix(http.CanonicalHeaderKey(name), "X-Prism-") {
+			throw("invalid header %q", name)
+		}
+
+		r.Header.Del(name)
+		r.Header.Set("X-Prism-Header-"+name, value)
+	})
+
+	headers.Set("remove", func(name string) {
+		r.Header.Del(name)
+		r.Header.Del("X-Prism-Header-" + name)
+	})
+
+	request.Set("headers", headers)
+
+	vm.Set("request", request)
+
+	// variables
+
+	vars := vm.NewObject()
+
+	vars.Set("get", func(name string) goja.Value {
+		if value, ok := lookup(name); ok {
+			return vm.ToValue(value)
+		}
+
+		return goja.Null()
+	})
+
+	vars.Set("has", func(name string) bool {
+		_, ok := lookup(name)
+		return ok
+	})
+
+	vars.Set("set", func(name, value string) {
+		if !variableNameRegex.MatchString(name) {
+			throw("invalid variable name %q", name)
+		}
+
+		set[name] = value
+	})
+
+	vars.Set("replaceIn", func(text string) string {
+		merged := maps.Clone(variables)
+		maps.Copy(merged, set)
+
+		return expandVariables(text, merged, nil, nil)
+	})
+
+	vm.Set("variables", vars)
+
+	env := vm.NewObject()
+
+	env.Set("get", func(name string) goja.Value {
+		if value, ok := environment[name]; ok {
+			return vm.ToValue(value)
+		}
+
+		return goja.Null()
+	})
+
+	vm.Set("environment", env)
+
+	// crypto
+
+	digest := func(sum []byte, encoding []string) string {
+		var enc string
+
+		if len(encoding) > 0 {
+			enc = encoding[0]
+		}
+
+		switch enc {
+		case "", "hex":
+			return hex.EncodeToString(sum)
+		case "base64":
+			return base64.StdEncoding.EncodeToString(sum)
+		case "base64url":
+			return base64.RawURLEncoding.EncodeToString(sum)
+		}
+
+		throw("unknown encoding %q", enc)
+		return ""
+	}
+
+	hasher := func(alg string) func() hash.Hash {
+		switch strings.ToLower(strings.ReplaceAll(alg, "-", "")) {
+		case "md5":
+			return md5.New
+		case "sha1":
+			return sha1.New
+		case "sha256":
+			return sha256.New
+		case "sha384":
+			return sha512.New384
+		case "sha512":
+			return sha512.New
+		}
+
+		throw("unknown algorithm %q", alg)
+		return nil
+	}
+
+	crypto := vm.NewObject()
+
+	crypto.Set("hmac", func(alg, key, data string, encoding ...string) string {
+		mac := hmac.New(hasher(alg), []byte(key))
+		mac.Write([]byte(data))
+
+		return digest(mac.Sum(nil), encoding)
+	})
+
+	crypto.Set("hash", func(alg, data string, encoding ...string) string {
+		h := hasher(alg)()
+		h.Write([]byte(data))
+
+		return digest(h.Sum(nil), encoding)
+	})
+
+	crypto.Set("randomUUID", newUUID)
+
+	vm.Set("crypto", crypto)
+
+	vm.Set("btoa", func(text string) string {
+		return base64.StdEncoding.EncodeToString([]byte(text))
+	})
+
+	vm.Set("atob", func(text string) string {
+		data, err := base64.StdEncoding.DecodeString(text)
+
+		if err != nil {
+			throw("invalid base64")
+		}
+
+		return string(data)
+	})
+
+	console := vm.NewObject()
+
+	console.Set("log", func(args ...goja.Value) {
+		parts := make([]string, len(args))
+
+		for i, arg := range args {
+			parts[i] = arg.String()
+		}
+
+		slog.Debug("script", "message", strings.Join(parts, " "))
+	})
+
+	vm.Set("console", console)
+
+	if _, err := vm.RunString(source); err != nil {
+		var interrupted *goja.InterruptedError
+
+		if errors.As(err, &interrupted) {
+			return nil, fmt.Errorf("%v", interrupted.Value())
+		}
+
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// scriptURL returns the target URL of a proxied request
+// (/proxy/{scheme}/{host}/{path...}).
+func scriptURL(r *http.Request) string {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.EscapedPath(), "/proxy/"), "/", 3)
+
+	target := parts[0] + "://" + parts[1]
+
+	if len(parts) == 3 {
+		target += "/" + parts[2]
+	}
+
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	return target
+}
+
+// setScriptURL points a proxied request to another HTTP target.
+func setScriptURL(r *http.Request, value string) error {
+	target, err := url.Parse(value)
+
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid URL %q", value)
+	}
+
+	prefix := "/proxy/" + target.Scheme + "/" + target.Host
+
+	r.URL.Path = prefix + target.Path
+	r.URL.RawPath = ""
+
+	if target.RawPath != "" {
+		r.URL.RawPath = prefix + target.EscapedPath()
+	}
+
+	r.URL.RawQuery = target.RawQuery
+
+	return nil
+}
+
+// scriptBody returns the textual body of a request, leaving it readable.
+func scriptBody(r *http.Request) (string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", nil
+	}
+
+	if r.ContentLength > secretsMaxBody {
+		return "", errors.New("body too large")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, secretsMaxBody+1))
+
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) > secretsMaxBody {
+		return "", errors.New("body too large")
+	}
+
+	if !utf8.Valid(data) {
+		return "", errors.New("body is binary")
+	}
+
+	return string(data), nil
+}
+
+// setScriptBody replaces the body of a request.
+func setScriptBody(r *http.Request, text string) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+
+	body := []byte(text)
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.TransferEncoding = nil
+	r.Header.Del("Transfer-Encoding")
+
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
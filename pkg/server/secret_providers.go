@@ -0,0 +1,389 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+const (
+	// secretProviderTimeout bounds a single lookup of an external secret.
+	secretProviderTimeout = 30 * time.Second
+
+	// secretCacheTTL is how long external secrets are reused, so runs and
+	// load tests do not query the provider for every request.
+	secretCacheTTL = time.Minute
+)
+
+// secretProviders are the reference prefixes, {{provider:ref}}.
+var secretProviders = []string{"secret", "keychain", "vault", "op", "env"}
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// externalSecret resolves a reference to a secret of an external provider
+// of the server configuration.
+func (s *Server) externalSecret(provider, ref string) (string, error) {
+	providers := s.config.Load().Secrets
+
+	switch provider {
+	case "env":
+		if len(providers.EnvAllow) == 0 {
+			return "", errors.New("env provider is not configured")
+		}
+
+		return envSecret(providers.EnvAllow, ref)
+
+	case "vault":
+		if providers.Vault == nil {
+			return "", errors.New("vault provider is not configured")
+		}
+
+		return s.cachedSecret(provider, ref, func() (string, error) {
+			return s.vaultSecret(providers.Vault, ref)
+		})
+
+	case "op":
+		if providers.OnePassword == nil {
+			return "", errors.New("1Password provider is not configured")
+		}
+
+		return s.cachedSecret(provider, ref, func() (string, error) {
+			return onePasswordSecret(providers.OnePassword, ref, s.baseUpstreamOptions())
+		})
+	}
+
+	return "", fmt.Errorf("unknown secret provider %q", provider)
+}
+
+// cachedSecret returns a value resolved less than secretCacheTTL ago, or
+// resolves it anew.
+func (s *Server) cachedSecret(provider, ref string, resolve func() (string, error)) (string, error) {
+	key := provider + ":" + ref
+
+	if v, ok := s.secretCache.Load(key); ok {
+		if cached := v.(cachedSecret); time.Now().Before(cached.expires) {
+			return cached.value, nil
+		}
+
+		s.secretCache.Delete(key)
+	}
+
+	value, err := resolve()
+
+	if err != nil {
+		return "", err
+	}
+
+	s.secretCache.Store(key, cachedSecret{value: value, expires: time.Now().Add(secretCacheTTL)})
+
+	return value, nil
+}
+
+// envSecret reads an environment variable matched by allow.
+func envSecret(allow []string, name string) (string, error) {
+	if !envNameRegex.MatchString(name) {
+		return "", errors.New("invalid variable name")
+	}
+
+	allowed := false
+
+	for _, pattern := range allow {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			allowed = allowed || strings.HasPrefix(name, prefix)
+		} else {
+			allowed = allowed || name == pattern
+		}
+	}
+
+	if !allowed {
+		return "", errors.New("variable is not allowed")
+	}
+
+	value, ok := os.LookupEnv(name)
+
+	if !ok {
+		return "", errSecretNotFound
+	}
+
+	return value, nil
+}
+
+// vaultSecret reads a field of a Vault secret, ref being path#field. The
+// field can be left out for secrets with a single field.
+func (s *Server) vaultSecret(provider *config.VaultConfig, ref string) (string, error) {
+	secretPath, field, _ := strings.Cut(ref, "#")
+
+	if secretPath == "" || path.Clean("/"+secretPath) != "/"+secretPath {
+		return "", errors.New("invalid path")
+	}
+
+	address := cmp.Or(provider.Address, os.Getenv("VAULT_ADDR"))
+
+	if address == "" {
+		return "", errors.New("vault address is not configured")
+	}
+
+	token, err := vaultToken(provider)
+
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretProviderTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(address, "/")+"/v1/"+secretPath, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("X-Vault-Request", "true")
+
+	if namespace := cmp.Or(provider.Namespace, os.Getenv("VAULT_NAMESPACE")); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := s.targetClient(s.baseUpstreamOptions(), 0).Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	var result struct {
+		Errors []string       `json:"errors"`
+		Data   map[string]any `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errSecretNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if len(result.Errors) > 0 {
+			return "", fmt.Errorf("vault: %s", strings.Join(result.Errors, "; "))
+		}
+
+		return "", fmt.Errorf("vault: %s", resp.Status)
+	}
+
+	data := result.Data
+
+	// KV v2 nests the fields next to the version metadata
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	if field == "" {
+		if len(data) != 1 {
+			return "", errors.New("secret has several fields, reference one as path#field")
+		}
+
+		for name := range data {
+			field = name
+		}
+	}
+
+	value, ok := data[field]
+
+	if !ok {
+		return "", errSecretNotFound
+	}
+
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+// vaultToken returns the configured token, or else that of the Vault CLI.
+func vaultToken(provider *config.VaultConfig) (string, error) {
+	if provider.Token != "" {
+		return provider.Token, nil
+	}
+
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+
+	return "", errors.New("vault token is not configured")
+}
+
+// onePasswordSecret reads op://ref through the 1Password CLI, which reaches
+// 1Password through the outbound proxy and with the CAs of opts.
+func onePasswordSecret(provider *config.OnePasswordConfig, ref string, opts upstreamOptions) (string, error) {
+	segments := strings.Split(ref, "/")
+
+	if len(segments) < 3 || len(segments) > 4 || strings.Contains(ref, "//") {
+		return "", errors.New("invalid reference, expected vault/item[/section]/field")
+	}
+
+	if _, err := exec.LookPath("op"); err != nil {
+		return "", errors.New("1Password CLI (op) not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretProviderTimeout)
+	defer cancel()
+
+	args := []string{"read", "--no-newline"}
+
+	if provider.Account != "" {
+		args = append(args, "--account", provider.Account)
+	}
+
+	args = append(args, "op://"+ref)
+
+	env, err := onePasswordEnviron(opts)
+
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "op", args...)
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+
+		if message == "" {
+			message = err.Error()
+		}
+
+		return "", errors.New("1Password: " + message)
+	}
+
+	return stdout.String(), nil
+}
+
+// onePasswordEnviron is the environment of the 1Password CLI: that of the
+// process, with the proxy of opts in the variables Go programs read and
+// its CAs in a directory of SSL_CERT_DIR, trusted besides the system ones.
+func onePasswordEnviron(opts upstreamOptions) ([]string, error) {
+	env := os.Environ()
+
+	switch opts.Proxy {
+	case "":
+	case "direct":
+		env = append(env, "NO_PROXY=*")
+	default:
+		env = append(env, "HTTPS_PROXY="+opts.Proxy, "HTTP_PROXY="+opts.Proxy, "NO_PROXY=")
+	}
+
+	if opts.CA != "" {
+		dir, err := caCertDir(opts.CA)
+
+		if err != nil {
+			return nil, err
+		}
+
+		env = append(env, "SSL_CERT_DIR="+dir)
+	}
+
+	return env, nil
+}
+
+// caCertDir writes a PEM bundle into a directory of the user cache named
+// by its digest, so other processes can be pointed at it.
+func caCertDir(bundle string) (string, error) {
+	cache, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(bundle))
+	dir := filepath.Join(cache, "prism", "ca-"+hex.EncodeToString(sum[:8]))
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "ca.pem")
+
+	if _, err := os.Stat(path); err == nil {
+		return dir, nil
+	}
+
+	// written aside and renamed, so a concurrent lookup never reads half
+	tmp, err := os.CreateTemp(dir, "ca.pem.tmp-*")
+
+	if err != nil {
+		return "", err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(bundle); err != nil {
+		tmp.Close()
+		return "", err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// unescapeSecretRef trims a reference and decodes it when it is
+// percent-encoded, as in URLs.
+func unescapeSecretRef(ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+
+	if !strings.Contains(ref, "%") {
+		return ref, nil
+	}
+
+	return url.PathUnescape(ref)
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// secretsFile holds the encrypted secrets, next to the data stores so
+	// it is synced along but never served by the /data endpoints.
+	secretsFile = "secrets.json"
+
+	// secretsIterations is the PBKDF2-SHA256 work factor for new vaults
+	// (OWASP recommendation).
+	secretsIterations = 600_000
+)
+
+var (
+	errSecretsLocked   = errors.New("secrets are locked")
+	errSecretNotFound  = errors.New("secret not found")
+	errWrongPassphrase = errors.New("wrong passphrase")
+	errEmptyPassphrase = errors.New("missing passphrase")
+	errSecretCorrupt   = errors.New("secret cannot be decrypted")
+)
+
+// secretVault is the secrets file: every value is sealed with AES-256-GCM
+// under a key derived from the passphrase, with the secret name as
+// additional data so values cannot be swapped between names. Check seals
+// a fixed value to tell a wrong passphrase on unlock.
+type secretVault struct {
+	Version int `json:"version"`
+
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+
+	Check []byte `json:"check"`
+
+	Secrets map[string]sealedSecret `json:"secrets"`
+}
+
+type sealedSecret struct {
+	Value   []byte    `json:"value"`
+	Updated time.Time `json:"updated"`
+}
+
+var secretsCheck = []byte("prism")
+
+// loadVault reads the secrets file; it returns nil when there is none yet.
+func loadVault(ctx context.Context) (*secretVault, error) {
+	data, err := os.ReadFile(filepath.Join(getDataDir(ctx), secretsFile))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var vault secretVault
+
+	if err := json.Unmarshal(data, &vault); err != nil {
+		return nil, err
+	}
+
+	if vault.KDF != "pbkdf2-sha256" {
+		return nil, errors.New("unsupported secrets key derivation: " + vault.KDF)
+	}
+
+	if vault.Secrets == nil {
+		vault.Secrets = map[string]sealedSecret{}
+	}
+
+	return &vault, nil
+}
+
+func saveVault(ctx context.Context, vault *secretVault) error {
+	data, err := json.MarshalIndent(vault, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(getDataDir(ctx), 0755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(getDataDir(ctx), secretsFile), data, 0600)
+}
+
+// newVault creates an empty vault for passphrase and returns its key.
+func newVault(passphrase string) (*secretVault, []byte, error) {
+	vault := &secretVault{
+		Version: 1,
+
+		KDF:        "pbkdf2-sha256",
+		Iterations: secretsIterations,
+		Salt:       make([]byte, 16),
+
+		Secrets: map[string]sealedSecret{},
+	}
+
+	rand.Read(vault.Salt)
+
+	key, err := vault.deriveKey(passphrase)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if vault.Check, err = sealSecret(key, "", secretsCheck); err != nil {
+		return nil, nil, err
+	}
+
+	return vault, key, nil
+}
+
+func (v *secretVault) deriveKey(passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errEmptyPassphrase
+	}
+
+	return pbkdf2.Key(sha256.New, passphrase, v.Salt, v.Iterations, 32)
+}
+
+// unlock derives the key of passphrase and verifies it against Check.
+func (v *secretVault) unlock(passphrase string) ([]byte, error) {
+	key, err := v.deriveKey(passphrase)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := openSecret(key, "", v.Check); err != nil {
+		return nil, errWrongPassphrase
+	}
+
+	return key, nil
+}
+
+func (v *secretVault) get(key []byte, name string) (string, error) {
+	secret, ok := v.Secrets[name]
+
+	if !ok {
+		return "", errSecretNotFound
+	}
+
+	value, err := openSecret(key, name, secret.Value)
+
+	if err != nil {
+		return "", errSecretCorrupt
+	}
+
+	return string(value), nil
+}
+
+func (v *secretVault) set(key []byte, name, value string) error {
+	sealed, err := sealSecret(key, name, []byte(value))
+
+	if err != nil {
+		return err
+	}
+
+	v.Secrets[name] = sealedSecret{
+		Value:   sealed,
+		Updated: time.Now().UTC(),
+	}
+
+	return nil
+}
+
+// sealSecret encrypts plaintext, returning nonce and ciphertext.
+func sealSecret(key []byte, name string, plaintext []byte) ([]byte, error) {
+	aead, err := newSecretCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+
+	return aead.Seal(nonce, nonce, plaintext, []byte(name)), nil
+}
+
+func openSecret(key []byte, name string, sealed []byte) ([]byte, error) {
+	aead, err := newSecretCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errSecretCorrupt
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, ciphertext, []byte(name))
+}
+
+func newSecretCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -2,15 +2,15 @@ package server
 
 import (
 	"context"
-	"encoding/json"
-	"io"
-	"log"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"log/slog"
 	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/adrianliechti/prism"
@@ -20,14 +20,120 @@ import (
 type Server struct {
 	http.Handler
 
+	// handler behind the access checks, for requests of the server itself
+	api http.Handler
+
+	// replaced when the configuration file changes, see reloadConfig
+	config atomic.Pointer[config.Config]
+
+	logger *slog.Logger
+
+	// token the UI proves its origin with, see requireSession
+	session string
+
+	// events pushed to the windows listening on GET /events
+	events *eventBus
+
+	// set while Serve accepts requests, see handleReadyz
+	ready atomic.Bool
+
+	// number of data changes published, see watchConfig
+	dataChanges atomic.Int64
+
+	// serializes appends to the audit trail
+	auditMu sync.Mutex
+
+	// certificate of HTTPS, nil for plain HTTP
+	tlsConfig *tls.Config
+
+	// PEM of the configured CAs trusted for upstream traffic
+	caCert string
+
+	// shared upstream transports keyed by upstreamOptions
+	transports transportCache
+
+	// slots of the proxied requests in flight, nil when unlimited
+	outbound chan struct{}
+
+	// token buckets of the rate limit keyed by upstream host
+	rateLimits sync.Map
+
+	// spooled response bodies keyed by download token
+	downloads sync.Map
+
+	// cancel funcs of in-flight proxied requests keyed by request ID
+	requests sync.Map
+
+	// raw wire captures keyed by capture ID
+	captures sync.Map
+
+	// staged request bodies keyed by upload ID
+	uploads sync.Map
+
+	// pending OAuth2 authorization-code flows keyed by state
+	oauth2Flows sync.Map
+
+	// fetched JWK sets keyed by URL
+	jwks sync.Map
+
+	// reflected gRPC descriptors keyed by target (scheme://host)
+	grpcReflections sync.Map
+
+	// last JSON-RPC request ID handed out
+	jsonrpcID atomic.Int64
+
 	// remembers which MCP transport (streamable vs. sse) worked per server URL
 	mcpTransports sync.Map
+
+	// persistent MCP sessions keyed by session ID
+	mcpSessions sync.Map
+
+	// sampling requests awaiting approval keyed by ID
+	mcpSamplings sync.Map
+
+	// elicitation requests awaiting user input keyed by ID
+	mcpElicitations sync.Map
+
+	// serializes updates of the data store folder indexes
+	foldersMu sync.Mutex
+
+	// serializes updates of the data store metadata indexes
+	metaMu sync.Mutex
+
+	// string fields of stored entries for searching
+	dataIndex dataIndex
+
+	// serializes git commands on the data directory
+	gitMu sync.Mutex
+
+	// pending auto-commits of data changes keyed by workspace
+	gitTimers  map[string]*time.Timer
+	gitTimerMu sync.Mutex
+
+	// keys of the unlocked secrets stores keyed by workspace
+	secretKeys map[string][]byte
+	secretsMu  sync.Mutex
+
+	// recently resolved external secrets keyed by reference
+	secretCache sync.Map
+
+	// serializes remote sync runs and configuration updates
+	remoteSyncMu sync.Mutex
+
+	// scheduling state of the monitors keyed by ID
+	monitors   map[string]*monitorState
+	monitorsMu sync.Mutex
+
+	// last check of the release feed and the release it found
+	update   *UpdateCheck
+	release  *githubRelease
+	updateMu sync.Mutex
 }
 
 // requireLocalHost rejects requests whose Host is not a loopback name. The
 // server binds localhost only, but without this check a DNS-rebinding page
 // (attacker domain resolving to 127.0.0.1) could read stored requests and
-// spend the server-side OpenAI key.
+// spend the server-side AI keys.
 func requireLocalHost(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		hostname := r.Host
@@ -54,94 +160,318 @@ func New(cfg *config.Config) (*Server, error) {
 	// requireLocalHost stops DNS rebinding (wrong Host); CrossOriginProtection
 	// stops cross-site POSTs a web page can send straight to localhost, which
 	// would otherwise reach the proxy endpoints and invoke MCP tools or spend
-	// the OpenAI key. Same-origin UI requests (browser and app shell) pass via
+	// the AI keys. Same-origin UI requests (browser and app shell) pass via
 	// Sec-Fetch-Site; header-less non-browser clients remain allowed.
+	// requireSession extends this to reads such as proxied GETs.
 	csrf := http.NewCrossOriginProtection()
 
+	if err := initDataDir(cfg.DataDir); err != nil {
+		return nil, err
+	}
+
+	if err := initWorkspace(cfg.Workspace); err != nil {
+		return nil, err
+	}
+
+	if err := initDataStore(cfg.Storage); err != nil {
+		return nil, err
+	}
+
 	s := &Server{
-		Handler: requireLocalHost(csrf.Handler(mux)),
+		logger: slog.Default(),
+
+		session: rand.Text(),
+
+		events: newEventBus(),
+
+		gitTimers: map[string]*time.Timer{},
+
+		secretKeys: map[string][]byte{},
+
+		monitors: map[string]*monitorState{},
+	}
+
+	s.config.Store(cfg)
+
+	if cfg.MaxConcurrentRequests > 0 {
+		s.outbound = make(chan struct{}, cfg.MaxConcurrentRequests)
+	}
+
+	if cfg.TLS {
+		tlsConfig, err := serverTLSConfig(cfg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		s.tlsConfig = tlsConfig
+	}
+
+	if cfg.CACert != "" {
+		ca, err := readCACert(cfg.CACert)
+
+		if err != nil {
+			return nil, err
+		}
+
+		s.caCert = ca
 	}
 
+	// environment variables are substituted before routing, as they may
+	// stand for parts of the proxied URL; bodies are limited before that.
+	// The workspace comes first as the environments belong to it.
+	s.api = s.withWorkspace(s.withRequestLimit(s.withEnvironment(s.withAccessLog(mux))))
+
+	handler := s.requireSession(mux, csrf.Handler(s.api))
+
+	// remote mode replaces the localhost restriction by the access token
+	if cfg.Token != "" {
+		handler = requireToken(cfg.Token, handler)
+	} else {
+		handler = requireLocalHost(handler)
+	}
+
+	// probes of orchestrators carry neither a token nor a local Host
+	probes := http.NewServeMux()
+	probes.HandleFunc("GET /healthz", s.handleHealthz)
+	probes.HandleFunc("GET /readyz", s.handleReadyz)
+	probes.Handle("/", s.withClient(handler))
+
+	s.Handler = probes
+
+	mux.HandleFunc("GET /proxy/grpc/ws/{scheme}/{host}/{path...}", s.handleGRPCWebSocket)
+	mux.HandleFunc("POST /proxy/grpc/{scheme}/{host}/refresh", s.handleGRPCRefresh)
+	mux.HandleFunc("GET /proxy/grpc/{scheme}/{host}/health", s.handleGRPCHealth)
+	mux.HandleFunc("GET /proxy/grpc/{scheme}/{host}/sample", s.handleGRPCSample)
+	mux.HandleFunc("GET /proxy/grpc/{scheme}/{host}/probe", s.handleGRPCProbe)
 	mux.HandleFunc("/proxy/grpc/{scheme}/{host}/{path...}", s.handleGRPC)
+	mux.HandleFunc("GET /proxy/mcp/{scheme}/{host}/info", s.handleMcpInfo)
 	mux.HandleFunc("/proxy/mcp/{scheme}/{host}/features", s.handleMcpListFeatures)
 	mux.HandleFunc("/proxy/mcp/{scheme}/{host}/tool/call", s.handleMcpCallTool)
 	mux.HandleFunc("/proxy/mcp/{scheme}/{host}/resource/call", s.handleMcpReadResource)
+	mux.HandleFunc("/proxy/mcp/{scheme}/{host}/complete", s.handleMcpComplete)
+	mux.HandleFunc("GET /mcp/servers", s.handleMcpServers)
+	mux.HandleFunc("GET /mcp/sessions", s.handleMcpSessionList)
+	mux.HandleFunc("POST /mcp/sessions", s.handleMcpSessionCreate)
+	mux.HandleFunc("DELETE /mcp/sessions/{id}", s.handleMcpSessionDelete)
+	mux.HandleFunc("GET /mcp/sessions/{id}/events", s.handleMcpSessionEvents)
+	mux.HandleFunc("POST /mcp/sampling/{id}", s.handleMcpSampling)
+	mux.HandleFunc("POST /mcp/elicitation/{id}", s.handleMcpElicitation)
+	mux.HandleFunc("POST /proxy/jsonrpc/{scheme}/{host}/{path...}", s.handleJsonRpc)
 	mux.HandleFunc("/proxy/{scheme}/{host}/{path...}", s.handleProxy)
 
-	mux.HandleFunc("GET /data/{store}", s.handleDataList)
-	mux.HandleFunc("GET /data/{store}/{id}", s.handleDataGet)
-	mux.HandleFunc("PUT /data/{store}/{id}", s.handleDataPut)
-	mux.HandleFunc("DELETE /data/{store}/{id}", s.handleDataDelete)
+	mux.HandleFunc("GET /grpc/descriptors/{host}", s.handleGRPCDescriptorsGet)
+	mux.HandleFunc("PUT /grpc/descriptors/{host}", s.handleGRPCDescriptorsPut)
+	mux.HandleFunc("DELETE /grpc/descriptors/{host}", s.handleGRPCDescriptorsDelete)
 
-	if cfg.OpenAI != nil {
-		target, err := url.Parse(cfg.OpenAI.URL)
+	mux.HandleFunc("GET /oauth2/callback", s.handleOAuth2Callback)
+	mux.HandleFunc("GET /oauth2/{name}", s.handleOAuth2Get)
+	mux.HandleFunc("POST /oauth2/{name}/authorize", s.handleOAuth2Authorize)
+	mux.HandleFunc("POST /oauth2/{name}/token", s.handleOAuth2Token)
+	mux.HandleFunc("DELETE /oauth2/{name}/token", s.handleOAuth2Revoke)
 
-		if err != nil {
-			return nil, err
-		}
+	mux.HandleFunc("POST /uploads", s.handleUploadCreate)
+	mux.HandleFunc("DELETE /uploads/{id}", s.handleUploadDelete)
 
-		proxy := &httputil.ReverseProxy{
-			ErrorLog: log.New(io.Discard, "", 0),
+	mux.HandleFunc("GET /downloads/{token}", s.handleDownloadGet)
+	mux.HandleFunc("DELETE /downloads/{token}", s.handleDownloadDelete)
 
-			Rewrite: func(r *httputil.ProxyRequest) {
-				r.Out.URL.Path = strings.TrimPrefix(r.Out.URL.Path, "/openai/v1")
+	mux.HandleFunc("DELETE /requests/{id}", s.handleRequestCancel)
 
-				r.SetURL(target)
+	mux.HandleFunc("GET /events", s.handleEvents)
 
-				if cfg.OpenAI.Token != "" {
-					r.Out.Header.Set("Authorization", "Bearer "+cfg.OpenAI.Token)
-				}
+	mux.HandleFunc("GET /version", s.handleVersion)
+	mux.HandleFunc("GET /version/check", s.handleUpdateCheck)
+	mux.HandleFunc("POST /version/update", s.handleUpdateInstall)
 
-				r.Out.Host = target.Host
-			},
-		}
+	mux.HandleFunc("POST /send", s.handleSend)
+	mux.HandleFunc("POST /runs", s.handleRun)
+	mux.HandleFunc("POST /run/load", s.handleLoadTest)
 
-		mux.Handle("/openai/v1/", proxy)
-	}
+	mux.HandleFunc("GET /monitors", s.handleMonitorList)
+	mux.HandleFunc("GET /monitors/{id}", s.handleMonitorGet)
+	mux.HandleFunc("POST /monitors/{id}/run", s.handleMonitorRun)
+	mux.HandleFunc("GET /monitors/{id}/history", s.handleMonitorHistory)
+	mux.HandleFunc("DELETE /monitors/{id}/history", s.handleMonitorHistoryDelete)
 
-	mux.HandleFunc("GET /config.json", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+	mux.HandleFunc("GET /captures/{id}", s.handleCaptureGet)
 
-		config := &Config{}
+	mux.HandleFunc("GET /audit", s.handleAudit)
+	mux.HandleFunc("GET /audit/export", s.handleAuditExport)
 
-		if cfg.OpenAI != nil {
-			config.AI = &AIConfig{
-				Model: cfg.OpenAI.Model,
-			}
-		}
+	mux.HandleFunc("POST /import/curl", s.handleImportCurl)
+	mux.HandleFunc("POST /import/openapi", s.handleImportOpenAPI)
+	mux.HandleFunc("POST /import/insomnia", s.handleImportInsomnia)
+	mux.HandleFunc("POST /import/har", s.handleImportHAR)
+	mux.HandleFunc("POST /import/workspace", s.handleImportWorkspace)
 
-		json.NewEncoder(w).Encode(config)
-	})
+	mux.HandleFunc("GET /export/snippet", s.handleSnippetLanguages)
+	mux.HandleFunc("POST /export/snippet", s.handleExportSnippet)
+	mux.HandleFunc("GET /export/workspace", s.handleExportWorkspace)
+
+	mux.HandleFunc("POST /tools/validate", s.handleValidate)
+	mux.HandleFunc("POST /tools/assert", s.handleAssert)
+	mux.HandleFunc("POST /tools/jwt/decode", s.handleJWTDecode)
+	mux.HandleFunc("POST /tools/jwt/verify", s.handleJWTVerify)
+	mux.HandleFunc("POST /tools/jwt/sign", s.handleJWTSign)
+
+	mux.HandleFunc("GET /data/search", s.handleDataSearch)
+	mux.HandleFunc("GET /data/{store}", s.handleDataList)
+	mux.HandleFunc("GET /data/{store}/{id}", s.handleDataGet)
+	mux.HandleFunc("PUT /data/{store}/{id}", s.handleDataPut)
+	mux.HandleFunc("DELETE /data/{store}/{id}", s.handleDataDelete)
+	mux.HandleFunc("POST /data/{store}/{id}/duplicate", s.handleDataDuplicate)
+	mux.HandleFunc("POST /data/{store}/{id}/move", s.handleDataMove)
+	mux.HandleFunc("PATCH /data/{store}/{id}/meta", s.handleDataMetaUpdate)
+
+	mux.HandleFunc("GET /folders/{store}", s.handleFolderList)
+	mux.HandleFunc("POST /folders/{store}", s.handleFolderCreate)
+	mux.HandleFunc("POST /folders/{store}/move", s.handleFolderMove)
+	mux.HandleFunc("PATCH /folders/{store}/{id}", s.handleFolderUpdate)
+	mux.HandleFunc("DELETE /folders/{store}/{id}", s.handleFolderDelete)
+
+	mux.HandleFunc("GET /workspaces", s.handleWorkspaceList)
+	mux.HandleFunc("POST /workspaces", s.handleWorkspaceCreate)
+	mux.HandleFunc("PUT /workspaces/active", s.handleWorkspaceActivePut)
+	mux.HandleFunc("DELETE /workspaces/{name}", s.handleWorkspaceDelete)
+
+	mux.HandleFunc("GET /environments/active", s.handleEnvironmentActiveGet)
+	mux.HandleFunc("PUT /environments/active", s.handleEnvironmentActivePut)
+	mux.HandleFunc("POST /environments/resolve", s.handleEnvironmentResolve)
+
+	mux.HandleFunc("GET /secrets", s.handleSecretsStatus)
+	mux.HandleFunc("POST /secrets/unlock", s.handleSecretsUnlock)
+	mux.HandleFunc("POST /secrets/lock", s.handleSecretsLock)
+	mux.HandleFunc("POST /secrets/passphrase", s.handleSecretsPassphrase)
+	mux.HandleFunc("PUT /secrets/{name}", s.handleSecretPut)
+	mux.HandleFunc("DELETE /secrets/{name}", s.handleSecretDelete)
+
+	mux.HandleFunc("GET /keychain", s.handleKeychainStatus)
+	mux.HandleFunc("PUT /keychain/{name}", s.handleKeychainPut)
+	mux.HandleFunc("DELETE /keychain/{name}", s.handleKeychainDelete)
+
+	mux.HandleFunc("GET /sync/git", s.handleGitStatus)
+	mux.HandleFunc("PATCH /sync/git", s.handleGitUpdate)
+	mux.HandleFunc("POST /sync/git/init", s.handleGitInit)
+	mux.HandleFunc("POST /sync/git/clone", s.handleGitClone)
+	mux.HandleFunc("POST /sync/git/commit", s.handleGitCommit)
+	mux.HandleFunc("POST /sync/git/pull", s.handleGitPull)
+	mux.HandleFunc("POST /sync/git/push", s.handleGitPush)
+	mux.HandleFunc("POST /sync/git/abort", s.handleGitAbort)
+
+	mux.HandleFunc("GET /sync/remote", s.handleRemoteSyncStatus)
+	mux.HandleFunc("PUT /sync/remote", s.handleRemoteSyncUpdate)
+	mux.HandleFunc("DELETE /sync/remote", s.handleRemoteSyncDelete)
+	mux.HandleFunc("POST /sync/remote/push", s.handleRemoteSyncPush)
+	mux.HandleFunc("POST /sync/remote/pull", s.handleRemoteSyncPull)
+
+	mux.HandleFunc("/openai/v1/", s.handleOpenAI)
+	mux.HandleFunc("POST /ai/generate-request", s.handleGenerateRequest)
+	mux.HandleFunc("GET /config.json", s.handleConfig)
 
 	mux.Handle("/", http.FileServerFS(prism.DistFS))
 
 	return s, nil
 }
 
-// Serve runs until ctx is cancelled, then shuts down gracefully with a timeout.
+// shutdownTimeout bounds how long in-flight requests may drain on
+// shutdown; those still running then are cancelled.
+const shutdownTimeout = 10 * time.Second
+
+// Serve runs until ctx is cancelled, then stops accepting connections,
+// drains in-flight requests and commits pending data changes.
 func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	defer s.Shutdown()
+
+	s.Start(ctx)
+
+	// requests outlive ctx to drain; cancelRequests aborts the stragglers
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
 	srv := &http.Server{
-		Handler: s,
+		Handler:   s,
+		TLSConfig: s.tlsConfig,
+
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
+
+		// failed handshakes and the like are the clients' business
+		ErrorLog: slog.NewLogLogger(s.logger.Handler(), slog.LevelDebug),
+	}
+
+	// event streams never go idle on their own
+	srv.RegisterOnShutdown(s.closeMcpSessions)
+	srv.RegisterOnShutdown(s.events.close)
+
+	serve := srv.Serve
+
+	if s.tlsConfig != nil {
+		serve = func(l net.Listener) error {
+			return srv.ServeTLS(l, "", "")
+		}
 	}
 
 	serverErr := make(chan error, 1)
 	go func() {
-		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+		if err := serve(listener); err != nil && err != http.ErrServerClosed {
 			serverErr <- err
 			return
 		}
 		serverErr <- nil
 	}()
 
+	s.ready.Store(true)
+
 	select {
 	case <-ctx.Done():
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := srv.Shutdown(shutdownCtx); err != nil {
-			return err
-		}
-		return nil
 	case err := <-serverErr:
+		s.ready.Store(false)
 		return err
 	}
+
+	s.ready.Store(false)
+
+	s.logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+
+		s.logger.Warn("cancelling requests still running after " + shutdownTimeout.String())
+
+		cancelRequests()
+		srv.Close()
+	}
+
+	return nil
+}
+
+// Start runs the background work of the server, scheduled monitors, the
+// reloading of the configuration file and environments and the update
+// checks, until ctx is done. Serve calls it; embedders serving the handler
+// themselves (the desktop app) call it before and Shutdown after.
+func (s *Server) Start(ctx context.Context) {
+	go s.runMonitors(ctx)
+	go s.watchConfig(ctx)
+	go s.watchUpdates(ctx)
+}
+
+// Shutdown releases what the server holds once it stopped serving: the
+// pending git commit is made, MCP sessions and event streams are closed and
+// temporary uploads and downloads removed. Serve calls it on return;
+// embedders serving the handler themselves (the desktop app) call it when
+// they are done.
+func (s *Server) Shutdown() {
+	s.flushGitCommit()
+	s.closeMcpSessions()
+	s.events.close()
+
+	s.removeDownloads()
+	s.removeUploads()
 }
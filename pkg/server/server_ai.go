@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+// aiProviderHeader selects the provider of a request to /openai/v1/ by
+// name, the default one when absent.
+const aiProviderHeader = "X-Prism-AI-Provider"
+
+// handleOpenAI handles /openai/v1/, forwarding to the OpenAI-compatible API
+// of the provider the request selects with its credentials. Providers
+// without the Responses API get POST /responses translated to chat
+// completions, see handleResponses.
+func (s *Server) handleOpenAI(w http.ResponseWriter, r *http.Request) {
+	provider := s.config.Load().AIProvider(r.Header.Get(aiProviderHeader))
+
+	if provider == nil {
+		writeProxyError(w, http.StatusNotFound, errors.New("no such AI provider"))
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/openai/v1")
+
+	if path == "/responses" && r.Method == http.MethodPost && !nativeResponses(provider) {
+		s.handleResponses(w, r, provider)
+		return
+	}
+
+	// validated when the configuration was read
+	target, _ := url.Parse(provider.URL)
+
+	proxy := &httputil.ReverseProxy{
+		Transport: s.targetClient(s.baseUpstreamOptions(), 0).Transport,
+
+		ErrorLog: slog.NewLogLogger(s.logger.Handler(), slog.LevelWarn),
+
+		// every write is flushed, so streamed completions pass token by
+		// token; the proxy drops hop-by-hop headers both ways
+		FlushInterval: -1,
+
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Path = path
+			r.Out.URL.RawPath = ""
+
+			r.SetURL(target)
+
+			// the provider sees neither the browser nor prism
+			r.Out.Header.Del("Origin")
+			r.Out.Header.Del("Referer")
+			r.Out.Header.Del("Cookie")
+
+			for key := range r.Out.Header {
+				if strings.HasPrefix(key, "Sec-") || strings.HasPrefix(key, "X-Prism-") {
+					r.Out.Header.Del(key)
+				}
+			}
+
+			authorizeAIRequest(r.Out, provider)
+
+			r.Out.Host = target.Host
+		},
+
+		ModifyResponse: func(resp *http.Response) error {
+			if isEventStream(resp.Header) {
+				setStreamHeaders(resp.Header)
+			}
+
+			return nil
+		},
+
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			writeProxyError(w, upstreamStatus(err), err)
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+}
+
+// nativeResponses tells whether provider serves the Responses API the chat
+// of the UI uses; the others only serve chat completions.
+func nativeResponses(provider *config.AIProviderConfig) bool {
+	return provider.Type == config.AIProviderOpenAI || provider.Type == config.AIProviderAzure
+}
+
+// authorizeAIRequest replaces the credentials of req, those of the UI or of
+// the server, with the token of provider, in the header its type expects.
+// The response is asked for uncompressed, as compressing providers may hold
+// back streamed events until a block fills.
+func authorizeAIRequest(req *http.Request, provider *config.AIProviderConfig) {
+	req.Header.Del("Authorization")
+	req.Header.Del("Api-Key")
+
+	req.Header.Set("Accept-Encoding", "identity")
+
+	if provider.Type == config.AIProviderAzure && provider.APIVersion != "" {
+		query := req.URL.Query()
+		query.Set("api-version", provider.APIVersion)
+
+		req.URL.RawQuery = query.Encode()
+	}
+
+	if provider.Token == "" {
+		return
+	}
+
+	if provider.Type == config.AIProviderAzure {
+		req.Header.Set("Api-Key", provider.Token)
+		return
+	}
+
+	req.Header.Set("Authorization", "Bearer "+provider.Token)
+}
+
+// newAIRequest returns a POST of the JSON body to path below the base URL
+// of provider, authorized with its token.
+func newAIRequest(ctx context.Context, provider *config.AIProviderConfig, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(provider.URL, "/")+path, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	authorizeAIRequest(req, provider)
+
+	return req, nil
+}
+
+// chatCompletion returns the answer of provider to messages, and the model
+// that wrote it.
+func (s *Server) chatCompletion(ctx context.Context, provider *config.AIProviderConfig, messages []map[string]any) (string, string, error) {
+	data, err := json.Marshal(map[string]any{
+		"model":    provider.Model,
+		"messages": messages,
+	})
+
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := newAIRequest(ctx, provider, "/chat/completions", data)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, err := s.targetClient(s.baseUpstreamOptions(), 0).Do(req)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	defer resp.Body.Close()
+
+	var result struct {
+		Model string `json:"model"`
+
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&result); err != nil && resp.StatusCode < 300 {
+		return "", "", fmt.Errorf("invalid completion response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		if result.Error != nil && result.Error.Message != "" {
+			return "", "", fmt.Errorf("completion request failed: %s", result.Error.Message)
+		}
+
+		return "", "", fmt.Errorf("completion request failed: %s", resp.Status)
+	}
+
+	if len(result.Choices) == 0 {
+		return "", "", errors.New("completion response has no choices")
+	}
+
+	return result.Choices[0].Message.Content, cmp.Or(result.Model, provider.Model), nil
+}
+
+// isEventStream tells whether h is of a stream of Server-Sent Events.
+func isEventStream(h http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// setStreamHeaders keeps caches and buffering proxies in front of prism,
+// such as nginx, from holding back a stream of events.
+func setStreamHeaders(h http.Header) {
+	h.Del("Content-Length")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+}
@@ -0,0 +1,357 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// generateRequestTimeout bounds POST /ai/generate-request, corrections
+	// included.
+	generateRequestTimeout = 2 * time.Minute
+
+	// generateRequestAttempts is how often the provider may write a body,
+	// the first time included.
+	generateRequestAttempts = 3
+)
+
+// generateRequestPrompt instructs the provider writing a request body.
+const generateRequestPrompt = `You write the JSON bodies of API requests.
+Answer with the JSON body only: no explanation, no code fence.
+The body must be valid against the JSON Schema given. Use realistic values fitting the intent and leave out optional fields the intent does not need.`
+
+// requestSchema is what a generated body is checked against. Local $refs
+// of schema are looked up in root.
+type requestSchema struct {
+	root, schema any
+
+	// operation names the OpenAPI operation or gRPC method, if any, which
+	// description tells the provider about
+	operation   string
+	description string
+
+	// check finds what the schema cannot tell, if set
+	check func(body []byte) *SchemaViolation
+}
+
+// handleGenerateRequest handles POST /ai/generate-request, a request body
+// written by an AI provider for an operation and checked against its schema.
+// Violations are part of a successful result; only unusable input is an
+// error.
+// Request body: RequestGeneration
+func (s *Server) handleGenerateRequest(w http.ResponseWriter, r *http.Request) {
+	var req RequestGeneration
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxOpenAPISize+(1<<20))).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Intent) == "" {
+		http.Error(w, "intent is required", http.StatusBadRequest)
+		return
+	}
+
+	provider := s.config.Load().AIProvider(req.Provider)
+
+	if provider == nil {
+		http.Error(w, "no such AI provider", http.StatusNotFound)
+		return
+	}
+
+	target, err := s.generationSchema(r, &req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	schema, err := json.MarshalIndent(target.schema, "", "  ")
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	prompt := fmt.Sprintf("JSON Schema of the body:\n%s\n\nIntent: %s", schema, req.Intent)
+
+	if target.description != "" {
+		prompt = "Operation: " + target.description + "\n\n" + prompt
+	}
+
+	messages := []map[string]any{
+		{"role": "system", "content": generateRequestPrompt},
+		{"role": "user", "content": prompt},
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), generateRequestTimeout)
+	defer cancel()
+
+	result := &GeneratedRequest{
+		Operation: target.operation,
+		Provider:  provider.Name,
+	}
+
+	for result.Attempts < generateRequestAttempts {
+		answer, model, err := s.chatCompletion(ctx, provider, messages)
+
+		if err != nil {
+			writeProxyError(w, upstreamStatus(err), err)
+			return
+		}
+
+		result.Attempts++
+		result.Model = model
+
+		result.Body, result.Violations = target.validate(answer)
+
+		if len(result.Violations) == 0 {
+			break
+		}
+
+		var correction strings.Builder
+
+		correction.WriteString("The body is invalid:\n")
+
+		for _, violation := range result.Violations {
+			fmt.Fprintf(&correction, "- %s: %s\n", violationPath(violation.Path), violation.Message)
+		}
+
+		correction.WriteString("Answer with the corrected JSON body only.")
+
+		messages = append(messages,
+			map[string]any{"role": "assistant", "content": answer},
+			map[string]any{"role": "user", "content": correction.String()},
+		)
+	}
+
+	if result.Violations == nil {
+		result.Violations = []SchemaViolation{}
+	}
+
+	result.Valid = len(result.Violations) == 0
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// violationPath names the body itself in violations told to the provider.
+func violationPath(path string) string {
+	if path == "" {
+		return "(body)"
+	}
+
+	return path
+}
+
+// validate checks the body of answer, which may come in a code fence.
+func (t *requestSchema) validate(answer string) (json.RawMessage, []SchemaViolation) {
+	text := strings.TrimSpace(answer)
+
+	if fenced, ok := strings.CutPrefix(text, "```"); ok {
+		// the fence may name the language
+		_, fenced, _ = strings.Cut(fenced, "\n")
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fenced), "```"))
+	}
+
+	var instance any
+
+	if err := json.Unmarshal([]byte(text), &instance); err != nil {
+		return nil, []SchemaViolation{{
+			Keyword: "json",
+			Message: "body is not valid JSON: " + err.Error(),
+		}}
+	}
+
+	body := json.RawMessage(text)
+
+	violations := validateSchema(t.root, t.schema, instance)
+
+	if len(violations) == 0 && t.check != nil {
+		if violation := t.check(body); violation != nil {
+			violations = append(violations, *violation)
+		}
+	}
+
+	return body, violations
+}
+
+// generationSchema returns the schema of the body req asks for.
+func (s *Server) generationSchema(r *http.Request, req *RequestGeneration) (*requestSchema, error) {
+	switch {
+	case len(req.Schema) > 0:
+		var schema any
+
+		if err := json.Unmarshal(req.Schema, &schema); err != nil {
+			return nil, fmt.Errorf("invalid schema: %w", err)
+		}
+
+		return &requestSchema{root: schema, schema: schema}, nil
+
+	case req.OpenAPI != nil:
+		data, _, err := s.openapiSource(r, req.OpenAPI)
+
+		if err != nil {
+			return nil, err
+		}
+
+		doc, raw, err := parseOpenAPI(data)
+
+		if err != nil {
+			return nil, fmt.Errorf("openapi: %w", err)
+		}
+
+		operations, err := openapiOperations(doc)
+
+		if err != nil {
+			return nil, fmt.Errorf("openapi: %w", err)
+		}
+
+		op, err := findOpenAPIOperation(doc, operations, req.Operation)
+
+		if err != nil {
+			return nil, err
+		}
+
+		body := preferredRequestBody(op.RequestBodies)
+
+		if body == nil {
+			return nil, fmt.Errorf("operation %s takes no request body", op.ID)
+		}
+
+		if !isJSONMediaType(body.ContentType) || body.Schema == nil {
+			return nil, fmt.Errorf("operation %s takes %s, only JSON bodies with a schema can be generated", op.ID, body.ContentType)
+		}
+
+		// unresolved (recursive) $refs point into the raw document
+		root, err := jsonNormalize(raw)
+
+		if err != nil {
+			return nil, err
+		}
+
+		schema, err := jsonNormalize(body.Schema)
+
+		if err != nil {
+			return nil, err
+		}
+
+		description := op.Method + " " + op.Path
+
+		if summary := strings.TrimSpace(op.Summary + "\n" + op.Description); summary != "" {
+			description += " (" + summary + ")"
+		}
+
+		return &requestSchema{root: root, schema: schema, operation: op.ID, description: description}, nil
+
+	case req.GRPC != nil:
+		md, err := s.generationMethod(r.Context(), req.GRPC)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the validator expects the types JSON decodes to
+		schema, err := jsonNormalize(protoMessageSchema(md.Input()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &requestSchema{
+			root:   schema,
+			schema: schema,
+
+			operation:   string(md.FullName()),
+			description: "gRPC method " + string(md.FullName()) + " taking " + string(md.Input().FullName()),
+
+			// protojson knows what the schema cannot tell, such as
+			// members of a oneof set together
+			check: func(body []byte) *SchemaViolation {
+				if err := protojson.Unmarshal(body, dynamicpb.NewMessage(md.Input())); err != nil {
+					return &SchemaViolation{Keyword: "protojson", Message: err.Error()}
+				}
+
+				return nil
+			},
+		}, nil
+	}
+
+	return nil, errors.New("one of schema, openapi or grpc is required")
+}
+
+// generationMethod returns the method req names, from the descriptors it
+// carries or those known of its target.
+func (s *Server) generationMethod(ctx context.Context, req *RequestGenerationGRPC) (protoreflect.MethodDescriptor, error) {
+	if req.Service == "" || req.Method == "" {
+		return nil, errors.New("grpc: service and method are required")
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+
+	switch {
+	case len(req.Protos) > 0:
+		compiled, err := compileProtos(ctx, req.Protos)
+
+		if err != nil {
+			return nil, fmt.Errorf("grpc: compile: %w", err)
+		}
+
+		set = compiled
+
+	case len(req.DescriptorSet) > 0:
+		if err := proto.Unmarshal(req.DescriptorSet, set); err != nil {
+			return nil, fmt.Errorf("grpc: invalid descriptor set: %w", err)
+		}
+
+	case req.Target != "":
+		u, err := url.Parse(req.Target)
+
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("grpc: invalid target %q, expected scheme://host", req.Target)
+		}
+
+		if value, ok := s.grpcReflections.Load(grpcTarget(u.Scheme, u.Host)); ok {
+			return value.(*grpcReflectionEntry).method(req.Service, req.Method)
+		}
+
+		files, err := loadGRPCDescriptors(ctx, u.Host)
+
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("grpc: no descriptors known of %s, reflect it or upload them first", req.Target)
+			}
+
+			return nil, fmt.Errorf("grpc: %w", err)
+		}
+
+		return lookupMethod(files, req.Service, req.Method)
+
+	default:
+		return nil, errors.New("grpc: one of protos, descriptorSet or target is required")
+	}
+
+	completeDescriptorSet(set)
+
+	files, err := protodesc.NewFiles(set)
+
+	if err != nil {
+		return nil, fmt.Errorf("grpc: invalid descriptor set: %w", err)
+	}
+
+	return lookupMethod(files, req.Service, req.Method)
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// assertionsMaxBody is the largest response body body and json assertions
+// and extractors inspect; larger bodies fail them.
+const assertionsMaxBody = 16 << 20
+
+// parseAssertions reads the assertions of a proxied request from
+// X-Prism-Assert (a JSON array of Assertion).
+func parseAssertions(r *http.Request) ([]Assertion, error) {
+	value := r.Header.Get("X-Prism-Assert")
+
+	if value == "" {
+		return nil, nil
+	}
+
+	var assertions []Assertion
+
+	if err := json.Unmarshal([]byte(value), &assertions); err != nil {
+		return nil, fmt.Errorf("invalid X-Prism-Assert: %w", err)
+	}
+
+	return assertions, nil
+}
+
+// responseChecks are the assertions and extractors of a proxied request.
+// Values extracted from its response are stored into environment when set.
+type responseChecks struct {
+	start time.Time
+
+	assertions []Assertion
+	extractors []Extractor
+
+	environment string
+}
+
+// active reports whether the response needs checking at all.
+func (c *responseChecks) active() bool {
+	return c.assertions != nil || c.extractors != nil
+}
+
+// checkResponse evaluates the checks against a proxied response and
+// reports the results as X-Prism-Assertions (AssertionReport) and
+// X-Prism-Extracted ([]ExtractionResult). The body is buffered when
+// inspected unless it is a stream or was truncated.
+func (s *Server) checkResponse(ctx context.Context, resp *http.Response, checks *responseChecks, withBody bool) error {
+	result := &assertionResponse{
+		status:   resp.StatusCode,
+		header:   resp.Header,
+		duration: float64(time.Since(checks.start).Microseconds()) / 1000,
+	}
+
+	switch mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType {
+	case "text/event-stream", "application/x-ndjson":
+		withBody = false
+	}
+
+	// a truncated body would fail or pass them by accident
+	if resp.Header.Get("X-Prism-Truncated") != "" {
+		withBody = false
+	}
+
+	if withBody && (needsBody(checks.assertions) || len(checks.extractors) > 0) {
+		body := resp.Body
+
+		data, err := io.ReadAll(io.LimitReader(body, assertionsMaxBody+1))
+
+		if err != nil {
+			body.Close()
+			return err
+		}
+
+		if len(data) > assertionsMaxBody {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(data), body), body}
+		} else {
+			body.Close()
+
+			result.body = data
+			resp.Body = io.NopCloser(bytes.NewReader(data))
+		}
+	}
+
+	if checks.assertions != nil {
+		data, err := json.Marshal(evaluateAssertions(checks.assertions, result))
+
+		if err != nil {
+			return err
+		}
+
+		resp.Header.Set("X-Prism-Assertions", string(data))
+	}
+
+	if checks.extractors != nil {
+		results := extractValues(checks.extractors, result)
+
+		if checks.environment != "" {
+			if err := s.storeExtracted(ctx, checks.environment, results); err != nil {
+				return fmt.Errorf("store extracted values: %w", err)
+			}
+		}
+
+		data, err := json.Marshal(results)
+
+		if err != nil {
+			return err
+		}
+
+		resp.Header.Set("X-Prism-Extracted", string(data))
+	}
+
+	return nil
+}
+
+// handleAssert handles POST /tools/assert. Failed assertions are part of a
+// successful result.
+// Request body: AssertionRequest
+func (s *Server) handleAssert(w http.ResponseWriter, r *http.Request) {
+	var req AssertionRequest
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, assertionsMaxBody+(1<<20))).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	header := http.Header{}
+
+	for key, values := range req.Headers {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	report := evaluateAssertions(req.Assertions, &assertionResponse{
+		status:   req.Status,
+		header:   header,
+		body:     []byte(req.Body),
+		duration: req.Duration,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
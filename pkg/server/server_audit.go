@@ -0,0 +1,321 @@
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// auditFilter selects entries of the audit trail, see parseAuditFilter.
+type auditFilter struct {
+	from, to time.Time
+
+	user   string
+	client string
+	method string
+	target string
+	status int
+}
+
+// parseAuditFilter reads from and to (RFC 3339 times, or dates including
+// the whole day of to), user, client, method, target (a part of
+// scheme://host) and status.
+func parseAuditFilter(query url.Values) (auditFilter, error) {
+	filter := auditFilter{
+		user:   query.Get("user"),
+		client: query.Get("client"),
+		method: strings.ToUpper(query.Get("method")),
+		target: strings.ToLower(query.Get("target")),
+	}
+
+	if value := query.Get("from"); value != "" {
+		from, err := parseAuditTime(value, false)
+
+		if err != nil {
+			return filter, errors.New("invalid from")
+		}
+
+		filter.from = from
+	}
+
+	if value := query.Get("to"); value != "" {
+		to, err := parseAuditTime(value, true)
+
+		if err != nil {
+			return filter, errors.New("invalid to")
+		}
+
+		filter.to = to
+	}
+
+	if value := query.Get("status"); value != "" {
+		status, err := strconv.Atoi(value)
+
+		if err != nil || status < 100 || status > 599 {
+			return filter, errors.New("invalid status")
+		}
+
+		filter.status = status
+	}
+
+	return filter, nil
+}
+
+// parseAuditTime parses an RFC 3339 time or a date (UTC), its end when end
+// is set.
+func parseAuditTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return t, nil
+}
+
+func (f *auditFilter) matches(entry *AuditEntry) bool {
+	switch {
+	case !f.from.IsZero() && entry.Time.Before(f.from):
+		return false
+	case !f.to.IsZero() && entry.Time.After(f.to):
+		return false
+	case f.user != "" && entry.User != f.user:
+		return false
+	case f.client != "" && entry.Client != f.client:
+		return false
+	case f.method != "" && entry.Method != f.method:
+		return false
+	case f.target != "" && !strings.Contains(strings.ToLower(entry.Target), f.target):
+		return false
+	case f.status != 0 && entry.Status != f.status:
+		return false
+	}
+
+	return true
+}
+
+// auditFiles returns the files of the audit trail of the days in the
+// range of filter, oldest first.
+func auditFiles(filter auditFilter) ([]string, error) {
+	dir := filepath.Join(dataRoot(), auditDir)
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var files []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+
+		// names sort like their days
+		if !filter.from.IsZero() && name < auditFile(filter.from) {
+			continue
+		}
+
+		if !filter.to.IsZero() && name > auditFile(filter.to) {
+			continue
+		}
+
+		files = append(files, filepath.Join(dir, name))
+	}
+
+	slices.Sort(files)
+
+	return files, nil
+}
+
+// readAuditFile calls fn with the entries of a file of the audit trail
+// matching filter, oldest first; unreadable lines are skipped.
+func readAuditFile(path string, filter auditFilter, fn func(*AuditEntry) error) error {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+		var entry AuditEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		if !filter.matches(&entry) {
+			continue
+		}
+
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// handleAudit handles GET /audit[?from=&to=&user=&client=&method=&target=
+// &status=&limit=100], the matching entries of the audit trail, newest
+// first.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := 100
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		limit = n
+	}
+
+	files, err := auditFiles(filter)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := []AuditEntry{}
+
+	for _, file := range slices.Backward(files) {
+		var day []AuditEntry
+
+		err := readAuditFile(file, filter, func(entry *AuditEntry) error {
+			day = append(day, *entry)
+			return nil
+		})
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		slices.Reverse(day)
+
+		result = append(result, day[:min(limit-len(result), len(day))]...)
+
+		if len(result) >= limit {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleAuditExport handles GET /audit/export[?format=jsonl|csv&from=...],
+// a download of the matching entries of the audit trail, oldest first,
+// taking the filters of GET /audit.
+func (s *Server) handleAuditExport(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+
+	if format == "" {
+		format = "jsonl"
+	}
+
+	if format != "jsonl" && format != "csv" {
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	files, err := auditFiles(filter)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := "prism-audit-" + time.Now().Format("20060102") + "." + format
+
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	var write func(*AuditEntry) error
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+
+		records := csv.NewWriter(w)
+		defer records.Flush()
+
+		records.Write([]string{"time", "user", "client", "method", "protocol", "target", "status", "bytes", "duration"})
+
+		write = func(entry *AuditEntry) error {
+			return records.Write([]string{
+				entry.Time.Format(time.RFC3339Nano),
+				entry.User,
+				entry.Client,
+				entry.Method,
+				entry.Protocol,
+				entry.Target,
+				strconv.Itoa(entry.Status),
+				strconv.FormatInt(entry.Bytes, 10),
+				strconv.FormatFloat(entry.Duration, 'f', -1, 64),
+			})
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+
+		encoder := json.NewEncoder(w)
+
+		write = func(entry *AuditEntry) error {
+			return encoder.Encode(entry)
+		}
+	}
+
+	for _, file := range files {
+		// the response has started, a failure can only cut it short
+		if err := readAuditFile(file, filter, write); err != nil {
+			s.logger.Warn("audit export failed", "file", file, "error", err)
+			return
+		}
+	}
+}
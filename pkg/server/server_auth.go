@@ -0,0 +1,79 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// tokenCookie carries the access token of remote mode for the UI.
+const tokenCookie = "prism_token"
+
+// requireToken rejects requests without the access token of remote mode.
+// Clients send it as bearer token; the UI is opened with ?token=..., which
+// is swapped for a cookie. Neither reaches the handlers, so it is never
+// forwarded upstream. SameSite keeps other sites from riding on the
+// cookie, and a page cannot learn the token, so the Host check against
+// DNS rebinding is not needed.
+func requireToken(token string, next http.Handler) http.Handler {
+	valid := func(value string) bool {
+		return value != "" && subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if query := r.URL.Query(); query.Has("token") && r.Method == http.MethodGet {
+			if !valid(query.Get("token")) {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:  tokenCookie,
+				Value: token,
+				Path:  "/",
+
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+
+			query.Del("token")
+
+			target := *r.URL
+			target.RawQuery = query.Encode()
+
+			http.Redirect(w, r, target.RequestURI(), http.StatusSeeOther)
+			return
+		}
+
+		if value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && valid(value) {
+			r.Header.Del("Authorization")
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cookie, err := r.Cookie(tokenCookie); err == nil && valid(cookie.Value) {
+			removeCookie(r, tokenCookie)
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="prism"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// removeCookie drops a cookie from the Cookie header of r.
+func removeCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+
+	r.Header.Del("Cookie")
+
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			r.AddCookie(cookie)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+)
+
+const (
+	// captureTTL bounds how long captures are kept in memory.
+	captureTTL = 15 * time.Minute
+
+	// maxCaptureBody caps the recorded bytes of each request/response body.
+	maxCaptureBody = 1 << 20
+)
+
+type captureEntry struct {
+	mu sync.Mutex
+
+	exchanges []*capturedExchange
+	expires   time.Time
+}
+
+// capturedExchange collects one request/response pair; bodies fill in while
+// they stream through.
+type capturedExchange struct {
+	requestHead  []byte
+	requestBody  limitedBuffer
+	responseHead []byte
+	responseBody limitedBuffer
+	err          string
+}
+
+// limitedBuffer keeps the first maxCaptureBody bytes written to it.
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if room := maxCaptureBody - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) snapshot() ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return bytes.Clone(b.buf.Bytes()), b.truncated
+}
+
+// teeBody copies everything read from a body into a capture buffer.
+type teeBody struct {
+	io.Reader
+	io.Closer
+}
+
+// captureTransport records the raw wire form of every round trip.
+type captureTransport struct {
+	base  http.RoundTripper
+	entry *captureEntry
+
+	// headers masked in the recorded request and response heads
+	redactRequest  []string
+	redactResponse []string
+}
+
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := &capturedExchange{}
+
+	t.entry.mu.Lock()
+	t.entry.exchanges = append(t.entry.exchanges, exchange)
+	t.entry.mu.Unlock()
+
+	// DumpRequestOut reports the request as the transport sends it (added
+	// User-Agent, Accept-Encoding, chunking); the body is recorded as it
+	// streams instead of being buffered up front. The dump runs a fake round
+	// trip, so it must not see the request's trace hooks.
+	dump := req.WithContext(context.Background())
+	dump.Header = redactHeader(dump.Header, t.redactRequest)
+
+	if head, err := httputil.DumpRequestOut(dump, false); err == nil {
+		exchange.requestHead = head
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &teeBody{Reader: io.TeeReader(req.Body, &exchange.requestBody), Closer: req.Body}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+
+	if err != nil {
+		exchange.err = err.Error()
+		return nil, err
+	}
+
+	dumpResp := *resp
+	dumpResp.Header = redactHeader(resp.Header, t.redactResponse)
+
+	if head, err := httputil.DumpResponse(&dumpResp, false); err == nil {
+		exchange.responseHead = head
+	}
+
+	resp.Body = &teeBody{Reader: io.TeeReader(resp.Body, &exchange.responseBody), Closer: resp.Body}
+
+	return resp, nil
+}
+
+// newCapture registers an empty capture and returns its ID.
+func (s *Server) newCapture() (string, *captureEntry) {
+	s.purgeCaptures()
+
+	id := rand.Text()
+
+	entry := &captureEntry{
+		expires: time.Now().Add(captureTTL),
+	}
+
+	s.captures.Store(id, entry)
+
+	return id, entry
+}
+
+func (s *Server) purgeCaptures() {
+	now := time.Now()
+
+	s.captures.Range(func(key, value any) bool {
+		if now.After(value.(*captureEntry).expires) {
+			s.captures.Delete(key)
+		}
+
+		return true
+	})
+}
+
+// handleCaptureGet handles GET /captures/{id}. Raw bytes are base64-encoded
+// by the JSON encoder so binary payloads survive exactly.
+func (s *Server) handleCaptureGet(w http.ResponseWriter, r *http.Request) {
+	value, ok := s.captures.Load(r.PathValue("id"))
+
+	if !ok || time.Now().After(value.(*captureEntry).expires) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	entry := value.(*captureEntry)
+
+	entry.mu.Lock()
+	exchanges := append([]*capturedExchange(nil), entry.exchanges...)
+	entry.mu.Unlock()
+
+	result := Capture{
+		ID:        r.PathValue("id"),
+		Exchanges: []CaptureExchange{},
+	}
+
+	for _, e := range exchanges {
+		requestBody, requestTruncated := e.requestBody.snapshot()
+		responseBody, responseTruncated := e.responseBody.snapshot()
+
+		exchange := CaptureExchange{
+			Request:   append(bytes.Clone(e.requestHead), requestBody...),
+			Error:     e.err,
+			Truncated: requestTruncated || responseTruncated,
+		}
+
+		if e.responseHead != nil {
+			exchange.Response = append(bytes.Clone(e.responseHead), responseBody...)
+		}
+
+		result.Exchanges = append(result.Exchanges, exchange)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+// configPollInterval is how often the configuration file and the stored
+// environments are checked for changes. Polling also notices changes on
+// network drives and bind mounts, which file system events miss.
+const configPollInterval = 2 * time.Second
+
+// handleConfig handles GET /config.json, the settings of the UI.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.clientConfig())
+}
+
+func (s *Server) clientConfig() *Config {
+	result := &Config{}
+
+	cfg := s.config.Load()
+
+	if provider := cfg.AIProvider(""); provider != nil {
+		result.AI = &AIConfig{
+			Model:    provider.Model,
+			Provider: provider.Name,
+		}
+
+		for _, p := range cfg.AIProviders {
+			result.AI.Providers = append(result.AI.Providers, AIProvider{
+				Name:  p.Name,
+				Type:  p.Type,
+				Model: p.Model,
+			})
+		}
+	}
+
+	return result
+}
+
+// watchConfig reloads the configuration file when it changes and tells the
+// windows of environments of any workspace changed on disk by others, e.g.
+// an editor, until ctx is cancelled.
+func (s *Server) watchConfig(ctx context.Context) {
+	file := s.config.Load().File
+
+	fileStamp := statStamp(file)
+	envStamps := environmentStamps(ctx)
+	changes := s.dataChanges.Load()
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if file != "" {
+			if stamp := statStamp(file); stamp != fileStamp {
+				fileStamp = stamp
+				s.reloadConfig()
+			}
+		}
+
+		// stamp before counting, so a change published meanwhile is
+		// counted by the next round at the latest
+		stamps := environmentStamps(ctx)
+		count := s.dataChanges.Load()
+
+		// changes of the server itself were published already
+		if count == changes {
+			for workspace, stamp := range stamps {
+				if previous, ok := envStamps[workspace]; ok && stamp != previous {
+					s.publishDataChange(workspaceContext(ctx, workspace), environmentsStore, "", "reloaded")
+				}
+			}
+
+			count = s.dataChanges.Load()
+		}
+
+		envStamps = stamps
+		changes = count
+	}
+}
+
+// reloadConfig reads the configuration file again and applies what can
+// change at runtime: the AI providers, the upstream proxy, the size limits,
+// the rate limit, the target rules, the MCP servers, the secret providers
+// and auditing. Anything else takes a restart.
+func (s *Server) reloadConfig() {
+	current := s.config.Load()
+
+	next, err := config.Load(current.File)
+
+	if err != nil {
+		s.logger.Warn("configuration not reloaded", "file", current.File, "error", err)
+		return
+	}
+
+	if current.Override != nil {
+		current.Override(next)
+	}
+
+	cfg := *current
+
+	cfg.AIProviders = next.AIProviders
+	cfg.DefaultAIProvider = next.DefaultAIProvider
+	cfg.Proxy = next.Proxy
+	cfg.MaxResponseSize = next.MaxResponseSize
+	cfg.MaxRequestSize = next.MaxRequestSize
+	cfg.RateLimit = next.RateLimit
+	cfg.AllowTargets = next.AllowTargets
+	cfg.DenyTargets = next.DenyTargets
+	cfg.DenyPrivate = next.DenyPrivate
+	cfg.McpServers = next.McpServers
+	cfg.Secrets = next.Secrets
+	cfg.Audit = next.Audit
+	cfg.AuditBodies = next.AuditBodies
+
+	s.config.Store(&cfg)
+
+	s.logger.Info("configuration reloaded", "file", cfg.File)
+
+	s.events.publish("config", s.clientConfig())
+}
+
+// statStamp identifies the version of the file at path, "" when missing.
+func statStamp(path string) string {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// environmentStamps returns the storeStamp of the environments of every
+// workspace keyed by workspace.
+func environmentStamps(ctx context.Context) map[string]string {
+	stamps := map[string]string{}
+
+	workspaces, err := listWorkspaces()
+
+	if err != nil {
+		return stamps
+	}
+
+	for _, workspace := range workspaces {
+		stamps[workspace.Name] = storeStamp(workspaceContext(ctx, workspace.Name), environmentsStore)
+	}
+
+	return stamps
+}
+
+// storeStamp identifies the version of the entries of store.
+func storeStamp(ctx context.Context, store string) string {
+	entries, err := dataStore(ctx).List(store)
+
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "%s/%d/%d\n", entry.ID, entry.Updated.UnixNano(), entry.Size)
+	}
+
+	return b.String()
+}
@@ -1,19 +1,41 @@
 package server
 
 import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/adrianliechti/prism/pkg/config"
 )
 
 type DataEntry struct {
 	ID string `json:"id"`
 
+	// Name is the entry's "name" field, if any.
+	Name string `json:"name,omitempty"`
+
+	// Folder is the ID of the folder holding the entry, empty at the root.
+	Folder string `json:"folder,omitempty"`
+
+	DataEntryMeta
+
+	// Size is the size of the stored JSON in bytes.
+	Size int64 `json:"size,omitempty"`
+
 	Updated *time.Time `json:"updated,omitempty"`
 }
 
@@ -25,6 +47,11 @@ func validName(name string) bool {
 	return safeNameRegex.MatchString(name)
 }
 
+// handleDataList handles GET /data/{store}[?tag=...][&type=...]
+// [&sort=id|name|updated][&order=asc|desc][&offset=][&limit=]. Entries are
+// filtered to those having every tag and one of the types given, sorted
+// (by ID unless asked otherwise; updated defaults to newest first) and
+// paginated; X-Total-Count reports the number of matching entries.
 func (s *Server) handleDataList(w http.ResponseWriter, r *http.Request) {
 	store := r.PathValue("store")
 
@@ -33,17 +60,75 @@ func (s *Server) handleDataList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := filepath.Join(getDataDir(), store)
+	query := r.URL.Query()
+
+	tags := query["tag"]
+	types := query["type"]
 
-	entries, err := os.ReadDir(dir)
+	sortBy := query.Get("sort")
+
+	switch sortBy {
+	case "":
+		sortBy = "id"
+	case "id", "name", "updated":
+	default:
+		http.Error(w, "sort must be id, name or updated", http.StatusBadRequest)
+		return
+	}
+
+	desc := sortBy == "updated"
+
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		desc = false
+	case "desc":
+		desc = true
+	default:
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	offset, err := queryCount(query.Get("offset"), 0)
 
 	if err != nil {
-		if os.IsNotExist(err) {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode([]string{})
-			return
-		}
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryCount(query.Get("limit"), -1)
 
+	if err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := dataStore(r.Context()).List(store)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	index, err := loadFolderIndex(r.Context(), store)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	meta, err := loadMetaIndex(r.Context(), store)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// display names come from the search index, which only re-reads
+	// changed entries
+	names, err := s.dataIndex.names(r.Context(), store)
+
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -51,32 +136,103 @@ func (s *Server) handleDataList(w http.ResponseWriter, r *http.Request) {
 	files := make([]DataEntry, 0)
 
 	for _, entry := range entries {
-		if entry.IsDir() {
+		// skips the folder and metadata indexes
+		if !validName(entry.ID) {
 			continue
 		}
 
-		if filepath.Ext(entry.Name()) != ".json" {
+		dataEntry := DataEntry{
+			ID:     entry.ID,
+			Name:   names[entry.ID],
+			Folder: index.Entries[entry.ID],
+
+			DataEntryMeta: meta.Entries[entry.ID],
+
+			Size:    entry.Size,
+			Updated: &entry.Updated,
+		}
+
+		// entries saved without the /data endpoints (imports) have no
+		// type recorded yet
+		if dataEntry.Type == "" {
+			if data, err := dataStore(r.Context()).Get(store, entry.ID); err == nil {
+				dataEntry.Type = detectEntryType(data)
+			}
+		}
+
+		if !matchesEntryFilter(dataEntry.DataEntryMeta, tags, types) {
 			continue
 		}
 
-		id := strings.TrimSuffix(entry.Name(), ".json")
+		files = append(files, dataEntry)
+	}
+
+	slices.SortStableFunc(files, func(a, b DataEntry) int {
+		var result int
 
-		dataEntry := DataEntry{
-			ID: id,
+		switch sortBy {
+		case "name":
+			// unnamed entries sort by their ID
+			nameA := strings.ToLower(cmp.Or(a.Name, a.ID))
+			nameB := strings.ToLower(cmp.Or(b.Name, b.ID))
+
+			result = cmp.Or(strings.Compare(nameA, nameB), strings.Compare(a.ID, b.ID))
+		case "updated":
+			result = cmp.Or(compareTimes(a.Updated, b.Updated), strings.Compare(a.ID, b.ID))
+		default:
+			result = strings.Compare(a.ID, b.ID)
 		}
 
-		if info, err := entry.Info(); err == nil {
-			modTime := info.ModTime()
-			dataEntry.Updated = &modTime
+		if desc {
+			return -result
 		}
 
-		files = append(files, dataEntry)
+		return result
+	})
+
+	total := len(files)
+
+	files = files[min(offset, total):]
+
+	if limit >= 0 && limit < len(files) {
+		files = files[:limit]
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	json.NewEncoder(w).Encode(files)
 }
 
+// queryCount parses a non-negative count query parameter, returning def
+// when it is empty.
+func queryCount(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid count")
+	}
+
+	return n, nil
+}
+
+// compareTimes orders missing times first.
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	return a.Compare(*b)
+}
+
 func (s *Server) handleDataGet(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	store := r.PathValue("store")
@@ -86,12 +242,10 @@ func (s *Server) handleDataGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filePath := filepath.Join(getDataDir(), store, id+".json")
-
-	data, err := os.ReadFile(filePath)
+	data, err := dataStore(r.Context()).Get(store, id)
 
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, os.ErrNotExist) {
 			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
@@ -100,6 +254,15 @@ func (s *Server) handleDataGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	etag := entryETag(data)
+
+	w.Header().Set("ETag", etag)
+
+	if matchETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(data)
 }
@@ -128,23 +291,107 @@ func (s *Server) handleDataPut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := filepath.Join(getDataDir(), store)
+	unlock := lockEntry(store, id)
+	defer unlock()
 
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !checkEntryPreconditions(w, r, store, id) {
 		return
 	}
 
-	filePath := filepath.Join(dir, id+".json")
+	if err := dataStore(r.Context()).Put(store, id, body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	if err := writeFileAtomic(filePath, body, 0644); err != nil {
+	if err := s.recordEntryType(r.Context(), store, id, body); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	s.scheduleGitCommit(r.Context())
+	s.publishDataChange(r.Context(), store, id, "saved")
+
+	w.Header().Set("ETag", entryETag(body))
 	w.WriteHeader(http.StatusOK)
 }
 
+// entryETag is the strong entity tag of an entry's content.
+func entryETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// matchETag reports whether an If-Match or If-None-Match header value (a
+// list of entity tags or "*") matches etag; an empty etag stands for a
+// missing entry, matching nothing. Weak tags never match.
+func matchETag(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+
+	for value := range strings.SplitSeq(header, ",") {
+		value = strings.TrimSpace(value)
+
+		if value == "*" || value == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkEntryPreconditions evaluates If-Match and If-None-Match of a write
+// against the stored entry, responding 412 Precondition Failed (with the
+// current ETag) when they don't hold. Writes to an existing entry need
+// If-Match with the ETag the client read, so a concurrent change from
+// another window isn't overwritten; without it they are answered 428
+// Precondition Required. The entry must be locked.
+func checkEntryPreconditions(w http.ResponseWriter, r *http.Request, store, id string) bool {
+	ifMatch := r.Header.Get("If-Match")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+
+	var etag string
+
+	data, err := dataStore(r.Context()).Get(store, id)
+
+	if err == nil {
+		etag = entryETag(data)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if (ifMatch != "" && !matchETag(ifMatch, etag)) || (ifNoneMatch != "" && matchETag(ifNoneMatch, etag)) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+
+		http.Error(w, "entry was modified", http.StatusPreconditionFailed)
+		return false
+	}
+
+	if ifMatch == "" && etag != "" {
+		http.Error(w, "If-Match required", http.StatusPreconditionRequired)
+		return false
+	}
+
+	return true
+}
+
+// entryLocks holds a *sync.Mutex per "store/id", serializing writes and
+// deletes of an entry across concurrent requests (e.g. several windows).
+var entryLocks sync.Map
+
+// lockEntry locks an entry and returns the func unlocking it.
+func lockEntry(store, id string) func() {
+	value, _ := entryLocks.LoadOrStore(store+"/"+id, &sync.Mutex{})
+
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+
+	return mu.Unlock
+}
+
 // writeFileAtomic writes via temp file + rename so a crash mid-write doesn't corrupt the original.
 func writeFileAtomic(path string, body []byte, perm os.FileMode) error {
 	dir, name := filepath.Split(path)
@@ -173,7 +420,24 @@ func writeFileAtomic(path string, body []byte, perm os.FileMode) error {
 		os.Remove(tmpPath)
 		return err
 	}
-	return os.Rename(tmpPath, path)
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes a directory so a rename into it survives a crash. It is
+// best effort: some platforms (Windows) cannot sync directories.
+func syncDir(dir string) {
+	if dir == "" {
+		dir = "."
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
 }
 
 func (s *Server) handleDataDelete(w http.ResponseWriter, r *http.Request) {
@@ -185,10 +449,15 @@ func (s *Server) handleDataDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filePath := filepath.Join(getDataDir(), store, id+".json")
+	unlock := lockEntry(store, id)
+	defer unlock()
 
-	if err := os.Remove(filePath); err != nil {
-		if os.IsNotExist(err) {
+	if !checkEntryPreconditions(w, r, store, id) {
+		return
+	}
+
+	if err := dataStore(r.Context()).Delete(store, id); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
 			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
@@ -197,15 +466,116 @@ func (s *Server) handleDataDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.updateFolderIndex(r.Context(), store, func(index *folderIndex) error {
+		delete(index.Entries, id)
+		return nil
+	})
+
+	s.updateMetaIndex(r.Context(), store, func(index *metaIndex) error {
+		delete(index.Entries, id)
+		return nil
+	})
+
+	s.scheduleGitCommit(r.Context())
+	s.publishDataChange(r.Context(), store, id, "deleted")
+
 	w.WriteHeader(http.StatusOK)
 }
 
-func getDataDir() string {
-	home, err := os.UserHomeDir()
+// loadEntry decodes a stored entry; it returns an os.ErrNotExist error when
+// the entry does not exist.
+func loadEntry(ctx context.Context, store, id string, v any) error {
+	data, err := dataStore(ctx).Get(store, id)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// saveEntry encodes and stores an entry.
+func saveEntry(ctx context.Context, store, id string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
 
 	if err != nil {
-		return "data"
+		return err
+	}
+
+	unlock := lockEntry(store, id)
+	defer unlock()
+
+	return dataStore(ctx).Put(store, id, data)
+}
+
+// loadWorkspaceSettings returns the workspace settings, or empty settings
+// when none were saved yet.
+func loadWorkspaceSettings(ctx context.Context) (*WorkspaceSettings, error) {
+	var settings WorkspaceSettings
+
+	if err := loadEntry(ctx, "settings", "workspace", &settings); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("workspace settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// dataDir is the configured data directory; empty uses the platform
+// default.
+var dataDir string
+
+// getDataDir returns the directory of the workspace of ctx.
+func getDataDir(ctx context.Context) string {
+	return workspaceDir(contextWorkspace(ctx))
+}
+
+// dataRoot returns the data directory, which is also the default
+// workspace.
+func dataRoot() string {
+	if dataDir != "" {
+		return dataDir
+	}
+
+	return config.DefaultDataDir()
+}
+
+// initDataDir applies the configured data directory. Without one, data
+// of earlier versions (always kept in ~/.local/share/prism) is moved to
+// the platform default; if that fails, the old location stays in use so
+// nothing appears lost.
+func initDataDir(dir string) error {
+	if dir != "" {
+		abs, err := filepath.Abs(dir)
+
+		if err != nil {
+			return err
+		}
+
+		dataDir = abs
+		return nil
+	}
+
+	legacy := config.LegacyDataDir()
+	target := config.DefaultDataDir()
+
+	if legacy == "" || legacy == target {
+		return nil
+	}
+
+	if _, err := os.Stat(legacy); err != nil {
+		return nil
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+		if err := os.Rename(legacy, target); err == nil {
+			return nil
+		}
 	}
 
-	return filepath.Join(home, ".local", "share", "prism")
+	dataDir = legacy
+	return nil
 }
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// handleDataDuplicate handles POST /data/{store}/{id}/duplicate, copying
+// the entry under a new ID (also set as its "id" field).
+// Request body: DataEntryTarget (optional)
+func (s *Server) handleDataDuplicate(w http.ResponseWriter, r *http.Request) {
+	s.copyEntry(w, r, false)
+}
+
+// handleDataMove handles POST /data/{store}/{id}/move, moving the entry
+// into another folder and/or store; the ID is kept.
+// Request body: DataEntryTarget (optional)
+func (s *Server) handleDataMove(w http.ResponseWriter, r *http.Request) {
+	s.copyEntry(w, r, true)
+}
+
+func (s *Server) copyEntry(w http.ResponseWriter, r *http.Request, move bool) {
+	id := r.PathValue("id")
+	store := r.PathValue("store")
+
+	if !validName(store) || !validName(id) {
+		http.Error(w, "invalid store or id", http.StatusBadRequest)
+		return
+	}
+
+	var req DataEntryTarget
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	target := DataEntry{
+		ID: id,
+	}
+
+	targetStore := store
+
+	if req.Store != "" {
+		if !validName(req.Store) {
+			http.Error(w, "invalid target store name", http.StatusBadRequest)
+			return
+		}
+
+		targetStore = req.Store
+	}
+
+	if !move {
+		target.ID = newRequestID()
+	}
+
+	if move && targetStore == store && req.Folder == nil {
+		http.Error(w, "missing target store or folder", http.StatusBadRequest)
+		return
+	}
+
+	sourceIndex, err := loadFolderIndex(r.Context(), store)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case req.Folder != nil:
+		target.Folder = *req.Folder
+	case targetStore == store:
+		target.Folder = sourceIndex.Entries[id]
+	}
+
+	if target.Folder != "" {
+		targetIndex, err := loadFolderIndex(r.Context(), targetStore)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if targetIndex.folder(target.Folder) == nil {
+			http.Error(w, errFolderNotFound.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	// lock in a fixed order so opposite moves can't deadlock
+	locks := [][2]string{{store, id}, {targetStore, target.ID}}
+
+	slices.SortFunc(locks, func(a, b [2]string) int {
+		return strings.Compare(a[0]+"/"+a[1], b[0]+"/"+b[1])
+	})
+
+	for _, key := range slices.Compact(locks) {
+		unlock := lockEntry(key[0], key[1])
+		defer unlock()
+	}
+
+	data, err := dataStore(r.Context()).Get(store, id)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if targetStore != store || target.ID != id {
+		if _, err := dataStore(r.Context()).Stat(targetStore, target.ID); err == nil {
+			http.Error(w, "entry exists in target store", http.StatusConflict)
+			return
+		}
+
+		if move {
+			err = dataStore(r.Context()).Rename(store, id, targetStore, target.ID)
+		} else {
+			err = dataStore(r.Context()).Put(targetStore, target.ID, withEntryID(data, target.ID))
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if targetStore != store || !move {
+		if err := s.copyEntryMeta(r.Context(), store, id, targetStore, target.ID, move); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if move && targetStore != store {
+		s.updateFolderIndex(r.Context(), store, func(index *folderIndex) error {
+			delete(index.Entries, id)
+			return nil
+		})
+	}
+
+	err = s.updateFolderIndex(r.Context(), targetStore, func(index *folderIndex) error {
+		// the folder may have been deleted meanwhile
+		if target.Folder == "" || index.folder(target.Folder) == nil {
+			target.Folder = ""
+			delete(index.Entries, target.ID)
+		} else {
+			index.Entries[target.ID] = target.Folder
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if targetStore != store || !move {
+		s.publishDataChange(r.Context(), targetStore, target.ID, "saved")
+	}
+
+	if move && targetStore != store {
+		s.publishDataChange(r.Context(), store, id, "deleted")
+	}
+
+	if index, err := loadMetaIndex(r.Context(), targetStore); err == nil {
+		target.DataEntryMeta = index.Entries[target.ID]
+	}
+
+	if entry, err := dataStore(r.Context()).Stat(targetStore, target.ID); err == nil {
+		target.Updated = &entry.Updated
+	}
+
+	status := http.StatusOK
+
+	if !move {
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(target)
+}
+
+// copyEntryMeta copies the metadata of an entry to its copy, removing it
+// from the source when moved.
+func (s *Server) copyEntryMeta(ctx context.Context, store, id, targetStore, targetID string, move bool) error {
+	source, err := loadMetaIndex(ctx, store)
+
+	if err != nil {
+		return err
+	}
+
+	meta, ok := source.Entries[id]
+
+	if !ok {
+		return nil
+	}
+
+	meta.Tags = slices.Clone(meta.Tags)
+
+	err = s.updateMetaIndex(ctx, targetStore, func(index *metaIndex) error {
+		index.Entries[targetID] = meta
+		return nil
+	})
+
+	if err != nil || !move {
+		return err
+	}
+
+	return s.updateMetaIndex(ctx, store, func(index *metaIndex) error {
+		delete(index.Entries, id)
+		return nil
+	})
+}
+
+// withEntryID sets the "id" field of an entry object to id; entries
+// without one are returned unchanged.
+func withEntryID(data []byte, id string) []byte {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data
+	}
+
+	if _, ok := fields["id"]; !ok {
+		return data
+	}
+
+	fields["id"], _ = json.Marshal(id)
+
+	result, err := json.MarshalIndent(fields, "", "  ")
+
+	if err != nil {
+		return data
+	}
+
+	return result
+}
@@ -0,0 +1,396 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// folderIndexID is the document holding the folders of a store and which
+// folder each entry is in. Entries stay flat, so their IDs and the /data
+// endpoints are unaffected; the leading dot keeps the index out of entry
+// listings. folderIndexFile is its name in workspace archives.
+const (
+	folderIndexID   = ".folders"
+	folderIndexFile = folderIndexID + ".json"
+)
+
+var (
+	errFolderNotFound = errors.New("folder not found")
+	errFolderNotEmpty = errors.New("folder not empty")
+	errInvalidParent  = errors.New("parent folder not found or nested in the folder")
+)
+
+type folderIndex struct {
+	Folders []DataFolder `json:"folders"`
+
+	// folder ID keyed by entry ID; entries not listed are at the root
+	Entries map[string]string `json:"entries"`
+}
+
+func loadFolderIndex(ctx context.Context, store string) (*folderIndex, error) {
+	index := &folderIndex{
+		Folders: []DataFolder{},
+		Entries: map[string]string{},
+	}
+
+	data, err := dataStore(ctx).Get(store, folderIndexID)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return index, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, err
+	}
+
+	if index.Entries == nil {
+		index.Entries = map[string]string{}
+	}
+
+	return index, nil
+}
+
+func saveFolderIndex(ctx context.Context, store string, index *folderIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return dataStore(ctx).Put(store, folderIndexID, data)
+}
+
+// updateFolderIndex applies fn to the folder index of store and saves it
+// unless fn fails. Updates are serialized so concurrent requests don't lose
+// each other's changes.
+func (s *Server) updateFolderIndex(ctx context.Context, store string, fn func(*folderIndex) error) error {
+	s.foldersMu.Lock()
+	defer s.foldersMu.Unlock()
+
+	index, err := loadFolderIndex(ctx, store)
+
+	if err != nil {
+		return err
+	}
+
+	if err := fn(index); err != nil {
+		return err
+	}
+
+	if err := saveFolderIndex(ctx, store, index); err != nil {
+		return err
+	}
+
+	s.scheduleGitCommit(ctx)
+	s.publishDataChange(ctx, store, "", "folders")
+
+	return nil
+}
+
+func (index *folderIndex) folder(id string) *DataFolder {
+	for i := range index.Folders {
+		if index.Folders[i].ID == id {
+			return &index.Folders[i]
+		}
+	}
+
+	return nil
+}
+
+// descendants returns id and the IDs of all folders nested in it.
+func (index *folderIndex) descendants(id string) []string {
+	result := []string{id}
+
+	for i := 0; i < len(result); i++ {
+		for _, f := range index.Folders {
+			if f.Parent == result[i] {
+				result = append(result, f.ID)
+			}
+		}
+	}
+
+	return result
+}
+
+// validParent reports whether folder id may be moved into parent: the
+// parent must exist and must not be the folder itself or nested in it.
+func (index *folderIndex) validParent(id, parent string) bool {
+	if parent == "" {
+		return true
+	}
+
+	if index.folder(parent) == nil {
+		return false
+	}
+
+	return id == "" || !slices.Contains(index.descendants(id), parent)
+}
+
+// handleFolderList handles GET /folders/{store}.
+func (s *Server) handleFolderList(w http.ResponseWriter, r *http.Request) {
+	store := r.PathValue("store")
+
+	if !validName(store) {
+		http.Error(w, "invalid store name", http.StatusBadRequest)
+		return
+	}
+
+	index, err := loadFolderIndex(r.Context(), store)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(index.Folders)
+}
+
+// handleFolderCreate handles POST /folders/{store}.
+// Request body: DataFolderRequest
+func (s *Server) handleFolderCreate(w http.ResponseWriter, r *http.Request) {
+	store := r.PathValue("store")
+
+	if !validName(store) {
+		http.Error(w, "invalid store name", http.StatusBadRequest)
+		return
+	}
+
+	var req DataFolderRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == nil || *req.Name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+
+	folder := DataFolder{
+		ID:   rand.Text(),
+		Name: *req.Name,
+	}
+
+	if req.Parent != nil {
+		folder.Parent = *req.Parent
+	}
+
+	err := s.updateFolderIndex(r.Context(), store, func(index *folderIndex) error {
+		if !index.validParent("", folder.Parent) {
+			return errInvalidParent
+		}
+
+		index.Folders = append(index.Folders, folder)
+		return nil
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), folderStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(folder)
+}
+
+// handleFolderUpdate handles PATCH /folders/{store}/{id}, renaming the
+// folder and/or moving it to another parent ("" for the root).
+// Request body: DataFolderRequest
+func (s *Server) handleFolderUpdate(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	store := r.PathValue("store")
+
+	if !validName(store) || !validName(id) {
+		http.Error(w, "invalid store or id", http.StatusBadRequest)
+		return
+	}
+
+	var req DataFolderRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name != nil && *req.Name == "" {
+		http.Error(w, "empty name", http.StatusBadRequest)
+		return
+	}
+
+	var result DataFolder
+
+	err := s.updateFolderIndex(r.Context(), store, func(index *folderIndex) error {
+		folder := index.folder(id)
+
+		if folder == nil {
+			return errFolderNotFound
+		}
+
+		if req.Parent != nil {
+			if !index.validParent(id, *req.Parent) {
+				return errInvalidParent
+			}
+
+			folder.Parent = *req.Parent
+		}
+
+		if req.Name != nil {
+			folder.Name = *req.Name
+		}
+
+		result = *folder
+		return nil
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), folderStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleFolderDelete handles DELETE /folders/{store}/{id}. A folder that
+// still holds entries or folders is only deleted with ?recursive=true,
+// which deletes its contents too.
+func (s *Server) handleFolderDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	store := r.PathValue("store")
+
+	if !validName(store) || !validName(id) {
+		http.Error(w, "invalid store or id", http.StatusBadRequest)
+		return
+	}
+
+	recursive := r.URL.Query().Get("recursive") == "true"
+
+	var deleted []string
+
+	err := s.updateFolderIndex(r.Context(), store, func(index *folderIndex) error {
+		if index.folder(id) == nil {
+			return errFolderNotFound
+		}
+
+		folders := index.descendants(id)
+
+		var entries []string
+
+		for entry, folder := range index.Entries {
+			if slices.Contains(folders, folder) {
+				entries = append(entries, entry)
+			}
+		}
+
+		if !recursive && (len(folders) > 1 || len(entries) > 0) {
+			return errFolderNotEmpty
+		}
+
+		for _, entry := range entries {
+			if err := dataStore(r.Context()).Delete(store, entry); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+
+			delete(index.Entries, entry)
+			deleted = append(deleted, entry)
+		}
+
+		index.Folders = slices.DeleteFunc(index.Folders, func(f DataFolder) bool {
+			return slices.Contains(folders, f.ID)
+		})
+
+		return nil
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), folderStatus(err))
+		return
+	}
+
+	if len(deleted) > 0 {
+		s.updateMetaIndex(r.Context(), store, func(index *metaIndex) error {
+			for _, entry := range deleted {
+				delete(index.Entries, entry)
+			}
+
+			return nil
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleFolderMove handles POST /folders/{store}/move, moving entries into
+// a folder ("" for the root).
+// Request body: DataFolderMove
+func (s *Server) handleFolderMove(w http.ResponseWriter, r *http.Request) {
+	store := r.PathValue("store")
+
+	if !validName(store) {
+		http.Error(w, "invalid store name", http.StatusBadRequest)
+		return
+	}
+
+	var req DataFolderMove
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	for _, entry := range req.Entries {
+		if !validName(entry) {
+			http.Error(w, "invalid entry id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := s.updateFolderIndex(r.Context(), store, func(index *folderIndex) error {
+		if req.Folder != "" && index.folder(req.Folder) == nil {
+			return errFolderNotFound
+		}
+
+		for _, entry := range req.Entries {
+			if req.Folder == "" {
+				delete(index.Entries, entry)
+			} else {
+				index.Entries[entry] = req.Folder
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), folderStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// folderStatus is the HTTP status of a failed folder index update.
+func folderStatus(err error) int {
+	switch {
+	case errors.Is(err, errFolderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errInvalidParent):
+		return http.StatusBadRequest
+	case errors.Is(err, errFolderNotEmpty):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// metaIndexID is the document holding the metadata of the entries of a
+// store, kept aside like the folder index so the stored JSON stays as the
+// UI wrote it. metaIndexFile is its name in workspace archives.
+const (
+	metaIndexID   = ".meta"
+	metaIndexFile = metaIndexID + ".json"
+)
+
+// dataEntryTypes are the valid entry types.
+var dataEntryTypes = []string{"http", "grpc", "mcp", "ws", "openai"}
+
+type metaIndex struct {
+	Entries map[string]DataEntryMeta `json:"entries"`
+}
+
+func loadMetaIndex(ctx context.Context, store string) (*metaIndex, error) {
+	index := &metaIndex{
+		Entries: map[string]DataEntryMeta{},
+	}
+
+	data, err := dataStore(ctx).Get(store, metaIndexID)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return index, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, err
+	}
+
+	if index.Entries == nil {
+		index.Entries = map[string]DataEntryMeta{}
+	}
+
+	return index, nil
+}
+
+func saveMetaIndex(ctx context.Context, store string, index *metaIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return dataStore(ctx).Put(store, metaIndexID, data)
+}
+
+// updateMetaIndex applies fn to the metadata index of store and saves it
+// unless fn fails.
+func (s *Server) updateMetaIndex(ctx context.Context, store string, fn func(*metaIndex) error) error {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+
+	index, err := loadMetaIndex(ctx, store)
+
+	if err != nil {
+		return err
+	}
+
+	if err := fn(index); err != nil {
+		return err
+	}
+
+	if err := saveMetaIndex(ctx, store, index); err != nil {
+		return err
+	}
+
+	s.scheduleGitCommit(ctx)
+
+	return nil
+}
+
+// detectEntryType derives the type of an entry from its content: the
+// settings it holds and, for HTTP, whether the URL is a WebSocket one.
+func detectEntryType(data []byte) string {
+	var entry struct {
+		HTTP *struct {
+			URL string `json:"url"`
+		} `json:"http"`
+
+		GRPC   json.RawMessage `json:"grpc"`
+		MCP    json.RawMessage `json:"mcp"`
+		OpenAI json.RawMessage `json:"openai"`
+	}
+
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return ""
+	}
+
+	switch {
+	case entry.HTTP != nil:
+		url := strings.ToLower(entry.HTTP.URL)
+
+		if strings.HasPrefix(url, "ws://") || strings.HasPrefix(url, "wss://") {
+			return "ws"
+		}
+
+		return "http"
+
+	case len(entry.GRPC) > 0 && string(entry.GRPC) != "null":
+		return "grpc"
+
+	case len(entry.MCP) > 0 && string(entry.MCP) != "null":
+		return "mcp"
+
+	case len(entry.OpenAI) > 0 && string(entry.OpenAI) != "null":
+		return "openai"
+	}
+
+	return ""
+}
+
+// recordEntryType records the detected type of an entry unless it
+// already has one, so explicitly set types are kept.
+func (s *Server) recordEntryType(ctx context.Context, store, id string, data []byte) error {
+	entryType := detectEntryType(data)
+
+	if entryType == "" {
+		return nil
+	}
+
+	index, err := loadMetaIndex(ctx, store)
+
+	if err != nil {
+		return err
+	}
+
+	if index.Entries[id].Type != "" {
+		return nil
+	}
+
+	return s.updateMetaIndex(ctx, store, func(index *metaIndex) error {
+		meta := index.Entries[id]
+
+		if meta.Type == "" {
+			meta.Type = entryType
+			index.Entries[id] = meta
+		}
+
+		return nil
+	})
+}
+
+// normalizeTags trims tags and drops empty and duplicate (ignoring case)
+// ones.
+func normalizeTags(tags []string) []string {
+	var result []string
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "" {
+			continue
+		}
+
+		if slices.ContainsFunc(result, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			continue
+		}
+
+		result = append(result, tag)
+	}
+
+	return result
+}
+
+// matchesEntryFilter reports whether meta has all tags (ignoring case) and
+// one of types; empty lists match everything.
+func matchesEntryFilter(meta DataEntryMeta, tags, types []string) bool {
+	if len(types) > 0 && !slices.Contains(types, meta.Type) {
+		return false
+	}
+
+	for _, tag := range tags {
+		if !slices.ContainsFunc(meta.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// handleDataMetaUpdate handles PATCH /data/{store}/{id}/meta.
+// Request body: DataEntryMetaUpdate
+func (s *Server) handleDataMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	store := r.PathValue("store")
+
+	if !validName(store) || !validName(id) {
+		http.Error(w, "invalid store or id", http.StatusBadRequest)
+		return
+	}
+
+	var req DataEntryMetaUpdate
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Type != nil && *req.Type != "" && !slices.Contains(dataEntryTypes, *req.Type) {
+		http.Error(w, "type must be one of "+strings.Join(dataEntryTypes, ", "), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := dataStore(r.Context()).Stat(store, id); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var result DataEntryMeta
+
+	err := s.updateMetaIndex(r.Context(), store, func(index *metaIndex) error {
+		meta := index.Entries[id]
+
+		if req.Type != nil {
+			meta.Type = *req.Type
+		}
+
+		if req.Tags != nil {
+			meta.Tags = normalizeTags(*req.Tags)
+		}
+
+		if req.Description != nil {
+			meta.Description = strings.TrimSpace(*req.Description)
+		}
+
+		index.Entries[id] = meta
+
+		result = meta
+		return nil
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.publishDataChange(r.Context(), store, id, "saved")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// dataSearchLimit is the default number of search results.
+	dataSearchLimit = 50
+
+	// dataSearchSnippets is the maximum number of snippets per result.
+	dataSearchSnippets = 3
+
+	// dataSearchContext is the number of bytes shown around a match.
+	dataSearchContext = 40
+)
+
+// dataIndex caches the string fields of all stored entries for searching.
+// Entries are re-read only when their modification time or size changed.
+type dataIndex struct {
+	mu sync.Mutex
+
+	// entries keyed by workspace, then by store/ID
+	entries map[string]map[string]*indexedEntry
+}
+
+type indexedEntry struct {
+	store string
+	id    string
+
+	updated time.Time
+	size    int64
+
+	fields []indexedField
+}
+
+// indexedField is a string leaf of an entry, with its JSON path
+// ("http.headers[0].value"); the entry ID is the field "id".
+type indexedField struct {
+	path  string
+	text  string
+	lower string
+}
+
+// refresh brings the index up to date with the data stores and returns
+// the entries of store, or of all stores when store is empty.
+func (x *dataIndex) refresh(ctx context.Context, store string) ([]*indexedEntry, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.entries == nil {
+		x.entries = map[string]map[string]*indexedEntry{}
+	}
+
+	workspace := contextWorkspace(ctx)
+
+	indexed := x.entries[workspace]
+
+	if indexed == nil {
+		indexed = map[string]*indexedEntry{}
+		x.entries[workspace] = indexed
+	}
+
+	stores := []string{store}
+
+	if store == "" {
+		all, err := dataStore(ctx).Stores()
+
+		if err != nil {
+			return nil, err
+		}
+
+		stores = all
+	}
+
+	seen := map[string]bool{}
+
+	var result []*indexedEntry
+
+	for _, store := range stores {
+		entries, err := dataStore(ctx).List(store)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, stat := range entries {
+			if !validName(stat.ID) {
+				continue
+			}
+
+			key := store + "/" + stat.ID
+			seen[key] = true
+
+			entry := indexed[key]
+
+			if entry == nil || !entry.updated.Equal(stat.Updated) || entry.size != stat.Size {
+				entry = indexEntry(ctx, store, stat)
+				indexed[key] = entry
+			}
+
+			result = append(result, entry)
+		}
+	}
+
+	// drop deleted entries of the stores just scanned
+	for key, entry := range indexed {
+		if !seen[key] && (store == "" || entry.store == store) {
+			delete(indexed, key)
+		}
+	}
+
+	return result, nil
+}
+
+// drop forgets the entries of a workspace.
+func (x *dataIndex) drop(workspace string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	delete(x.entries, workspace)
+}
+
+// names returns the "name" field of the entries of store keyed by ID.
+func (x *dataIndex) names(ctx context.Context, store string) (map[string]string, error) {
+	entries, err := x.refresh(ctx, store)
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]string{}
+
+	for _, entry := range entries {
+		for _, field := range entry.fields {
+			if field.path == "name" {
+				names[entry.id] = field.text
+				break
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func indexEntry(ctx context.Context, store string, stat StoreEntry) *indexedEntry {
+	entry := &indexedEntry{
+		store: store,
+		id:    stat.ID,
+
+		updated: stat.Updated,
+		size:    stat.Size,
+
+		fields: []indexedField{newIndexedField("id", stat.ID)},
+	}
+
+	data, err := dataStore(ctx).Get(store, stat.ID)
+
+	if err != nil {
+		return entry
+	}
+
+	var value any
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return entry
+	}
+
+	collectIndexedFields(&entry.fields, "", value)
+
+	return entry
+}
+
+func newIndexedField(path, text string) indexedField {
+	return indexedField{
+		path:  path,
+		text:  text,
+		lower: strings.ToLower(text),
+	}
+}
+
+// collectIndexedFields appends the non-empty string leaves of value.
+func collectIndexedFields(fields *[]indexedField, path string, value any) {
+	switch v := value.(type) {
+	case string:
+		// the top-level id is already indexed
+		if v != "" && path != "id" {
+			*fields = append(*fields, newIndexedField(path, v))
+		}
+
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			child := key
+
+			if path != "" {
+				child = path + "." + key
+			}
+
+			collectIndexedFields(fields, child, v[key])
+		}
+
+	case []any:
+		for i, item := range v {
+			collectIndexedFields(fields, fmt.Sprintf("%s[%d]", path, i), item)
+		}
+	}
+}
+
+// handleDataSearch handles GET /data/search?q=...[&store=][&limit=]. An
+// entry matches when each whitespace-separated term of q occurs in its ID or
+// any of its string fields, ignoring case.
+func (s *Server) handleDataSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	terms := strings.Fields(strings.ToLower(query.Get("q")))
+
+	if len(terms) == 0 {
+		http.Error(w, "missing q parameter", http.StatusBadRequest)
+		return
+	}
+
+	store := query.Get("store")
+
+	if store != "" && !validName(store) {
+		http.Error(w, "invalid store name", http.StatusBadRequest)
+		return
+	}
+
+	limit := dataSearchLimit
+
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		limit = n
+	}
+
+	entries, err := s.dataIndex.refresh(r.Context(), store)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]DataSearchResult, 0)
+
+	for _, entry := range entries {
+		snippets, ok := searchEntry(entry, terms)
+
+		if !ok {
+			continue
+		}
+
+		updated := entry.updated
+
+		results = append(results, DataSearchResult{
+			Store: entry.store,
+			ID:    entry.id,
+
+			Updated: &updated,
+
+			Snippets: snippets,
+		})
+	}
+
+	// most recently updated first
+	slices.SortFunc(results, func(a, b DataSearchResult) int {
+		return b.Updated.Compare(*a.Updated)
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// searchEntry reports whether every term occurs in entry, with a snippet
+// per matching field (at most dataSearchSnippets).
+func searchEntry(entry *indexedEntry, terms []string) ([]DataSearchSnippet, bool) {
+	found := make([]bool, len(terms))
+
+	var snippets []DataSearchSnippet
+
+	for _, field := range entry.fields {
+		matched := false
+
+		for i, term := range terms {
+			index := strings.Index(field.lower, term)
+
+			if index < 0 {
+				continue
+			}
+
+			found[i] = true
+
+			if !matched && len(snippets) < dataSearchSnippets {
+				snippets = append(snippets, newDataSearchSnippet(field, index, len(term)))
+				matched = true
+			}
+		}
+	}
+
+	if slices.Contains(found, false) {
+		return nil, false
+	}
+
+	return snippets, true
+}
+
+// newDataSearchSnippet cuts the match at index (in the lowercased text) out
+// of field together with some context on either side.
+func newDataSearchSnippet(field indexedField, index, length int) DataSearchSnippet {
+	text := field.text
+
+	// lowercasing changed some byte lengths, so offsets only fit the
+	// lowercased text
+	if len(field.lower) != len(field.text) {
+		text = field.lower
+	}
+
+	start := max(0, index-dataSearchContext)
+	end := min(len(text), index+length+dataSearchContext)
+
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	snippet := DataSearchSnippet{
+		Path: field.path,
+
+		Before: text[start:index],
+		Match:  text[index : index+length],
+		After:  text[index+length : end],
+	}
+
+	if start > 0 {
+		snippet.Before = "…" + snippet.Before
+	}
+
+	if end < len(text) {
+		snippet.After += "…"
+	}
+
+	return snippet
+}
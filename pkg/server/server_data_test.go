@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEntryPreconditions(t *testing.T) {
+	body := []byte(`{"name":"entry"}`)
+	etag := entryETag(body)
+
+	tests := []struct {
+		name    string
+		method  string
+		exists  bool
+		headers map[string]string
+		code    int
+	}{
+		{"create", http.MethodPut, false, nil, http.StatusOK},
+		{"create if none match", http.MethodPut, false, map[string]string{"If-None-Match": "*"}, http.StatusOK},
+		{"create if match", http.MethodPut, false, map[string]string{"If-Match": etag}, http.StatusPreconditionFailed},
+		{"update without if match", http.MethodPut, true, nil, http.StatusPreconditionRequired},
+		{"update if none match other", http.MethodPut, true, map[string]string{"If-None-Match": `"other"`}, http.StatusPreconditionRequired},
+		{"update if match", http.MethodPut, true, map[string]string{"If-Match": etag}, http.StatusOK},
+		{"update if match any", http.MethodPut, true, map[string]string{"If-Match": "*"}, http.StatusOK},
+		{"update if match list", http.MethodPut, true, map[string]string{"If-Match": `"other", ` + etag}, http.StatusOK},
+		{"update if match stale", http.MethodPut, true, map[string]string{"If-Match": `"stale"`}, http.StatusPreconditionFailed},
+		{"update if match weak", http.MethodPut, true, map[string]string{"If-Match": "W/" + etag}, http.StatusPreconditionFailed},
+		{"update if none match", http.MethodPut, true, map[string]string{"If-None-Match": "*"}, http.StatusPreconditionFailed},
+		{"delete without if match", http.MethodDelete, true, nil, http.StatusPreconditionRequired},
+		{"delete if match", http.MethodDelete, true, map[string]string{"If-Match": etag}, http.StatusOK},
+		{"delete if match stale", http.MethodDelete, true, map[string]string{"If-Match": `"stale"`}, http.StatusPreconditionFailed},
+		{"delete missing", http.MethodDelete, false, nil, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestDataDir(t)
+
+			if test.exists {
+				if err := dataStore(t.Context()).Put("tests", "entry", body); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest(test.method, "/data/tests/entry", nil)
+
+			for key, value := range test.headers {
+				r.Header.Set(key, value)
+			}
+
+			w := httptest.NewRecorder()
+
+			if ok := checkEntryPreconditions(w, r, "tests", "entry"); ok != (test.code == http.StatusOK) {
+				t.Errorf("checkEntryPreconditions() = %v", ok)
+			}
+
+			if w.Code != test.code {
+				t.Fatalf("%s: %d %s, want %d", test.method, w.Code, w.Body, test.code)
+			}
+
+			if w.Code == http.StatusPreconditionFailed && test.exists && w.Header().Get("ETag") != etag {
+				t.Errorf("ETag = %s, want %s", w.Header().Get("ETag"), etag)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// loadWorkspaceDefaults returns the workspace defaults, nil when there are
+// none.
+func loadWorkspaceDefaults(ctx context.Context) (*WorkspaceDefaults, error) {
+	settings, err := loadWorkspaceSettings(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return settings.Defaults, nil
+}
+
+// baseURL returns the base URL for requests in env.
+func (d *WorkspaceDefaults) baseURL(env *Environment) string {
+	if d == nil {
+		return ""
+	}
+
+	if env != nil {
+		if value, ok := d.BaseURLs[env.ID]; ok {
+			return value
+		}
+	}
+
+	return d.BaseURL
+}
+
+// workspaceVariables returns the enabled variables of env plus the
+// baseUrl of the workspace defaults, unless env defines its own.
+func workspaceVariables(ctx context.Context, env *Environment) (map[string]string, error) {
+	defaults, err := loadWorkspaceDefaults(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	variables := environmentVariables(env)
+
+	if _, ok := variables["baseUrl"]; !ok {
+		if base := defaults.baseURL(env); base != "" {
+			variables["baseUrl"] = base
+		}
+	}
+
+	return variables, nil
+}
+
+// resolveBaseURL prefixes a relative URL ("/users") with the baseUrl
+// variable; other URLs are returned unchanged.
+func resolveBaseURL(target string, variables map[string]string) string {
+	base := variables["baseUrl"]
+
+	if base == "" || !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+		return target
+	}
+
+	return strings.TrimSuffix(base, "/") + target
+}
+
+// applyDefaults adds the default headers a proxied request does not set,
+// smuggled as X-Prism-Header-<Name> like the UI sends them, and the
+// default timeout when it has none.
+func applyDefaults(r *http.Request, defaults *WorkspaceDefaults) {
+	if defaults == nil {
+		return
+	}
+
+	for _, header := range defaults.Headers {
+		if !header.Enabled || header.Key == "" {
+			continue
+		}
+
+		// user headers all arrive smuggled; plain ones are browser artifacts
+		if r.Header.Get("X-Prism-Header-"+header.Key) != "" {
+			continue
+		}
+
+		r.Header.Set("X-Prism-Header-"+header.Key, header.Value)
+	}
+
+	if defaults.Timeout > 0 && r.Header.Get("X-Prism-Timeout") == "" {
+		r.Header.Set("X-Prism-Timeout", strconv.FormatInt(defaults.Timeout, 10))
+	}
+}
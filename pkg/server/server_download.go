@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// downloadTTL bounds how long spooled downloads are kept on disk.
+const downloadTTL = time.Hour
+
+// createSpoolFile creates a private temp file for staged uploads and
+// downloads.
+func createSpoolFile(kind string) (*os.File, error) {
+	dir := filepath.Join(os.TempDir(), "prism-"+kind)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return os.CreateTemp(dir, kind+"-*")
+}
+
+type downloadEntry struct {
+	Path     string
+	Download Download
+	Expires  time.Time
+}
+
+// spoolDownload replaces an upstream response with Download metadata after
+// streaming its body into a temp file, so large payloads never pass through
+// the browser's memory. Used by handleProxy in X-Prism-Download mode.
+func (s *Server) spoolDownload(resp *http.Response) error {
+	s.purgeDownloads()
+
+	f, err := createSpoolFile("downloads")
+
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), resp.Body)
+
+	resp.Body.Close()
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	token := rand.Text()
+
+	download := Download{
+		Token: token,
+		URL:   "/downloads/" + token,
+
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+
+		Size:        size,
+		ContentType: resp.Header.Get("Content-Type"),
+		Filename:    downloadFilename(resp),
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	s.downloads.Store(token, &downloadEntry{
+		Path:     f.Name(),
+		Download: download,
+		Expires:  time.Now().Add(downloadTTL),
+	})
+
+	s.events.publish("download.ready", download)
+
+	body, err := json.Marshal(download)
+
+	if err != nil {
+		return err
+	}
+
+	resp.StatusCode = http.StatusOK
+	resp.Status = "200 OK"
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Disposition")
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return nil
+}
+
+// downloadFilename prefers the upstream Content-Disposition filename and
+// falls back to the last URL path segment.
+func downloadFilename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := filepath.Base(params["filename"]); name != "." && name != "/" && name != "" {
+			return name
+		}
+	}
+
+	if resp.Request != nil {
+		if name := path.Base(resp.Request.URL.Path); name != "." && name != "/" {
+			return name
+		}
+	}
+
+	return "download"
+}
+
+// purgeDownloads removes expired downloads from disk.
+func (s *Server) purgeDownloads() {
+	now := time.Now()
+
+	s.downloads.Range(func(key, value any) bool {
+		entry := value.(*downloadEntry)
+
+		if now.After(entry.Expires) {
+			s.downloads.Delete(key)
+			os.Remove(entry.Path)
+		}
+
+		return true
+	})
+}
+
+// removeDownloads deletes all spooled downloads, e.g. on shutdown.
+func (s *Server) removeDownloads() {
+	s.downloads.Range(func(key, value any) bool {
+		s.downloads.Delete(key)
+		os.Remove(value.(*downloadEntry).Path)
+		return true
+	})
+}
+
+func (s *Server) lookupDownload(token string) (*downloadEntry, bool) {
+	value, ok := s.downloads.Load(token)
+
+	if !ok {
+		return nil, false
+	}
+
+	entry := value.(*downloadEntry)
+
+	if time.Now().After(entry.Expires) {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// handleDownloadGet handles GET /downloads/{token}. The file is served as an
+// attachment, so the browser saves it instead of rendering upstream content
+// on the origin of the UI; ?inline=true previews it in a sandbox without
+// scripts or access to that origin.
+func (s *Server) handleDownloadGet(w http.ResponseWriter, r *http.Request) {
+	entry, ok := s.lookupDownload(r.PathValue("token"))
+
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(entry.Path)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := entry.Download.ContentType
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	disposition := "attachment"
+
+	if r.URL.Query().Get("inline") == "true" {
+		disposition = "inline"
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": entry.Download.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// handleDownloadDelete handles DELETE /downloads/{token}.
+func (s *Server) handleDownloadDelete(w http.ResponseWriter, r *http.Request) {
+	value, ok := s.downloads.LoadAndDelete(r.PathValue("token"))
+
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	os.Remove(value.(*downloadEntry).Path)
+
+	w.WriteHeader(http.StatusOK)
+}
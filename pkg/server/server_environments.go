@@ -0,0 +1,454 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// environmentsStore holds the environments, managed through the
+	// /data endpoints like any other store.
+	environmentsStore = "environments"
+
+	// activeEnvironmentFile remembers the active environment of this
+	// machine, so it is neither synced nor committed.
+	activeEnvironmentFile = ".environment.json"
+)
+
+var errEnvironmentNotFound = errors.New("environment not found")
+
+// variableRefRegex matches {{name}} and dynamic {{$name(args)}}
+// references, also percent-encoded as they appear in URLs. Typed
+// references ({{secret:name}}) are left alone.
+var variableRefRegex = regexp.MustCompile(`(?:\{\{|%7[Bb]%7[Bb])\s*([A-Za-z_][A-Za-z0-9_.-]{0,127}|(?:\$|%24)[A-Za-z][A-Za-z0-9]{0,63}(?:\([^(){}]{0,256}\))?)\s*(?:\}\}|%7[Dd]%7[Dd])`)
+
+// loadEnvironment reads a stored environment.
+func loadEnvironment(ctx context.Context, id string) (*Environment, error) {
+	if !validName(id) {
+		return nil, errEnvironmentNotFound
+	}
+
+	data, err := dataStore(ctx).Get(environmentsStore, id)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errEnvironmentNotFound
+		}
+
+		return nil, err
+	}
+
+	var env Environment
+
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+
+	env.ID = id
+
+	return &env, nil
+}
+
+// activeEnvironment returns the ID of the active environment, empty when
+// there is none.
+func activeEnvironment(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(filepath.Join(getDataDir(ctx), activeEnvironmentFile))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	var selection EnvironmentSelection
+
+	if err := json.Unmarshal(data, &selection); err != nil {
+		return "", err
+	}
+
+	return selection.ID, nil
+}
+
+// environmentVariables returns the enabled variables of an environment;
+// later definitions of a key win.
+func environmentVariables(env *Environment) map[string]string {
+	variables := map[string]string{}
+
+	if env == nil {
+		return variables
+	}
+
+	for _, variable := range env.Variables {
+		if variable.Disabled || variable.Key == "" {
+			continue
+		}
+
+		variables[variable.Key] = variable.Value
+	}
+
+	return variables
+}
+
+// requestEnvironment returns the environment named by X-Prism-Environment,
+// or else the active one; nil when there is none.
+func requestEnvironment(r *http.Request) (*Environment, error) {
+	if id := r.Header.Get("X-Prism-Environment"); id != "" {
+		return loadEnvironment(r.Context(), id)
+	}
+
+	return currentEnvironment(r.Context())
+}
+
+// currentEnvironment returns the active environment, nil when there is
+// none.
+func currentEnvironment(ctx context.Context) (*Environment, error) {
+	active, err := activeEnvironment(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if active == "" {
+		return nil, nil
+	}
+
+	env, err := loadEnvironment(ctx, active)
+
+	// a deleted active environment is as good as none
+	if errors.Is(err, errEnvironmentNotFound) {
+		return nil, nil
+	}
+
+	return env, err
+}
+
+// expandVariables replaces the variable references in text with their
+// values, escaped for the context; dynamic variables get a fresh value per
+// reference. References without a value are kept; found records every
+// referenced name and whether it had a value.
+func expandVariables(text string, variables map[string]string, escape func(string) string, found map[string]bool) string {
+	if !strings.Contains(text, "{{") && !strings.Contains(text, "%7") {
+		return text
+	}
+
+	return variableRefRegex.ReplaceAllStringFunc(text, func(ref string) string {
+		name := variableRefRegex.FindStringSubmatch(ref)[1]
+
+		value, ok := variables[name]
+
+		if !ok && (name[0] == '$' || name[0] == '%') {
+			value, ok = dynamicValue(name)
+		}
+
+		if found != nil {
+			found[name] = found[name] || ok
+		}
+
+		if !ok {
+			return ref
+		}
+
+		if escape != nil {
+			value = escape(value)
+		}
+
+		return value
+	})
+}
+
+// escapePathValue escapes a value substituted into a path, keeping the
+// slashes so a value can span segments (e.g. a base path).
+func escapePathValue(value string) string {
+	segments := strings.Split(value, "/")
+
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// withEnvironment applies the workspace defaults (unless X-Prism-Defaults
+// is false) and substitutes environment variables in the URL, headers and
+// body of proxied requests (HTTP, gRPC, MCP) before they are routed, so
+// variables may also stand for the target host. The pre-request script of
+// X-Prism-Script runs last, so it may also change the target.
+func (s *Server) withEnvironment(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied := strings.HasPrefix(r.URL.Path, "/proxy/") || (r.Method == http.MethodPost && r.URL.Path == "/mcp/sessions")
+
+		if !proxied || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		env, err := requestEnvironment(r)
+
+		var defaults *WorkspaceDefaults
+
+		if err == nil && r.Header.Get("X-Prism-Defaults") != "false" {
+			defaults, err = loadWorkspaceDefaults(r.Context())
+		}
+
+		var variables map[string]string
+
+		if err == nil {
+			variables, err = workspaceVariables(r.Context(), env)
+		}
+
+		if err == nil {
+			r.Header.Del("X-Prism-Environment")
+			r.Header.Del("X-Prism-Defaults")
+
+			// defaults go first so their values may reference variables
+			applyDefaults(r, defaults)
+
+			err = applyVariables(r, variables)
+		}
+
+		// scripts see the substituted request, so signatures cover what is sent
+		if err == nil && r.Header.Get("X-Prism-Script") != "" {
+			err = applyScript(r, variables)
+		}
+
+		// the proxy stores extracted values into the same environment
+		if err == nil && env != nil {
+			r = r.WithContext(context.WithValue(r.Context(), environmentKey{}, env.ID))
+		}
+
+		if err != nil {
+			setCORSHeaders(w.Header())
+
+			code := http.StatusInternalServerError
+			if errors.Is(err, errEnvironmentNotFound) || errors.Is(err, errScript) {
+				code = http.StatusBadRequest
+			}
+
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// environmentKey is the context key of the ID of the environment a
+// proxied request was expanded with.
+type environmentKey struct{}
+
+// contextEnvironment returns the environment ID withEnvironment stored in
+// ctx, empty when the request had none.
+func contextEnvironment(ctx context.Context) string {
+	id, _ := ctx.Value(environmentKey{}).(string)
+	return id
+}
+
+// applyVariables substitutes variables in the URL, headers and textual
+// body of a request.
+func applyVariables(r *http.Request, variables map[string]string) error {
+	if escaped := r.URL.EscapedPath(); strings.Contains(escaped, "%7") {
+		expanded := expandVariables(escaped, variables, escapePathValue, nil)
+
+		path, err := url.PathUnescape(expanded)
+
+		if err != nil {
+			return err
+		}
+
+		r.URL.Path = path
+		r.URL.RawPath = expanded
+	}
+
+	r.URL.RawQuery = expandVariables(r.URL.RawQuery, variables, url.QueryEscape, nil)
+
+	for _, values := range r.Header {
+		for i, value := range values {
+			values[i] = expandVariables(value, variables, nil, nil)
+		}
+	}
+
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength > secretsMaxBody {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, secretsMaxBody+1))
+
+	if err != nil {
+		return err
+	}
+
+	// large and binary bodies are sent unchanged
+	if len(data) > secretsMaxBody || !utf8.Valid(data) {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+
+		return nil
+	}
+
+	r.Body.Close()
+
+	body := []byte(expandVariables(string(data), variables, nil, nil))
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.TransferEncoding = nil
+	r.Header.Del("Transfer-Encoding")
+
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return nil
+}
+
+// handleEnvironmentActiveGet handles GET /environments/active.
+func (s *Server) handleEnvironmentActiveGet(w http.ResponseWriter, r *http.Request) {
+	id, err := activeEnvironment(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EnvironmentSelection{ID: id})
+}
+
+// handleEnvironmentActivePut handles PUT /environments/active.
+// Request body: EnvironmentSelection
+func (s *Server) handleEnvironmentActivePut(w http.ResponseWriter, r *http.Request) {
+	var req EnvironmentSelection
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	target := filepath.Join(getDataDir(r.Context()), activeEnvironmentFile)
+
+	if req.ID == "" {
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.publishDataChange(r.Context(), environmentsStore, "", "activated")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req)
+		return
+	}
+
+	if _, err := loadEnvironment(r.Context(), req.ID); err != nil {
+		if errors.Is(err, errEnvironmentNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := os.MkdirAll(getDataDir(r.Context()), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := writeFileAtomic(target, data, 0644); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.publishDataChange(r.Context(), environmentsStore, req.ID, "activated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// handleEnvironmentResolve handles POST /environments/resolve, reporting
+// the variables a text (e.g. a stored request) references and which of
+// them the environment leaves unresolved.
+// Request body: EnvironmentResolveRequest
+func (s *Server) handleEnvironmentResolve(w http.ResponseWriter, r *http.Request) {
+	var req EnvironmentResolveRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var env *Environment
+	var err error
+
+	if req.Environment != "" {
+		env, err = loadEnvironment(r.Context(), req.Environment)
+	} else {
+		env, err = requestEnvironment(r)
+	}
+
+	if err != nil {
+		if errors.Is(err, errEnvironmentNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	variables, err := workspaceVariables(r.Context(), env)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	found := map[string]bool{}
+
+	result := EnvironmentResolveResult{
+		Text: expandVariables(req.Text, variables, nil, found),
+
+		Variables:  []string{},
+		Unresolved: []string{},
+	}
+
+	if env != nil {
+		result.Environment = env.ID
+	}
+
+	for name, resolved := range found {
+		result.Variables = append(result.Variables, name)
+
+		if !resolved {
+			result.Unresolved = append(result.Unresolved, name)
+		}
+	}
+
+	slices.Sort(result.Variables)
+	slices.Sort(result.Unresolved)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventPing is the interval of the comments keeping idle event streams
+// open through proxies.
+const eventPing = 30 * time.Second
+
+// eventBus fans the server's events out to the browser windows listening
+// on GET /events, so they learn about runs, monitors, downloads, MCP
+// notifications and data changes without polling. Slow listeners miss
+// events rather than stalling the publisher.
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan ServerEvent]struct{}
+
+	// closed on shutdown, ending the streams
+	done chan struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subscribers: map[chan ServerEvent]struct{}{},
+
+		done: make(chan struct{}),
+	}
+}
+
+// subscribe returns a channel receiving the events published from now on,
+// and the func ending the subscription.
+func (b *eventBus) subscribe() (<-chan ServerEvent, func()) {
+	ch := make(chan ServerEvent, 256)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+// publish sends an event of eventType with data to every subscriber; it is
+// a no-op while nobody listens.
+func (b *eventBus) publish(eventType string, data any) {
+	b.publishIn("", eventType, data)
+}
+
+// publishIn is publish for an event of a workspace, which only the windows
+// of that workspace receive.
+func (b *eventBus) publishIn(workspace, eventType string, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.subscribers) == 0 {
+		return
+	}
+
+	event := ServerEvent{
+		Type: eventType,
+		Time: time.Now(),
+
+		Workspace: workspace,
+	}
+
+	if data != nil {
+		event.Data, _ = json.Marshal(data)
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// close ends the streams of all subscribers.
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+}
+
+// publishDataChange tells the windows of the workspace of ctx that an
+// entry of a store changed; an empty id stands for the folders of store, an
+// empty store for the whole workspace.
+func (s *Server) publishDataChange(ctx context.Context, store, id, action string) {
+	s.dataChanges.Add(1)
+
+	s.events.publishIn(contextWorkspace(ctx), "data", DataChange{
+		Store:  store,
+		ID:     id,
+		Action: action,
+	})
+}
+
+// handleEvents handles GET /events[?type=run&type=data]. It streams the
+// server's events as Server-Sent Events named after their type, only
+// those of the given types (or prefixes like "run") when filtered, until
+// the browser disconnects or the server shuts down. Events of workspaces
+// reach the windows of the workspace only; windows on none follow the open
+// workspace.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	types := r.URL.Query()["type"]
+
+	workspace := refererWorkspace(r)
+
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	ping := time.NewTicker(eventPing)
+	defer ping.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if !matchesEventType(event.Type, types) {
+				continue
+			}
+
+			if event.Workspace != "" && event.Workspace != cmp.Or(workspace, currentWorkspace()) {
+				continue
+			}
+
+			if err := writeServerEvent(w, event.Type, event); err != nil {
+				return
+			}
+
+			rc.Flush()
+
+		case <-ping.C:
+			if _, err := w.Write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+
+			rc.Flush()
+
+		case <-s.events.done:
+			return
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// matchesEventType reports whether an event of eventType passes the type
+// filter of a stream; "run" matches "run.started" and the like.
+func matchesEventType(eventType string, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+
+	for _, t := range types {
+		if eventType == t || strings.HasPrefix(eventType, t+".") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/adrianliechti/prism/pkg/snippet"
+)
+
+// handleSnippetLanguages handles GET /export/snippet.
+func (s *Server) handleSnippetLanguages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snippet.Languages())
+}
+
+// handleExportSnippet handles POST /export/snippet, rendering a stored
+// request as client code.
+func (s *Server) handleExportSnippet(w http.ResponseWriter, r *http.Request) {
+	var req SnippetRequest
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	input, err := snippetInput(&req.Request)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code, err := snippet.Generate(req.Language, input)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Snippet{
+		Language: req.Language,
+		Code:     code,
+	})
+}
+
+// snippetInput resolves the enabled parts of a stored HTTP request the same
+// way the UI does when sending it.
+func snippetInput(req *Request) (*snippet.Request, error) {
+	if req.HTTP == nil {
+		return nil, errors.New("only HTTP requests can be exported")
+	}
+
+	settings := req.HTTP
+
+	target, err := url.Parse(settings.URL)
+
+	if err != nil {
+		return nil, errors.New("invalid URL")
+	}
+
+	var query []string
+
+	if target.RawQuery != "" {
+		query = append(query, target.RawQuery)
+	}
+
+	for _, p := range settings.Query {
+		if p.Enabled && p.Key != "" {
+			query = append(query, url.QueryEscape(p.Key)+"="+url.QueryEscape(p.Value))
+		}
+	}
+
+	target.RawQuery = strings.Join(query, "&")
+
+	result := &snippet.Request{
+		Method: settings.Method,
+		URL:    target.String(),
+
+		Insecure:        settings.Options.Insecure,
+		FollowRedirects: settings.Options.Redirect,
+	}
+
+	if result.Method == "" {
+		result.Method = http.MethodGet
+	}
+
+	for _, h := range settings.Headers {
+		if h.Enabled && h.Key != "" {
+			result.Headers = append(result.Headers, snippet.Header{Name: h.Key, Value: h.Value})
+		}
+	}
+
+	contentType := ""
+
+	switch body := settings.Body; body.Type {
+	case "json":
+		result.Body = body.Content
+		contentType = "application/json"
+
+	case "xml":
+		result.Body = body.Content
+		contentType = "application/xml"
+
+	case "raw":
+		result.Body = body.Content
+		contentType = "text/plain"
+
+	case "form-urlencoded":
+		var pairs []string
+
+		for _, f := range body.Data {
+			if f.Enabled && f.Key != "" {
+				pairs = append(pairs, url.QueryEscape(f.Key)+"="+url.QueryEscape(f.Value))
+			}
+		}
+
+		result.Body = strings.Join(pairs, "&")
+		contentType = "application/x-www-form-urlencoded"
+
+	case "form-data":
+		for _, f := range body.Data {
+			if !f.Enabled || f.Key == "" {
+				continue
+			}
+
+			field := snippet.FormField{Name: f.Key, Value: f.Value}
+
+			if f.Type == "file" {
+				field = snippet.FormField{Name: f.Key, File: f.FileName}
+			}
+
+			result.Form = append(result.Form, field)
+		}
+
+	case "binary":
+		result.File = body.FileName
+	}
+
+	if contentType != "" && !hasHeader(result.Headers, "Content-Type") {
+		result.Headers = append(result.Headers, snippet.Header{Name: "Content-Type", Value: contentType})
+	}
+
+	return result, nil
+}
+
+func hasHeader(headers []snippet.Header, name string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return true
+		}
+	}
+
+	return false
+}
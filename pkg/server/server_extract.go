@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// parseExtractors reads the extractors of a proxied request from
+// X-Prism-Extract (a JSON array of Extractor).
+func parseExtractors(r *http.Request) ([]Extractor, error) {
+	value := r.Header.Get("X-Prism-Extract")
+
+	if value == "" {
+		return nil, nil
+	}
+
+	var extractors []Extractor
+
+	if err := json.Unmarshal([]byte(value), &extractors); err != nil {
+		return nil, fmt.Errorf("invalid X-Prism-Extract: %w", err)
+	}
+
+	return extractors, nil
+}
+
+// storeExtracted saves the found values of results as variables of an
+// environment: existing variables get the new value and are enabled,
+// others are appended. Fields of the stored environment the server does
+// not know are kept.
+func (s *Server) storeExtracted(ctx context.Context, id string, results []ExtractionResult) error {
+	if !validName(id) {
+		return errEnvironmentNotFound
+	}
+
+	values := map[string]string{}
+	var order []string
+
+	for _, result := range results {
+		if !result.Found {
+			continue
+		}
+
+		if _, ok := values[result.Variable]; !ok {
+			order = append(order, result.Variable)
+		}
+
+		values[result.Variable] = result.Value
+	}
+
+	if len(order) == 0 {
+		return nil
+	}
+
+	unlock := lockEntry(environmentsStore, id)
+	defer unlock()
+
+	data, err := dataStore(ctx).Get(environmentsStore, id)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errEnvironmentNotFound
+		}
+
+		return err
+	}
+
+	var env map[string]any
+
+	if err := json.Unmarshal(data, &env); err != nil {
+		return err
+	}
+
+	if env == nil {
+		env = map[string]any{}
+	}
+
+	variables, _ := env["variables"].([]any)
+
+	for _, item := range variables {
+		variable, ok := item.(map[string]any)
+
+		if !ok {
+			continue
+		}
+
+		key, _ := variable["key"].(string)
+
+		value, ok := values[key]
+
+		if !ok {
+			continue
+		}
+
+		variable["value"] = value
+		delete(variable, "disabled")
+	}
+
+	for _, key := range order {
+		if !hasVariable(variables, key) {
+			variables = append(variables, map[string]any{"key": key, "value": values[key]})
+		}
+	}
+
+	env["variables"] = variables
+
+	if data, err = json.MarshalIndent(env, "", "  "); err != nil {
+		return err
+	}
+
+	if err := dataStore(ctx).Put(environmentsStore, id, data); err != nil {
+		return err
+	}
+
+	s.scheduleGitCommit(ctx)
+	s.publishDataChange(ctx, environmentsStore, id, "saved")
+
+	return nil
+}
+
+func hasVariable(variables []any, key string) bool {
+	for _, item := range variables {
+		if variable, ok := item.(map[string]any); ok && variable["key"] == key {
+			return true
+		}
+	}
+
+	return false
+}
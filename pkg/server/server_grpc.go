@@ -8,20 +8,29 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	// Registers google.rpc.* detail types (BadRequest, RetryInfo, ...) so
-	// status details can be decoded in grpcErrorText.
+	// status details can be decoded in grpcErrorText and grpcStatusDetails.
 	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection/grpc_reflection_v1"
 	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/stats"
 	"google.golang.org/grpc/status"
 
 	"google.golang.org/protobuf/encoding/protojson"
@@ -46,7 +55,7 @@ func (s *Server) handleGRPC(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(strings.Trim(path, "/"), "/")
 
 	if len(parts) != 2 {
-		http.Error(w, "invalid path format, expected 'service/method'", http.StatusBadRequest)
+		writeProxyError(w, http.StatusBadRequest, errors.New("invalid path format, expected 'service/method'"))
 		return
 	}
 
@@ -56,78 +65,163 @@ func (s *Server) handleGRPC(w http.ResponseWriter, r *http.Request) {
 	jsonBody, err := io.ReadAll(r.Body)
 
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("failed to read body: %w", err))
 		return
 	}
 
 	defer r.Body.Close()
 
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	// Server streams relayed as events run until they end or the client
+	// goes away; everything else gets the usual default deadline.
+	eventStream := acceptsEventStream(r)
+
+	// X-Prism-Deadline bounds the call itself, while X-Prism-Timeout also
+	// covers connecting and resolving the method.
+	deadline, err := parseTimeout(r, "X-Prism-Deadline")
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Envelope mode returns message, metadata and status as one JSON
+	// document instead of spreading them over body and headers.
+	envelope := r.Header.Get("X-Prism-Envelope") == "true"
+
+	callOpts, err := grpcCallOptions(r)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	timeout := 30*time.Second + deadline
+
+	if eventStream {
+		timeout = 0
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, timeout)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	defer cancel()
 
+	opts, err := s.upstreamOptionsFromRequest(r)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// User metadata arrives smuggled as X-Prism-Header-*; it is also sent for
 	// the reflection calls, so auth-protected reflection services work.
-	ctx = metadata.NewOutgoingContext(ctx, grpcMetadataFromRequest(r))
+	md, err := s.grpcOutgoingMetadata(r, opts)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err)
+		return
+	}
 
-	conn, err := grpc.NewClient(host, grpcTransportCredentials(scheme, r.Header.Get("X-Prism-Insecure") == "true"))
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	conn, err := s.connectGRPC(ctx, scheme, host, opts, r.Header.Get("X-Prism-Grpc-Web") == "true")
 
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to connect to %s: %v", host, err), http.StatusBadGateway)
+		writeProxyError(w, upstreamStatus(err), fmt.Errorf("failed to connect to %s: %w", host, err))
 		return
 	}
 
 	defer conn.Close()
 
-	methodDesc, err := findMethodDescriptor(ctx, conn, service, method)
+	methodDesc, err := s.grpcMethod(ctx, conn, scheme, host, service, method)
 
 	if err != nil {
 		code := http.StatusBadRequest
 		if errors.Is(err, errGRPCReflection) {
 			code = http.StatusBadGateway
 		}
-		http.Error(w, err.Error(), code)
+		writeProxyError(w, code, err)
 		return
 	}
 
 	if methodDesc.IsStreamingClient() {
-		http.Error(w, "client/bidirectional streaming methods are not supported", http.StatusNotImplemented)
+		writeProxyError(w, http.StatusNotImplemented, errors.New("client/bidirectional streaming methods are not supported"))
 		return
 	}
 
 	reqMsg := dynamicpb.NewMessage(methodDesc.Input())
 
 	if err := protojson.Unmarshal(jsonBody, reqMsg); err != nil {
-		http.Error(w, fmt.Sprintf("failed to unmarshal JSON to proto: %v", err), http.StatusBadRequest)
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("failed to unmarshal JSON to proto: %w", err))
 		return
 	}
 
+	// sent to the server as grpc-timeout
+	if deadline > 0 {
+		var cancelCall context.CancelFunc
+
+		ctx, cancelCall = context.WithTimeout(ctx, deadline)
+		defer cancelCall()
+	}
+
+	ctx = context.WithValue(ctx, grpcEncodingKey{}, &grpcEncoding{})
+
 	if methodDesc.IsStreamingServer() {
-		invokeServerStream(ctx, w, conn, fmt.Sprintf("/%s/%s", service, method), methodDesc, reqMsg)
+		if eventStream {
+			relayServerStream(ctx, w, conn, fmt.Sprintf("/%s/%s", service, method), methodDesc, reqMsg, callOpts...)
+			return
+		}
+
+		invokeServerStream(ctx, w, conn, fmt.Sprintf("/%s/%s", service, method), methodDesc, reqMsg, envelope, callOpts...)
 		return
 	}
 
 	respMsg := dynamicpb.NewMessage(methodDesc.Output())
 
 	var respHeader, respTrailer metadata.MD
-	invokeErr := conn.Invoke(ctx, fmt.Sprintf("/%s/%s", service, method), reqMsg, respMsg, grpc.Header(&respHeader), grpc.Trailer(&respTrailer))
+	invokeErr := conn.Invoke(ctx, fmt.Sprintf("/%s/%s", service, method), reqMsg, respMsg, append(callOpts, grpc.Header(&respHeader), grpc.Trailer(&respTrailer))...)
+
+	if envelope {
+		result := &GRPCResponse{
+			Header:   grpcMetadataMap(respHeader),
+			Encoding: responseEncoding(ctx),
+		}
+
+		if invokeErr == nil {
+			raw, err := protojson.Marshal(respMsg)
+
+			if err != nil {
+				invokeErr = status.Error(codes.Internal, fmt.Sprintf("failed to marshal proto to JSON: %v", err))
+			}
+
+			result.Message = raw
+		}
+
+		result.Status = grpcStatus(ctx, invokeErr, respTrailer)
+
+		writeGRPCEnvelope(w, result)
+		return
+	}
 
 	// Write response metadata as HTTP headers (also on errors, where trailers
 	// often carry details). Binary metadata is base64-encoded.
+	w.Header().Set("Grpc-Encoding", responseEncoding(ctx))
 	writeGRPCMetadata(w.Header(), "Grpc-Header-", respHeader)
 	writeGRPCMetadata(w.Header(), "Grpc-Trailer-", respTrailer)
 
 	if invokeErr != nil {
-		st := status.Convert(invokeErr)
-		w.Header().Set("Grpc-Status", st.Code().String())
-		w.Header().Set("Grpc-Message", st.Message())
-		http.Error(w, grpcErrorText(st), httpStatusFromGRPCCode(st.Code()))
+		writeGRPCError(ctx, w, invokeErr, respTrailer)
 		return
 	}
 
 	jsonResp, err := protojson.Marshal(respMsg)
 
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to marshal proto to JSON: %v", err), http.StatusInternalServerError)
+		writeProxyError(w, http.StatusInternalServerError, fmt.Errorf("failed to marshal proto to JSON: %w", err))
 		return
 	}
 
@@ -138,11 +232,12 @@ func (s *Server) handleGRPC(w http.ResponseWriter, r *http.Request) {
 }
 
 // invokeServerStream calls a server-streaming method and returns the received
-// messages as a JSON array (capped; a hit cap is flagged via header).
-func invokeServerStream(ctx context.Context, w http.ResponseWriter, conn *grpc.ClientConn, fullMethod string, methodDesc protoreflect.MethodDescriptor, reqMsg proto.Message) {
+// messages as a JSON array (capped; a hit cap is flagged via header), or as
+// a GRPCResponse in envelope mode.
+func invokeServerStream(ctx context.Context, w http.ResponseWriter, conn grpcConn, fullMethod string, methodDesc protoreflect.MethodDescriptor, reqMsg proto.Message, envelope bool, callOpts ...grpc.CallOption) {
 	const maxStreamMessages = 256
 
-	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fullMethod)
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fullMethod, callOpts...)
 
 	if err == nil {
 		if sendErr := stream.SendMsg(reqMsg); sendErr != nil {
@@ -153,10 +248,12 @@ func invokeServerStream(ctx context.Context, w http.ResponseWriter, conn *grpc.C
 	}
 
 	if err != nil {
-		st := status.Convert(err)
-		w.Header().Set("Grpc-Status", st.Code().String())
-		w.Header().Set("Grpc-Message", st.Message())
-		http.Error(w, grpcErrorText(st), httpStatusFromGRPCCode(st.Code()))
+		if envelope {
+			writeGRPCEnvelope(w, &GRPCResponse{Status: grpcStatus(ctx, err, nil)})
+			return
+		}
+
+		writeGRPCError(ctx, w, err, nil)
 		return
 	}
 
@@ -184,16 +281,32 @@ func invokeServerStream(ctx context.Context, w http.ResponseWriter, conn *grpc.C
 		messages = append(messages, raw)
 	}
 
+	if envelope {
+		result := &GRPCResponse{
+			Messages:  messages,
+			Truncated: truncated,
+
+			Encoding: responseEncoding(ctx),
+
+			Status: grpcStatus(ctx, streamErr, stream.Trailer()),
+		}
+
+		if header, headerErr := stream.Header(); headerErr == nil {
+			result.Header = grpcMetadataMap(header)
+		}
+
+		writeGRPCEnvelope(w, result)
+		return
+	}
+
 	if header, headerErr := stream.Header(); headerErr == nil {
 		writeGRPCMetadata(w.Header(), "Grpc-Header-", header)
 	}
 	writeGRPCMetadata(w.Header(), "Grpc-Trailer-", stream.Trailer())
+	w.Header().Set("Grpc-Encoding", responseEncoding(ctx))
 
 	if streamErr != nil && len(messages) == 0 {
-		st := status.Convert(streamErr)
-		w.Header().Set("Grpc-Status", st.Code().String())
-		w.Header().Set("Grpc-Message", st.Message())
-		http.Error(w, grpcErrorText(st), httpStatusFromGRPCCode(st.Code()))
+		writeGRPCError(ctx, w, streamErr, stream.Trailer())
 		return
 	}
 
@@ -214,6 +327,154 @@ func invokeServerStream(ctx context.Context, w http.ResponseWriter, conn *grpc.C
 	json.NewEncoder(w).Encode(messages)
 }
 
+// acceptsEventStream reports whether the client asked for Server-Sent Events.
+func acceptsEventStream(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for mediaType := range strings.SplitSeq(value, ",") {
+			if mediaType, _, _ := mime.ParseMediaType(mediaType); mediaType == "text/event-stream" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// relayServerStream calls a server-streaming method and relays each message
+// as a "message" event as soon as it arrives. Response header metadata goes
+// out as HTTP headers; a final "status" event carries the status code and
+// trailers, which can no longer be sent as headers once the stream started.
+func relayServerStream(ctx context.Context, w http.ResponseWriter, conn grpcConn, fullMethod string, methodDesc protoreflect.MethodDescriptor, reqMsg proto.Message, callOpts ...grpc.CallOption) {
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fullMethod, callOpts...)
+
+	if err == nil {
+		if sendErr := stream.SendMsg(reqMsg); sendErr != nil {
+			err = sendErr
+		} else {
+			err = stream.CloseSend()
+		}
+	}
+
+	if err != nil {
+		writeGRPCError(ctx, w, err, nil)
+		return
+	}
+
+	// blocks until the server sent its headers (or failed)
+	if header, headerErr := stream.Header(); headerErr == nil {
+		writeGRPCMetadata(w.Header(), "Grpc-Header-", header)
+	}
+
+	w.Header().Set("Grpc-Encoding", responseEncoding(ctx))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	var streamErr error
+
+	for {
+		respMsg := dynamicpb.NewMessage(methodDesc.Output())
+
+		if recvErr := stream.RecvMsg(respMsg); recvErr != nil {
+			if recvErr != io.EOF {
+				streamErr = recvErr
+			}
+			break
+		}
+
+		// protojson emits a single line, as an SSE data field requires
+		raw, marshalErr := protojson.Marshal(respMsg)
+
+		if marshalErr != nil {
+			streamErr = status.Error(codes.Internal, fmt.Sprintf("failed to marshal proto to JSON: %v", marshalErr))
+			break
+		}
+
+		if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", raw); err != nil {
+			return
+		}
+
+		rc.Flush()
+	}
+
+	data, _ := json.Marshal(grpcStatus(ctx, streamErr, stream.Trailer()))
+
+	fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+	rc.Flush()
+}
+
+// grpcStatus describes the outcome of a call (err nil means OK) made with
+// ctx.
+func grpcStatus(ctx context.Context, err error, trailer metadata.MD) *GRPCStatus {
+	st := status.Convert(err)
+
+	result := &GRPCStatus{
+		Code:    st.Code().String(),
+		Message: st.Message(),
+
+		Trailers: grpcMetadataMap(trailer),
+	}
+
+	if err != nil {
+		result.Error = grpcErrorText(st)
+		result.Details = grpcStatusDetails(st)
+		result.Category, result.Retriable = grpcErrorCategory(st)
+	}
+
+	// as opposed to a DeadlineExceeded the server itself returned
+	if st.Code() == codes.DeadlineExceeded && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.DeadlineExceeded = true
+	}
+
+	return result
+}
+
+// grpcStatusDetails decodes the detail messages of a status (google.rpc
+// BadRequest, RetryInfo, ErrorInfo, ...) into their protojson form with an
+// "@type" member. Unknown types keep their raw bytes as base64 "value".
+func grpcStatusDetails(st *status.Status) []json.RawMessage {
+	var details []json.RawMessage
+
+	for _, detail := range st.Proto().GetDetails() {
+		raw, err := protojson.Marshal(detail)
+
+		if err != nil {
+			raw, _ = json.Marshal(map[string]string{
+				"@type": detail.GetTypeUrl(),
+				"value": base64.StdEncoding.EncodeToString(detail.GetValue()),
+			})
+		}
+
+		details = append(details, raw)
+	}
+
+	return details
+}
+
+// writeGRPCError answers a failed call with its GRPCStatus as JSON, under the
+// HTTP status matching the gRPC code.
+func writeGRPCError(ctx context.Context, w http.ResponseWriter, err error, trailer metadata.MD) {
+	result := grpcStatus(ctx, err, trailer)
+
+	w.Header().Set("Grpc-Status", result.Code)
+	w.Header().Set("Grpc-Message", result.Message)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusFromGRPCCode(status.Code(err)))
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeGRPCEnvelope answers with a GRPCResponse. Once the call was made its
+// outcome is part of the envelope, so the HTTP status is always 200.
+func writeGRPCEnvelope(w http.ResponseWriter, result *GRPCResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
 // grpcErrorText renders a failed call including any decodable status details
 // (e.g. google.rpc.BadRequest), which otherwise only travel as base64-encoded
 // grpc-status-details-bin trailers.
@@ -244,6 +505,27 @@ func writeGRPCMetadata(h http.Header, prefix string, md metadata.MD) {
 	}
 }
 
+// grpcMetadataMap converts metadata for JSON output, keeping the lowercase
+// keys (unlike writeGRPCMetadata); nil when md is empty.
+func grpcMetadataMap(md metadata.MD) map[string][]string {
+	if len(md) == 0 {
+		return nil
+	}
+
+	result := make(map[string][]string, len(md))
+
+	for k, vals := range md {
+		for _, v := range vals {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			result[k] = append(result[k], v)
+		}
+	}
+
+	return result
+}
+
 // grpcMetadataFromRequest builds outgoing metadata exclusively from smuggled
 // X-Prism-Header-* headers, so browser artifacts never leak into gRPC
 // metadata and no user key gets blocklisted. Values for -bin keys are
@@ -268,13 +550,270 @@ func grpcMetadataFromRequest(r *http.Request) metadata.MD {
 	return md
 }
 
-func grpcTransportCredentials(scheme string, insecureSkipVerify bool) grpc.DialOption {
-	if scheme == "grpcs" {
-		return grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
-			InsecureSkipVerify: insecureSkipVerify,
+// grpcOutgoingMetadata combines user metadata with the authorization derived
+// from a referenced OAuth2 credential (X-Prism-OAuth2) or the auth shortcut
+// (X-Prism-Grpc-Auth), which replaces any authorization metadata.
+func (s *Server) grpcOutgoingMetadata(r *http.Request, opts upstreamOptions) (metadata.MD, error) {
+	md := grpcMetadataFromRequest(r)
+
+	if r.Header.Get("X-Prism-Grpc-Auth") != "" && r.Header.Get("X-Prism-OAuth2") != "" {
+		return nil, errors.New("X-Prism-Grpc-Auth and X-Prism-OAuth2 cannot be combined")
+	}
+
+	authorization, err := s.oauth2Header(r, opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: %w", err)
+	}
+
+	if authorization == "" {
+		if authorization, err = s.grpcAuthorization(r, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if authorization != "" {
+		md.Set("authorization", authorization)
+	}
+
+	return md, nil
+}
+
+// grpcAuthorization resolves the X-Prism-Grpc-Auth shortcut into an
+// authorization value: "bearer <token>", "basic <user>:<password>" or
+// "credential <name>" for a stored OAuth2 credential. It returns "" when
+// the header is absent.
+func (s *Server) grpcAuthorization(r *http.Request, opts upstreamOptions) (string, error) {
+	value := r.Header.Get("X-Prism-Grpc-Auth")
+
+	if value == "" {
+		return "", nil
+	}
+
+	kind, arg, _ := strings.Cut(value, " ")
+	arg = strings.TrimSpace(arg)
+
+	if arg == "" {
+		return "", errors.New(`invalid X-Prism-Grpc-Auth, expected "<kind> <value>"`)
+	}
+
+	switch strings.ToLower(kind) {
+	case "bearer":
+		return "Bearer " + arg, nil
+
+	case "basic":
+		if !strings.Contains(arg, ":") {
+			return "", errors.New("invalid X-Prism-Grpc-Auth, basic expects user:password")
+		}
+
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(arg)), nil
+
+	case "credential":
+		token, err := s.oauth2AccessToken(r.Context(), arg, opts)
+
+		if err != nil {
+			return "", fmt.Errorf("oauth2: %w", err)
+		}
+
+		return token.Type() + " " + token.AccessToken, nil
+
+	default:
+		return "", fmt.Errorf("unsupported X-Prism-Grpc-Auth %q, expected bearer, basic or credential", kind)
+	}
+}
+
+// grpcCallOptions reads X-Prism-Compression: gzip compresses the request
+// messages, identity (the default) sends them uncompressed.
+func grpcCallOptions(r *http.Request) ([]grpc.CallOption, error) {
+	switch compression := r.Header.Get("X-Prism-Compression"); compression {
+	case "", "identity":
+		return nil, nil
+
+	case gzip.Name:
+		return []grpc.CallOption{grpc.UseCompressor(gzip.Name)}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported X-Prism-Compression %q, expected gzip or identity", compression)
+	}
+}
+
+type grpcEncodingKey struct{}
+
+// grpcEncoding receives the compression the server applied to the responses
+// of a call (grpc-encoding), which gRPC keeps out of the header metadata.
+// Calls opt in by carrying one in their context under grpcEncodingKey.
+type grpcEncoding struct {
+	mu   sync.Mutex
+	name string
+}
+
+func (e *grpcEncoding) set(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.name = name
+}
+
+// responseEncoding returns the response compression of the call made with
+// ctx, "identity" when the responses were not compressed.
+func responseEncoding(ctx context.Context) string {
+	e, ok := ctx.Value(grpcEncodingKey{}).(*grpcEncoding)
+
+	if !ok {
+		return ""
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.name == "" {
+		return "identity"
+	}
+
+	return e.name
+}
+
+// grpcEncodingRecorder is the stats handler filling in grpcEncoding.
+type grpcEncodingRecorder struct{}
+
+func (grpcEncodingRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (grpcEncodingRecorder) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	if header, ok := s.(*stats.InHeader); ok {
+		if e, ok := ctx.Value(grpcEncodingKey{}).(*grpcEncoding); ok {
+			e.set(header.Compression)
+		}
+	}
+}
+
+func (grpcEncodingRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (grpcEncodingRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+// connectGRPC dials host natively, or through gRPC-Web when web is set
+// (X-Prism-Grpc-Web), unless the target rules deny it.
+func (s *Server) connectGRPC(ctx context.Context, scheme, host string, opts upstreamOptions, web bool) (grpcConn, error) {
+	if err := s.checkTarget(ctx, scheme, host, opts); err != nil {
+		return nil, err
+	}
+
+	if web {
+		if _, ok := unixSocketPath(host); ok {
+			return nil, errors.New("gRPC-Web is not supported for unix socket targets")
+		}
+
+		return s.newGRPCWebConn(scheme, host, opts), nil
+	}
+
+	return s.dialGRPC(scheme, host, opts)
+}
+
+// dialGRPC creates a client for host, tunneling through an explicitly
+// configured outbound proxy. Without one, grpc-go applies HTTPS_PROXY from
+// the environment itself; else the address dialed is checked against the
+// target rules like for HTTP. The extra options come last and so override
+// the defaults.
+func (s *Server) dialGRPC(scheme, host string, opts upstreamOptions, extra ...grpc.DialOption) (*grpc.ClientConn, error) {
+	target := host
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(grpcTransportCredentials(scheme, opts)),
+		grpc.WithStatsHandler(grpcEncodingRecorder{}),
+	}
+
+	if opts.Proxy == "direct" {
+		dialOpts = append(dialOpts, grpc.WithNoProxy())
+	}
+
+	if opts.ConnectTimeout > 0 {
+		dialOpts = append(dialOpts, grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.DefaultConfig,
+			MinConnectTimeout: opts.ConnectTimeout,
 		}))
 	}
-	return grpc.WithTransportCredentials(insecure.NewCredentials())
+
+	if path, ok := unixSocketPath(host); ok {
+		// sockets are dialed directly, proxy and resolve overrides do not
+		// apply; the authority becomes localhost
+		target = "passthrough:///localhost"
+
+		dialOpts = append(dialOpts,
+			grpc.WithNoProxy(),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			}),
+		)
+	} else if proxyURL := opts.proxyURL(); proxyURL != nil {
+		// passthrough hands the unresolved host:port to the dialer, so the
+		// proxy resolves the name (as it would for HTTP).
+		target = "passthrough:///" + host
+
+		dialOpts = append(dialOpts,
+			grpc.WithNoProxy(),
+			grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				return dialProxy(s.withDialTarget(ctx, host, opts), proxyURL, opts.resolveAddr(addr))
+			}),
+		)
+	} else if opts.Resolve != "" || opts.Proxy == "direct" || !environmentProxy(host) {
+		// the name is resolved when dialing, so the address checked is the
+		// one connected to; resolve overrides only change where we dial, the
+		// authority (and with it TLS SNI) stays the original host
+		target = "passthrough:///" + host
+
+		dialOpts = append(dialOpts,
+			grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				return opts.dialContext(s.withDialTarget(ctx, host, opts), "tcp", addr)
+			}),
+		)
+	}
+
+	return grpc.NewClient(target, append(dialOpts, extra...)...)
+}
+
+// environmentProxy tells whether grpc-go tunnels to host through a proxy of
+// the environment; like grpc-go, it looks at HTTPS_PROXY whatever the
+// scheme.
+func environmentProxy(host string) bool {
+	proxyURL, err := http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: "https", Host: host}})
+	return err != nil || proxyURL != nil
+}
+
+// unixSocketPath returns the socket of a "unix:" host, written like a gRPC
+// target: unix:///absolute/path, unix:/absolute/path or unix:relative/path.
+// In proxy URLs the host is a single path segment, so its slashes are
+// percent-encoded.
+func unixSocketPath(host string) (string, bool) {
+	path, ok := strings.CutPrefix(host, "unix:")
+
+	if !ok || path == "" {
+		return "", false
+	}
+
+	if rest, ok := strings.CutPrefix(path, "//"); ok {
+		path = rest
+	}
+
+	return path, true
+}
+
+// grpcTransportCredentials selects TLS for grpcs (system roots plus any
+// CA, client certificate and skip-verify from opts) and plaintext for grpc.
+func grpcTransportCredentials(scheme string, opts upstreamOptions) credentials.TransportCredentials {
+	if scheme == "grpcs" {
+		config, _ := opts.tlsConfig()
+
+		if config == nil {
+			config = &tls.Config{}
+		}
+
+		return credentials.NewTLS(config)
+	}
+	return insecure.NewCredentials()
 }
 
 // httpStatusFromGRPCCode maps gRPC status codes to HTTP status codes
@@ -308,28 +847,56 @@ func httpStatusFromGRPCCode(code codes.Code) int {
 	}
 }
 
+// handleGRPCRefresh handles POST /proxy/grpc/{scheme}/{host}/refresh. It
+// drops the cached descriptors of the target and returns a fresh listing.
+func (s *Server) handleGRPCRefresh(w http.ResponseWriter, r *http.Request) {
+	s.grpcReflections.Delete(grpcTarget(r.PathValue("scheme"), r.PathValue("host")))
+
+	s.handleGRPCReflect(w, r)
+}
+
 func (s *Server) handleGRPCReflect(w http.ResponseWriter, r *http.Request) {
 	scheme := r.PathValue("scheme")
 	host := r.PathValue("host")
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	ctx, cancel, err := s.requestContext(w, r, 10*time.Second)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	defer cancel()
 
-	ctx = metadata.NewOutgoingContext(ctx, grpcMetadataFromRequest(r))
+	opts, err := s.upstreamOptionsFromRequest(r)
 
-	conn, err := grpc.NewClient(host, grpcTransportCredentials(scheme, r.Header.Get("X-Prism-Insecure") == "true"))
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	md, err := s.grpcOutgoingMetadata(r, opts)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	conn, err := s.connectGRPC(ctx, scheme, host, opts, r.Header.Get("X-Prism-Grpc-Web") == "true")
 
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to connect to %s: %v", host, err), http.StatusBadGateway)
+		writeProxyError(w, upstreamStatus(err), fmt.Errorf("failed to connect to %s: %w", host, err))
 		return
 	}
 
 	defer conn.Close()
 
-	services, err := reflectAllServices(ctx, conn)
+	services, err := s.grpcServices(ctx, conn, scheme, host)
 
 	if err != nil {
-		http.Error(w, "failed to list services: "+reflectionErrorText(err), http.StatusBadGateway)
+		writeProxyError(w, http.StatusBadGateway, &describedError{"failed to list services: " + reflectionErrorText(err), err})
 		return
 	}
 
@@ -349,6 +916,8 @@ func (s *Server) handleGRPCReflect(w http.ResponseWriter, r *http.Request) {
 			m := methods.Get(j)
 			methodRef := MethodReflection{
 				Name:            string(m.Name()),
+				InputType:       string(m.Input().FullName()),
+				OutputType:      string(m.Output().FullName()),
 				Schema:          buildMessageSchema(m.Input(), map[protoreflect.FullName]bool{}),
 				OutputSchema:    buildMessageSchema(m.Output(), map[protoreflect.FullName]bool{}),
 				ClientStreaming: m.IsStreamingClient(),
@@ -366,6 +935,8 @@ func (s *Server) handleGRPCReflect(w http.ResponseWriter, r *http.Request) {
 
 // buildMessageSchema creates a JSON Schema-like representation of a protobuf message.
 // visited breaks recursion for self-referential types (e.g. tree nodes).
+// Oneof members carry "x-oneof" with the oneof's name, and an "allOf"
+// constraint allows at most one member per oneof to be set.
 func buildMessageSchema(msg protoreflect.MessageDescriptor, visited map[protoreflect.FullName]bool) map[string]interface{} {
 	if wkt := wellKnownSchema(msg.FullName()); wkt != nil {
 		return wkt
@@ -373,6 +944,7 @@ func buildMessageSchema(msg protoreflect.MessageDescriptor, visited map[protoref
 
 	schema := map[string]interface{}{
 		"type":       "object",
+		"title":      string(msg.FullName()),
 		"properties": map[string]interface{}{},
 	}
 
@@ -386,10 +958,59 @@ func buildMessageSchema(msg protoreflect.MessageDescriptor, visited map[protoref
 	properties := schema["properties"].(map[string]interface{})
 	fields := msg.Fields()
 
+	var required []string
+
 	for i := 0; i < fields.Len(); i++ {
 		field := fields.Get(i)
 		fieldName := string(field.JSONName())
 		properties[fieldName] = buildFieldSchema(field, visited)
+
+		// proto2 only
+		if field.Cardinality() == protoreflect.Required {
+			required = append(required, fieldName)
+		}
+	}
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	var constraints []interface{}
+
+	oneofs := msg.Oneofs()
+
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+
+		// proto3 optional fields sit in a oneof of their own
+		if oneof.IsSynthetic() {
+			continue
+		}
+
+		members := oneof.Fields()
+		options := make([]interface{}, 0, members.Len())
+
+		for j := 0; j < members.Len(); j++ {
+			fieldName := string(members.Get(j).JSONName())
+
+			properties[fieldName].(map[string]interface{})["x-oneof"] = string(oneof.Name())
+			options = append(options, map[string]interface{}{"required": []string{fieldName}})
+		}
+
+		if len(options) < 2 {
+			continue
+		}
+
+		// exactly one of: a single member set, or none at all
+		constraints = append(constraints, map[string]interface{}{
+			"oneOf": append(options, map[string]interface{}{
+				"not": map[string]interface{}{"anyOf": options},
+			}),
+		})
+	}
+
+	if len(constraints) > 0 {
+		schema["allOf"] = constraints
 	}
 
 	return schema
@@ -490,13 +1111,14 @@ func buildScalarSchema(field protoreflect.FieldDescriptor, visited map[protorefl
 			return schema
 		}
 		schema["type"] = "string"
+		schema["title"] = string(field.Enum().FullName())
 		enumValues := field.Enum().Values()
 		values := make([]string, enumValues.Len())
 		for i := 0; i < enumValues.Len(); i++ {
 			values[i] = string(enumValues.Get(i).Name())
 		}
 		schema["enum"] = values
-	case protoreflect.MessageKind:
+	case protoreflect.MessageKind, protoreflect.GroupKind:
 		return buildMessageSchema(field.Message(), visited)
 	default:
 		schema["type"] = "string"
@@ -566,7 +1188,7 @@ func transcode(src, dst proto.Message) error {
 // servers that only register the deprecated variant.
 type autoReflectionClient struct {
 	ctx        context.Context
-	conn       *grpc.ClientConn
+	conn       grpcConn
 	client     reflectionClient
 	triedAlpha bool
 }
@@ -661,6 +1283,9 @@ var errGRPCReflection = errors.New("reflection failed")
 
 // reflectionErrorText clarifies the common no-reflection case.
 func reflectionErrorText(err error) string {
+	if errors.Is(err, errGRPCWebStreaming) {
+		return "reflection is not available over gRPC-Web, upload descriptors for this host instead"
+	}
 	if status.Code(err) == codes.Unimplemented {
 		return "server does not support the gRPC reflection API"
 	}
@@ -738,8 +1363,10 @@ func collectFiles(c reflectionClient, symbols []string) (map[string]*descriptorp
 
 // buildRegistry registers files in dependency order, skipping any file whose
 // closure is broken so the rest still resolve (best effort, like grpcurl).
-func buildRegistry(fdProtos map[string]*descriptorpb.FileDescriptorProto) *protoregistry.Files {
+// Skipped files are returned with the reason.
+func buildRegistry(fdProtos map[string]*descriptorpb.FileDescriptorProto) (*protoregistry.Files, map[string]error) {
 	files := new(protoregistry.Files)
+	unresolved := map[string]error{}
 
 	const (
 		stateFailed     = 1
@@ -763,15 +1390,25 @@ func buildRegistry(fdProtos map[string]*descriptorpb.FileDescriptorProto) *proto
 		}
 		for _, dep := range fdProto.GetDependency() {
 			if !register(dep) {
+				switch {
+				case fdProtos[dep] == nil:
+					unresolved[name] = fmt.Errorf("missing dependency %s", dep)
+				case unresolved[dep] == nil:
+					unresolved[name] = fmt.Errorf("import cycle through %s", dep)
+				default:
+					unresolved[name] = fmt.Errorf("unresolved dependency %s", dep)
+				}
 				return false
 			}
 		}
 
 		fd, err := protodesc.NewFile(fdProto, files)
 		if err != nil {
+			unresolved[name] = err
 			return false
 		}
 		if err := files.RegisterFile(fd); err != nil {
+			unresolved[name] = err
 			return false
 		}
 		state[name] = stateRegistered
@@ -782,11 +1419,23 @@ func buildRegistry(fdProtos map[string]*descriptorpb.FileDescriptorProto) *proto
 		register(name)
 	}
 
-	return files
+	return files, unresolved
+}
+
+// grpcReflectionEntry holds the descriptors of every service a server
+// lists via reflection.
+type grpcReflectionEntry struct {
+	files    *protoregistry.Files
+	services []string
+
+	// files that failed to resolve and why
+	unresolved map[string]error
+
+	fetched time.Time
 }
 
-// reflectAllServices lists every non-reflection service with full descriptors.
-func reflectAllServices(ctx context.Context, conn *grpc.ClientConn) ([]protoreflect.ServiceDescriptor, error) {
+// reflectServer fetches the descriptors of all non-reflection services.
+func reflectServer(ctx context.Context, conn grpcConn) (*grpcReflectionEntry, error) {
 	client := &autoReflectionClient{ctx: ctx, conn: conn}
 
 	names, err := reflectListServices(client)
@@ -809,11 +1458,49 @@ func reflectAllServices(ctx context.Context, conn *grpc.ClientConn) ([]protorefl
 		return nil, fmt.Errorf("failed to fetch descriptors: %s", reflectionErrorText(err))
 	}
 
-	files := buildRegistry(fdProtos)
+	files, unresolved := buildRegistry(fdProtos)
+
+	return &grpcReflectionEntry{
+		files:    files,
+		services: symbols,
+
+		unresolved: unresolved,
+
+		fetched: time.Now(),
+	}, nil
+}
+
+// method looks up service/method. When the service is missing while some
+// files failed to resolve, those are named as the likely cause.
+func (e *grpcReflectionEntry) method(service, method string) (protoreflect.MethodDescriptor, error) {
+	methodDesc, err := lookupMethod(e.files, service, method)
+
+	if err == nil || len(e.unresolved) == 0 {
+		return methodDesc, err
+	}
+
+	if _, findErr := e.files.FindDescriptorByName(protoreflect.FullName(service)); findErr == nil {
+		return nil, err
+	}
+
+	names := slices.Sorted(maps.Keys(e.unresolved))
+
+	reasons := make([]string, 0, len(names))
+	for _, name := range names[:min(len(names), 3)] {
+		reasons = append(reasons, fmt.Sprintf("%s: %v", name, e.unresolved[name]))
+	}
+	if len(names) > 3 {
+		reasons = append(reasons, fmt.Sprintf("and %d more", len(names)-3))
+	}
+
+	return nil, fmt.Errorf("%w (unresolved descriptors: %s)", err, strings.Join(reasons, "; "))
+}
 
+// serviceDescriptors returns the listed services that could be resolved.
+func (e *grpcReflectionEntry) serviceDescriptors() []protoreflect.ServiceDescriptor {
 	var services []protoreflect.ServiceDescriptor
-	for _, symbol := range symbols {
-		desc, err := files.FindDescriptorByName(protoreflect.FullName(symbol))
+	for _, symbol := range e.services {
+		desc, err := e.files.FindDescriptorByName(protoreflect.FullName(symbol))
 		if err != nil {
 			continue
 		}
@@ -822,22 +1509,11 @@ func reflectAllServices(ctx context.Context, conn *grpc.ClientConn) ([]protorefl
 		}
 	}
 
-	return services, nil
+	return services
 }
 
-// findMethodDescriptor resolves a single method for invocation without
-// reflecting the server's entire service list.
-func findMethodDescriptor(ctx context.Context, conn *grpc.ClientConn, service, method string) (protoreflect.MethodDescriptor, error) {
-	client := &autoReflectionClient{ctx: ctx, conn: conn}
-
-	fdProtos, err := collectFiles(client, []string{service})
-
-	if err != nil {
-		return nil, fmt.Errorf("%w: %s", errGRPCReflection, reflectionErrorText(err))
-	}
-
-	files := buildRegistry(fdProtos)
-
+// lookupMethod finds service/method in a set of resolved files.
+func lookupMethod(files *protoregistry.Files, service, method string) (protoreflect.MethodDescriptor, error) {
 	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
 
 	if err != nil {
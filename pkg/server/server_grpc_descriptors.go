@@ -0,0 +1,434 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// grpcDescriptorStore is the data store holding uploaded descriptors per
+// host, used for servers that have reflection disabled.
+const grpcDescriptorStore = "protos"
+
+const maxDescriptorSize = 16 << 20
+
+const (
+	// grpcReflectionTTL is how long reflected descriptors of a target are
+	// reused before reflecting again.
+	grpcReflectionTTL = 5 * time.Minute
+
+	// grpcReflectionRefreshInterval limits refetches triggered by services
+	// missing from the cache.
+	grpcReflectionRefreshInterval = 30 * time.Second
+)
+
+// grpcDescriptorEntry is a stored, self-contained FileDescriptorSet.
+type grpcDescriptorEntry struct {
+	Host string `json:"host"`
+
+	DescriptorSet []byte `json:"descriptorSet"`
+
+	Updated time.Time `json:"updated"`
+}
+
+// grpcDescriptorID maps a host ("api.example.com:443") onto a store id;
+// base64url only uses characters validName accepts.
+func grpcDescriptorID(host string) (string, error) {
+	id := base64.RawURLEncoding.EncodeToString([]byte(strings.ToLower(host)))
+
+	if !validName(id) {
+		return "", errors.New("invalid host")
+	}
+
+	return id, nil
+}
+
+// handleGRPCDescriptorsGet handles GET /grpc/descriptors/{host}
+func (s *Server) handleGRPCDescriptorsGet(w http.ResponseWriter, r *http.Request) {
+	host := r.PathValue("host")
+
+	entry, err := loadGRPCDescriptorEntry(r.Context(), host)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "no descriptors uploaded for "+host, http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	files, err := entry.files()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(describeGRPCDescriptors(entry, files))
+}
+
+// handleGRPCDescriptorsPut handles PUT /grpc/descriptors/{host}. The body is
+// either a binary FileDescriptorSet (protoc --include_imports -o) or a
+// GRPCDescriptorUpload; descriptors already stored for the host are replaced.
+func (s *Server) handleGRPCDescriptorsPut(w http.ResponseWriter, r *http.Request) {
+	host := r.PathValue("host")
+
+	id, err := grpcDescriptorID(host)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDescriptorSize))
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case "application/octet-stream", "application/x-protobuf", "application/protobuf":
+		if err := proto.Unmarshal(body, set); err != nil {
+			http.Error(w, "invalid descriptor set: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+	default:
+		var req GRPCDescriptorUpload
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case len(req.Protos) > 0:
+			if set, err = compileProtos(r.Context(), req.Protos); err != nil {
+				http.Error(w, "compile: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+		case len(req.DescriptorSet) > 0:
+			if err := proto.Unmarshal(req.DescriptorSet, set); err != nil {
+				http.Error(w, "invalid descriptor set: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+		default:
+			http.Error(w, "one of protos or descriptorSet is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(set.File) == 0 {
+		http.Error(w, "descriptor set contains no files", http.StatusBadRequest)
+		return
+	}
+
+	completeDescriptorSet(set)
+
+	files, err := protodesc.NewFiles(set)
+
+	if err != nil {
+		http.Error(w, "invalid descriptor set: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := proto.Marshal(set)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entry := &grpcDescriptorEntry{
+		Host: strings.ToLower(host),
+
+		DescriptorSet: data,
+
+		Updated: time.Now().UTC(),
+	}
+
+	if err := saveEntry(r.Context(), grpcDescriptorStore, id, entry); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(describeGRPCDescriptors(entry, files))
+}
+
+// handleGRPCDescriptorsDelete handles DELETE /grpc/descriptors/{host}
+func (s *Server) handleGRPCDescriptorsDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := grpcDescriptorID(r.PathValue("host"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := dataStore(r.Context()).Delete(grpcDescriptorStore, id); err != nil && !errors.Is(err, os.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func loadGRPCDescriptorEntry(ctx context.Context, host string) (*grpcDescriptorEntry, error) {
+	id, err := grpcDescriptorID(host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entry grpcDescriptorEntry
+
+	if err := loadEntry(ctx, grpcDescriptorStore, id, &entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// loadGRPCDescriptors returns the uploaded descriptors of host; a missing
+// upload is reported as os.ErrNotExist.
+func loadGRPCDescriptors(ctx context.Context, host string) (*protoregistry.Files, error) {
+	entry, err := loadGRPCDescriptorEntry(ctx, host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.files()
+}
+
+func (e *grpcDescriptorEntry) files() (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+
+	if err := proto.Unmarshal(e.DescriptorSet, set); err != nil {
+		return nil, fmt.Errorf("stored descriptors of %s: %w", e.Host, err)
+	}
+
+	files, err := protodesc.NewFiles(set)
+
+	if err != nil {
+		return nil, fmt.Errorf("stored descriptors of %s: %w", e.Host, err)
+	}
+
+	return files, nil
+}
+
+func describeGRPCDescriptors(entry *grpcDescriptorEntry, files *protoregistry.Files) GRPCDescriptors {
+	result := GRPCDescriptors{
+		Host: entry.Host,
+
+		Files:    []string{},
+		Services: []string{},
+
+		Updated: &entry.Updated,
+	}
+
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		result.Files = append(result.Files, fd.Path())
+
+		services := fd.Services()
+
+		for i := range services.Len() {
+			result.Services = append(result.Services, string(services.Get(i).FullName()))
+		}
+
+		return true
+	})
+
+	slices.Sort(result.Files)
+	slices.Sort(result.Services)
+
+	return result
+}
+
+// compileProtos compiles .proto sources keyed by file name into a set that
+// includes every imported file. Imports resolve among the sources and the
+// well-known types.
+func compileProtos(ctx context.Context, sources map[string]string) (*descriptorpb.FileDescriptorSet, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(sources),
+		}),
+	}
+
+	files, err := compiler.Compile(ctx, slices.Sorted(maps.Keys(sources))...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+
+	// dependencies first, as protoc orders them
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+
+		seen[fd.Path()] = true
+
+		imports := fd.Imports()
+
+		for i := range imports.Len() {
+			add(imports.Get(i).FileDescriptor)
+		}
+
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+
+	for _, fd := range files {
+		add(fd)
+	}
+
+	return set, nil
+}
+
+// completeDescriptorSet adds imported files missing from set (a set built
+// without --include_imports) from the well-known types linked into prism.
+func completeDescriptorSet(set *descriptorpb.FileDescriptorSet) {
+	present := map[string]bool{}
+
+	for _, fd := range set.File {
+		present[fd.GetName()] = true
+	}
+
+	for i := 0; i < len(set.File); i++ {
+		for _, dep := range set.File[i].GetDependency() {
+			if present[dep] {
+				continue
+			}
+
+			if fd, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+				present[dep] = true
+			}
+		}
+	}
+}
+
+// grpcReflection returns the cached reflection of a target, reflecting
+// again once it expired or when it lacks service (a redeployed server), at
+// most every grpcReflectionRefreshInterval. Failures are not cached.
+func (s *Server) grpcReflection(ctx context.Context, conn grpcConn, scheme, host, service string) (*grpcReflectionEntry, error) {
+	target := grpcTarget(scheme, host)
+
+	now := time.Now()
+
+	if value, ok := s.grpcReflections.Load(target); ok {
+		entry := value.(*grpcReflectionEntry)
+
+		age := now.Sub(entry.fetched)
+		known := service == "" || slices.Contains(entry.services, service)
+
+		if age < grpcReflectionTTL && (known || age < grpcReflectionRefreshInterval) {
+			return entry, nil
+		}
+	}
+
+	entry, err := reflectServer(ctx, conn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.grpcReflections.Store(target, entry)
+
+	return entry, nil
+}
+
+func grpcTarget(scheme, host string) string {
+	return strings.ToLower(scheme + "://" + host)
+}
+
+// grpcMethod resolves a method through (cached) reflection, falling back to
+// the descriptors uploaded for host when the server offers no reflection.
+func (s *Server) grpcMethod(ctx context.Context, conn grpcConn, scheme, host, service, method string) (protoreflect.MethodDescriptor, error) {
+	entry, err := s.grpcReflection(ctx, conn, scheme, host, service)
+
+	if err == nil {
+		return entry.method(service, method)
+	}
+
+	err = fmt.Errorf("%w: %w", errGRPCReflection, &describedError{reflectionErrorText(err), err})
+
+	files, loadErr := loadGRPCDescriptors(ctx, host)
+
+	if loadErr != nil {
+		if errors.Is(loadErr, os.ErrNotExist) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w: %v", errGRPCReflection, loadErr)
+	}
+
+	return lookupMethod(files, service, method)
+}
+
+// grpcServices lists the services of host, like grpcMethod falling back to
+// uploaded descriptors.
+func (s *Server) grpcServices(ctx context.Context, conn grpcConn, scheme, host string) ([]protoreflect.ServiceDescriptor, error) {
+	entry, err := s.grpcReflection(ctx, conn, scheme, host, "")
+
+	if err == nil {
+		return entry.serviceDescriptors(), nil
+	}
+
+	files, loadErr := loadGRPCDescriptors(ctx, host)
+
+	if loadErr != nil {
+		if errors.Is(loadErr, os.ErrNotExist) {
+			return nil, err
+		}
+
+		return nil, loadErr
+	}
+
+	var services []protoreflect.ServiceDescriptor
+
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		list := fd.Services()
+
+		for i := range list.Len() {
+			services = append(services, list.Get(i))
+		}
+
+		return true
+	})
+
+	slices.SortFunc(services, func(a, b protoreflect.ServiceDescriptor) int {
+		return strings.Compare(string(a.FullName()), string(b.FullName()))
+	})
+
+	return services, nil
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// maxGRPCHealthWatch bounds ?watch= of a health probe.
+const maxGRPCHealthWatch = time.Minute
+
+// handleGRPCHealth handles GET /proxy/grpc/{scheme}/{host}/health. It asks
+// grpc.health.v1.Health about each ?service= or, without any, about the
+// server as a whole ("") and every service it exposes. ?watch=<ms> watches
+// the statuses for that long instead of checking them once.
+func (s *Server) handleGRPCHealth(w http.ResponseWriter, r *http.Request) {
+	scheme := r.PathValue("scheme")
+	host := r.PathValue("host")
+
+	query := r.URL.Query()
+
+	var watch time.Duration
+
+	if value := query.Get("watch"); value != "" {
+		ms, err := strconv.ParseInt(value, 10, 64)
+
+		if err != nil || ms <= 0 {
+			writeProxyError(w, http.StatusBadRequest, errors.New("invalid watch: expected milliseconds"))
+			return
+		}
+
+		watch = min(time.Duration(ms)*time.Millisecond, maxGRPCHealthWatch)
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, 10*time.Second+watch)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	defer cancel()
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	md, err := s.grpcOutgoingMetadata(r, opts)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	conn, err := s.connectGRPC(ctx, scheme, host, opts, r.Header.Get("X-Prism-Grpc-Web") == "true")
+
+	if err != nil {
+		writeProxyError(w, upstreamStatus(err), fmt.Errorf("failed to connect to %s: %w", host, err))
+		return
+	}
+
+	defer conn.Close()
+
+	services := query["service"]
+
+	if len(services) == 0 {
+		services = []string{""}
+
+		// listing is best effort, the overall status needs no reflection
+		if list, err := s.grpcServices(ctx, conn, scheme, host); err == nil {
+			for _, svc := range list {
+				switch name := string(svc.FullName()); name {
+				case grpc_health_v1.Health_ServiceDesc.ServiceName,
+					grpc_reflection_v1.ServerReflection_ServiceDesc.ServiceName,
+					grpc_reflection_v1alpha.ServerReflection_ServiceDesc.ServiceName:
+				default:
+					services = append(services, name)
+				}
+			}
+		}
+	}
+
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	result := &GRPCHealth{
+		Services: make([]GRPCServiceHealth, len(services)),
+	}
+
+	var wg sync.WaitGroup
+
+	for i, service := range services {
+		wg.Go(func() {
+			if watch > 0 {
+				result.Services[i] = watchGRPCHealth(ctx, client, service, watch)
+			} else {
+				result.Services[i] = checkGRPCHealth(ctx, client, service)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	result.Serving = true
+
+	for _, h := range result.Services {
+		if h.Status != grpc_health_v1.HealthCheckResponse_SERVING.String() {
+			result.Serving = false
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func checkGRPCHealth(ctx context.Context, client grpc_health_v1.HealthClient, service string) GRPCServiceHealth {
+	result := GRPCServiceHealth{
+		Service: service,
+	}
+
+	start := time.Now()
+
+	resp, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service})
+
+	result.DurationMS = time.Since(start).Milliseconds()
+
+	if err != nil {
+		result.Status, result.Error = grpcHealthError(err)
+		return result
+	}
+
+	result.Status = resp.GetStatus().String()
+
+	return result
+}
+
+// watchGRPCHealth follows the status of service for d; Updates lists every
+// status the server reported, the first being the status at the start.
+func watchGRPCHealth(ctx context.Context, client grpc_health_v1.HealthClient, service string, d time.Duration) GRPCServiceHealth {
+	result := GRPCServiceHealth{
+		Service: service,
+	}
+
+	start := time.Now()
+
+	watchCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	stream, err := client.Watch(watchCtx, &grpc_health_v1.HealthCheckRequest{Service: service})
+
+	for err == nil {
+		var resp *grpc_health_v1.HealthCheckResponse
+
+		if resp, err = stream.Recv(); err == nil {
+			result.Status = resp.GetStatus().String()
+			result.Updates = append(result.Updates, result.Status)
+		}
+	}
+
+	result.DurationMS = time.Since(start).Milliseconds()
+
+	// the watch period running out, or the server ending the stream, is the
+	// expected end of a watch
+	if err == io.EOF || (watchCtx.Err() != nil && ctx.Err() == nil) {
+		return result
+	}
+
+	result.Status, result.Error = grpcHealthError(err)
+
+	return result
+}
+
+// grpcHealthError maps a failed probe to a status, or to an error text when
+// the server could not tell.
+func grpcHealthError(err error) (string, string) {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return grpc_health_v1.HealthCheckResponse_SERVICE_UNKNOWN.String(), ""
+
+	case codes.Unimplemented:
+		return "", "the server does not implement grpc.health.v1.Health"
+	}
+
+	return "", err.Error()
+}
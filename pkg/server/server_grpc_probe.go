@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// handleGRPCProbe handles GET /proxy/grpc/{scheme}/{host}/probe. It dials
+// the target without calling any method and reports the connectivity state
+// transitions, the TLS handshake and the Stage a failed connection broke
+// down in, telling network, TLS and protocol problems apart.
+func (s *Server) handleGRPCProbe(w http.ResponseWriter, r *http.Request) {
+	scheme := r.PathValue("scheme")
+	host := r.PathValue("host")
+
+	ctx, cancel, err := s.requestContext(w, r, 10*time.Second)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	defer cancel()
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.checkTarget(ctx, scheme, host, opts); err != nil {
+		writeProxyError(w, http.StatusForbidden, err)
+		return
+	}
+
+	probe := &grpcProbe{
+		start: time.Now(),
+	}
+
+	creds := &probeCredentials{
+		TransportCredentials: grpcTransportCredentials(scheme, opts),
+		probe:                probe,
+	}
+
+	conn, err := s.dialGRPC(scheme, host, opts, grpc.WithTransportCredentials(creds))
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, fmt.Errorf("failed to connect to %s: %w", host, err))
+		return
+	}
+
+	defer conn.Close()
+
+	result := &GRPCProbe{
+		Target:      conn.CanonicalTarget(),
+		Transitions: []GRPCStateTransition{},
+	}
+
+	conn.Connect()
+
+	for {
+		state := conn.GetState()
+
+		result.State = state.String()
+		result.Transitions = append(result.Transitions, GRPCStateTransition{
+			State: state.String(),
+			AtMS:  time.Since(probe.start).Milliseconds(),
+		})
+
+		if state == connectivity.Ready || state == connectivity.TransientFailure || state == connectivity.Shutdown {
+			break
+		}
+
+		if !conn.WaitForStateChange(ctx, state) {
+			result.Error = "timed out while " + state.String()
+			break
+		}
+	}
+
+	result.DurationMS = time.Since(probe.start).Milliseconds()
+
+	if result.State == connectivity.TransientFailure.String() {
+		result.Error = lastConnectionError(ctx, conn)
+	}
+
+	probe.report(result)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// lastConnectionError returns the error that took conn into
+// TRANSIENT_FAILURE, which gRPC only reveals through failing calls: a
+// fail-fast call is rejected right away with it, without reaching the
+// server.
+func lastConnectionError(ctx context.Context, conn *grpc.ClientConn) string {
+	err := conn.Invoke(ctx, "/prism.Probe/Connect", &emptypb.Empty{}, &emptypb.Empty{})
+
+	if err == nil {
+		return ""
+	}
+
+	return status.Convert(err).Message()
+}
+
+// grpcProbe records the connection attempts of a probe.
+type grpcProbe struct {
+	mu sync.Mutex
+
+	start time.Time
+
+	connected  time.Time
+	remoteAddr string
+
+	handshakeDone time.Time
+	handshakeErr  error
+	tlsState      *tls.ConnectionState
+}
+
+// report fills in the connection details and, for a failed connection,
+// the stage it failed in: "network" when no connection was established,
+// "tls" when the handshake failed, else "protocol" (the peer does not
+// speak HTTP/2 or gRPC).
+func (p *grpcProbe) report(result *GRPCProbe) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result.RemoteAddr = p.remoteAddr
+
+	if !p.connected.IsZero() {
+		result.ConnectMS = p.connected.Sub(p.start).Milliseconds()
+	}
+
+	if p.tlsState != nil {
+		result.TLS = grpcProbeTLS(p.tlsState)
+		result.TLS.HandshakeMS = p.handshakeDone.Sub(p.connected).Milliseconds()
+	}
+
+	if result.State == connectivity.Ready.String() {
+		return
+	}
+
+	switch {
+	case p.connected.IsZero():
+		result.Stage = "network"
+
+	case p.handshakeErr != nil:
+		result.Stage = "tls"
+
+		if result.Error == "" {
+			result.Error = p.handshakeErr.Error()
+		}
+
+	default:
+		result.Stage = "protocol"
+	}
+}
+
+func grpcProbeTLS(state *tls.ConnectionState) *GRPCProbeTLS {
+	info := &GRPCProbeTLS{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		ServerName:  state.ServerName,
+		Resumed:     state.DidResume,
+	}
+
+	for _, cert := range state.PeerCertificates {
+		info.Certificates = append(info.Certificates, GRPCProbeCertificate{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			DNSNames:  cert.DNSNames,
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+
+	return info
+}
+
+// probeCredentials wraps the transport credentials of a probe to learn when
+// the connection was established and how the handshake went.
+type probeCredentials struct {
+	credentials.TransportCredentials
+
+	probe *grpcProbe
+}
+
+func (c *probeCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	c.probe.mu.Lock()
+	c.probe.connected = time.Now()
+	c.probe.remoteAddr = rawConn.RemoteAddr().String()
+	c.probe.mu.Unlock()
+
+	conn, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+
+	c.probe.mu.Lock()
+	defer c.probe.mu.Unlock()
+
+	c.probe.handshakeDone = time.Now()
+	c.probe.handshakeErr = err
+
+	if tlsInfo, ok := info.(credentials.TLSInfo); ok {
+		c.probe.tlsState = &tlsInfo.State
+	}
+
+	return conn, info, err
+}
+
+func (c *probeCredentials) Clone() credentials.TransportCredentials {
+	return &probeCredentials{
+		TransportCredentials: c.TransportCredentials.Clone(),
+		probe:                c.probe,
+	}
+}
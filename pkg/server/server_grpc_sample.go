@@ -0,0 +1,207 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// handleGRPCSample handles GET /proxy/grpc/{scheme}/{host}/sample. It
+// returns a request skeleton for ?service=&method= with every field set to
+// a placeholder, so the protojson field names need not be guessed.
+func (s *Server) handleGRPCSample(w http.ResponseWriter, r *http.Request) {
+	scheme := r.PathValue("scheme")
+	host := r.PathValue("host")
+
+	service := r.URL.Query().Get("service")
+	method := r.URL.Query().Get("method")
+
+	if service == "" || method == "" {
+		writeProxyError(w, http.StatusBadRequest, errors.New("service and method are required"))
+		return
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, 10*time.Second)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	defer cancel()
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	md, err := s.grpcOutgoingMetadata(r, opts)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	conn, err := s.connectGRPC(ctx, scheme, host, opts, r.Header.Get("X-Prism-Grpc-Web") == "true")
+
+	if err != nil {
+		writeProxyError(w, upstreamStatus(err), fmt.Errorf("failed to connect to %s: %w", host, err))
+		return
+	}
+
+	defer conn.Close()
+
+	methodDesc, err := s.grpcMethod(ctx, conn, scheme, host, service, method)
+
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errGRPCReflection) {
+			code = http.StatusBadGateway
+		}
+		writeProxyError(w, code, err)
+		return
+	}
+
+	enums := map[string][]string{}
+
+	msg := dynamicpb.NewMessage(methodDesc.Input())
+	fillSampleMessage(msg, "", map[protoreflect.FullName]bool{}, enums)
+
+	data, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(msg)
+
+	if err != nil {
+		writeProxyError(w, http.StatusInternalServerError, fmt.Errorf("failed to marshal sample: %w", err))
+		return
+	}
+
+	result := &GRPCSample{
+		Service:   service,
+		Method:    method,
+		InputType: string(methodDesc.Input().FullName()),
+
+		Message: data,
+	}
+
+	if len(enums) > 0 {
+		result.Enums = enums
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// fillSampleMessage sets every field of msg to a placeholder: scalars to
+// their default, repeated fields and maps to one element, and oneofs to
+// their first member. Recursive types are set once and then left empty.
+// The values of enum fields are collected by dotted JSON path.
+func fillSampleMessage(msg protoreflect.Message, path string, visited map[protoreflect.FullName]bool, enums map[string][]string) {
+	desc := msg.Descriptor()
+
+	// well-known types have their own JSON forms, which the empty message
+	// already renders (a Value needs a kind though)
+	if strings.HasPrefix(string(desc.FullName()), "google.protobuf.") {
+		if desc.FullName() == "google.protobuf.Value" {
+			msg.Set(desc.Fields().ByName("null_value"), protoreflect.ValueOfEnum(0))
+		}
+
+		return
+	}
+
+	if visited[desc.FullName()] {
+		return
+	}
+
+	visited[desc.FullName()] = true
+	defer delete(visited, desc.FullName())
+
+	fields := desc.Fields()
+
+	for i := range fields.Len() {
+		field := fields.Get(i)
+
+		if oneof := field.ContainingOneof(); oneof != nil && oneof.Fields().Get(0) != field {
+			continue
+		}
+
+		fieldPath := string(field.JSONName())
+
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		switch {
+		case field.IsMap():
+			entries := msg.Mutable(field).Map()
+
+			key := field.MapKey().Default().MapKey()
+
+			if field.MapKey().Kind() == protoreflect.StringKind {
+				key = protoreflect.ValueOfString("key").MapKey()
+			}
+
+			value := field.MapValue()
+
+			if value.Message() != nil {
+				entry := entries.NewValue()
+				fillSampleMessage(entry.Message(), fieldPath, visited, enums)
+				entries.Set(key, entry)
+			} else {
+				entries.Set(key, sampleScalar(value, fieldPath, enums))
+			}
+
+		case field.IsList():
+			list := msg.Mutable(field).List()
+
+			if field.Message() != nil {
+				element := list.NewElement()
+				fillSampleMessage(element.Message(), fieldPath, visited, enums)
+				list.Append(element)
+			} else {
+				list.Append(sampleScalar(field, fieldPath, enums))
+			}
+
+		case field.Message() != nil:
+			if visited[field.Message().FullName()] {
+				continue
+			}
+
+			fillSampleMessage(msg.Mutable(field).Message(), fieldPath, visited, enums)
+
+		default:
+			msg.Set(field, sampleScalar(field, fieldPath, enums))
+		}
+	}
+}
+
+// sampleScalar returns the placeholder of a scalar field, recording the
+// allowed values of an enum.
+func sampleScalar(field protoreflect.FieldDescriptor, path string, enums map[string][]string) protoreflect.Value {
+	if enum := field.Enum(); enum != nil && enum.FullName() != "google.protobuf.NullValue" {
+		values := enum.Values()
+
+		names := make([]string, values.Len())
+
+		for i := range values.Len() {
+			names[i] = string(values.Get(i).Name())
+		}
+
+		enums[path] = names
+
+		return protoreflect.ValueOfEnum(values.Get(0).Number())
+	}
+
+	return field.Default()
+}
@@ -0,0 +1,536 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcConn is a native gRPC client connection or a gRPC-Web one.
+type grpcConn interface {
+	grpc.ClientConnInterface
+
+	Close() error
+}
+
+// errGRPCWebStreaming rejects client and bidirectional streams, which the
+// gRPC-Web protocol cannot carry (this includes the reflection service).
+var errGRPCWebStreaming = status.Error(codes.Unimplemented, "gRPC-Web does not support client or bidirectional streaming")
+
+const maxGRPCWebMessage = 64 << 20
+
+// grpcWebConn speaks gRPC-Web (application/grpc-web+proto over HTTP/1.1 or
+// HTTP/2) to targets behind Envoy or Connect gateways that do not accept
+// native gRPC.
+type grpcWebConn struct {
+	client *http.Client
+
+	// base is "http://host" or "https://host"
+	base string
+}
+
+func (s *Server) newGRPCWebConn(scheme, host string, opts upstreamOptions) *grpcWebConn {
+	base := "http://" + host
+
+	if scheme == "grpcs" {
+		base = "https://" + host
+	}
+
+	return &grpcWebConn{
+		client: &http.Client{Transport: &targetTransport{base: s.transport(opts), server: s, opts: opts}},
+		base:   base,
+	}
+}
+
+func (c *grpcWebConn) Close() error {
+	return nil
+}
+
+func (c *grpcWebConn) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	stream, err := c.NewStream(ctx, &grpc.StreamDesc{}, method, opts...)
+
+	if err != nil {
+		return err
+	}
+
+	ws := stream.(*grpcWebStream)
+
+	err = ws.invoke(args, reply)
+
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case grpc.HeaderCallOption:
+			*o.HeaderAddr = ws.header
+		case grpc.TrailerCallOption:
+			*o.TrailerAddr = ws.trailer
+		}
+	}
+
+	return err
+}
+
+func (c *grpcWebConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if desc.ClientStreams {
+		return nil, errGRPCWebStreaming
+	}
+
+	stream := &grpcWebStream{
+		ctx:    ctx,
+		conn:   c,
+		method: method,
+
+		ready: make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		if o, ok := opt.(grpc.CompressorCallOption); ok && o.CompressorType != "" && o.CompressorType != "identity" {
+			if o.CompressorType != "gzip" {
+				return nil, status.Errorf(codes.Internal, "unsupported compression %q", o.CompressorType)
+			}
+
+			stream.compress = true
+		}
+	}
+
+	return stream, nil
+}
+
+// grpcWebStream is a call with a single request message; the request is
+// sent on CloseSend and the response frames are read by RecvMsg.
+type grpcWebStream struct {
+	ctx    context.Context
+	conn   *grpcWebConn
+	method string
+
+	request  []byte
+	compress bool
+	sent     bool
+	started  sync.Once
+
+	// closed once the response headers arrived or the request failed
+	ready chan struct{}
+
+	resp    *http.Response
+	reader  *bufio.Reader
+	respErr error
+
+	header  metadata.MD
+	trailer metadata.MD
+
+	// final status once the stream ended (nil means OK)
+	done   bool
+	status error
+}
+
+func (s *grpcWebStream) Header() (metadata.MD, error) {
+	select {
+	case <-s.ready:
+	case <-s.ctx.Done():
+		return nil, status.FromContextError(s.ctx.Err()).Err()
+	}
+
+	if s.respErr != nil {
+		return nil, s.respErr
+	}
+
+	return s.header, nil
+}
+
+func (s *grpcWebStream) Trailer() metadata.MD {
+	return s.trailer
+}
+
+func (s *grpcWebStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *grpcWebStream) SendMsg(m any) error {
+	if s.sent {
+		return status.Error(codes.Internal, "gRPC-Web calls take a single request message")
+	}
+
+	data, err := proto.Marshal(m.(proto.Message))
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to marshal request: %v", err)
+	}
+
+	s.request = data
+	s.sent = true
+
+	return nil
+}
+
+func (s *grpcWebStream) CloseSend() error {
+	s.started.Do(func() {
+		go s.roundTrip()
+	})
+
+	return nil
+}
+
+func (s *grpcWebStream) RecvMsg(m any) error {
+	s.CloseSend()
+
+	select {
+	case <-s.ready:
+	case <-s.ctx.Done():
+		return status.FromContextError(s.ctx.Err()).Err()
+	}
+
+	if s.respErr != nil {
+		return s.respErr
+	}
+
+	for !s.done {
+		flags, data, err := s.readFrame()
+
+		if err != nil {
+			s.finish(err)
+			break
+		}
+
+		if flags&0x80 != 0 {
+			s.finish(s.trailerStatus(parseGRPCWebTrailer(data)))
+			break
+		}
+
+		if err := proto.Unmarshal(data, m.(proto.Message)); err != nil {
+			s.finish(status.Errorf(codes.Internal, "failed to unmarshal response: %v", err))
+			break
+		}
+
+		return nil
+	}
+
+	if s.status != nil {
+		return s.status
+	}
+
+	return io.EOF
+}
+
+// invoke performs a unary call.
+func (s *grpcWebStream) invoke(args, reply any) error {
+	if err := s.SendMsg(args); err != nil {
+		return err
+	}
+
+	if err := s.RecvMsg(reply); err != nil {
+		if err == io.EOF {
+			return status.Error(codes.Internal, "server sent no response message")
+		}
+
+		return err
+	}
+
+	// read on to the trailers, which carry the status
+	switch err := s.RecvMsg(proto.Clone(reply.(proto.Message))); {
+	case err == nil:
+		s.finish(status.Error(codes.Internal, "server sent more than one response message"))
+		return s.status
+
+	case err != io.EOF:
+		return err
+	}
+
+	return nil
+}
+
+func (s *grpcWebStream) roundTrip() {
+	defer close(s.ready)
+
+	payload := s.request
+
+	if s.compress {
+		var buf bytes.Buffer
+
+		zw := gzip.NewWriter(&buf)
+		zw.Write(payload)
+		zw.Close()
+
+		payload = buf.Bytes()
+	}
+
+	body := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(payload)))
+	copy(body[5:], payload)
+
+	if s.compress {
+		body[0] = 0x01
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.conn.base+s.method, bytes.NewReader(body))
+
+	if err != nil {
+		s.respErr = status.Error(codes.Internal, err.Error())
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("Accept", "application/grpc-web+proto")
+	req.Header.Set("X-Grpc-Web", "1")
+	req.Header.Set("Grpc-Accept-Encoding", "gzip")
+
+	if s.compress {
+		req.Header.Set("Grpc-Encoding", "gzip")
+	}
+
+	if deadline, ok := s.ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", encodeGRPCTimeout(time.Until(deadline)))
+	}
+
+	md, _ := metadata.FromOutgoingContext(s.ctx)
+
+	for key, values := range md {
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				v = base64.RawStdEncoding.EncodeToString([]byte(v))
+			}
+
+			req.Header.Add(key, v)
+		}
+	}
+
+	resp, err := s.conn.client.Do(req)
+
+	if err != nil {
+		if ctxErr := s.ctx.Err(); ctxErr != nil {
+			s.respErr = status.FromContextError(ctxErr).Err()
+		} else {
+			s.respErr = status.Error(codes.Unavailable, err.Error())
+		}
+
+		return
+	}
+
+	s.header = grpcWebMetadata(resp.Header)
+
+	if encoding, ok := s.ctx.Value(grpcEncodingKey{}).(*grpcEncoding); ok {
+		encoding.set(resp.Header.Get("Grpc-Encoding"))
+	}
+
+	// trailers-only responses carry the status as headers
+	if resp.Header.Get("Grpc-Status") != "" {
+		resp.Body.Close()
+
+		s.trailer = s.header
+		s.header = metadata.MD{}
+
+		s.respErr = s.trailerStatus(s.trailer)
+		s.finish(s.respErr)
+
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+
+		s.respErr = status.Errorf(grpcCodeFromHTTPStatus(resp.StatusCode), "unexpected HTTP status %s", resp.Status)
+		s.finish(s.respErr)
+
+		return
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/grpc-web") {
+		resp.Body.Close()
+
+		s.respErr = status.Errorf(codes.Unknown, "unexpected content type %q (not a gRPC-Web endpoint?)", contentType)
+		s.finish(s.respErr)
+
+		return
+	}
+
+	s.resp = resp
+	s.reader = bufio.NewReader(resp.Body)
+}
+
+func (s *grpcWebStream) finish(err error) {
+	s.done = true
+	s.status = err
+
+	if s.resp != nil {
+		s.resp.Body.Close()
+	}
+}
+
+// readFrame reads one length-prefixed frame, decompressing its payload if
+// flagged.
+func (s *grpcWebStream) readFrame() (byte, []byte, error) {
+	var prefix [5]byte
+
+	if _, err := io.ReadFull(s.reader, prefix[:]); err != nil {
+		if ctxErr := s.ctx.Err(); ctxErr != nil {
+			return 0, nil, status.FromContextError(ctxErr).Err()
+		}
+
+		if err == io.EOF {
+			return 0, nil, status.Error(codes.Internal, "stream ended without trailers")
+		}
+
+		return 0, nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	flags := prefix[0]
+	length := binary.BigEndian.Uint32(prefix[1:])
+
+	if length > maxGRPCWebMessage {
+		return 0, nil, status.Errorf(codes.ResourceExhausted, "frame of %d bytes exceeds the limit", length)
+	}
+
+	data := make([]byte, length)
+
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		return 0, nil, status.Error(codes.Internal, "truncated frame")
+	}
+
+	if flags&0x01 != 0 {
+		if encoding := s.resp.Header.Get("Grpc-Encoding"); encoding != "gzip" {
+			return 0, nil, status.Errorf(codes.Internal, "unsupported compression %q", encoding)
+		}
+
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+
+		if err != nil {
+			return 0, nil, status.Errorf(codes.Internal, "invalid compressed frame: %v", err)
+		}
+
+		if data, err = io.ReadAll(io.LimitReader(zr, maxGRPCWebMessage)); err != nil {
+			return 0, nil, status.Errorf(codes.Internal, "invalid compressed frame: %v", err)
+		}
+	}
+
+	return flags, data, nil
+}
+
+// trailerStatus stores trailer and returns the status it carries.
+func (s *grpcWebStream) trailerStatus(trailer metadata.MD) error {
+	code := codes.Unknown
+	message := ""
+
+	if values := trailer.Get("grpc-status"); len(values) > 0 {
+		if n, err := strconv.Atoi(values[0]); err == nil {
+			code = codes.Code(n)
+		}
+	}
+
+	if values := trailer.Get("grpc-message"); len(values) > 0 {
+		message = values[0]
+
+		if decoded, err := url.PathUnescape(message); err == nil {
+			message = decoded
+		}
+	}
+
+	s.trailer = trailer.Copy()
+	delete(s.trailer, "grpc-status")
+	delete(s.trailer, "grpc-message")
+
+	if code == codes.OK {
+		return nil
+	}
+
+	if values := trailer.Get("grpc-status-details-bin"); len(values) > 0 {
+		st := &spb.Status{}
+
+		if err := proto.Unmarshal([]byte(values[0]), st); err == nil && codes.Code(st.GetCode()) == code {
+			return status.ErrorProto(st)
+		}
+	}
+
+	return status.Error(code, message)
+}
+
+// parseGRPCWebTrailer reads the "key: value\r\n" block of a trailer frame.
+func parseGRPCWebTrailer(data []byte) metadata.MD {
+	header := http.Header{}
+
+	for line := range strings.SplitSeq(string(data), "\r\n") {
+		key, value, ok := strings.Cut(line, ":")
+
+		if !ok {
+			continue
+		}
+
+		header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+
+	return grpcWebMetadata(header)
+}
+
+// grpcWebMetadata converts HTTP headers into metadata, decoding -bin values
+// and leaving out headers that only describe the HTTP exchange.
+func grpcWebMetadata(header http.Header) metadata.MD {
+	md := metadata.MD{}
+
+	for key, values := range header {
+		key = strings.ToLower(key)
+
+		switch key {
+		case "content-length", "transfer-encoding", "connection", "date":
+			continue
+		}
+
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				if decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(v, "=")); err == nil {
+					v = string(decoded)
+				}
+			}
+
+			md.Append(key, v)
+		}
+	}
+
+	return md
+}
+
+// encodeGRPCTimeout renders a grpc-timeout value (at most 8 digits).
+func encodeGRPCTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "1n"
+	}
+
+	if ms := (d + time.Millisecond - 1) / time.Millisecond; ms < 1e8 {
+		return fmt.Sprintf("%dm", ms)
+	}
+
+	return fmt.Sprintf("%dS", min((d+time.Second-1)/time.Second, 1e8-1))
+}
+
+// grpcCodeFromHTTPStatus maps the HTTP status of a response that carries no
+// gRPC status, as the gRPC HTTP/2 spec does.
+func grpcCodeFromHTTPStatus(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	}
+
+	return codes.Unknown
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// handleGRPCWebSocket handles GET /proxy/grpc/ws/{scheme}/{host}/{path...}
+// and bridges a WebSocket to a gRPC stream of any kind: JSON messages from
+// the browser become client sends, server messages are relayed back as
+// GRPCStreamFrames. This is the only way to drive client-streaming and
+// bidirectional methods from the UI.
+func (s *Server) handleGRPCWebSocket(w http.ResponseWriter, r *http.Request) {
+	scheme := r.PathValue("scheme")
+	host := r.PathValue("host")
+	path := r.PathValue("path")
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(parts) != 2 {
+		writeProxyError(w, http.StatusBadRequest, errors.New("invalid path format, expected 'service/method'"))
+		return
+	}
+
+	service := parts[0]
+	method := parts[1]
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	md, err := s.grpcOutgoingMetadata(r, opts)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	web := r.Header.Get("X-Prism-Grpc-Web") == "true"
+
+	// streams stay open until either side ends them
+	ctx, cancel, err := s.requestContext(w, r, 0)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	defer cancel()
+
+	server := websocket.Server{
+		Handshake: checkWebSocketOrigin,
+
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			bridge := &grpcBridge{server: s, ws: ws, web: web}
+			bridge.run(ctx, scheme, host, service, method, opts, md)
+		},
+	}
+
+	server.ServeHTTP(w, r)
+}
+
+// checkWebSocketOrigin admits non-browser clients (no Origin) and pages
+// served from this or another loopback origin. WebSockets are exempt from
+// CORS and CrossOriginProtection, so any website could otherwise open one.
+func checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+
+	if err != nil {
+		return err
+	}
+
+	config.Origin = origin
+
+	if origin == nil || origin.Host == r.Host {
+		return nil
+	}
+
+	if hostname := origin.Hostname(); hostname == "localhost" {
+		return nil
+	} else if ip := net.ParseIP(hostname); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return errors.New("cross-origin websocket rejected")
+}
+
+// grpcBridge relays between one WebSocket and one gRPC stream. Frames are
+// written by both the client reader (errors) and the server relay.
+type grpcBridge struct {
+	server *Server
+
+	// web selects gRPC-Web, which cannot carry client streams
+	web bool
+
+	ws *websocket.Conn
+
+	mu sync.Mutex
+}
+
+func (b *grpcBridge) send(frame GRPCStreamFrame) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return websocket.JSON.Send(b.ws, frame)
+}
+
+func (b *grpcBridge) sendStatus(ctx context.Context, err error, trailer metadata.MD) {
+	b.send(GRPCStreamFrame{Type: "status", Status: grpcStatus(ctx, err, trailer)})
+}
+
+func (b *grpcBridge) run(ctx context.Context, scheme, host, service, method string, opts upstreamOptions, md metadata.MD) {
+	// Browsers cannot set headers on a WebSocket, so metadata may come in
+	// an initial "start" frame instead.
+	var first GRPCStreamFrame
+
+	if err := websocket.JSON.Receive(b.ws, &first); err != nil {
+		return
+	}
+
+	var pending *GRPCStreamFrame
+
+	if first.Type == "start" {
+		for key, values := range first.Metadata {
+			key = strings.ToLower(key)
+
+			for _, v := range values {
+				if strings.HasSuffix(key, "-bin") {
+					if decoded, err := base64.StdEncoding.DecodeString(v); err == nil {
+						v = string(decoded)
+					}
+				}
+
+				md.Append(key, v)
+			}
+		}
+	} else {
+		pending = &first
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	conn, err := b.server.connectGRPC(ctx, scheme, host, opts, b.web)
+
+	if err != nil {
+		code := codes.Unavailable
+		if errors.Is(err, errTargetDenied) {
+			code = codes.PermissionDenied
+		}
+
+		b.sendStatus(ctx, status.Errorf(code, "failed to connect to %s: %v", host, err), nil)
+		return
+	}
+
+	defer conn.Close()
+
+	methodDesc, err := b.server.grpcMethod(ctx, conn, scheme, host, service, method)
+
+	if err != nil {
+		code := codes.NotFound
+		if errors.Is(err, errGRPCReflection) {
+			code = codes.Unavailable
+		}
+		b.sendStatus(ctx, status.Error(code, err.Error()), nil)
+		return
+	}
+
+	desc := &grpc.StreamDesc{
+		ClientStreams: methodDesc.IsStreamingClient(),
+		ServerStreams: methodDesc.IsStreamingServer(),
+	}
+
+	stream, err := conn.NewStream(ctx, desc, fmt.Sprintf("/%s/%s", service, method))
+
+	if err != nil {
+		b.sendStatus(ctx, err, nil)
+		return
+	}
+
+	go func() {
+		// a closed socket abandons the call
+		defer cancel()
+
+		closed := false
+
+		handle := func(frame GRPCStreamFrame) {
+			switch frame.Type {
+			case "message":
+				if closed {
+					b.send(GRPCStreamFrame{Type: "error", Error: "stream already ended"})
+					return
+				}
+
+				msg := dynamicpb.NewMessage(methodDesc.Input())
+
+				if err := protojson.Unmarshal(frame.Message, msg); err != nil {
+					b.send(GRPCStreamFrame{Type: "error", Error: fmt.Sprintf("failed to unmarshal JSON to proto: %v", err)})
+					return
+				}
+
+				// io.EOF means the server already ended the call; its
+				// status arrives through the receive side
+				if err := stream.SendMsg(msg); err != nil {
+					closed = true
+					return
+				}
+
+				// methods without client streaming take exactly one message
+				if !desc.ClientStreams {
+					closed = true
+					stream.CloseSend()
+				}
+
+			case "end":
+				if !closed {
+					closed = true
+					stream.CloseSend()
+				}
+
+			default:
+				b.send(GRPCStreamFrame{Type: "error", Error: fmt.Sprintf("unknown frame type %q", frame.Type)})
+			}
+		}
+
+		if pending != nil {
+			handle(*pending)
+		}
+
+		for {
+			var frame GRPCStreamFrame
+
+			if err := websocket.JSON.Receive(b.ws, &frame); err != nil {
+				return
+			}
+
+			handle(frame)
+		}
+	}()
+
+	// blocks until the server sent its headers (or failed)
+	if header, err := stream.Header(); err == nil {
+		b.send(GRPCStreamFrame{Type: "header", Metadata: grpcMetadataMap(header)})
+	}
+
+	var streamErr error
+
+	for {
+		respMsg := dynamicpb.NewMessage(methodDesc.Output())
+
+		if err := stream.RecvMsg(respMsg); err != nil {
+			if err != io.EOF {
+				streamErr = err
+			}
+			break
+		}
+
+		raw, err := protojson.Marshal(respMsg)
+
+		if err != nil {
+			streamErr = status.Error(codes.Internal, fmt.Sprintf("failed to marshal proto to JSON: %v", err))
+			break
+		}
+
+		if err := b.send(GRPCStreamFrame{Type: "message", Message: raw}); err != nil {
+			return
+		}
+	}
+
+	b.sendStatus(ctx, streamErr, stream.Trailer())
+}
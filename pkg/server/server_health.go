@@ -0,0 +1,31 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// handleHealthz handles GET /healthz, the liveness probe: the process
+// serves requests.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz handles GET /readyz, the readiness probe: the server runs
+// and the data directory, such as a mounted volume, is available.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	if info, err := os.Stat(getDataDir(r.Context())); err != nil || !info.IsDir() {
+		http.Error(w, fmt.Sprintf("data directory unavailable: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
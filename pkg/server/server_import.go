@@ -0,0 +1,369 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+)
+
+// handleImportCurl handles POST /import/curl. The parsed Request is returned
+// and, when a store is given, saved into it as well.
+func (s *Server) handleImportCurl(w http.ResponseWriter, r *http.Request) {
+	var req CurlImport
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Store != "" && !validName(req.Store) {
+		http.Error(w, "invalid store name", http.StatusBadRequest)
+		return
+	}
+
+	result, err := parseCurl(req.Command)
+
+	if err != nil {
+		http.Error(w, "curl: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Name != "" {
+		result.Name = req.Name
+	}
+
+	status := http.StatusOK
+
+	if req.Store != "" {
+		if err := saveEntry(r.Context(), req.Store, result.ID, result); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.publishDataChange(r.Context(), req.Store, result.ID, "saved")
+
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleImportOpenAPI handles POST /import/openapi. It returns the document's
+// operations grouped by tag and, when asked to, materializes them as
+// requests (saved into a store if one is given).
+func (s *Server) handleImportOpenAPI(w http.ResponseWriter, r *http.Request) {
+	var req OpenAPIImport
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxOpenAPISize+(1<<20))).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Store != "" && !validName(req.Store) {
+		http.Error(w, "invalid store name", http.StatusBadRequest)
+		return
+	}
+
+	data, documentURL, err := s.openapiSource(r, &req.OpenAPISource)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	doc, _, err := parseOpenAPI(data)
+
+	if err != nil {
+		http.Error(w, "openapi: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	operations, err := openapiOperations(doc)
+
+	if err != nil {
+		http.Error(w, "openapi: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := OpenAPIImportResult{
+		Title:       doc.Info.Title,
+		Version:     doc.Info.Version,
+		Description: doc.Info.Description,
+
+		Servers: []string{},
+		Tags:    openapiTags(doc, operations),
+	}
+
+	for _, server := range doc.Servers {
+		result.Servers = append(result.Servers, resolveServerURL(documentURL, openapiServerURL(server)))
+	}
+
+	if req.Materialize || req.Store != "" {
+		for i := range operations {
+			op := &operations[i]
+
+			if len(req.Operations) > 0 && !slices.Contains(req.Operations, op.ID) {
+				continue
+			}
+
+			baseURL := req.BaseURL
+
+			if baseURL == "" && len(op.Servers) > 0 {
+				baseURL = resolveServerURL(documentURL, op.Servers[0])
+			}
+
+			if baseURL == "" && len(result.Servers) > 0 {
+				baseURL = result.Servers[0]
+			}
+
+			request := openapiRequest(op, baseURL, doc.Components.SecuritySchemes)
+			request.CreationTime = time.Now().UnixMilli()
+
+			if req.Store != "" {
+				if err := saveEntry(r.Context(), req.Store, request.ID, request); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				s.publishDataChange(r.Context(), req.Store, request.ID, "saved")
+			}
+
+			result.Requests = append(result.Requests, *request)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleImportInsomnia handles POST /import/insomnia. It converts an
+// Insomnia v4 export and, when a store is given, saves the requests into it
+// with request groups as folders.
+func (s *Server) handleImportInsomnia(w http.ResponseWriter, r *http.Request) {
+	var req InsomniaImport
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxOpenAPISize+(1<<20))).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Store != "" && !validName(req.Store) {
+		http.Error(w, "invalid store name", http.StatusBadRequest)
+		return
+	}
+
+	data, _, err := s.openapiSource(r, &req.OpenAPISource)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	imp, err := parseInsomnia(data, req.Environment)
+
+	if err != nil {
+		http.Error(w, "insomnia: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := InsomniaImportResult{
+		Items: imp.Items,
+
+		Requests: []Request{},
+		Folders:  imp.Folders,
+	}
+
+	for _, request := range imp.Requests {
+		result.Requests = append(result.Requests, *request)
+	}
+
+	status := http.StatusOK
+
+	if req.Store != "" {
+		for _, request := range imp.Requests {
+			if err := saveEntry(r.Context(), req.Store, request.ID, request); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			s.publishDataChange(r.Context(), req.Store, request.ID, "saved")
+		}
+
+		err := s.updateFolderIndex(r.Context(), req.Store, func(index *folderIndex) error {
+			index.Folders = append(index.Folders, imp.Folders...)
+			maps.Copy(index.Entries, imp.Entries)
+			return nil
+		})
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleImportHAR handles POST /import/har. It converts the requests of a
+// HAR file and, when a store is given, saves them into it, in a folder per
+// host if grouped by host.
+func (s *Server) handleImportHAR(w http.ResponseWriter, r *http.Request) {
+	var req HARImport
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxOpenAPISize+(1<<20))).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Store != "" && !validName(req.Store) {
+		http.Error(w, "invalid store name", http.StatusBadRequest)
+		return
+	}
+
+	data, _, err := s.openapiSource(r, &req.OpenAPISource)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requests, skipped, err := parseHAR(data)
+
+	if err != nil {
+		http.Error(w, "har: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := HARImportResult{
+		Requests: []Request{},
+		Skipped:  skipped,
+	}
+
+	// folder ID keyed by request ID
+	entries := map[string]string{}
+
+	if req.GroupByHost {
+		folders := map[string]string{}
+
+		for _, request := range requests {
+			u, _ := url.Parse(request.HTTP.URL)
+
+			folder, ok := folders[u.Host]
+
+			if !ok {
+				folder = newRequestID()
+				folders[u.Host] = folder
+
+				result.Folders = append(result.Folders, DataFolder{ID: folder, Name: u.Host})
+			}
+
+			entries[request.ID] = folder
+		}
+	}
+
+	for _, request := range requests {
+		result.Requests = append(result.Requests, *request)
+	}
+
+	status := http.StatusOK
+
+	if req.Store != "" {
+		for _, request := range requests {
+			if err := saveEntry(r.Context(), req.Store, request.ID, request); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			s.publishDataChange(r.Context(), req.Store, request.ID, "saved")
+		}
+
+		if len(result.Folders) > 0 {
+			err := s.updateFolderIndex(r.Context(), req.Store, func(index *folderIndex) error {
+				index.Folders = append(index.Folders, result.Folders...)
+				maps.Copy(index.Entries, entries)
+				return nil
+			})
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// openapiSource loads a document and returns the URL it was fetched from
+// (for resolving relative server URLs).
+func (s *Server) openapiSource(r *http.Request, req *OpenAPISource) ([]byte, string, error) {
+	switch {
+	case req.Document != "":
+		return []byte(req.Document), "", nil
+
+	case req.Upload != "":
+		entry, err := s.lookupUpload(req.Upload)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if entry.Upload.Size > maxOpenAPISize {
+			return nil, "", errors.New("document too large")
+		}
+
+		data, err := os.ReadFile(entry.Path)
+		return data, "", err
+
+	case req.URL != "":
+		opts, err := s.upstreamOptionsFromRequest(r)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		client := s.targetClient(opts, 30*time.Second)
+
+		data, err := fetchOpenAPI(client, req.URL)
+		return data, req.URL, err
+	}
+
+	return nil, "", errors.New("one of document, url or upload is required")
+}
+
+// resolveServerURL resolves a relative server URL ("/v1") against the URL
+// the document was loaded from.
+func resolveServerURL(documentURL, serverURL string) string {
+	if documentURL == "" {
+		return serverURL
+	}
+
+	base, err := url.Parse(documentURL)
+
+	if err != nil {
+		return serverURL
+	}
+
+	ref, err := url.Parse(serverURL)
+
+	if err != nil {
+		return serverURL
+	}
+
+	return base.ResolveReference(ref).String()
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonrpcEnvelope is a JSON-RPC 2.0 request object; notifications omit ID.
+type jsonrpcEnvelope struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// jsonrpcReply is a JSON-RPC 2.0 response object.
+type jsonrpcReply struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *JsonRpcError   `json:"error"`
+}
+
+// handleJsonRpc handles POST /proxy/jsonrpc/{scheme}/{host}/{path...}. It
+// wraps the calls of a JsonRpcRequest into 2.0 envelopes (batched when asked
+// for or when there are several), assigns IDs and matches the replies back
+// to their calls. X-Prism-Header-* are sent as request headers.
+func (s *Server) handleJsonRpc(w http.ResponseWriter, r *http.Request) {
+	target := &url.URL{
+		Scheme:   r.PathValue("scheme"),
+		Host:     r.PathValue("host"),
+		Path:     "/" + r.PathValue("path"),
+		RawQuery: r.URL.RawQuery,
+	}
+
+	if target.Scheme != "http" && target.Scheme != "https" {
+		writeProxyError(w, http.StatusBadRequest, errors.New("unsupported scheme"))
+		return
+	}
+
+	var req JsonRpcRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	if len(req.Calls) == 0 {
+		writeProxyError(w, http.StatusBadRequest, errors.New("no calls"))
+		return
+	}
+
+	envelopes := make([]jsonrpcEnvelope, len(req.Calls))
+
+	for i, call := range req.Calls {
+		if call.Method == "" {
+			writeProxyError(w, http.StatusBadRequest, fmt.Errorf("call %d: missing method", i))
+			return
+		}
+
+		if len(call.Params) > 0 {
+			// params must be structured (by-position or by-name)
+			switch bytes.TrimSpace(call.Params)[0] {
+			case '[', '{':
+			default:
+				writeProxyError(w, http.StatusBadRequest, fmt.Errorf("call %d: params must be an array or object", i))
+				return
+			}
+		}
+
+		envelopes[i] = jsonrpcEnvelope{
+			JSONRPC: "2.0",
+			Method:  call.Method,
+			Params:  call.Params,
+		}
+
+		if !call.Notification {
+			id := s.jsonrpcID.Add(1)
+			envelopes[i].ID = &id
+		}
+	}
+
+	batch := req.Batch || len(envelopes) > 1
+
+	var payload any = envelopes[0]
+
+	if batch {
+		payload = envelopes
+	}
+
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		writeProxyError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	authorization, err := s.oauth2Header(r, opts)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, fmt.Errorf("oauth2: %w", err))
+		return
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, 0)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	defer cancel()
+
+	upstreamReq, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(body))
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for key, values := range r.Header {
+		name, ok := strings.CutPrefix(key, "X-Prism-Header-")
+
+		if !ok || name == "" {
+			continue
+		}
+
+		for _, v := range values {
+			upstreamReq.Header.Add(name, v)
+		}
+	}
+
+	upstreamReq.Header.Set("Content-Type", "application/json")
+	upstreamReq.Header.Set("Accept", "application/json")
+
+	if authorization != "" {
+		upstreamReq.Header.Set("Authorization", authorization)
+	}
+
+	client := &http.Client{Transport: s.proxyTransport(opts)}
+
+	start := time.Now()
+
+	resp, err := client.Do(upstreamReq)
+
+	if err != nil {
+		if requestCanceled(ctx) {
+			writeProxyError(w, statusClientClosedRequest, errRequestCanceled)
+			return
+		}
+
+		writeProxyError(w, upstreamStatus(err), fmt.Errorf("proxy error: %w", err))
+		return
+	}
+
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+
+	if limit := s.config.Load().MaxResponseSize; limit > 0 {
+		reader = io.LimitReader(resp.Body, limit)
+	}
+
+	data, err := io.ReadAll(reader)
+
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, fmt.Errorf("proxy error: %w", err))
+		return
+	}
+
+	result := JsonRpcResponse{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+
+		Request: body,
+
+		Results: []JsonRpcResult{},
+
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+
+	replies, err := parseJsonRpcReplies(data)
+
+	if err != nil {
+		// not JSON-RPC (e.g. an HTML error page): hand back the raw body
+		result.Error = err.Error()
+		result.Body = string(data)
+	}
+
+	matched := make(map[string]bool)
+
+	for i, envelope := range envelopes {
+		if envelope.ID == nil {
+			continue
+		}
+
+		id := strconv.FormatInt(*envelope.ID, 10)
+
+		entry := JsonRpcResult{
+			ID:     json.RawMessage(id),
+			Method: req.Calls[i].Method,
+		}
+
+		for _, reply := range replies {
+			if string(bytes.TrimSpace(reply.ID)) == id {
+				entry.Result = reply.Result
+				entry.Error = reply.Error
+				matched[id] = true
+				break
+			}
+		}
+
+		result.Results = append(result.Results, entry)
+	}
+
+	// replies without a matching call (e.g. parse errors with a null id)
+	for _, reply := range replies {
+		if matched[string(bytes.TrimSpace(reply.ID))] {
+			continue
+		}
+
+		result.Results = append(result.Results, JsonRpcResult{
+			ID:     reply.ID,
+			Result: reply.Result,
+			Error:  reply.Error,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// parseJsonRpcReplies accepts a single response object, a batch array, or an
+// empty body (all calls were notifications).
+func parseJsonRpcReplies(data []byte) ([]jsonrpcReply, error) {
+	data = bytes.TrimSpace(data)
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if data[0] == '[' {
+		var replies []jsonrpcReply
+
+		if err := json.Unmarshal(data, &replies); err != nil {
+			return nil, fmt.Errorf("invalid JSON-RPC batch response: %w", err)
+		}
+
+		return replies, nil
+	}
+
+	var reply jsonrpcReply
+
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("invalid JSON-RPC response: %w", err)
+	}
+
+	if reply.Result == nil && reply.Error == nil {
+		return nil, errors.New("invalid JSON-RPC response: neither result nor error")
+	}
+
+	return []jsonrpcReply{reply}, nil
+}
@@ -0,0 +1,473 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// jwksTTL is how long a key set is cached without a max-age.
+	jwksTTL = 10 * time.Minute
+
+	// jwksRefreshInterval limits refetches triggered by unknown key IDs.
+	jwksRefreshInterval = 30 * time.Second
+
+	maxJWKSSize = 1 << 20
+)
+
+type jwksEntry struct {
+	keys []jwk
+
+	fetched time.Time
+	expires time.Time
+}
+
+// handleJWTDecode handles POST /tools/jwt/decode. The signature is not
+// checked.
+func (s *Server) handleJWTDecode(w http.ResponseWriter, r *http.Request) {
+	var req JWTDecode
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := parseJWT(req.Token)
+
+	if err != nil {
+		http.Error(w, "invalid token: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := decodedJWT(token, time.Now(), 0)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleJWTVerify handles POST /tools/jwt/verify. A bad signature or an
+// expired token is a result with Valid unset, not an error.
+func (s *Server) handleJWTVerify(w http.ResponseWriter, r *http.Request) {
+	var req JWTVerify
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := parseJWT(req.Token)
+
+	if err != nil {
+		http.Error(w, "invalid token: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keys, err := s.jwtVerificationKeys(r, &req, token)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+
+	result := JWTVerifyResult{
+		JWT: decodedJWT(token, now, req.Leeway),
+	}
+
+	switch alg := token.algorithm(); {
+	case alg == "" || strings.EqualFold(alg, "none"):
+		result.Error = "unsigned token"
+
+	case len(keys) == 0:
+		result.Error = "no key matches the token"
+
+		if kid := token.keyID(); kid != "" {
+			result.Error = fmt.Sprintf("no key matches kid %q", kid)
+		}
+
+	default:
+		for _, key := range keys {
+			if err = verifyJWS(alg, token.signingInput, token.signature, key); err == nil {
+				break
+			}
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}
+
+	if result.Error == "" {
+		leeway := time.Duration(req.Leeway) * time.Second
+
+		switch {
+		case result.Expired:
+			result.Error = "token expired at " + result.ExpiresAt.Format(time.RFC3339)
+
+		case result.NotBefore != nil && now.Add(leeway).Before(*result.NotBefore):
+			result.Error = "token not valid before " + result.NotBefore.Format(time.RFC3339)
+		}
+	}
+
+	result.Valid = result.Error == ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleJWTSign handles POST /tools/jwt/sign.
+func (s *Server) handleJWTSign(w http.ResponseWriter, r *http.Request) {
+	var req JWTSign
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	alg := req.Algorithm
+
+	if alg == "" {
+		alg = "HS256"
+	}
+
+	if _, err := jwtHash(alg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var key any
+
+	if strings.HasPrefix(alg, "HS") {
+		secret, err := jwtSecret(req.Secret, req.SecretBase64)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(secret) == 0 {
+			http.Error(w, "secret is required for "+alg, http.StatusBadRequest)
+			return
+		}
+
+		key = secret
+	} else {
+		if req.Key == "" {
+			http.Error(w, "key is required for "+alg, http.StatusBadRequest)
+			return
+		}
+
+		privateKey, err := parsePEMKey(req.Key, true)
+
+		if err != nil {
+			http.Error(w, "invalid key: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		key = privateKey
+	}
+
+	claims := map[string]any{}
+
+	if len(req.Claims) > 0 {
+		if err := json.Unmarshal(req.Claims, &claims); err != nil {
+			http.Error(w, "claims must be a JSON object", http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now().Unix()
+
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = now
+	}
+
+	if req.ExpiresIn > 0 {
+		claims["exp"] = now + req.ExpiresIn
+	}
+
+	header := map[string]any{}
+
+	for k, v := range req.Header {
+		header[k] = v
+	}
+
+	header["alg"] = alg
+
+	if _, ok := header["typ"]; !ok {
+		header["typ"] = "JWT"
+	}
+
+	if req.KeyID != "" {
+		header["kid"] = req.KeyID
+	}
+
+	rawHeader, err := json.Marshal(header)
+
+	if err != nil {
+		http.Error(w, "invalid header: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rawClaims, err := json.Marshal(claims)
+
+	if err != nil {
+		http.Error(w, "invalid claims: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(rawHeader) + "." + base64.RawURLEncoding.EncodeToString(rawClaims)
+
+	signature, err := signJWS(alg, input, key)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	encoded := input + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	token, err := parseJWT(encoded)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := decodedJWT(token, time.Now(), 0)
+	result.Token = encoded
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// decodedJWT describes a parsed token; leeway (seconds) applies to Expired.
+func decodedJWT(token *jwtToken, now time.Time, leeway int64) JWT {
+	result := JWT{
+		Header:    token.rawHeader,
+		Claims:    token.rawClaims,
+		Signature: base64.RawURLEncoding.EncodeToString(token.signature),
+
+		Algorithm: token.algorithm(),
+		KeyID:     token.keyID(),
+	}
+
+	var claims map[string]any
+	json.Unmarshal(token.rawClaims, &claims)
+
+	result.IssuedAt = claimTime(claims, "iat")
+	result.NotBefore = claimTime(claims, "nbf")
+	result.ExpiresAt = claimTime(claims, "exp")
+
+	if result.ExpiresAt != nil {
+		result.Expired = !now.Add(-time.Duration(leeway) * time.Second).Before(*result.ExpiresAt)
+	}
+
+	return result
+}
+
+// claimTime reads a NumericDate claim (seconds since the epoch).
+func claimTime(claims map[string]any, name string) *time.Time {
+	value, ok := claims[name].(float64)
+
+	if !ok {
+		return nil
+	}
+
+	sec, frac := math.Modf(value)
+	t := time.Unix(int64(sec), int64(frac*1e9)).UTC()
+
+	return &t
+}
+
+// jwtSecret returns a shared secret as bytes, decoding base64 (standard or
+// URL alphabet, padded or not) when asked to.
+func jwtSecret(secret string, encoded bool) ([]byte, error) {
+	if !encoded {
+		return []byte(secret), nil
+	}
+
+	secret = strings.TrimRight(strings.TrimSpace(secret), "=")
+
+	if data, err := base64.RawStdEncoding.DecodeString(secret); err == nil {
+		return data, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(secret)
+
+	if err != nil {
+		return nil, errors.New("secret is not valid base64")
+	}
+
+	return data, nil
+}
+
+// jwtVerificationKeys collects the keys that may have signed token.
+func (s *Server) jwtVerificationKeys(r *http.Request, req *JWTVerify, token *jwtToken) ([]any, error) {
+	alg := token.algorithm()
+	kid := token.keyID()
+
+	var keys []any
+
+	if req.Secret != "" {
+		secret, err := jwtSecret(req.Secret, req.SecretBase64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, secret)
+	}
+
+	if key := strings.TrimSpace(req.Key); key != "" {
+		if strings.HasPrefix(key, "{") {
+			set, err := parseJWKs([]byte(key))
+
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, matchingJWKs(set, alg, kid)...)
+		} else {
+			publicKey, err := parsePEMKey(key, false)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid key: %w", err)
+			}
+
+			keys = append(keys, publicKey)
+		}
+	}
+
+	if req.JWKSURL != "" {
+		set, err := s.fetchJWKS(r, req.JWKSURL, kid)
+
+		if err != nil {
+			return nil, fmt.Errorf("jwks: %w", err)
+		}
+
+		keys = append(keys, matchingJWKs(set, alg, kid)...)
+	}
+
+	if req.Secret == "" && req.Key == "" && req.JWKSURL == "" {
+		return nil, errors.New("one of secret, key or jwksUrl is required")
+	}
+
+	return keys, nil
+}
+
+// matchingJWKs converts the keys usable for alg and kid; keys that fail to
+// convert are skipped.
+func matchingJWKs(set []jwk, alg, kid string) []any {
+	var keys []any
+
+	for i := range set {
+		if !jwkMatches(&set[i], alg, kid) {
+			continue
+		}
+
+		if key, err := set[i].publicKey(); err == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// fetchJWKS returns the cached key set of a URL, refetching it once it
+// expires or when it lacks kid (key rotation), at most every
+// jwksRefreshInterval.
+func (s *Server) fetchJWKS(r *http.Request, jwksURL, kid string) ([]jwk, error) {
+	now := time.Now()
+
+	if value, ok := s.jwks.Load(jwksURL); ok {
+		entry := value.(*jwksEntry)
+
+		known := kid == ""
+
+		for _, key := range entry.keys {
+			if key.Kid == kid {
+				known = true
+			}
+		}
+
+		if now.Before(entry.expires) && (known || now.Sub(entry.fetched) < jwksRefreshInterval) {
+			return entry.keys, nil
+		}
+	}
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := s.targetClient(opts, 30*time.Second)
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, jwksURL, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := parseJWKs(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.jwks.Store(jwksURL, &jwksEntry{
+		keys: keys,
+
+		fetched: now,
+		expires: now.Add(cacheMaxAge(resp.Header.Get("Cache-Control"), jwksTTL)),
+	})
+
+	return keys, nil
+}
+
+// cacheMaxAge reads max-age from a Cache-Control header, capped at a day.
+func cacheMaxAge(header string, fallback time.Duration) time.Duration {
+	for directive := range strings.SplitSeq(header, ",") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(strings.ToLower(directive)), "max-age=")
+
+		if !ok {
+			continue
+		}
+
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, 24*time.Hour)
+		}
+	}
+
+	return fallback
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// handleKeychainStatus handles GET /keychain.
+func (s *Server) handleKeychainStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(KeychainStatus{Available: s.userKeychain().available()})
+}
+
+// handleKeychainPut handles PUT /keychain/{name}, storing the value in the
+// OS credential store only.
+// Request body: SecretValue
+func (s *Server) handleKeychainPut(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if !validName(name) {
+		http.Error(w, "invalid secret name", http.StatusBadRequest)
+		return
+	}
+
+	var req SecretValue
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := checkKeychainValue(req.Value); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.userKeychain().set(name, req.Value); err != nil {
+		http.Error(w, err.Error(), secretStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SecretInfo{Name: name, Updated: time.Now().UTC()})
+}
+
+// handleKeychainDelete handles DELETE /keychain/{name}.
+func (s *Server) handleKeychainDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if !validName(name) {
+		http.Error(w, "invalid secret name", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.userKeychain().delete(name); err != nil {
+		if errors.Is(err, errSecretNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), secretStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxLoadConcurrency bounds the virtual users of a load test.
+	maxLoadConcurrency = 1000
+
+	// maxLoadDuration bounds the duration of a load test.
+	maxLoadDuration = time.Hour
+
+	// loadDuration is the default duration of a load test.
+	loadDuration = 10 * time.Second
+
+	// loadInterval is the default interval of progress events.
+	loadInterval = time.Second
+)
+
+// loadTest is a validated load test.
+type loadTest struct {
+	run     *RunRequest
+	entries []runEntry
+	env     *Environment
+
+	// variables of env and the workspace
+	variables map[string]string
+
+	concurrency int
+	rate        float64
+	duration    time.Duration
+	maxRequests int64
+
+	// passed on as X-Prism-Timeout of every request
+	timeout string
+}
+
+// parseLoadDuration parses an optional duration option.
+func parseLoadDuration(name, value string, fallback, minimum, maximum time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+
+	if err != nil || d < minimum || d > maximum {
+		return 0, fmt.Errorf("invalid %s %q: expected a duration between %s and %s", name, value, minimum, maximum)
+	}
+
+	return d, nil
+}
+
+// executeLoadTest fires the requests until the duration elapsed or the
+// maximum was sent, recording their outcomes in stats. Requests in flight
+// at the end are completed; cancelling ctx aborts them unrecorded.
+func (s *Server) executeLoadTest(ctx context.Context, test *loadTest, stats *loadStats) {
+	start := time.Now()
+	deadline := start.Add(test.duration)
+
+	stats.begin(start)
+
+	var gap time.Duration
+
+	if test.rate > 0 {
+		gap = time.Duration(float64(time.Second) / test.rate)
+	}
+
+	var sent atomic.Int64
+
+	// acquire reserves the next request, waiting for its turn under the
+	// rate; false once the test is over
+	acquire := func() bool {
+		n := sent.Add(1)
+
+		if test.maxRequests > 0 && n > test.maxRequests {
+			return false
+		}
+
+		if gap > 0 {
+			at := start.Add(time.Duration(n-1) * gap)
+
+			if !at.Before(deadline) {
+				return false
+			}
+
+			timer := time.NewTimer(time.Until(at))
+			defer timer.Stop()
+
+			select {
+			case <-ctx.Done():
+				return false
+			case <-timer.C:
+			}
+		}
+
+		return ctx.Err() == nil && time.Now().Before(deadline)
+	}
+
+	var wg sync.WaitGroup
+
+	for range test.concurrency {
+		wg.Go(func() {
+			// every virtual user chains its own extracted values
+			extracted := map[string]string{}
+
+			for {
+				for i, entry := range test.entries {
+					if !acquire() {
+						return
+					}
+
+					variables := maps.Clone(test.variables)
+					maps.Copy(variables, extracted)
+
+					result := s.runRequest(ctx, test.run, entry, variables, extracted, test.timeout)
+
+					if ctx.Err() != nil {
+						return
+					}
+
+					stats.record(i, &result)
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+}
+
+// writeServerEvent writes v as a Server-Sent Event.
+func writeServerEvent(w http.ResponseWriter, name string, v any) error {
+	data, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
+
+// handleLoadTest handles POST /run/load. With Accept: text/event-stream
+// the statistics are streamed as "progress" events (LoadTestStats) every
+// interval, ending with a "report" event (LoadTestReport); otherwise the
+// report is the response once the test is over.
+// Request body: LoadTestRequest
+func (s *Server) handleLoadTest(w http.ResponseWriter, r *http.Request) {
+	var req LoadTestRequest
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	test, interval, err := s.loadTestFromRequest(r, &req)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, 0)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer cancel()
+
+	stats := newLoadStats(test.entries)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		s.executeLoadTest(ctx, test, stats)
+	}()
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		<-done
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats.report(time.Now()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			writeServerEvent(w, "progress", stats.snapshot(now))
+			rc.Flush()
+
+		case <-done:
+			writeServerEvent(w, "report", stats.report(time.Now()))
+			rc.Flush()
+			return
+		}
+	}
+}
+
+// loadTestFromRequest validates a load test and loads its requests; it
+// also returns the interval of progress events.
+func (s *Server) loadTestFromRequest(r *http.Request, req *LoadTestRequest) (*loadTest, time.Duration, error) {
+	test := &loadTest{
+		run: &RunRequest{
+			Environment: req.Environment,
+			Assertions:  req.Assertions,
+		},
+
+		concurrency: max(req.Concurrency, 1),
+		rate:        req.Rate,
+		maxRequests: int64(req.MaxRequests),
+
+		timeout: r.Header.Get("X-Prism-Timeout"),
+	}
+
+	if test.concurrency > maxLoadConcurrency {
+		return nil, 0, fmt.Errorf("at most %d concurrent users are allowed", maxLoadConcurrency)
+	}
+
+	if req.Rate < 0 || req.MaxRequests < 0 {
+		return nil, 0, errors.New("rate and maxRequests must not be negative")
+	}
+
+	var err error
+
+	if test.duration, err = parseLoadDuration("duration", req.Duration, loadDuration, time.Second, maxLoadDuration); err != nil {
+		return nil, 0, err
+	}
+
+	interval, err := parseLoadDuration("interval", req.Interval, loadInterval, 100*time.Millisecond, time.Minute)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch {
+	case req.Request != nil:
+		test.entries = []runEntry{{request: &Request{HTTP: req.Request}}}
+
+	case len(req.IDs) > 0:
+		store := req.Store
+
+		if store == "" {
+			store = runStore
+		}
+
+		if !validName(store) {
+			return nil, 0, errors.New("invalid store")
+		}
+
+		if test.entries, err = s.runEntries(r.Context(), store, &RunRequest{IDs: req.IDs}); err != nil {
+			return nil, 0, err
+		}
+
+	default:
+		return nil, 0, errors.New("request or ids is required")
+	}
+
+	if req.Environment != "" {
+		test.env, err = loadEnvironment(r.Context(), req.Environment)
+	} else {
+		test.env, err = requestEnvironment(r)
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if test.variables, err = workspaceVariables(r.Context(), test.env); err != nil {
+		return nil, 0, err
+	}
+
+	return test, interval, nil
+}
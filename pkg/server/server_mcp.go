@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync/atomic"
 
@@ -17,12 +18,15 @@ import (
 // headerTransport wraps an http.RoundTripper to add custom headers
 type headerTransport struct {
 	base    http.RoundTripper
-	headers map[string]string
+	headers Headers
 }
 
 func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	for k, v := range t.headers {
-		req.Header.Set(k, v)
+	for k, values := range t.headers {
+		req.Header.Del(k)
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
 	}
 	return t.base.RoundTrip(req)
 }
@@ -64,18 +68,30 @@ func mcpErrorText(prefix string, err error) string {
 
 // connectMcp creates a new MCP client and connects to the server, preferring
 // the transport that worked last time for this URL (Streamable HTTP first by
-// default, legacy SSE as fallback). The caller must close the session.
-func (s *Server) connectMcp(ctx context.Context, serverURL string, headers map[string]string) (*mcp.ClientSession, error) {
+// default, legacy SSE as fallback). Server notifications are published to
+// events, if given; the headers of a configured server are added to
+// headers. The caller must close the session.
+func (s *Server) connectMcp(ctx context.Context, serverURL string, headers Headers, opts upstreamOptions, events *mcpEventHub) (*mcp.ClientSession, error) {
+	headers = s.configuredMcpHeaders(serverURL, headers)
+
 	serverURL, preferSSE := normalizeMcpURL(serverURL)
 
+	if u, err := url.Parse(serverURL); err == nil {
+		if err := s.checkTarget(ctx, u.Scheme, u.Host, opts); err != nil {
+			return nil, err
+		}
+	}
+
 	client := mcp.NewClient(&mcp.Implementation{
 		Name:    "prism",
 		Version: "1.0.0",
-	}, nil)
+	}, events.clientOptions())
 
-	transport := &statusTransport{base: http.DefaultTransport}
+	var base http.RoundTripper = &targetTransport{base: s.transport(opts), server: s, opts: opts}
+
+	transport := &statusTransport{base: base}
 	if len(headers) > 0 {
-		transport.base = &headerTransport{base: http.DefaultTransport, headers: headers}
+		transport.base = &headerTransport{base: base, headers: headers}
 	}
 	httpClient := &http.Client{Transport: transport}
 
@@ -93,6 +109,7 @@ func (s *Server) connectMcp(ctx context.Context, serverURL string, headers map[s
 	session, err := client.Connect(ctx, attempts[0].transport, nil)
 	if err == nil {
 		s.mcpTransports.Store(serverURL, attempts[0].kind)
+		events.enableLogging(ctx, session)
 		return session, nil
 	}
 	if ctx.Err() != nil {
@@ -117,18 +134,136 @@ func (s *Server) connectMcp(ctx context.Context, serverURL string, headers map[s
 	}
 
 	s.mcpTransports.Store(serverURL, attempts[1].kind)
+	events.enableLogging(ctx, session)
 	return session, nil
 }
 
+// mcpHeaders adds the authorization derived from a referenced OAuth2
+// credential (X-Prism-OAuth2) and the workspace default headers (smuggled
+// as X-Prism-Header-*) to the user-supplied connection headers.
+func (s *Server) mcpHeaders(r *http.Request, headers Headers, opts upstreamOptions) (Headers, error) {
+	if defaults := mcpDefaultHeaders(r); len(defaults) > 0 {
+		for k, v := range headers {
+			for name := range defaults {
+				if strings.EqualFold(name, k) {
+					delete(defaults, name)
+				}
+			}
+			defaults[k] = v
+		}
+		headers = defaults
+	}
+
+	authorization, err := s.oauth2Header(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: %w", err)
+	}
+	if authorization == "" {
+		return headers, nil
+	}
+
+	result := Headers{"Authorization": {authorization}}
+	for k, v := range headers {
+		if !strings.EqualFold(k, "Authorization") {
+			result[k] = v
+		}
+	}
+	return result, nil
+}
+
+// mcpDefaultHeaders returns the headers smuggled as X-Prism-Header-*,
+// which for MCP are only the workspace defaults.
+func mcpDefaultHeaders(r *http.Request) Headers {
+	headers := Headers{}
+	for key, values := range r.Header {
+		if name, ok := strings.CutPrefix(key, "X-Prism-Header-"); ok && name != "" {
+			headers[name] = values
+		}
+	}
+	return headers
+}
+
 // mcpTargetURL returns the target server URL from the ?server= query
-// parameter (the full URL including any path and query).
+// parameter (the full URL including any path and query). It is optional
+// when a persistent session is referenced (X-Prism-Mcp-Session).
 func mcpTargetURL(r *http.Request) (string, error) {
 	if server := r.URL.Query().Get("server"); server != "" {
 		return server, nil
 	}
+	if r.Header.Get("X-Prism-Mcp-Session") != "" {
+		return "", nil
+	}
 	return "", fmt.Errorf("missing server parameter")
 }
 
+// handleMcpInfo handles GET /proxy/mcp/{scheme}/{host}/info?server=...
+// It returns what the server reported when initializing: implementation,
+// negotiated protocol version, capabilities and instructions.
+// Request body: McpListFeaturesRequest (optional, for headers)
+func (s *Server) handleMcpInfo(w http.ResponseWriter, r *http.Request) {
+	serverURL, err := mcpTargetURL(r)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var req McpListFeaturesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, 0)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cancel()
+
+	headers, err := s.mcpHeaders(r, req.Headers, opts)
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	session, _, release, err := s.mcpSession(ctx, r, serverURL, headers, opts)
+	if err != nil {
+		writeProxyError(w, mcpSessionStatus(err), err)
+		return
+	}
+	defer release()
+
+	init := session.InitializeResult()
+
+	info := McpServerInfo{
+		ProtocolVersion: init.ProtocolVersion,
+		Instructions:    init.Instructions,
+		Capabilities:    init.Capabilities,
+
+		// sampling is a client capability, offered when an AI provider is set
+		Sampling: s.config.Load().AIProvider("") != nil,
+	}
+
+	if init.ServerInfo != nil {
+		info.Name = init.ServerInfo.Name
+		info.Title = init.ServerInfo.Title
+		info.Version = init.ServerInfo.Version
+	}
+
+	if info.Capabilities == nil {
+		info.Capabilities = &mcp.ServerCapabilities{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
 // handleMcpListFeatures handles POST /proxy/mcp/{scheme}/{host}/features?server=...
 // It connects to the MCP server, fetches tools and resources (best effort),
 // and returns them combined; listing failures are reported per section.
@@ -136,24 +271,41 @@ func mcpTargetURL(r *http.Request) (string, error) {
 func (s *Server) handleMcpListFeatures(w http.ResponseWriter, r *http.Request) {
 	serverURL, err := mcpTargetURL(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProxyError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	var req McpListFeaturesRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
-		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	ctx := r.Context()
+	ctx, cancel, err := s.requestContext(w, r, 0)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cancel()
 
-	session, err := s.connectMcp(ctx, serverURL, req.Headers)
+	headers, err := s.mcpHeaders(r, req.Headers, opts)
 	if err != nil {
-		http.Error(w, "failed to connect to MCP server: "+err.Error(), http.StatusBadGateway)
+		writeProxyError(w, http.StatusBadGateway, err)
 		return
 	}
-	defer session.Close()
+
+	session, _, release, err := s.mcpSession(ctx, r, serverURL, headers, opts)
+	if err != nil {
+		writeProxyError(w, mcpSessionStatus(err), err)
+		return
+	}
+	defer release()
 
 	// Listing is attempted regardless of advertised capabilities (lax servers
 	// omit them); errors are only surfaced for sections the server advertised.
@@ -212,36 +364,62 @@ func (s *Server) handleMcpListFeatures(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleMcpCallTool handles POST /proxy/mcp/{scheme}/{host}/tool/call?server=...
+// With Accept: text/event-stream the server's notifications are relayed
+// while the tool runs (see relayMcpToolCall).
 // Request body: McpCallToolRequest
 func (s *Server) handleMcpCallTool(w http.ResponseWriter, r *http.Request) {
 	serverURL, err := mcpTargetURL(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProxyError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	var req McpCallToolRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
 		return
 	}
 
-	ctx := r.Context()
+	opts, err := s.upstreamOptionsFromRequest(r)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
 
-	session, err := s.connectMcp(ctx, serverURL, req.Headers)
+	ctx, cancel, err := s.requestContext(w, r, 0)
 	if err != nil {
-		http.Error(w, "failed to connect to MCP server: "+err.Error(), http.StatusBadGateway)
+		writeProxyError(w, http.StatusBadRequest, err)
 		return
 	}
-	defer session.Close()
+	defer cancel()
 
-	// Call the tool and return as-is; encoder will base64 any binary content
-	result, err := session.CallTool(ctx, &mcp.CallToolParams{
+	headers, err := s.mcpHeaders(r, req.Headers, opts)
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	session, events, release, err := s.mcpSession(ctx, r, serverURL, headers, opts)
+	if err != nil {
+		writeProxyError(w, mcpSessionStatus(err), err)
+		return
+	}
+	defer release()
+
+	params := &mcp.CallToolParams{
 		Name:      req.Name,
 		Arguments: req.Arguments,
-	})
+	}
+
+	if acceptsEventStream(r) {
+		relayMcpToolCall(ctx, w, session, events, params)
+		return
+	}
+
+	// Call the tool and return as-is; encoder will base64 any binary content
+	result, err := session.CallTool(ctx, params)
 	if err != nil {
-		http.Error(w, mcpErrorText("tool call failed", err), http.StatusBadGateway)
+		writeProxyError(w, http.StatusBadGateway, &describedError{mcpErrorText("tool call failed", err), err})
 		return
 	}
 
@@ -254,34 +432,139 @@ func (s *Server) handleMcpCallTool(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleMcpReadResource(w http.ResponseWriter, r *http.Request) {
 	serverURL, err := mcpTargetURL(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProxyError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	var req McpReadResourceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
 		return
 	}
 
-	ctx := r.Context()
+	opts, err := s.upstreamOptionsFromRequest(r)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, 0)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cancel()
+
+	headers, err := s.mcpHeaders(r, req.Headers, opts)
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err)
+		return
+	}
 
-	session, err := s.connectMcp(ctx, serverURL, req.Headers)
+	session, _, release, err := s.mcpSession(ctx, r, serverURL, headers, opts)
 	if err != nil {
-		http.Error(w, "failed to connect to MCP server: "+err.Error(), http.StatusBadGateway)
+		writeProxyError(w, mcpSessionStatus(err), err)
 		return
 	}
-	defer session.Close()
+	defer release()
 
 	// Read the resource and return as-is; encoder will base64 blobs
 	result, err := session.ReadResource(ctx, &mcp.ReadResourceParams{
 		URI: req.URI,
 	})
 	if err != nil {
-		http.Error(w, mcpErrorText("resource read failed", err), http.StatusBadGateway)
+		writeProxyError(w, http.StatusBadGateway, &describedError{mcpErrorText("resource read failed", err), err})
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
+
+// handleMcpComplete handles POST /proxy/mcp/{scheme}/{host}/complete?server=...
+// It asks the server for completions of a prompt argument or a resource
+// template parameter.
+// Request body: McpCompleteRequest
+func (s *Server) handleMcpComplete(w http.ResponseWriter, r *http.Request) {
+	serverURL, err := mcpTargetURL(r)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var req McpCompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	var ref *mcp.CompleteReference
+	switch {
+	case req.Prompt != "" && req.URI != "":
+		writeProxyError(w, http.StatusBadRequest, errors.New("prompt and uri are mutually exclusive"))
+		return
+	case req.Prompt != "":
+		ref = &mcp.CompleteReference{Type: "ref/prompt", Name: req.Prompt}
+	case req.URI != "":
+		ref = &mcp.CompleteReference{Type: "ref/resource", URI: req.URI}
+	default:
+		writeProxyError(w, http.StatusBadRequest, errors.New("missing prompt or uri"))
+		return
+	}
+
+	if req.Argument == "" {
+		writeProxyError(w, http.StatusBadRequest, errors.New("missing argument"))
+		return
+	}
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, 0)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cancel()
+
+	headers, err := s.mcpHeaders(r, req.Headers, opts)
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	session, _, release, err := s.mcpSession(ctx, r, serverURL, headers, opts)
+	if err != nil {
+		writeProxyError(w, mcpSessionStatus(err), err)
+		return
+	}
+	defer release()
+
+	params := &mcp.CompleteParams{
+		Ref: ref,
+		Argument: mcp.CompleteParamsArgument{
+			Name:  req.Argument,
+			Value: req.Value,
+		},
+	}
+	if len(req.Arguments) > 0 {
+		params.Context = &mcp.CompleteContext{Arguments: req.Arguments}
+	}
+
+	result, err := session.Complete(ctx, params)
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, &describedError{mcpErrorText("completion failed", err), err})
+		return
+	}
+
+	completion := result.Completion
+	if completion.Values == nil {
+		completion.Values = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(completion)
+}
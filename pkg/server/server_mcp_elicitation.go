@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// mcpElicitationTimeout bounds how long an elicitation request waits for the
+// user's input; filling in a form takes longer than approving a sampling.
+const mcpElicitationTimeout = 10 * time.Minute
+
+// elicitMcpInput answers an elicitation/create request of an MCP server. The
+// request is published as an "elicitation" event and blocks until a browser
+// responds via POST /mcp/elicitation/{id}; with nobody listening it fails.
+func (s *Server) elicitMcpInput(ctx context.Context, events *mcpEventHub, params *mcp.ElicitParams) (*mcp.ElicitResult, error) {
+	if !events.listening() {
+		return nil, errors.New("elicitation requires user input, but no client is listening")
+	}
+
+	id := rand.Text()
+	response := make(chan *mcp.ElicitResult, 1)
+
+	s.mcpElicitations.Store(id, response)
+	defer s.mcpElicitations.Delete(id)
+
+	events.publish("elicitation", &McpElicitationRequest{
+		ID:     id,
+		Params: params,
+	})
+
+	timer := time.NewTimer(mcpElicitationTimeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-response:
+		return result, nil
+
+	case <-timer.C:
+		return &mcp.ElicitResult{Action: "cancel"}, nil
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// handleMcpElicitation handles POST /mcp/elicitation/{id}, answering a
+// pending elicitation request.
+// Request body: McpElicitationResponse
+func (s *Server) handleMcpElicitation(w http.ResponseWriter, r *http.Request) {
+	var req McpElicitationResponse
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Action {
+	case "accept":
+	case "decline", "cancel":
+		req.Content = nil
+	default:
+		http.Error(w, "action must be accept, decline or cancel", http.StatusBadRequest)
+		return
+	}
+
+	value, ok := s.mcpElicitations.LoadAndDelete(r.PathValue("id"))
+
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	value.(chan *mcp.ElicitResult) <- &mcp.ElicitResult{
+		Action:  req.Action,
+		Content: req.Content,
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
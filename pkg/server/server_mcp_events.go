@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// mcpEventHub fans the notifications of an MCP connection out to the
+// browsers listening for them. Slow listeners miss events rather than
+// stalling the connection.
+type mcpEventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan McpEvent]struct{}
+
+	// also receives every event, see forward
+	forwarder func(McpEvent)
+
+	// answers sampling/createMessage requests; nil without an AI provider
+	createMessage func(context.Context, *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)
+
+	// answers elicitation/create requests with the user's input
+	elicit func(context.Context, *mcp.ElicitRequest) (*mcp.ElicitResult, error)
+}
+
+func (s *Server) newMcpEventHub() *mcpEventHub {
+	h := &mcpEventHub{
+		subscribers: map[chan McpEvent]struct{}{},
+	}
+
+	h.elicit = func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+		return s.elicitMcpInput(ctx, h, req.Params)
+	}
+
+	if s.config.Load().AIProvider("") != nil {
+		h.createMessage = func(ctx context.Context, req *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+			return s.sampleMcpMessage(ctx, h, req.Params)
+		}
+	}
+
+	return h
+}
+
+// subscribe returns a channel receiving the events published from now on,
+// and the func ending the subscription.
+func (h *mcpEventHub) subscribe() (<-chan McpEvent, func()) {
+	ch := make(chan McpEvent, 64)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+	}
+}
+
+// listening reports whether any browser is subscribed.
+func (h *mcpEventHub) listening() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers) > 0
+}
+
+// forward passes every event published from now on to fn as well.
+func (h *mcpEventHub) forward(fn func(McpEvent)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.forwarder = fn
+}
+
+func (h *mcpEventHub) publish(eventType string, params any) {
+	event := McpEvent{
+		Type: eventType,
+	}
+
+	if params != nil {
+		event.Data, _ = json.Marshal(params)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+
+	if h.forwarder != nil {
+		h.forwarder(event)
+	}
+}
+
+// clientOptions registers the notification handlers publishing to h, the
+// elicitation handler, and the sampling handler when an AI provider is
+// configured; a nil hub registers none.
+func (h *mcpEventHub) clientOptions() *mcp.ClientOptions {
+	if h == nil {
+		return nil
+	}
+
+	return &mcp.ClientOptions{
+		LoggingMessageHandler: func(_ context.Context, req *mcp.LoggingMessageRequest) {
+			h.publish("log", req.Params)
+		},
+		ProgressNotificationHandler: func(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+			h.publish("progress", newMcpProgress(req.Params))
+		},
+		ToolListChangedHandler: func(_ context.Context, req *mcp.ToolListChangedRequest) {
+			h.publish("toolsChanged", nil)
+		},
+		ResourceListChangedHandler: func(_ context.Context, req *mcp.ResourceListChangedRequest) {
+			h.publish("resourcesChanged", nil)
+		},
+		PromptListChangedHandler: func(_ context.Context, req *mcp.PromptListChangedRequest) {
+			h.publish("promptsChanged", nil)
+		},
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			h.publish("resourceUpdated", req.Params)
+		},
+
+		// setting the handlers advertises the sampling and elicitation
+		// capabilities
+		CreateMessageHandler: h.createMessage,
+		ElicitationHandler:   h.elicit,
+	}
+}
+
+// enableLogging asks a server that supports logging to send all its log
+// messages; servers send none until a level is set.
+func (h *mcpEventHub) enableLogging(ctx context.Context, session *mcp.ClientSession) {
+	if h == nil {
+		return
+	}
+
+	if init := session.InitializeResult(); init == nil || init.Capabilities == nil || init.Capabilities.Logging == nil {
+		return
+	}
+
+	session.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: "debug"})
+}
+
+// handleMcpSessionEvents handles GET /mcp/sessions/{id}/events. It relays
+// the notifications of a persistent session as Server-Sent Events until the
+// browser disconnects or the session ends.
+func (s *Server) handleMcpSessionEvents(w http.ResponseWriter, r *http.Request) {
+	value, ok := s.mcpSessions.Load(r.PathValue("id"))
+
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	entry := value.(*mcpSessionEntry)
+
+	events, unsubscribe := entry.events.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	for {
+		select {
+		case event := <-events:
+			if err := writeMcpEvent(w, event); err != nil {
+				return
+			}
+
+			rc.Flush()
+
+		case <-entry.done:
+			writeMcpEvent(w, McpEvent{Type: "closed"})
+			rc.Flush()
+			return
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func newMcpProgress(params *mcp.ProgressNotificationParams) *McpProgress {
+	progress := &McpProgress{
+		Token:    params.ProgressToken,
+		Progress: params.Progress,
+		Total:    params.Total,
+		Message:  params.Message,
+	}
+
+	if params.Total > 0 {
+		percent := min(100, params.Progress/params.Total*100)
+		progress.Percent = &percent
+	}
+
+	return progress
+}
+
+// writeMcpEvent writes event as a Server-Sent Event named after its type.
+func writeMcpEvent(w http.ResponseWriter, event McpEvent) error {
+	data := event.Data
+
+	if data == nil {
+		data = json.RawMessage("{}")
+	}
+
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
+
+// relayMcpToolCall calls a tool and relays the notifications of the
+// connection as Server-Sent Events while it runs, ending with a "result"
+// event carrying the CallToolResult or an "error" event.
+func relayMcpToolCall(ctx context.Context, w http.ResponseWriter, session *mcp.ClientSession, events *mcpEventHub, params *mcp.CallToolParams) {
+	notifications, unsubscribe := events.subscribe()
+	defer unsubscribe()
+
+	// the token ties the server's progress notifications to this call; those
+	// of other calls on a shared session are skipped
+	token := rand.Text()
+	params.SetProgressToken(token)
+
+	relay := func(event McpEvent) error {
+		if event.Type == "progress" {
+			var progress McpProgress
+
+			if json.Unmarshal(event.Data, &progress) == nil && progress.Token != token {
+				return nil
+			}
+		}
+
+		return writeMcpEvent(w, event)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	type outcome struct {
+		result *mcp.CallToolResult
+		err    error
+	}
+
+	done := make(chan outcome, 1)
+
+	go func() {
+		result, err := session.CallTool(ctx, params)
+		done <- outcome{result, err}
+	}()
+
+	for {
+		select {
+		case event := <-notifications:
+			if err := relay(event); err != nil {
+				return
+			}
+
+			rc.Flush()
+
+		case o := <-done:
+			// notifications sent before the result may still be queued
+			for len(notifications) > 0 {
+				relay(<-notifications)
+			}
+
+			if o.err != nil {
+				data, _ := json.Marshal(map[string]string{"error": mcpErrorText("tool call failed", o.err)})
+				writeMcpEvent(w, McpEvent{Type: "error", Data: data})
+			} else {
+				data, _ := json.Marshal(o.result)
+				writeMcpEvent(w, McpEvent{Type: "result", Data: data})
+			}
+
+			rc.Flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adrianliechti/prism/pkg/config"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// mcpSamplingTimeout bounds how long a sampling request waits for the user
+// to approve or reject it.
+const mcpSamplingTimeout = 5 * time.Minute
+
+// sampleMcpMessage answers a sampling/createMessage request of an MCP server
+// with a completion of the configured AI provider. The request is published
+// as a "sampling" event first and only sent once a browser approves it via
+// POST /mcp/sampling/{id}; with nobody listening it is rejected.
+func (s *Server) sampleMcpMessage(ctx context.Context, events *mcpEventHub, params *mcp.CreateMessageParams) (*mcp.CreateMessageResult, error) {
+	if !events.listening() {
+		return nil, errors.New("sampling requires approval, but no client is listening")
+	}
+
+	id := rand.Text()
+	decision := make(chan bool, 1)
+
+	s.mcpSamplings.Store(id, decision)
+	defer s.mcpSamplings.Delete(id)
+
+	events.publish("sampling", &McpSamplingRequest{
+		ID:     id,
+		Params: params,
+	})
+
+	timer := time.NewTimer(mcpSamplingTimeout)
+	defer timer.Stop()
+
+	select {
+	case approved := <-decision:
+		if !approved {
+			return nil, errors.New("sampling request rejected by user")
+		}
+
+	case <-timer.C:
+		return nil, errors.New("sampling request not approved in time")
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return s.createChatCompletion(ctx, params)
+}
+
+// handleMcpSampling handles POST /mcp/sampling/{id}, approving or rejecting
+// a pending sampling request.
+// Request body: McpSamplingDecision
+func (s *Server) handleMcpSampling(w http.ResponseWriter, r *http.Request) {
+	var req McpSamplingDecision
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	value, ok := s.mcpSamplings.LoadAndDelete(r.PathValue("id"))
+
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	value.(chan bool) <- req.Approve
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createChatCompletion sends a sampling request to the OpenAI-compatible
+// chat completions endpoint of the default provider.
+func (s *Server) createChatCompletion(ctx context.Context, params *mcp.CreateMessageParams) (*mcp.CreateMessageResult, error) {
+	cfg := s.config.Load().AIProvider("")
+
+	// the provider may be gone since the session started
+	if cfg == nil {
+		return nil, errors.New("no AI provider configured")
+	}
+
+	var messages []map[string]any
+
+	if params.SystemPrompt != "" {
+		messages = append(messages, map[string]any{
+			"role":    "system",
+			"content": params.SystemPrompt,
+		})
+	}
+
+	for _, m := range params.Messages {
+		content, err := chatMessageContent(m.Content)
+
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, map[string]any{
+			"role":    string(m.Role),
+			"content": content,
+		})
+	}
+
+	body := map[string]any{
+		"model":    cfg.Model,
+		"messages": messages,
+	}
+
+	if params.MaxTokens > 0 {
+		// other providers know the former name only
+		if cfg.Type == config.AIProviderOpenAI || cfg.Type == config.AIProviderAzure {
+			body["max_completion_tokens"] = params.MaxTokens
+		} else {
+			body["max_tokens"] = params.MaxTokens
+		}
+	}
+
+	if params.Temperature != 0 {
+		body["temperature"] = params.Temperature
+	}
+
+	if len(params.StopSequences) > 0 {
+		body["stop"] = params.StopSequences
+	}
+
+	data, err := json.Marshal(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := newAIRequest(ctx, cfg, "/chat/completions", data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.targetClient(s.baseUpstreamOptions(), 0).Do(req)
+
+	if err != nil {
+		return nil, fmt.Errorf("completion request failed: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	var result struct {
+		Model string `json:"model"`
+
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&result); err != nil && resp.StatusCode < 300 {
+		return nil, fmt.Errorf("invalid completion response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		if result.Error != nil && result.Error.Message != "" {
+			return nil, fmt.Errorf("completion request failed: %s", result.Error.Message)
+		}
+
+		return nil, fmt.Errorf("completion request failed: %s", resp.Status)
+	}
+
+	if len(result.Choices) == 0 {
+		return nil, errors.New("completion response has no choices")
+	}
+
+	choice := result.Choices[0]
+
+	stopReason := choice.FinishReason
+
+	switch stopReason {
+	case "stop":
+		stopReason = "endTurn"
+	case "length":
+		stopReason = "maxTokens"
+	}
+
+	model := result.Model
+
+	if model == "" {
+		model = cfg.Model
+	}
+
+	return &mcp.CreateMessageResult{
+		Content:    &mcp.TextContent{Text: choice.Message.Content},
+		Model:      model,
+		Role:       "assistant",
+		StopReason: stopReason,
+	}, nil
+}
+
+// chatMessageContent converts sampling message content to chat completion
+// content: plain text stays a string, images and audio become content parts.
+func chatMessageContent(content mcp.Content) (any, error) {
+	switch c := content.(type) {
+	case *mcp.TextContent:
+		return c.Text, nil
+
+	case *mcp.ImageContent:
+		return []map[string]any{{
+			"type": "image_url",
+			"image_url": map[string]string{
+				"url": "data:" + c.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(c.Data),
+			},
+		}}, nil
+
+	case *mcp.AudioContent:
+		format := strings.TrimPrefix(c.MIMEType, "audio/")
+
+		if format == "mpeg" {
+			format = "mp3"
+		}
+
+		return []map[string]any{{
+			"type": "input_audio",
+			"input_audio": map[string]string{
+				"data":   base64.StdEncoding.EncodeToString(c.Data),
+				"format": format,
+			},
+		}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported sampling content %T", content)
+	}
+}
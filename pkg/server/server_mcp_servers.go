@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+// handleMcpServers handles GET /mcp/servers, listing the MCP servers of
+// the configuration file. Only the names of their headers are returned; the
+// values are added when connecting.
+func (s *Server) handleMcpServers(w http.ResponseWriter, r *http.Request) {
+	result := []McpServerDefinition{}
+
+	for _, server := range s.config.Load().McpServers {
+		def := McpServerDefinition{
+			Name: server.Name,
+			URL:  server.URL,
+
+			Headers: []string{},
+		}
+
+		for name := range server.Headers {
+			def.Headers = append(def.Headers, name)
+		}
+
+		slices.Sort(def.Headers)
+
+		result = append(result, def)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// configuredMcpServer returns the configured MCP server named or at URL
+// ref, nil when there is none.
+func (s *Server) configuredMcpServer(ref string) *config.McpServerConfig {
+	servers := s.config.Load().McpServers
+
+	for i, server := range servers {
+		if server.Name == ref || server.URL == ref {
+			return &servers[i]
+		}
+	}
+
+	return nil
+}
+
+// configuredMcpHeaders adds the headers of the configured MCP server at
+// serverURL to headers, which take precedence.
+func (s *Server) configuredMcpHeaders(serverURL string, headers Headers) Headers {
+	server := s.configuredMcpServer(serverURL)
+
+	if server == nil || len(server.Headers) == 0 {
+		return headers
+	}
+
+	result := Headers{}
+
+	for name, value := range server.Headers {
+		result[name] = []string{value}
+	}
+
+	for k, v := range headers {
+		for name := range result {
+			if strings.EqualFold(name, k) {
+				delete(result, name)
+			}
+		}
+
+		result[k] = v
+	}
+
+	return result
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// mcpSessionIdleTimeout closes persistent MCP sessions nobody used for this
+// long.
+const mcpSessionIdleTimeout = 15 * time.Minute
+
+var (
+	errMcpSessionNotFound = errors.New("MCP session not found")
+	errMcpSessionTarget   = errors.New("MCP session belongs to another server")
+)
+
+// mcpSessionKey identifies the target and connection settings of a session,
+// so opening a session for the same target again reuses it.
+type mcpSessionKey struct {
+	server  string
+	headers string
+	opts    upstreamOptions
+}
+
+type mcpSessionEntry struct {
+	id  string
+	key mcpSessionKey
+
+	session *mcp.ClientSession
+	events  *mcpEventHub
+	created time.Time
+
+	// closed once the session ended
+	done chan struct{}
+
+	mu       sync.Mutex
+	lastUsed time.Time
+	idle     *time.Timer
+}
+
+// touch marks the session as used, restarting its idle timeout.
+func (e *mcpSessionEntry) touch() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lastUsed = time.Now()
+	e.idle.Reset(mcpSessionIdleTimeout)
+}
+
+func (e *mcpSessionEntry) info() McpSession {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := McpSession{
+		ID:     e.id,
+		Server: e.key.server,
+
+		Created:  e.created,
+		LastUsed: e.lastUsed,
+
+		IdleTimeout: int64(mcpSessionIdleTimeout / time.Second),
+	}
+
+	if init := e.session.InitializeResult(); init != nil && init.ServerInfo != nil {
+		result.ServerName = init.ServerInfo.Name
+		result.ServerVersion = init.ServerInfo.Version
+	}
+
+	return result
+}
+
+// handleMcpSessionList handles GET /mcp/sessions.
+func (s *Server) handleMcpSessionList(w http.ResponseWriter, r *http.Request) {
+	result := []McpSession{}
+
+	s.mcpSessions.Range(func(_, value any) bool {
+		result = append(result, value.(*mcpSessionEntry).info())
+		return true
+	})
+
+	slices.SortFunc(result, func(a, b McpSession) int {
+		return a.Created.Compare(b.Created)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleMcpSessionCreate handles POST /mcp/sessions. It connects to the
+// server, given by URL or the name of a configured one, and keeps the session open until it is deleted or idles out; an
+// open session for the same target and settings is returned instead.
+// Request body: McpSessionRequest
+func (s *Server) handleMcpSessionCreate(w http.ResponseWriter, r *http.Request) {
+	var req McpSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	if req.Server == "" {
+		writeProxyError(w, http.StatusBadRequest, errors.New("server is required"))
+		return
+	}
+
+	// configured servers may be named instead
+	if server := s.configuredMcpServer(req.Server); server != nil {
+		req.Server = server.URL
+	}
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, 30*time.Second)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cancel()
+
+	headers, err := s.mcpHeaders(r, req.Headers, opts)
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	key := newMcpSessionKey(req.Server, headers, opts)
+
+	if entry := s.findMcpSession(key); entry != nil {
+		entry.touch()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entry.info())
+		return
+	}
+
+	// the session outlives this request; the request only bounds connecting
+	sessionCtx, closeSession := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, closeSession)
+
+	events := s.newMcpEventHub()
+
+	session, err := s.connectMcp(sessionCtx, req.Server, headers, opts, events)
+
+	if !stop() || err != nil {
+		closeSession()
+
+		if err == nil {
+			session.Close()
+			err = ctx.Err()
+		}
+
+		writeProxyError(w, mcpSessionStatus(err), fmt.Errorf("failed to connect to MCP server: %w", err))
+		return
+	}
+
+	now := time.Now()
+
+	entry := &mcpSessionEntry{
+		id:  rand.Text(),
+		key: key,
+
+		session: session,
+		events:  events,
+		created: now,
+
+		done: make(chan struct{}),
+
+		lastUsed: now,
+	}
+
+	entry.idle = time.AfterFunc(mcpSessionIdleTimeout, func() {
+		s.closeMcpSession(entry.id)
+	})
+
+	// the windows without a stream of the session learn of its
+	// notifications on GET /events
+	events.forward(func(event McpEvent) {
+		s.events.publish("mcp", McpSessionEvent{Session: entry.id, McpEvent: event})
+	})
+
+	s.mcpSessions.Store(entry.id, entry)
+
+	// forget sessions the server or transport ended
+	go func() {
+		session.Wait()
+		closeSession()
+		close(entry.done)
+
+		s.events.publish("mcp", McpSessionEvent{Session: entry.id, McpEvent: McpEvent{Type: "closed"}})
+
+		if s.mcpSessions.CompareAndDelete(entry.id, entry) {
+			entry.idle.Stop()
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry.info())
+}
+
+// handleMcpSessionDelete handles DELETE /mcp/sessions/{id}.
+func (s *Server) handleMcpSessionDelete(w http.ResponseWriter, r *http.Request) {
+	if !s.closeMcpSession(r.PathValue("id")) {
+		writeProxyError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func newMcpSessionKey(serverURL string, headers Headers, opts upstreamOptions) mcpSessionKey {
+	serverURL, _ = normalizeMcpURL(serverURL)
+
+	// encoding/json sorts map keys, so equal headers encode equally
+	data, _ := json.Marshal(headers)
+
+	return mcpSessionKey{
+		server:  serverURL,
+		headers: string(data),
+		opts:    opts,
+	}
+}
+
+func (s *Server) findMcpSession(key mcpSessionKey) *mcpSessionEntry {
+	var result *mcpSessionEntry
+
+	s.mcpSessions.Range(func(_, value any) bool {
+		if entry := value.(*mcpSessionEntry); entry.key == key {
+			result = entry
+			return false
+		}
+
+		return true
+	})
+
+	return result
+}
+
+// closeMcpSession closes and forgets a session, reporting whether it existed.
+func (s *Server) closeMcpSession(id string) bool {
+	value, ok := s.mcpSessions.LoadAndDelete(id)
+
+	if !ok {
+		return false
+	}
+
+	entry := value.(*mcpSessionEntry)
+	entry.idle.Stop()
+	entry.session.Close()
+
+	return true
+}
+
+// closeMcpSessions closes all sessions, e.g. on shutdown.
+func (s *Server) closeMcpSessions() {
+	s.mcpSessions.Range(func(key, _ any) bool {
+		s.closeMcpSession(key.(string))
+		return true
+	})
+}
+
+// mcpSession returns the persistent session named by X-Prism-Mcp-Session,
+// or else connects a new one for this request only, together with the hub
+// its notifications are published to. The returned func releases the
+// session (closing a per-request one).
+func (s *Server) mcpSession(ctx context.Context, r *http.Request, serverURL string, headers Headers, opts upstreamOptions) (*mcp.ClientSession, *mcpEventHub, func(), error) {
+	id := r.Header.Get("X-Prism-Mcp-Session")
+
+	if id == "" {
+		events := s.newMcpEventHub()
+
+		session, err := s.connectMcp(ctx, serverURL, headers, opts, events)
+
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to connect to MCP server: %w", err)
+		}
+
+		return session, events, func() { session.Close() }, nil
+	}
+
+	value, ok := s.mcpSessions.Load(id)
+
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%w: %s", errMcpSessionNotFound, id)
+	}
+
+	entry := value.(*mcpSessionEntry)
+
+	if serverURL != "" {
+		if normalized, _ := normalizeMcpURL(serverURL); !strings.EqualFold(normalized, entry.key.server) {
+			return nil, nil, nil, fmt.Errorf("%w: %s", errMcpSessionTarget, entry.key.server)
+		}
+	}
+
+	entry.touch()
+
+	return entry.session, entry.events, entry.touch, nil
+}
+
+// mcpSessionStatus is the HTTP status of a failed mcpSession.
+func mcpSessionStatus(err error) int {
+	if errors.Is(err, errMcpSessionNotFound) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, errMcpSessionTarget) {
+		return http.StatusBadRequest
+	}
+
+	return upstreamStatus(err)
+}
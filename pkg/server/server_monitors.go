@@ -0,0 +1,699 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// monitorsStore holds the monitors, managed through the /data
+	// endpoints like any other store.
+	monitorsStore = "monitors"
+
+	// monitorHistoryDir holds the recorded results per monitor as JSON
+	// lines; they are local to this machine, so neither synced nor
+	// committed.
+	monitorHistoryDir = ".monitors"
+
+	// maxMonitorHistory bounds the results kept per monitor.
+	maxMonitorHistory = 500
+
+	// monitorPoll is how often the monitors are re-read, so changes apply
+	// without a restart.
+	monitorPoll = 30 * time.Second
+
+	// monitorTimeout bounds a single run of a monitor.
+	monitorTimeout = 10 * time.Minute
+
+	// monitorWebhookTimeout bounds a webhook call.
+	monitorWebhookTimeout = 30 * time.Second
+
+	// monitorWindow is the default window of the statistics (24h).
+	monitorWindow = 24 * time.Hour
+)
+
+var (
+	errMonitorNotFound = errors.New("monitor not found")
+	errMonitorRunning  = errors.New("monitor is already running")
+)
+
+// monitorState is the scheduling state of a monitor.
+type monitorState struct {
+	schedule string
+	next     time.Time
+
+	running bool
+}
+
+// monitorKey returns the key of the state of the monitor id of the
+// workspace of ctx.
+func monitorKey(ctx context.Context, id string) string {
+	return contextWorkspace(ctx) + "/" + id
+}
+
+// loadMonitor reads a stored monitor.
+func loadMonitor(ctx context.Context, id string) (*Monitor, error) {
+	if !validName(id) {
+		return nil, errMonitorNotFound
+	}
+
+	var monitor Monitor
+
+	if err := loadEntry(ctx, monitorsStore, id, &monitor); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errMonitorNotFound
+		}
+
+		return nil, err
+	}
+
+	monitor.ID = id
+
+	return &monitor, nil
+}
+
+// loadMonitors reads all stored monitors ordered by name; unreadable
+// entries are skipped.
+func loadMonitors(ctx context.Context) ([]Monitor, error) {
+	entries, err := dataStore(ctx).List(monitorsStore)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var monitors []Monitor
+
+	for _, entry := range entries {
+		if !validName(entry.ID) {
+			continue
+		}
+
+		monitor, err := loadMonitor(ctx, entry.ID)
+
+		if err != nil {
+			continue
+		}
+
+		monitors = append(monitors, *monitor)
+	}
+
+	slices.SortStableFunc(monitors, func(a, b Monitor) int {
+		if c := strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return monitors, nil
+}
+
+// runMonitors runs the monitors of all workspaces that are due until ctx
+// is done.
+func (s *Server) runMonitors(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		wake := now.Add(monitorPoll)
+
+		workspaces, err := listWorkspaces()
+
+		if err != nil {
+			s.logger.Warn("listing workspaces failed", "error", err)
+		}
+
+		for _, workspace := range workspaces {
+			if next := s.scheduleMonitors(workspaceContext(ctx, workspace.Name), now); next.Before(wake) {
+				wake = next
+			}
+		}
+
+		timer.Reset(max(time.Until(wake), 0))
+	}
+}
+
+// scheduleMonitors starts the monitors of the workspace of ctx due at now
+// and returns when to look again. A run still in progress when the next one is due skips that one.
+func (s *Server) scheduleMonitors(ctx context.Context, now time.Time) time.Time {
+	wake := now.Add(monitorPoll)
+
+	monitors, err := loadMonitors(ctx)
+
+	if err != nil {
+		return wake
+	}
+
+	s.monitorsMu.Lock()
+	defer s.monitorsMu.Unlock()
+
+	seen := map[string]bool{}
+
+	for _, monitor := range monitors {
+		key := monitorKey(ctx, monitor.ID)
+		seen[key] = true
+
+		state := s.monitors[key]
+
+		if state == nil {
+			state = &monitorState{}
+			s.monitors[key] = state
+		}
+
+		sched, err := parseSchedule(monitor.Schedule)
+
+		if monitor.Disabled || err != nil {
+			state.schedule = ""
+			state.next = time.Time{}
+
+			continue
+		}
+
+		if state.schedule != monitor.Schedule || state.next.IsZero() {
+			state.schedule = monitor.Schedule
+			state.next = sched.next(now)
+		}
+
+		if !now.Before(state.next) {
+			if !state.running {
+				state.running = true
+
+				go func() {
+					defer s.finishMonitor(ctx, monitor.ID)
+					s.executeMonitor(ctx, &monitor)
+				}()
+			}
+
+			state.next = sched.next(now)
+		}
+
+		if !state.next.IsZero() && state.next.Before(wake) {
+			wake = state.next
+		}
+	}
+
+	prefix := monitorKey(ctx, "")
+
+	for key, state := range s.monitors {
+		if strings.HasPrefix(key, prefix) && !seen[key] && !state.running {
+			delete(s.monitors, key)
+		}
+	}
+
+	return wake
+}
+
+// startMonitor marks a monitor as running; false when it already is.
+func (s *Server) startMonitor(ctx context.Context, id string) bool {
+	s.monitorsMu.Lock()
+	defer s.monitorsMu.Unlock()
+
+	key := monitorKey(ctx, id)
+
+	state := s.monitors[key]
+
+	if state == nil {
+		state = &monitorState{}
+		s.monitors[key] = state
+	}
+
+	if state.running {
+		return false
+	}
+
+	state.running = true
+
+	return true
+}
+
+func (s *Server) finishMonitor(ctx context.Context, id string) {
+	s.monitorsMu.Lock()
+	defer s.monitorsMu.Unlock()
+
+	if state := s.monitors[monitorKey(ctx, id)]; state != nil {
+		state.running = false
+	}
+}
+
+// executeMonitor runs a monitor, calls its webhook when the run failed,
+// records the result and publishes it.
+func (s *Server) executeMonitor(ctx context.Context, monitor *Monitor) MonitorResult {
+	result := MonitorResult{
+		Time: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, monitorTimeout)
+	defer cancel()
+
+	var env *Environment
+	var err error
+
+	if monitor.Run.Environment != "" {
+		env, err = loadEnvironment(ctx, monitor.Run.Environment)
+	} else {
+		env, err = currentEnvironment(ctx)
+	}
+
+	var run *RunResult
+
+	if err == nil {
+		run, err = s.executeRun(ctx, &monitor.Run, env, "", "")
+	}
+
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+
+	case run.Requests == 0:
+		result.Error = "no requests to run"
+
+	default:
+		result.Duration = run.Duration
+		result.Requests = run.Requests
+		result.Failed = run.Failed
+		result.Results = run.Results
+
+		result.Passed = run.Failed == 0
+
+		if ctx.Err() != nil {
+			result.Passed = false
+			result.Error = "run did not complete: " + context.Cause(ctx).Error()
+		}
+	}
+
+	if !result.Passed && monitor.Webhook != "" {
+		if err := s.sendMonitorWebhook(monitor, result); err != nil {
+			result.WebhookError = err.Error()
+		}
+	}
+
+	// a result that cannot be recorded is still returned to a manual run
+	recordMonitorResult(ctx, monitor.ID, result)
+
+	s.events.publishIn(contextWorkspace(ctx), "monitor.result", MonitorEvent{
+		Monitor: monitor.ID,
+		Name:    monitor.Name,
+
+		Result: result,
+	})
+
+	return result
+}
+
+// sendMonitorWebhook posts a MonitorEvent to the webhook of a monitor.
+func (s *Server) sendMonitorWebhook(monitor *Monitor, result MonitorResult) error {
+	data, err := json.Marshal(MonitorEvent{
+		Monitor: monitor.ID,
+		Name:    monitor.Name,
+
+		Result: result,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), monitorWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, monitor.Webhook, bytes.NewReader(data))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.targetClient(s.baseUpstreamOptions(), 0).Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func monitorHistoryPath(ctx context.Context, id string) string {
+	return filepath.Join(getDataDir(ctx), monitorHistoryDir, id+".jsonl")
+}
+
+// loadMonitorHistory reads the recorded results of a monitor, oldest
+// first; unreadable lines are skipped.
+func loadMonitorHistory(ctx context.Context, id string) ([]MonitorResult, error) {
+	data, err := os.ReadFile(monitorHistoryPath(ctx, id))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var history []MonitorResult
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+
+	for scanner.Scan() {
+		var result MonitorResult
+
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue
+		}
+
+		history = append(history, result)
+	}
+
+	return history, nil
+}
+
+// recordMonitorResult appends a result to the history of a monitor,
+// dropping the oldest beyond maxMonitorHistory.
+func recordMonitorResult(ctx context.Context, id string, result MonitorResult) error {
+	unlock := lockEntry(monitorHistoryDir, id)
+	defer unlock()
+
+	history, err := loadMonitorHistory(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	history = append(history, result)
+
+	if len(history) > maxMonitorHistory {
+		history = history[len(history)-maxMonitorHistory:]
+	}
+
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+
+	for _, result := range history {
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(getDataDir(ctx), monitorHistoryDir), 0755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(monitorHistoryPath(ctx, id), buf.Bytes(), 0644)
+}
+
+// monitorStats summarizes the results since a time.
+func monitorStats(history []MonitorResult, since time.Time) MonitorStats {
+	var stats MonitorStats
+
+	var requests int
+	var latency float64
+
+	for _, result := range history {
+		if result.Time.Before(since) {
+			continue
+		}
+
+		stats.Runs++
+
+		if result.Passed {
+			stats.Passed++
+		} else {
+			stats.Failed++
+
+			failed := result.Time
+			stats.LastFailure = &failed
+		}
+
+		for _, iteration := range result.Results {
+			for _, request := range iteration.Requests {
+				if request.Error != "" {
+					continue
+				}
+
+				requests++
+				latency += request.Duration
+			}
+		}
+	}
+
+	if stats.Runs > 0 {
+		stats.Uptime = float64(stats.Passed) * 100 / float64(stats.Runs)
+	}
+
+	if requests > 0 {
+		stats.Latency = latency / float64(requests)
+	}
+
+	return stats
+}
+
+// monitorStatus describes a monitor with its statistics over window.
+func (s *Server) monitorStatus(ctx context.Context, monitor *Monitor, window time.Duration, label string) (*MonitorStatus, error) {
+	history, err := loadMonitorHistory(ctx, monitor.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MonitorStatus{
+		Monitor: *monitor,
+
+		Stats: monitorStats(history, time.Now().Add(-window)),
+	}
+
+	status.Stats.Window = label
+
+	if len(history) > 0 {
+		status.Last = &history[len(history)-1]
+	}
+
+	sched, err := parseSchedule(monitor.Schedule)
+
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	s.monitorsMu.Lock()
+	state := s.monitors[monitorKey(ctx, monitor.ID)]
+
+	if state != nil {
+		status.Running = state.running
+
+		if state.schedule == monitor.Schedule && !state.next.IsZero() {
+			next := state.next
+			status.Next = &next
+		}
+	}
+	s.monitorsMu.Unlock()
+
+	// not picked up by the scheduler yet
+	if status.Next == nil && sched != nil && !monitor.Disabled {
+		next := sched.next(time.Now())
+		status.Next = &next
+	}
+
+	return status, nil
+}
+
+// monitorWindowParam reads ?window=, a duration such as 24h or 7d, and
+// returns it with its label.
+func monitorWindowParam(r *http.Request) (time.Duration, string, error) {
+	value := r.URL.Query().Get("window")
+
+	if value == "" {
+		return monitorWindow, "24h", nil
+	}
+
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, value, nil
+		}
+	}
+
+	window, err := time.ParseDuration(value)
+
+	if err != nil || window <= 0 {
+		return 0, "", fmt.Errorf("invalid window %q", value)
+	}
+
+	return window, value, nil
+}
+
+// handleMonitorList handles GET /monitors[?window=24h].
+func (s *Server) handleMonitorList(w http.ResponseWriter, r *http.Request) {
+	window, label, err := monitorWindowParam(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	monitors, err := loadMonitors(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := []*MonitorStatus{}
+
+	for _, monitor := range monitors {
+		status, err := s.monitorStatus(r.Context(), &monitor, window, label)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result = append(result, status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleMonitorGet handles GET /monitors/{id}[?window=24h].
+func (s *Server) handleMonitorGet(w http.ResponseWriter, r *http.Request) {
+	window, label, err := monitorWindowParam(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	monitor, err := loadMonitor(r.Context(), r.PathValue("id"))
+
+	if err != nil {
+		writeMonitorError(w, err)
+		return
+	}
+
+	status, err := s.monitorStatus(r.Context(), monitor, window, label)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleMonitorRun handles POST /monitors/{id}/run, running a monitor now
+// (also a disabled one). The result is recorded like a scheduled run.
+func (s *Server) handleMonitorRun(w http.ResponseWriter, r *http.Request) {
+	monitor, err := loadMonitor(r.Context(), r.PathValue("id"))
+
+	if err != nil {
+		writeMonitorError(w, err)
+		return
+	}
+
+	if !s.startMonitor(r.Context(), monitor.ID) {
+		writeMonitorError(w, errMonitorRunning)
+		return
+	}
+
+	defer s.finishMonitor(r.Context(), monitor.ID)
+
+	result := s.executeMonitor(r.Context(), monitor)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleMonitorHistory handles GET /monitors/{id}/history[?limit=100],
+// newest results first.
+func (s *Server) handleMonitorHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		limit = n
+	}
+
+	monitor, err := loadMonitor(r.Context(), r.PathValue("id"))
+
+	if err != nil {
+		writeMonitorError(w, err)
+		return
+	}
+
+	history, err := loadMonitorHistory(r.Context(), monitor.ID)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slices.Reverse(history)
+
+	result := append([]MonitorResult{}, history[:min(limit, len(history))]...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleMonitorHistoryDelete handles DELETE /monitors/{id}/history. The
+// history of a deleted monitor can be cleared, too.
+func (s *Server) handleMonitorHistoryDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if !validName(id) {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	unlock := lockEntry(monitorHistoryDir, id)
+	defer unlock()
+
+	if err := os.Remove(monitorHistoryPath(r.Context(), id)); err != nil && !os.IsNotExist(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeMonitorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errMonitorNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errMonitorRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
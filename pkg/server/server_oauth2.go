@@ -0,0 +1,510 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// oauth2Store is the data store holding named OAuth2 credentials, the
+// configuration of their clients.
+const oauth2Store = "oauth2"
+
+// oauth2TokenDir holds the current token of each credential, out of reach
+// of the /data endpoints.
+const oauth2TokenDir = ".oauth2"
+
+// oauth2FlowTTL bounds how long a started authorization-code flow waits for
+// its callback.
+const oauth2FlowTTL = 10 * time.Minute
+
+// oauth2Flow is a pending authorization-code flow, keyed by state. The
+// callback comes without the workspace of the request starting the flow,
+// so the flow records it.
+type oauth2Flow struct {
+	Name        string
+	Workspace   string
+	Verifier    string
+	RedirectURL string
+	Expires     time.Time
+}
+
+// oauth2TokenFile is the stored token of a credential. The client it was
+// issued to is recorded, so the token of a replaced credential of the same
+// name is not used.
+type oauth2TokenFile struct {
+	ClientID string `json:"clientId"`
+	TokenURL string `json:"tokenUrl"`
+
+	Token *oauth2.Token `json:"token"`
+}
+
+func (c *OAuth2Credential) config(redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Scopes:       c.Scopes,
+		RedirectURL:  redirectURL,
+
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  c.AuthURL,
+			TokenURL: c.TokenURL,
+		},
+	}
+}
+
+func (c *OAuth2Credential) status(name string, token *oauth2.Token) OAuth2Status {
+	status := OAuth2Status{
+		Name:   name,
+		Grant:  c.Grant,
+		Scopes: c.Scopes,
+	}
+
+	if token != nil {
+		status.Authorized = token.AccessToken != ""
+		status.Refreshable = token.RefreshToken != ""
+
+		if !token.Expiry.IsZero() {
+			expiry := token.Expiry
+			status.Expiry = &expiry
+		}
+	}
+
+	return status
+}
+
+func loadOAuth2Credential(ctx context.Context, name string) (*OAuth2Credential, error) {
+	if !validName(name) {
+		return nil, fmt.Errorf("invalid credential name")
+	}
+
+	var cred OAuth2Credential
+
+	if err := loadEntry(ctx, oauth2Store, name, &cred); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("oauth2 credential %q not found", name)
+		}
+
+		return nil, err
+	}
+
+	return &cred, nil
+}
+
+// lockOAuth2 serializes token fetches of the named credential, so
+// concurrent requests don't race to rotate the same refresh token, and
+// returns the func unlocking it. Other credentials are not held up.
+func lockOAuth2(name string) func() {
+	return lockEntry(oauth2TokenDir, name)
+}
+
+// loadOAuth2Token returns the current token of the named credential, nil if
+// there is none. Tokens stored in the credential itself, as they were before
+// being kept apart, are moved out of it.
+func loadOAuth2Token(ctx context.Context, name string, cred *OAuth2Credential) (*oauth2.Token, error) {
+	data, err := os.ReadFile(filepath.Join(getDataDir(ctx), oauth2TokenDir, name+".json"))
+
+	if errors.Is(err, os.ErrNotExist) {
+		var legacy struct {
+			Token *oauth2.Token `json:"token"`
+		}
+
+		if err := loadEntry(ctx, oauth2Store, name, &legacy); err != nil || legacy.Token == nil {
+			return nil, nil
+		}
+
+		if err := saveOAuth2Token(ctx, name, cred, legacy.Token); err != nil {
+			return nil, err
+		}
+
+		// rewritten without the token
+		if err := saveEntry(ctx, oauth2Store, name, cred); err != nil {
+			return nil, err
+		}
+
+		return legacy.Token, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var file oauth2TokenFile
+
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	if file.ClientID != cred.ClientID || file.TokenURL != cred.TokenURL {
+		return nil, nil
+	}
+
+	return file.Token, nil
+}
+
+// saveOAuth2Token stores token as the current one of the named credential,
+// readable by the owner only; a nil token removes it.
+func saveOAuth2Token(ctx context.Context, name string, cred *OAuth2Credential, token *oauth2.Token) error {
+	path := filepath.Join(getDataDir(ctx), oauth2TokenDir, name+".json")
+
+	if token == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	data, err := json.MarshalIndent(oauth2TokenFile{
+		ClientID: cred.ClientID,
+		TokenURL: cred.TokenURL,
+
+		Token: token,
+	}, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, 0600)
+}
+
+// oauth2Context routes token endpoint calls through the upstream transport
+// (honoring outbound proxy and TLS options and the target rules).
+func (s *Server) oauth2Context(ctx context.Context, opts upstreamOptions) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, s.targetClient(opts, 30*time.Second))
+}
+
+// oauth2AccessToken returns a valid access token for the named credential,
+// refreshing (or re-fetching client credentials) when it has expired.
+func (s *Server) oauth2AccessToken(ctx context.Context, name string, opts upstreamOptions) (*oauth2.Token, error) {
+	cred, err := loadOAuth2Credential(ctx, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := lockOAuth2(name)
+	defer unlock()
+
+	current, err := loadOAuth2Token(ctx, name, cred)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Valid() {
+		return current, nil
+	}
+
+	token, err := s.fetchOAuth2Token(ctx, cred, current, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := saveOAuth2Token(ctx, name, cred, token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// fetchOAuth2Token obtains a new token without user interaction: via the
+// refresh token of current when there is one, else via client credentials.
+func (s *Server) fetchOAuth2Token(ctx context.Context, cred *OAuth2Credential, current *oauth2.Token, opts upstreamOptions) (*oauth2.Token, error) {
+	ctx = s.oauth2Context(ctx, opts)
+
+	if current != nil && current.RefreshToken != "" {
+		token, err := cred.config("").TokenSource(ctx, current).Token()
+
+		if err != nil {
+			return nil, fmt.Errorf("token refresh failed: %w", err)
+		}
+
+		return token, nil
+	}
+
+	if cred.Grant == "client_credentials" {
+		cc := &clientcredentials.Config{
+			ClientID:     cred.ClientID,
+			ClientSecret: cred.ClientSecret,
+			TokenURL:     cred.TokenURL,
+			Scopes:       cred.Scopes,
+		}
+
+		token, err := cc.Token(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("client credentials grant failed: %w", err)
+		}
+
+		return token, nil
+	}
+
+	return nil, fmt.Errorf("not authorized: start the authorization flow first")
+}
+
+// handleOAuth2Get handles GET /oauth2/{name}, reporting the token state
+// without exposing token values.
+func (s *Server) handleOAuth2Get(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	cred, err := loadOAuth2Credential(r.Context(), name)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	unlock := lockOAuth2(name)
+	defer unlock()
+
+	token, err := loadOAuth2Token(r.Context(), name, cred)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cred.status(name, token))
+}
+
+// handleOAuth2Authorize handles POST /oauth2/{name}/authorize. It starts an
+// authorization-code + PKCE flow and returns the URL to open in a browser;
+// the provider redirects back to /oauth2/callback on this server.
+func (s *Server) handleOAuth2Authorize(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	cred, err := loadOAuth2Credential(r.Context(), name)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if cred.AuthURL == "" {
+		http.Error(w, "credential has no authorization URL", http.StatusBadRequest)
+		return
+	}
+
+	s.purgeOAuth2Flows()
+
+	scheme := "http"
+
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	flow := &oauth2Flow{
+		Name:        name,
+		Workspace:   contextWorkspace(r.Context()),
+		Verifier:    oauth2.GenerateVerifier(),
+		RedirectURL: scheme + "://" + r.Host + "/oauth2/callback",
+		Expires:     time.Now().Add(oauth2FlowTTL),
+	}
+
+	state := oauth2.GenerateVerifier()
+	s.oauth2Flows.Store(state, flow)
+
+	authURL := cred.config(flow.RedirectURL).AuthCodeURL(state, oauth2.S256ChallengeOption(flow.Verifier))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OAuth2Authorization{
+		AuthorizationURL: authURL,
+		RedirectURL:      flow.RedirectURL,
+	})
+}
+
+// handleOAuth2Callback handles GET /oauth2/callback, exchanging the
+// authorization code and storing the resulting token.
+func (s *Server) handleOAuth2Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	value, ok := s.oauth2Flows.LoadAndDelete(query.Get("state"))
+
+	if !ok || time.Now().After(value.(*oauth2Flow).Expires) {
+		writeOAuth2Page(w, http.StatusBadRequest, "Unknown or expired authorization request.")
+		return
+	}
+
+	flow := value.(*oauth2Flow)
+
+	if e := query.Get("error"); e != "" {
+		writeOAuth2Page(w, http.StatusBadRequest, "Authorization failed: "+e+" "+query.Get("error_description"))
+		return
+	}
+
+	ctx := workspaceContext(r.Context(), flow.Workspace)
+
+	cred, err := loadOAuth2Credential(ctx, flow.Name)
+
+	if err != nil {
+		writeOAuth2Page(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	unlock := lockOAuth2(flow.Name)
+	defer unlock()
+
+	ctx = s.oauth2Context(ctx, s.baseUpstreamOptions())
+
+	token, err := cred.config(flow.RedirectURL).Exchange(ctx, query.Get("code"), oauth2.VerifierOption(flow.Verifier))
+
+	if err != nil {
+		writeOAuth2Page(w, http.StatusBadGateway, "Token exchange failed: "+err.Error())
+		return
+	}
+
+	if err := saveOAuth2Token(ctx, flow.Name, cred, token); err != nil {
+		writeOAuth2Page(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeOAuth2Page(w, http.StatusOK, "Prism is now authorized. You can close this window.")
+}
+
+// handleOAuth2Token handles POST /oauth2/{name}/token, forcing a refresh or
+// client-credentials grant.
+func (s *Server) handleOAuth2Token(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cred, err := loadOAuth2Credential(r.Context(), name)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	unlock := lockOAuth2(name)
+	defer unlock()
+
+	current, err := loadOAuth2Token(r.Context(), name, cred)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if current != nil {
+		// force the refresh even if the current token is still valid
+		current.Expiry = time.Unix(1, 0)
+	}
+
+	token, err := s.fetchOAuth2Token(r.Context(), cred, current, opts)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if err := saveOAuth2Token(r.Context(), name, cred, token); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cred.status(name, token))
+}
+
+// handleOAuth2Revoke handles DELETE /oauth2/{name}/token, forgetting the
+// stored token (the client configuration is kept).
+func (s *Server) handleOAuth2Revoke(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	cred, err := loadOAuth2Credential(r.Context(), name)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	unlock := lockOAuth2(name)
+	defer unlock()
+
+	// a token still stored in the credential is moved out first
+	if _, err := loadOAuth2Token(r.Context(), name, cred); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := saveOAuth2Token(r.Context(), name, cred, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) purgeOAuth2Flows() {
+	now := time.Now()
+
+	s.oauth2Flows.Range(func(key, value any) bool {
+		if now.After(value.(*oauth2Flow).Expires) {
+			s.oauth2Flows.Delete(key)
+		}
+
+		return true
+	})
+}
+
+func writeOAuth2Page(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "<!doctype html><title>Prism</title><p>%s</p>", html.EscapeString(message))
+}
+
+// oauth2Header resolves the X-Prism-OAuth2 credential reference into an
+// Authorization header value. It returns "" when no credential is referenced.
+func (s *Server) oauth2Header(r *http.Request, opts upstreamOptions) (string, error) {
+	name := r.Header.Get("X-Prism-OAuth2")
+
+	if name == "" {
+		return "", nil
+	}
+
+	token, err := s.oauth2AccessToken(r.Context(), name, opts)
+
+	if err != nil {
+		return "", err
+	}
+
+	return token.Type() + " " + token.AccessToken, nil
+}
+
+// oauth2Placeholder stands in for oauth2Header in dry runs: the referenced
+// credential must exist, but no token is fetched or refreshed.
+func oauth2Placeholder(r *http.Request, opts upstreamOptions) (string, error) {
+	name := r.Header.Get("X-Prism-OAuth2")
+
+	if name == "" {
+		return "", nil
+	}
+
+	if _, err := loadOAuth2Credential(r.Context(), name); err != nil {
+		return "", err
+	}
+
+	return "Bearer {{oauth2:" + name + "}}", nil
+}
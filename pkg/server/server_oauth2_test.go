@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+// useTestDataDir points the data directory to a temporary one with the
+// default workspace open.
+func useTestDataDir(t *testing.T) {
+	t.Helper()
+
+	if err := initDataDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := initWorkspace(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := initDataStore(""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOAuth2CallbackWorkspace(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"token","token_type":"bearer"}`))
+	}))
+	defer tokenServer.Close()
+
+	tests := []struct {
+		name      string
+		workspace string
+	}{
+		{"open workspace", defaultWorkspace},
+		{"other workspace", "team"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestDataDir(t)
+
+			if err := os.MkdirAll(workspaceDir(test.workspace), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := workspaceContext(t.Context(), test.workspace)
+
+			if err := saveEntry(ctx, oauth2Store, "api", OAuth2Credential{
+				Grant:    "authorization_code",
+				AuthURL:  tokenServer.URL + "/authorize",
+				TokenURL: tokenServer.URL + "/token",
+				ClientID: "prism",
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			s := targetServer(&config.Config{})
+
+			// the flow starts in the workspace of the request
+			r := httptest.NewRequestWithContext(ctx, http.MethodPost, "/oauth2/api/authorize", nil)
+			r.SetPathValue("name", "api")
+
+			w := httptest.NewRecorder()
+			s.handleOAuth2Authorize(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("authorize: %d %s", w.Code, w.Body)
+			}
+
+			var authorization OAuth2Authorization
+
+			if err := json.NewDecoder(w.Body).Decode(&authorization); err != nil {
+				t.Fatal(err)
+			}
+
+			authURL, err := url.Parse(authorization.AuthorizationURL)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the callback of the provider names no workspace
+			query := url.Values{"state": {authURL.Query().Get("state")}, "code": {"code"}}
+			r = httptest.NewRequest(http.MethodGet, "/oauth2/callback?"+query.Encode(), nil)
+
+			w = httptest.NewRecorder()
+			s.handleOAuth2Callback(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("callback: %d %s", w.Code, w.Body)
+			}
+
+			data, err := os.ReadFile(filepath.Join(workspaceDir(test.workspace), oauth2TokenDir, "api.json"))
+
+			if err != nil {
+				t.Fatalf("token not stored in workspace %s: %v", test.workspace, err)
+			}
+
+			if !strings.Contains(string(data), `"access_token": "token"`) {
+				t.Errorf("stored token = %s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// previewTransport stands in for the upstream in dry-run mode: instead of
+// sending the request it answers with a Preview of it, so everything the
+// proxy does before the wire (rewriting, auth, unwrapped headers, staged
+// bodies) is reflected.
+type previewTransport struct {
+	opts upstreamOptions
+
+	// headers masked in the preview
+	redact []string
+}
+
+func (t *previewTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	preview := Preview{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Query:  req.URL.Query(),
+
+		Headers: Headers(redactHeader(req.Header, t.redact).Clone()),
+
+		Proxy:    t.opts.Proxy,
+		Insecure: t.opts.Insecure,
+	}
+
+	// the credentials of the proxy are not shown
+	if u := t.opts.proxyURL(); u != nil {
+		preview.Proxy = u.Redacted()
+	}
+
+	if t.opts.Resolve != "" {
+		preview.Resolve = strings.Split(t.opts.Resolve, ",")
+	}
+
+	if preview.Headers == nil {
+		preview.Headers = Headers{}
+	}
+
+	preview.Headers["Host"] = []string{req.Host}
+
+	// ReverseProxy blanks a missing User-Agent; the transport then omits it
+	if req.Header.Get("User-Agent") == "" {
+		delete(preview.Headers, "User-Agent")
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		defer req.Body.Close()
+
+		// count the whole body but keep only the first maxCaptureBody bytes
+		var body limitedBuffer
+
+		n, err := io.Copy(&body, req.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, truncated := body.snapshot()
+
+		preview.BodySize = n
+		preview.Truncated = truncated
+
+		if utf8.Valid(data) {
+			preview.Body = string(data)
+		} else {
+			preview.Body = base64.StdEncoding.EncodeToString(data)
+			preview.BodyEncoding = "base64"
+		}
+
+		preview.Headers["Content-Length"] = []string{strconv.FormatInt(n, 10)}
+	}
+
+	data, err := json.Marshal(preview)
+
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	header.Set("X-Prism-Dry-Run", "true")
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+
+		Request: req,
+	}, nil
+}
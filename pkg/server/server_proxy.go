@@ -1,23 +1,17 @@
 package server
 
 import (
-	"crypto/tls"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
-)
-
-// Shared upstream transports; per-request transports leak idle connections.
-var (
-	proxyTransport = http.DefaultTransport.(*http.Transport).Clone()
-
-	proxyTransportInsecure = func() *http.Transport {
-		t := http.DefaultTransport.(*http.Transport).Clone()
-		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-		return t
-	}()
+	"time"
 )
 
 // redirectTransport wraps a RoundTripper to follow redirects server-side.
@@ -55,6 +49,58 @@ func setCORSHeaders(h http.Header) {
 	h.Set("Access-Control-Expose-Headers", "*")
 }
 
+// limitResponse truncates bodies larger than maxSize, flagging it via
+// X-Prism-Truncated and reporting the upstream's Content-Length (when known)
+// as X-Prism-Content-Length. Streams (SSE, NDJSON) are left alone: they are
+// consumed incrementally and must not be buffered.
+func limitResponse(resp *http.Response, maxSize int64) error {
+	switch mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType {
+	case "text/event-stream", "application/x-ndjson":
+		return nil
+	}
+
+	if resp.ContentLength >= 0 && resp.ContentLength <= maxSize {
+		return nil
+	}
+
+	body := resp.Body
+
+	data, err := io.ReadAll(io.LimitReader(body, maxSize+1))
+
+	if err != nil {
+		body.Close()
+		return err
+	}
+
+	if int64(len(data)) <= maxSize {
+		body.Close()
+
+		resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+
+		resp.ContentLength = int64(len(data))
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+
+		return nil
+	}
+
+	// closing early aborts the upstream transfer instead of draining it
+	body.Close()
+
+	data = data[:maxSize]
+
+	if resp.ContentLength > 0 {
+		resp.Header.Set("X-Prism-Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+
+	resp.Header.Set("X-Prism-Truncated", "true")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+
+	resp.ContentLength = int64(len(data))
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	return nil
+}
+
 func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodOptions {
 		// CORS preflight (only sent when the UI runs on a different origin)
@@ -71,7 +117,7 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		setCORSHeaders(w.Header())
-		http.Error(w, "Invalid target URL: "+err.Error(), http.StatusBadRequest)
+		writeProxyError(w, http.StatusBadRequest, fmt.Errorf("invalid target URL: %w", err))
 		return
 	}
 
@@ -87,21 +133,194 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 		r.URL.RawPath = ""
 	}
 
+	// Large bodies are staged via POST /uploads and referenced here instead
+	// of travelling inline.
+	if id := r.Header.Get("X-Prism-Body-File"); id != "" {
+		if err := s.applyUploadBody(r, id); err != nil {
+			setCORSHeaders(w.Header())
+			writeProxyError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
 	// Redirect handling is opt-in via X-Prism-Redirect ("true" = follow
 	// server-side, "false" = surface the 3xx). Consumers that don't send the
 	// header (OpenAI panel, chat adapter) get redirects passed through as-is.
 	redirectMode := r.Header.Get("X-Prism-Redirect")
 
-	transport := proxyTransport
-	if r.Header.Get("X-Prism-Insecure") == "true" {
-		transport = proxyTransportInsecure
+	// Download mode spools the body to disk and answers with Download
+	// metadata; the file is then fetched from /downloads/{token}.
+	downloadMode := r.Header.Get("X-Prism-Download") == "true"
+
+	maxResponseSize := s.config.Load().MaxResponseSize
+
+	if value := r.Header.Get("X-Prism-Max-Response-Size"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+
+		if err != nil || size < 0 {
+			setCORSHeaders(w.Header())
+			writeProxyError(w, http.StatusBadRequest, errors.New("invalid X-Prism-Max-Response-Size: expected a byte count"))
+			return
+		}
+
+		maxResponseSize = size
+	}
+
+	if downloadMode {
+		maxResponseSize = 0
+	}
+
+	// Compressed bodies are decoded server-side by default, so truncation
+	// and spooling operate on the content; "raw" hands the compressed bytes
+	// to the UI instead.
+	rawMode := r.Header.Get("X-Prism-Encoding") == "raw" && !downloadMode
+
+	// Dry-run mode answers with a Preview of the upstream request instead
+	// of sending it.
+	dryRun := r.Header.Get("X-Prism-Dry-Run") == "true"
+
+	// Secret and keychain references are left in place for previews so they
+	// never show secret values.
+	if !dryRun {
+		if err := s.applySecrets(r); err != nil {
+			setCORSHeaders(w.Header())
+
+			code := http.StatusBadRequest
+			if errors.Is(err, errSecretsLocked) {
+				code = http.StatusLocked
+			}
+
+			writeProxyError(w, code, err)
+			return
+		}
+	}
+
+	opts, err := s.upstreamOptionsFromRequest(r)
+
+	if err != nil {
+		setCORSHeaders(w.Header())
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Dry runs fetch no token, so previews never show a live one.
+	oauth2Header := s.oauth2Header
+
+	if dryRun {
+		oauth2Header = oauth2Placeholder
+	}
+
+	authorization, err := oauth2Header(r, opts)
+
+	if err != nil {
+		setCORSHeaders(w.Header())
+		writeProxyError(w, http.StatusBadGateway, fmt.Errorf("oauth2: %w", err))
+		return
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, defaultProxyTimeout)
+
+	if err != nil {
+		setCORSHeaders(w.Header())
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	defer cancel()
+
+	// Hooks of the workspace run around every round trip; the headers they
+	// redact are masked in captures and previews and announced as
+	// X-Prism-Redacted.
+	hooks, err := loadHooks(ctx)
+
+	if err != nil {
+		setCORSHeaders(w.Header())
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	redacted := redactedHeaders(hooks, "request", targetURL.Host)
+
+	trace := newRequestTrace()
+
+	r = r.WithContext(trace.withContext(ctx))
+
+	var transport http.RoundTripper = s.proxyTransport(opts)
+
+	// Capture mode records every round trip (redirect hops and retries
+	// included) in wire format, retrievable from /captures/{id}.
+	var captureID string
+
+	if r.Header.Get("X-Prism-Capture") == "true" && !dryRun {
+		id, entry := s.newCapture()
+
+		captureID = id
+		transport = &captureTransport{
+			base:  transport,
+			entry: entry,
+
+			redactRequest:  redacted,
+			redactResponse: redactedHeaders(hooks, "response", targetURL.Host),
+		}
 	}
 
-	var rt http.RoundTripper = transport
+	if len(hooks) > 0 {
+		transport = &hookTransport{base: transport, hooks: hooks}
+	}
+
+	rt := transport
 	if redirectMode == "true" {
 		rt = &redirectTransport{base: transport}
 	}
 
+	retryPolicy, err := parseRetryPolicy(r)
+
+	if err != nil {
+		setCORSHeaders(w.Header())
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var retry *retryTransport
+
+	if retryPolicy != nil && !dryRun {
+		if err := bufferRetryBody(r); err != nil {
+			setCORSHeaders(w.Header())
+			writeProxyError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		retry = &retryTransport{base: rt, policy: retryPolicy}
+		rt = retry
+	}
+
+	if dryRun {
+		rt = &previewTransport{opts: opts, redact: redacted}
+
+		if len(hooks) > 0 {
+			rt = &hookTransport{base: rt, hooks: hooks}
+		}
+	}
+
+	// Assertions run against the response and report their results as
+	// X-Prism-Assertions, also when there are none (an empty list);
+	// extracted values go to the environment of the request.
+	checks := &responseChecks{
+		start: time.Now(),
+
+		environment: contextEnvironment(r.Context()),
+	}
+
+	if checks.assertions, err = parseAssertions(r); err == nil {
+		checks.extractors, err = parseExtractors(r)
+	}
+
+	if err != nil {
+		setCORSHeaders(w.Header())
+		writeProxyError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	proxy := &httputil.ReverseProxy{
 		Transport: rt,
 
@@ -113,6 +332,23 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 			// target was never meant to see.
 			pr.Out.Header.Del("X-Prism-Insecure")
 			pr.Out.Header.Del("X-Prism-Redirect")
+			pr.Out.Header.Del("X-Prism-Proxy")
+			pr.Out.Header.Del("X-Prism-Timeout")
+			pr.Out.Header.Del("X-Prism-Connect-Timeout")
+			pr.Out.Header.Del("X-Prism-Download")
+			pr.Out.Header.Del("X-Prism-Body-File")
+			pr.Out.Header.Del("X-Prism-OAuth2")
+			pr.Out.Header.Del("X-Prism-TLS")
+			pr.Out.Header.Del("X-Prism-Max-Response-Size")
+			pr.Out.Header.Del("X-Prism-Encoding")
+			pr.Out.Header.Del("X-Prism-Resolve")
+			pr.Out.Header.Del("X-Prism-Retry")
+			pr.Out.Header.Del("X-Prism-Capture")
+			pr.Out.Header.Del("X-Prism-Request-Id")
+			pr.Out.Header.Del("X-Prism-Dry-Run")
+			pr.Out.Header.Del("X-Prism-Assert")
+			pr.Out.Header.Del("X-Prism-Extract")
+			pr.Out.Header.Del("X-Prism-Script")
 			pr.Out.Header.Del("Origin")
 			pr.Out.Header.Del("Referer")
 			pr.Out.Header.Del("Cookie")
@@ -122,6 +358,10 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
+			if authorization != "" {
+				pr.Out.Header.Set("Authorization", authorization)
+			}
+
 			// Unwrap headers the browser refuses to send directly
 			// (Cookie, Host, Origin, ...): the UI smuggles them as
 			// X-Prism-Header-<Name>.
@@ -143,8 +383,12 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 		},
 
 		ModifyResponse: func(resp *http.Response) error {
-			// Never let the upstream spoof our control header.
-			resp.Header.Del("X-Prism-Status")
+			// Never let the upstream spoof our control headers.
+			for key := range resp.Header {
+				if strings.HasPrefix(key, "X-Prism-") {
+					resp.Header.Del(key)
+				}
+			}
 
 			// With redirect-following explicitly off, mask 3xx statuses so
 			// the browser fetch in the UI reports them instead of following
@@ -161,9 +405,11 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 
 			// Upstream CORS headers must not reach the browser (they would
 			// conflict with ours), but the UI still wants to display them:
-			// move them aside under X-Prism-Upstream-<Name>.
+			// move them aside under X-Prism-Upstream-<Name>. Set-Cookie is
+			// treated alike since fetch() never exposes it; every cookie is
+			// kept as its own header line.
 			for key, values := range resp.Header {
-				if !strings.HasPrefix(key, "Access-Control-") {
+				if !strings.HasPrefix(key, "Access-Control-") && key != "Set-Cookie" {
 					continue
 				}
 				resp.Header.Del(key)
@@ -172,6 +418,63 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 			setCORSHeaders(resp.Header)
+
+			if len(redacted) > 0 {
+				resp.Header.Set("X-Prism-Redacted", strings.Join(redacted, ", "))
+			}
+
+			trace.writeHeaders(resp.Header)
+
+			if retry != nil {
+				retry.writeHeaders(resp.Header)
+			}
+
+			if captureID != "" {
+				resp.Header.Set("X-Prism-Capture-Id", captureID)
+			}
+
+			if rawMode {
+				rawEncoding(resp)
+			}
+
+			var encoded *countingReader
+
+			if !rawMode {
+				counter, err := decodeResponse(resp)
+
+				if err != nil {
+					return err
+				}
+
+				encoded = counter
+			}
+
+			if downloadMode {
+				if checks.active() {
+					if err := s.checkResponse(ctx, resp, checks, false); err != nil {
+						return err
+					}
+				}
+
+				return s.spoolDownload(resp)
+			}
+
+			if maxResponseSize > 0 {
+				if err := limitResponse(resp, maxResponseSize); err != nil {
+					return err
+				}
+			}
+
+			// sizes are only known once the decoded body was buffered whole
+			if encoded != nil && resp.ContentLength >= 0 && resp.Header.Get("X-Prism-Truncated") == "" {
+				resp.Header.Set("X-Prism-Encoded-Size", strconv.FormatInt(encoded.n, 10))
+				resp.Header.Set("X-Prism-Decoded-Size", strconv.FormatInt(resp.ContentLength, 10))
+			}
+
+			if checks.active() {
+				return s.checkResponse(ctx, resp, checks, true)
+			}
+
 			return nil
 		},
 
@@ -179,9 +482,36 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 			// ModifyResponse never runs on transport errors; without CORS
 			// headers a cross-origin UI can't read the error text.
 			setCORSHeaders(w.Header())
-			http.Error(w, fmt.Sprintf("proxy error: %v", err), http.StatusBadGateway)
+
+			if retry != nil {
+				retry.writeHeaders(w.Header())
+			}
+
+			if captureID != "" {
+				w.Header().Set("X-Prism-Capture-Id", captureID)
+			}
+
+			if requestCanceled(r.Context()) {
+				writeProxyError(w, statusClientClosedRequest, errRequestCanceled)
+				return
+			}
+
+			code := upstreamStatus(err)
+
+			s.logger.Debug("proxy error", "target", r.URL.Scheme+"://"+r.URL.Host, "error", err)
+
+			writeProxyError(w, code, fmt.Errorf("proxy error: %w", err))
 		},
 	}
 
+	if dryRun {
+		// the preview is our own answer: none of the upstream response
+		// handling applies
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			setCORSHeaders(resp.Header)
+			return nil
+		}
+	}
+
 	proxy.ServeHTTP(w, r)
 }
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// errRequestCanceled is the cancellation cause of DELETE /requests/{id}.
+var errRequestCanceled = errors.New("request canceled")
+
+// statusClientClosedRequest (nginx's 499) answers requests aborted on
+// behalf of the client.
+const statusClientClosedRequest = 499
+
+type inflightRequest struct {
+	cancel context.CancelCauseFunc
+}
+
+// requestContext derives the upstream context of a proxied request: it
+// applies X-Prism-Timeout (see withRequestTimeout) and registers the request
+// under X-Prism-Request-Id (or a generated ID, echoed in the response) so it
+// can be aborted via DELETE /requests/{id}. The UI picks the ID up front to
+// be able to cancel before any response header arrives.
+func (s *Server) requestContext(w http.ResponseWriter, r *http.Request, fallback time.Duration) (context.Context, context.CancelFunc, error) {
+	id := r.Header.Get("X-Prism-Request-Id")
+
+	if id == "" {
+		id = rand.Text()
+	}
+
+	if !validName(id) {
+		return nil, nil, fmt.Errorf("invalid X-Prism-Request-Id")
+	}
+
+	ctx, cancelTimeout, err := withRequestTimeout(r, fallback)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	entry := &inflightRequest{cancel: cancel}
+
+	if _, loaded := s.requests.LoadOrStore(id, entry); loaded {
+		cancel(nil)
+		cancelTimeout()
+
+		return nil, nil, fmt.Errorf("request %s is already in flight", id)
+	}
+
+	w.Header().Set("X-Prism-Request-Id", id)
+
+	return ctx, func() {
+		s.requests.CompareAndDelete(id, entry)
+
+		cancel(nil)
+		cancelTimeout()
+	}, nil
+}
+
+// requestCanceled reports whether ctx was aborted via DELETE /requests/{id}.
+func requestCanceled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errRequestCanceled)
+}
+
+// handleRequestCancel handles DELETE /requests/{id}, tearing down the
+// upstream connection of an in-flight request.
+func (s *Server) handleRequestCancel(w http.ResponseWriter, r *http.Request) {
+	value, ok := s.requests.LoadAndDelete(r.PathValue("id"))
+
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	value.(*inflightRequest).cancel(errRequestCanceled)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,616 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// runStore is the store requests are run from by default.
+	runStore = "requests"
+
+	// maxRunIterations bounds the iterations of a run.
+	maxRunIterations = 10000
+
+	// runMaxBody is the largest response body kept per request.
+	runMaxBody = assertionsMaxBody
+)
+
+// runEntry is a stored request of a run.
+type runEntry struct {
+	id   string
+	name string
+
+	request *Request
+}
+
+// runRecorder captures the response of a request run through the proxy
+// handler, keeping up to runMaxBody of the body.
+type runRecorder struct {
+	header http.Header
+	status int
+
+	body bytes.Buffer
+	size int64
+}
+
+func (rec *runRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *runRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *runRecorder) Write(data []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+
+	rec.size += int64(len(data))
+
+	if room := runMaxBody - rec.body.Len(); room > 0 {
+		rec.body.Write(data[:min(len(data), room)])
+	}
+
+	return len(data), nil
+}
+
+// runEntries loads the requests of a run in order.
+func (s *Server) runEntries(ctx context.Context, store string, req *RunRequest) ([]runEntry, error) {
+	var entries []runEntry
+
+	load := func(id string) error {
+		var request Request
+
+		if err := loadEntry(ctx, store, id, &request); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("request %s not found", id)
+			}
+
+			return err
+		}
+
+		entries = append(entries, runEntry{id: id, name: request.Name, request: &request})
+		return nil
+	}
+
+	if len(req.IDs) > 0 {
+		for _, id := range req.IDs {
+			if !validName(id) {
+				return nil, fmt.Errorf("invalid id %q", id)
+			}
+
+			if err := load(id); err != nil {
+				return nil, err
+			}
+		}
+
+		return entries, nil
+	}
+
+	if req.Folder == nil {
+		return nil, errors.New("ids or folder is required")
+	}
+
+	index, err := loadFolderIndex(ctx, store)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var folders []string
+
+	if *req.Folder != "" {
+		if index.folder(*req.Folder) == nil {
+			return nil, errFolderNotFound
+		}
+
+		folders = index.descendants(*req.Folder)
+	}
+
+	stored, err := dataStore(ctx).List(store)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stat := range stored {
+		if !validName(stat.ID) {
+			continue
+		}
+
+		if folders != nil && !slices.Contains(folders, index.Entries[stat.ID]) {
+			continue
+		}
+
+		if err := load(stat.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// only HTTP requests can be run from a folder; other protocols are
+	// skipped rather than failed
+	entries = slices.DeleteFunc(entries, func(e runEntry) bool {
+		return e.request.HTTP == nil
+	})
+
+	slices.SortStableFunc(entries, func(a, b runEntry) int {
+		if c := strings.Compare(strings.ToLower(a.name), strings.ToLower(b.name)); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.id, b.id)
+	})
+
+	return entries, nil
+}
+
+// runDataRows loads the rows of the iteration data file of a run.
+func (s *Server) runDataRows(data *RunData) ([]map[string]string, error) {
+	var document []byte
+
+	switch {
+	case data.Document != "":
+		document = []byte(data.Document)
+
+	case data.Upload != "":
+		entry, err := s.lookupUpload(data.Upload)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if entry.Upload.Size > maxRunDataSize {
+			return nil, errors.New("data file too large")
+		}
+
+		if document, err = os.ReadFile(entry.Path); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, errors.New("data requires document or upload")
+	}
+
+	return parseRunData(document, data.Format)
+}
+
+// expandRequest substitutes variables in the URL, query, headers and body
+// of HTTP settings.
+func expandRequest(settings HTTPSettings, variables map[string]string) HTTPSettings {
+	expand := func(text string) string {
+		return expandVariables(text, variables, nil, nil)
+	}
+
+	expandPairs := func(pairs []KeyValue) []KeyValue {
+		result := slices.Clone(pairs)
+
+		for i := range result {
+			result[i].Key = expand(result[i].Key)
+			result[i].Value = expand(result[i].Value)
+		}
+
+		return result
+	}
+
+	settings.URL = expand(settings.URL)
+	settings.Query = expandPairs(settings.Query)
+	settings.Headers = expandPairs(settings.Headers)
+
+	settings.Body.Content = expand(settings.Body.Content)
+	settings.Body.Data = slices.Clone(settings.Body.Data)
+
+	for i := range settings.Body.Data {
+		settings.Body.Data[i].Key = expand(settings.Body.Data[i].Key)
+		settings.Body.Data[i].Value = expand(settings.Body.Data[i].Value)
+	}
+
+	return settings
+}
+
+// runProxyRequest turns stored HTTP settings into a request for the proxy
+// handler, so runs get the same treatment as requests sent by the UI.
+func runProxyRequest(ctx context.Context, settings *HTTPSettings, timeout string) (*http.Request, string, error) {
+	input, err := snippetInput(&Request{HTTP: settings})
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	target, err := url.Parse(input.URL)
+
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, input.URL, fmt.Errorf("invalid URL %q", input.URL)
+	}
+
+	if input.File != "" {
+		return nil, input.URL, errors.New("binary bodies cannot be run")
+	}
+
+	var body io.Reader = strings.NewReader(input.Body)
+
+	var contentType string
+
+	if len(input.Form) > 0 {
+		var buf bytes.Buffer
+
+		writer := multipart.NewWriter(&buf)
+
+		for _, field := range input.Form {
+			if field.File != "" {
+				return nil, input.URL, errors.New("file fields cannot be run")
+			}
+
+			writer.WriteField(field.Name, field.Value)
+		}
+
+		writer.Close()
+
+		body = &buf
+		contentType = writer.FormDataContentType()
+	}
+
+	proxyURL := "http://localhost/proxy/" + target.Scheme + "/" + target.Host + target.EscapedPath()
+
+	if target.RawQuery != "" {
+		proxyURL += "?" + target.RawQuery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, input.Method, proxyURL, body)
+
+	if err != nil {
+		return nil, input.URL, err
+	}
+
+	req.Host = "localhost"
+
+	// smuggled like the UI does, so Cookie, Host & co. reach the upstream
+	for _, h := range input.Headers {
+		req.Header.Add("X-Prism-Header-"+h.Name, h.Value)
+	}
+
+	if contentType != "" {
+		req.Header.Set("X-Prism-Header-Content-Type", contentType)
+	}
+
+	if input.Insecure {
+		req.Header.Set("X-Prism-Insecure", "true")
+	}
+
+	if input.FollowRedirects {
+		req.Header.Set("X-Prism-Redirect", "true")
+	}
+
+	if timeout != "" {
+		req.Header.Set("X-Prism-Timeout", timeout)
+	}
+
+	if settings.Options.NoDefaults {
+		req.Header.Set("X-Prism-Defaults", "false")
+	}
+
+	if settings.Script != "" {
+		req.Header.Set("X-Prism-Script", base64.StdEncoding.EncodeToString([]byte(settings.Script)))
+	}
+
+	return req, input.URL, nil
+}
+
+// runRequest sends one request of an iteration, checks its assertions and
+// stores the values it extracts into extracted.
+func (s *Server) runRequest(ctx context.Context, run *RunRequest, entry runEntry, variables, extracted map[string]string, timeout string) RunRequestResult {
+	result := RunRequestResult{
+		ID:   entry.id,
+		Name: entry.name,
+
+		Assertions: []AssertionResult{},
+	}
+
+	if entry.request.HTTP == nil {
+		result.Error = "only HTTP requests can be run"
+		return result
+	}
+
+	settings := expandRequest(*entry.request.HTTP, variables)
+	settings.URL = resolveBaseURL(settings.URL, variables)
+
+	result.Method = settings.Method
+	result.URL = settings.URL
+
+	if result.Method == "" {
+		result.Method = http.MethodGet
+	}
+
+	req, target, err := runProxyRequest(ctx, &settings, timeout)
+
+	if target != "" {
+		result.URL = target
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// an empty list still asks for the (empty) report
+	assertions := append([]Assertion{}, settings.Assertions...)
+	assertions = append(assertions, run.Assertions...)
+
+	data, err := json.Marshal(assertions)
+
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	req.Header.Set("X-Prism-Assert", string(data))
+
+	if run.Environment != "" {
+		req.Header.Set("X-Prism-Environment", run.Environment)
+	}
+
+	// the script reads the variables of the iteration; those it sets are
+	// handed on like extracted values
+	scope := &scriptScope{variables: variables, set: map[string]string{}}
+
+	req = req.WithContext(withScriptScope(req.Context(), scope))
+
+	rec := &runRecorder{header: http.Header{}}
+
+	start := time.Now()
+
+	s.api.ServeHTTP(rec, req)
+
+	maps.Copy(extracted, scope.set)
+
+	result.Duration = float64(time.Since(start).Microseconds()) / 1000
+
+	// only responses of the upstream carry the assertion report
+	report := rec.header.Get("X-Prism-Assertions")
+
+	if report == "" {
+		result.Error = strings.TrimSpace(rec.body.String())
+
+		var proxyErr ProxyError
+
+		if rec.header.Get("X-Prism-Error") != "" && json.Unmarshal(rec.body.Bytes(), &proxyErr) == nil {
+			result.Error = proxyErr.Message
+		}
+
+		if result.Error == "" {
+			result.Error = http.StatusText(rec.status)
+		}
+
+		return result
+	}
+
+	var assertionReport AssertionReport
+
+	if err := json.Unmarshal([]byte(report), &assertionReport); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = rec.status
+	result.Size = rec.size
+	result.Passed = assertionReport.Passed
+	result.Assertions = assertionReport.Results
+
+	if len(settings.Extract) > 0 {
+		response := &assertionResponse{
+			status: rec.status,
+			header: rec.header,
+		}
+
+		if rec.size <= runMaxBody && rec.header.Get("X-Prism-Truncated") == "" {
+			response.body = rec.body.Bytes()
+		}
+
+		result.Extracted = extractValues(settings.Extract, response)
+
+		for _, extraction := range result.Extracted {
+			if extraction.Found {
+				extracted[extraction.Variable] = extraction.Value
+			}
+		}
+	}
+
+	return result
+}
+
+// executeRun runs stored HTTP requests once per iteration with the
+// variables of env; timeout is passed on as X-Prism-Timeout of every
+// request. Errors are about the run itself: failed requests are part of
+// the result. With an id, the progress is published as run events.
+func (s *Server) executeRun(ctx context.Context, req *RunRequest, env *Environment, timeout, id string) (*RunResult, error) {
+	store := req.Store
+
+	if store == "" {
+		store = runStore
+	}
+
+	if !validName(store) {
+		return nil, errors.New("invalid store")
+	}
+
+	entries, err := s.runEntries(ctx, store, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]string
+
+	if req.Data != nil {
+		if rows, err = s.runDataRows(req.Data); err != nil {
+			return nil, err
+		}
+
+		if len(rows) == 0 {
+			return nil, errors.New("data has no rows")
+		}
+	}
+
+	iterations := max(req.Iterations, 1)
+
+	if rows != nil {
+		iterations = len(rows)
+	}
+
+	if iterations > maxRunIterations {
+		return nil, fmt.Errorf("at most %d iterations are allowed", maxRunIterations)
+	}
+
+	base, err := workspaceVariables(ctx, env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RunResult{
+		Results: []RunIteration{},
+	}
+
+	start := time.Now()
+
+	extracted := map[string]string{}
+
+	progress := RunEvent{
+		Run:   id,
+		Total: iterations * len(entries),
+	}
+
+	if id != "" {
+		s.events.publishIn(contextWorkspace(ctx), "run.started", progress)
+	}
+
+run:
+	for i := range iterations {
+		iteration := RunIteration{
+			Iteration: i + 1,
+
+			Requests: []RunRequestResult{},
+		}
+
+		if rows != nil {
+			iteration.Data = rows[i]
+		}
+
+		result.Iterations++
+
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				result.Results = append(result.Results, iteration)
+				break run
+			}
+
+			variables := maps.Clone(base)
+
+			maps.Copy(variables, extracted)
+
+			if rows != nil {
+				maps.Copy(variables, rows[i])
+			}
+
+			outcome := s.runRequest(ctx, req, entry, variables, extracted, timeout)
+
+			iteration.Requests = append(iteration.Requests, outcome)
+
+			result.Requests++
+
+			if outcome.Passed {
+				result.Passed++
+			} else {
+				result.Failed++
+			}
+
+			if id != "" {
+				progress.Completed = result.Requests
+				progress.Passed = result.Passed
+				progress.Failed = result.Failed
+				progress.Iteration = i + 1
+				progress.Result = &outcome
+
+				s.events.publishIn(contextWorkspace(ctx), "run.progress", progress)
+			}
+
+			if !outcome.Passed && req.StopOnFailure {
+				result.Results = append(result.Results, iteration)
+				break run
+			}
+		}
+
+		result.Results = append(result.Results, iteration)
+	}
+
+	result.Duration = float64(time.Since(start).Microseconds()) / 1000
+
+	if id != "" {
+		progress.Iteration = 0
+		progress.Result = nil
+
+		s.events.publishIn(contextWorkspace(ctx), "run.finished", progress)
+	}
+
+	return result, nil
+}
+
+// handleRun handles POST /runs, running stored HTTP requests once per
+// iteration. Failed requests are part of a successful result.
+// Request body: RunRequest
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	var req RunRequest
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRunDataSize+(1<<20))).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var env *Environment
+	var err error
+
+	if req.Environment != "" {
+		env, err = loadEnvironment(r.Context(), req.Environment)
+	} else {
+		env, err = requestEnvironment(r)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := s.requestContext(w, r, 0)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer cancel()
+
+	// the ID of the request, for cancelling it, names the run in its events
+	result, err := s.executeRun(ctx, &req, env, r.Header.Get("X-Prism-Timeout"), w.Header().Get("X-Prism-Request-Id"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
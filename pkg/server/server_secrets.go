@@ -0,0 +1,462 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// secretsMaxBody is the largest request body searched for secret
+// references; larger bodies (uploads) are sent unchanged.
+const secretsMaxBody = 1 << 20
+
+// secretRefRegex matches {{provider:ref}} references to stored secrets
+// ({{secret:name}}), the OS keychain ({{keychain:name}}) and the external
+// providers (see config.SecretsConfig), also percent-encoded as they
+// appear in URLs.
+var secretRefRegex = regexp.MustCompile(`(?:\{\{|%7[Bb]%7[Bb])\s*(secret|keychain|vault|op|env):([A-Za-z0-9_./#@% -]{1,256}?)\s*(?:\}\}|%7[Dd]%7[Dd])`)
+
+// secretsStatus lists the names of the stored secrets.
+func (s *Server) secretsStatus(ctx context.Context) (*SecretsStatus, error) {
+	vault, err := loadVault(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	status := &SecretsStatus{
+		Initialized: vault != nil,
+		Unlocked:    s.secretKeys[contextWorkspace(ctx)] != nil,
+
+		Secrets: []SecretInfo{},
+	}
+
+	if vault == nil {
+		return status, nil
+	}
+
+	for name, secret := range vault.Secrets {
+		status.Secrets = append(status.Secrets, SecretInfo{Name: name, Updated: secret.Updated})
+	}
+
+	slices.SortFunc(status.Secrets, func(a, b SecretInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return status, nil
+}
+
+// secret returns the value of a stored secret.
+func (s *Server) secret(ctx context.Context, name string) (string, error) {
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+
+	key := s.secretKeys[contextWorkspace(ctx)]
+
+	if key == nil {
+		return "", errSecretsLocked
+	}
+
+	vault, err := loadVault(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	if vault == nil {
+		return "", errSecretNotFound
+	}
+
+	return vault.get(key, name)
+}
+
+// resolveSecretRefs replaces the secret references in text with their
+// values, escaped for the context.
+func (s *Server) resolveSecretRefs(ctx context.Context, text string, escape func(string) string) (string, error) {
+	if !slices.ContainsFunc(secretProviders, func(provider string) bool {
+		return strings.Contains(text, provider+":")
+	}) {
+		return text, nil
+	}
+
+	var resolveErr error
+
+	result := secretRefRegex.ReplaceAllStringFunc(text, func(ref string) string {
+		match := secretRefRegex.FindStringSubmatch(ref)
+
+		value, err := s.secretValue(ctx, match[1], match[2])
+
+		if err != nil {
+			if resolveErr == nil {
+				resolveErr = fmt.Errorf("%s %s: %w", match[1], strings.TrimSpace(match[2]), err)
+			}
+
+			return ref
+		}
+
+		if escape != nil {
+			value = escape(value)
+		}
+
+		return value
+	})
+
+	return result, resolveErr
+}
+
+// secretValue resolves a single reference of a provider.
+func (s *Server) secretValue(ctx context.Context, provider, ref string) (string, error) {
+	name, err := unescapeSecretRef(ref)
+
+	if err != nil {
+		return "", err
+	}
+
+	switch provider {
+	case "secret", "keychain":
+		if !validName(name) {
+			return "", errors.New("invalid name")
+		}
+
+		if provider == "keychain" {
+			return s.userKeychain().get(name)
+		}
+
+		return s.secret(ctx, name)
+	}
+
+	return s.externalSecret(provider, name)
+}
+
+// applySecrets resolves the secret references in the URL, headers and
+// body of a request to be proxied.
+func (s *Server) applySecrets(r *http.Request) error {
+	var err error
+
+	if r.URL.Path, err = s.resolveSecretRefs(r.Context(), r.URL.Path, nil); err != nil {
+		return err
+	}
+
+	if r.URL.RawPath, err = s.resolveSecretRefs(r.Context(), r.URL.RawPath, url.PathEscape); err != nil {
+		return err
+	}
+
+	if r.URL.RawQuery, err = s.resolveSecretRefs(r.Context(), r.URL.RawQuery, url.QueryEscape); err != nil {
+		return err
+	}
+
+	for _, values := range r.Header {
+		for i, value := range values {
+			if values[i], err = s.resolveSecretRefs(r.Context(), value, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength > secretsMaxBody {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, secretsMaxBody+1))
+
+	if err != nil {
+		return err
+	}
+
+	if len(data) > secretsMaxBody {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+
+		return nil
+	}
+
+	r.Body.Close()
+
+	resolved, err := s.resolveSecretRefs(r.Context(), string(data), nil)
+
+	if err != nil {
+		return err
+	}
+
+	body := []byte(resolved)
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.TransferEncoding = nil
+	r.Header.Del("Transfer-Encoding")
+
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return nil
+}
+
+// handleSecretsStatus handles GET /secrets.
+func (s *Server) handleSecretsStatus(w http.ResponseWriter, r *http.Request) {
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+
+	writeSecretsStatus(r.Context(), w, s)
+}
+
+// handleSecretsUnlock handles POST /secrets/unlock. The first unlock
+// creates the store with the given passphrase.
+// Request body: SecretsUnlock
+func (s *Server) handleSecretsUnlock(w http.ResponseWriter, r *http.Request) {
+	var req SecretsUnlock
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+
+	vault, err := loadVault(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var key []byte
+
+	if vault == nil {
+		vault, key, err = newVault(req.Passphrase)
+
+		if err == nil {
+			err = saveVault(r.Context(), vault)
+		}
+	} else {
+		key, err = vault.unlock(req.Passphrase)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), secretStatus(err))
+		return
+	}
+
+	s.secretKeys[contextWorkspace(r.Context())] = key
+
+	writeSecretsStatus(r.Context(), w, s)
+}
+
+// handleSecretsLock handles POST /secrets/lock, forgetting the key.
+func (s *Server) handleSecretsLock(w http.ResponseWriter, r *http.Request) {
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+
+	workspace := contextWorkspace(r.Context())
+
+	clear(s.secretKeys[workspace])
+	delete(s.secretKeys, workspace)
+
+	writeSecretsStatus(r.Context(), w, s)
+}
+
+// handleSecretsPassphrase handles POST /secrets/passphrase, re-encrypting
+// all secrets under NewPassphrase.
+// Request body: SecretsUnlock
+func (s *Server) handleSecretsPassphrase(w http.ResponseWriter, r *http.Request) {
+	var req SecretsUnlock
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+
+	vault, err := loadVault(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if vault == nil {
+		http.Error(w, errSecretNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	key, err := vault.unlock(req.Passphrase)
+
+	if err != nil {
+		http.Error(w, err.Error(), secretStatus(err))
+		return
+	}
+
+	next, nextKey, err := newVault(req.NewPassphrase)
+
+	if err != nil {
+		http.Error(w, err.Error(), secretStatus(err))
+		return
+	}
+
+	for name, secret := range vault.Secrets {
+		value, err := vault.get(key, name)
+
+		if err != nil {
+			http.Error(w, fmt.Sprintf("secret %s: %v", name, err), http.StatusInternalServerError)
+			return
+		}
+
+		if err := next.set(nextKey, name, value); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		sealed := next.Secrets[name]
+		sealed.Updated = secret.Updated
+		next.Secrets[name] = sealed
+	}
+
+	if err := saveVault(r.Context(), next); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.secretKeys[contextWorkspace(r.Context())] = nextKey
+
+	writeSecretsStatus(r.Context(), w, s)
+}
+
+// handleSecretPut handles PUT /secrets/{name}; the store must be unlocked.
+// Request body: SecretValue
+func (s *Server) handleSecretPut(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if !validName(name) {
+		http.Error(w, "invalid secret name", http.StatusBadRequest)
+		return
+	}
+
+	var req SecretValue
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+
+	key := s.secretKeys[contextWorkspace(r.Context())]
+
+	if key == nil {
+		http.Error(w, errSecretsLocked.Error(), http.StatusLocked)
+		return
+	}
+
+	vault, err := loadVault(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if vault == nil {
+		http.Error(w, errSecretsLocked.Error(), http.StatusLocked)
+		return
+	}
+
+	if err := vault.set(key, name, req.Value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := saveVault(r.Context(), vault); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.scheduleGitCommit(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SecretInfo{Name: name, Updated: vault.Secrets[name].Updated})
+}
+
+// handleSecretDelete handles DELETE /secrets/{name}, which works while
+// locked too.
+func (s *Server) handleSecretDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if !validName(name) {
+		http.Error(w, "invalid secret name", http.StatusBadRequest)
+		return
+	}
+
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+
+	vault, err := loadVault(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if vault == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if _, ok := vault.Secrets[name]; !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	delete(vault.Secrets, name)
+
+	if err := saveVault(r.Context(), vault); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.scheduleGitCommit(r.Context())
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeSecretsStatus responds with the store status; s.secretsMu must be
+// held.
+func writeSecretsStatus(ctx context.Context, w http.ResponseWriter, s *Server) {
+	status, err := s.secretsStatus(ctx)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// secretStatus is the HTTP status of a failed secrets operation.
+func secretStatus(err error) int {
+	switch {
+	case errors.Is(err, errSecretsLocked):
+		return http.StatusLocked
+	case errors.Is(err, errWrongPassphrase):
+		return http.StatusForbidden
+	case errors.Is(err, errEmptyPassphrase), errors.Is(err, errSecretNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, errKeychainUnavailable):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+)
+
+// handleSend handles POST /send, sending a stored request or ad-hoc HTTP
+// settings through the proxy with the variables of an environment, like a
+// run does. The response is the one of the proxy: that of the upstream
+// with X-Prism-Assertions reporting the assertions of the request, or an
+// error without it.
+// Request body: SendRequest
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req SendRequest
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRunDataSize)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var env *Environment
+	var err error
+
+	if req.Environment != "" {
+		env, err = findEnvironment(r.Context(), req.Environment)
+	} else {
+		env, err = requestEnvironment(r)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var settings HTTPSettings
+
+	switch {
+	case req.ID != "":
+		store := cmp.Or(req.Store, runStore)
+
+		if !validName(store) {
+			http.Error(w, "invalid store", http.StatusBadRequest)
+			return
+		}
+
+		id, err := findEntry(r.Context(), store, req.ID)
+
+		if err != nil {
+			http.Error(w, "request "+req.ID+": "+err.Error(), http.StatusNotFound)
+			return
+		}
+
+		var request Request
+
+		if err := loadEntry(r.Context(), store, id, &request); err != nil {
+			code := http.StatusInternalServerError
+
+			if errors.Is(err, os.ErrNotExist) {
+				code = http.StatusNotFound
+			}
+
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		if request.HTTP == nil {
+			http.Error(w, "only HTTP requests can be sent", http.StatusBadRequest)
+			return
+		}
+
+		settings = *request.HTTP
+
+	case req.HTTP != nil:
+		settings = *req.HTTP
+
+	default:
+		http.Error(w, "id or http is required", http.StatusBadRequest)
+		return
+	}
+
+	variables, err := workspaceVariables(r.Context(), env)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	settings = expandRequest(settings, variables)
+	settings.URL = resolveBaseURL(settings.URL, variables)
+
+	proxyReq, _, err := runProxyRequest(r.Context(), &settings, r.Header.Get("X-Prism-Timeout"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// an empty list still asks for the (empty) report
+	assertions, err := json.Marshal(append([]Assertion{}, settings.Assertions...))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	proxyReq.Header.Set("X-Prism-Assert", string(assertions))
+
+	if env != nil {
+		proxyReq.Header.Set("X-Prism-Environment", env.ID)
+	}
+
+	s.api.ServeHTTP(w, proxyReq)
+}
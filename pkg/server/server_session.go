@@ -0,0 +1,108 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// sessionHeader carries the session token for clients that cannot rely on
+// the cookie.
+const sessionHeader = "X-Prism-Session"
+
+// requireSession keeps other web pages away from the API, where they could
+// use the proxy as a trampoline into the network of the user: browser
+// requests must come from the origin of the UI and carry the session token,
+// which is issued as cookie with the UI and /config.json. SameSite keeps
+// other sites from sending the cookie; the origin check covers pages on
+// other ports of the same host. Clients without Origin and Sec-Fetch-Site
+// headers are not browsers and remain allowed.
+func (s *Server) requireSession(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch _, pattern := mux.Handler(r); pattern {
+		case "/", "GET /config.json":
+			s.issueSession(w, r)
+
+			next.ServeHTTP(w, r)
+			return
+
+		case "GET /oauth2/callback":
+			// identity providers redirect here from their own site
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Origin") == "" && r.Header.Get("Sec-Fetch-Site") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request", http.StatusForbidden)
+			return
+		}
+
+		if !s.validSession(r) {
+			http.Error(w, "missing or invalid session", http.StatusForbidden)
+			return
+		}
+
+		removeCookie(r, sessionCookie(r))
+		r.Header.Del(sessionHeader)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// issueSession sets the session cookie unless the request carries it.
+func (s *Server) issueSession(w http.ResponseWriter, r *http.Request) {
+	if s.validSession(r) {
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:  sessionCookie(r),
+		Value: s.session,
+		Path:  "/",
+
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func (s *Server) validSession(r *http.Request) bool {
+	value := r.Header.Get(sessionHeader)
+
+	if cookie, err := r.Cookie(sessionCookie(r)); err == nil && value == "" {
+		value = cookie.Value
+	}
+
+	return value != "" && subtle.ConstantTimeCompare([]byte(value), []byte(s.session)) == 1
+}
+
+// sessionCookie is the name of the session cookie. Cookies ignore ports,
+// so the port keeps servers on the same host apart.
+func sessionCookie(r *http.Request) string {
+	if _, port, err := net.SplitHostPort(r.Host); err == nil && port != "" {
+		return "prism_session_" + port
+	}
+
+	return "prism_session"
+}
+
+// sameOrigin tells whether a browser request comes from a page of the
+// server itself, by Sec-Fetch-Site or else by Origin.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+
+	case "":
+		origin, err := url.Parse(r.Header.Get("Origin"))
+		return err == nil && origin.Host == r.Host
+	}
+
+	return false
+}
@@ -0,0 +1,777 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// gitCommitDelay batches data changes into one auto-commit.
+	gitCommitDelay = 5 * time.Second
+
+	// gitTimeout bounds a single git command, including network access.
+	gitTimeout = 2 * time.Minute
+)
+
+// gitIgnore keeps credentials and temp files out of the repository.
+var gitIgnore = strings.Join([]string{
+	"# written by Prism",
+	"/" + oauth2Store + "/",
+	"/" + oauth2TokenDir + "/",
+	"/" + tlsStore + "/",
+	"/" + certDir + "/",
+	"/" + workspacesDir + "/",
+	"/" + remoteSyncFile,
+	"/" + activeEnvironmentFile,
+	"/" + monitorHistoryDir + "/",
+	"/" + auditDir + "/",
+	"/" + sqliteStoreFile + "*",
+	"/prism.yaml",
+	"/prism.yml",
+	"/prism.json",
+	"*.tmp-*",
+	"",
+}, "\n")
+
+// gitProtocols are the transports git may use (GIT_ALLOW_PROTOCOL); file
+// covers local remotes, which checkGitRemote refuses in remote mode.
+const gitProtocols = "https:ssh:file"
+
+var errGitNotInitialized = errors.New("data directory is not a git repository")
+
+var errGitRemote = errors.New("invalid git remote: use https or ssh")
+
+// gitError is a failed git command with its output.
+type gitError struct {
+	args   []string
+	output string
+}
+
+func (e *gitError) Error() string {
+	command := e.args[0]
+
+	// skip -c options
+	for i := 0; i+2 < len(e.args) && e.args[i] == "-c"; i += 2 {
+		command = e.args[i+2]
+	}
+
+	return "git " + command + ": " + e.output
+}
+
+// runGit runs git in the data directory. Prompts are disabled, so remotes
+// must be reachable with configured credentials (helper, SSH agent).
+func runGit(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = getDataDir(ctx)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "GIT_ALLOW_PROTOCOL="+gitProtocols, "LC_ALL=C")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", errors.New("git is not installed")
+		}
+
+		output := strings.TrimSpace(stderr.String())
+
+		if output == "" {
+			output = strings.TrimSpace(stdout.String())
+		}
+
+		if output == "" {
+			output = err.Error()
+		}
+
+		return stdout.String(), &gitError{args: args, output: output}
+	}
+
+	return stdout.String(), nil
+}
+
+func gitInitialized(ctx context.Context) bool {
+	_, err := os.Stat(filepath.Join(getDataDir(ctx), ".git"))
+	return err == nil
+}
+
+// gitMerging reports whether a conflicted merge awaits resolution.
+func gitMerging(ctx context.Context) bool {
+	_, err := os.Stat(filepath.Join(getDataDir(ctx), ".git", "MERGE_HEAD"))
+	return err == nil
+}
+
+// gitAutoCommit reports whether auto-commit is enabled, which is kept in
+// the repository config as prism.autocommit.
+func gitAutoCommit(ctx context.Context) bool {
+	value, _ := runGit(ctx, "config", "--bool", "prism.autocommit")
+	return strings.TrimSpace(value) == "true"
+}
+
+// gitIdentity returns the options setting a Prism identity for commands
+// creating commits when no git identity is configured.
+func gitIdentity(ctx context.Context) []string {
+	if email, _ := runGit(ctx, "config", "user.email"); strings.TrimSpace(email) != "" {
+		return nil
+	}
+
+	return []string{"-c", "user.name=Prism", "-c", "user.email=prism@localhost"}
+}
+
+// gitCommitAll commits all changes of the data directory and reports
+// whether there was anything to commit.
+func gitCommitAll(ctx context.Context, message string) (bool, error) {
+	if _, err := runGit(ctx, "add", "-A"); err != nil {
+		return false, err
+	}
+
+	// exit code 1: staged changes
+	if _, err := runGit(ctx, "diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+
+	args := append(gitIdentity(ctx), "commit", "--no-verify", "-m", message)
+
+	if _, err := runGit(ctx, args...); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// gitConfigure applies settings to the repository.
+func gitConfigure(ctx context.Context, settings GitSyncSettings) error {
+	if settings.AutoCommit != nil {
+		if _, err := runGit(ctx, "config", "--bool", "prism.autocommit", strconv.FormatBool(*settings.AutoCommit)); err != nil {
+			return err
+		}
+	}
+
+	if settings.Remote != nil {
+		runGit(ctx, "remote", "remove", "origin")
+
+		if *settings.Remote != "" {
+			if _, err := runGit(ctx, "remote", "add", "origin", *settings.Remote); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseGitRemote returns the transport of a git remote, https, ssh or file
+// for local paths, and its host (host:port) unless local.
+func parseGitRemote(remote string) (string, string, error) {
+	// a leading dash would be read as an option
+	if remote == "" || strings.HasPrefix(remote, "-") {
+		return "", "", errGitRemote
+	}
+
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+
+		if err != nil {
+			return "", "", errGitRemote
+		}
+
+		port := u.Port()
+
+		switch u.Scheme {
+		case "file":
+			return "file", "", nil
+		case "https":
+			if port == "" {
+				port = "443"
+			}
+		case "ssh":
+			if port == "" {
+				port = "22"
+			}
+		default:
+			return "", "", errGitRemote
+		}
+
+		if host := u.Hostname(); host != "" && !strings.HasPrefix(host, "-") {
+			return u.Scheme, net.JoinHostPort(host, port), nil
+		}
+
+		return "", "", errGitRemote
+	}
+
+	// scp-like [user@]host:path has a colon before any slash
+	if i := strings.IndexAny(remote, ":/"); i >= 0 && remote[i] == ':' {
+		host := remote[:i]
+
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+
+		// transport::address runs a remote helper
+		if host == "" || strings.HasPrefix(host, "-") || strings.ContainsAny(host, "[]") || strings.HasPrefix(remote[i:], "::") {
+			return "", "", errGitRemote
+		}
+
+		return "ssh", net.JoinHostPort(host, "22"), nil
+	}
+
+	return "file", "", nil
+}
+
+// checkGitRemote fails unless git may reach remote: https and ssh remotes
+// whose host the target rules allow, or local paths unless the server
+// serves other machines or users.
+func (s *Server) checkGitRemote(ctx context.Context, remote string) error {
+	scheme, host, err := parseGitRemote(remote)
+
+	if err != nil {
+		return err
+	}
+
+	if scheme == "file" {
+		if cfg := s.config.Load(); cfg.Remote || cfg.User != "" {
+			return errGitRemote
+		}
+
+		return nil
+	}
+
+	return s.checkTarget(ctx, scheme, host, s.baseUpstreamOptions())
+}
+
+// checkGitOrigin checks the origin remote, which may have been added before
+// the current rules, before git reaches it.
+func (s *Server) checkGitOrigin(ctx context.Context) error {
+	remote, err := runGit(ctx, "remote", "get-url", "origin")
+
+	// without origin, git fails on its own
+	if err != nil {
+		return nil
+	}
+
+	return s.checkGitRemote(ctx, strings.TrimSpace(remote))
+}
+
+// gitRemoteStatus is the status of a refused git remote: forbidden for
+// denied targets, else bad request.
+func gitRemoteStatus(err error) int {
+	if errors.Is(err, errTargetDenied) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusBadRequest
+}
+
+// gitStatus reads the repository state.
+func gitStatus(ctx context.Context) (*GitSyncStatus, error) {
+	status := &GitSyncStatus{
+		Changes:   []GitChange{},
+		Conflicts: []string{},
+	}
+
+	if !gitInitialized(ctx) {
+		return status, nil
+	}
+
+	status.Initialized = true
+	status.AutoCommit = gitAutoCommit(ctx)
+
+	if remote, err := runGit(ctx, "remote", "get-url", "origin"); err == nil {
+		status.Remote = strings.TrimSpace(remote)
+	}
+
+	output, err := runGit(ctx, "status", "--porcelain=v2", "--branch", "--untracked-files=all")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for line := range strings.Lines(output) {
+		line = strings.TrimSuffix(line, "\n")
+
+		if header, ok := strings.CutPrefix(line, "# "); ok {
+			key, value, _ := strings.Cut(header, " ")
+
+			switch key {
+			case "branch.head":
+				status.Branch = value
+			case "branch.upstream":
+				status.Upstream = value
+			case "branch.ab":
+				fmt.Sscanf(value, "+%d -%d", &status.Ahead, &status.Behind)
+			}
+
+			continue
+		}
+
+		if change, conflict, ok := parseGitStatusLine(line); ok {
+			if conflict {
+				status.Conflicts = append(status.Conflicts, change.Path)
+			} else {
+				status.Changes = append(status.Changes, change)
+			}
+		}
+	}
+
+	if output, err := runGit(ctx, "log", "-1", "--format=%H%x00%cI%x00%s"); err == nil {
+		parts := strings.SplitN(strings.TrimSpace(output), "\x00", 3)
+
+		if len(parts) == 3 {
+			commit := &GitCommit{Hash: parts[0], Message: parts[2]}
+			commit.Time, _ = time.Parse(time.RFC3339, parts[1])
+
+			status.LastCommit = commit
+		}
+	}
+
+	return status, nil
+}
+
+// parseGitStatusLine parses an entry of git status --porcelain=v2.
+func parseGitStatusLine(line string) (GitChange, bool, bool) {
+	kind, rest, _ := strings.Cut(line, " ")
+
+	switch kind {
+	case "?":
+		return GitChange{Path: rest, Status: "untracked"}, false, true
+
+	case "u":
+		// u XY sub m1 m2 m3 mW h1 h2 h3 path
+		if parts := strings.SplitN(rest, " ", 10); len(parts) == 10 {
+			return GitChange{Path: parts[9]}, true, true
+		}
+
+	case "1", "2":
+		// 1 XY sub mH mI mW hH hI path
+		// 2 XY sub mH mI mW hH hI Xscore path\torigPath
+		n := 8
+
+		if kind == "2" {
+			n = 9
+		}
+
+		parts := strings.SplitN(rest, " ", n)
+
+		if len(parts) != n {
+			break
+		}
+
+		path, _, _ := strings.Cut(parts[n-1], "\t")
+
+		return GitChange{Path: path, Status: gitChangeStatus(parts[0])}, false, true
+	}
+
+	return GitChange{}, false, false
+}
+
+func gitChangeStatus(xy string) string {
+	for _, c := range xy {
+		switch c {
+		case 'A':
+			return "added"
+		case 'D':
+			return "deleted"
+		case 'R', 'C':
+			return "renamed"
+		}
+	}
+
+	return "modified"
+}
+
+// scheduleGitCommit auto-commits data changes after gitCommitDelay, so a
+// burst of writes ends up in one commit.
+func (s *Server) scheduleGitCommit(ctx context.Context) {
+	if !fileStores() || !gitInitialized(ctx) {
+		return
+	}
+
+	workspace := contextWorkspace(ctx)
+
+	s.gitTimerMu.Lock()
+	defer s.gitTimerMu.Unlock()
+
+	if timer := s.gitTimers[workspace]; timer != nil {
+		timer.Reset(gitCommitDelay)
+		return
+	}
+
+	s.gitTimers[workspace] = time.AfterFunc(gitCommitDelay, func() {
+		s.commitPending(workspace)
+	})
+}
+
+// flushGitCommit runs the scheduled auto-commits right away, so changes
+// made just before shutdown are committed.
+func (s *Server) flushGitCommit() {
+	var pending []string
+
+	s.gitTimerMu.Lock()
+
+	for workspace, timer := range s.gitTimers {
+		if timer.Stop() {
+			pending = append(pending, workspace)
+		}
+	}
+
+	s.gitTimerMu.Unlock()
+
+	for _, workspace := range pending {
+		s.commitPending(workspace)
+	}
+}
+
+func (s *Server) commitPending(workspace string) {
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+
+	ctx := workspaceContext(context.Background(), workspace)
+
+	// conflicts are resolved by an explicit commit
+	if !gitInitialized(ctx) || gitMerging(ctx) || !gitAutoCommit(ctx) {
+		return
+	}
+
+	if _, err := gitCommitAll(ctx, "Update workspace"); err != nil {
+		s.logger.Warn("git auto-commit failed", "error", err)
+	}
+}
+
+// handleGitStatus handles GET /sync/git; with ?fetch=true the remote is
+// fetched first so Ahead and Behind are current.
+func (s *Server) handleGitStatus(w http.ResponseWriter, r *http.Request) {
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+
+	if r.URL.Query().Get("fetch") == "true" && gitInitialized(r.Context()) {
+		if err := s.checkGitOrigin(r.Context()); err != nil {
+			http.Error(w, err.Error(), gitRemoteStatus(err))
+			return
+		}
+
+		if _, err := runGit(r.Context(), "fetch", "--prune", "origin"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	writeGitStatus(w, r, http.StatusOK)
+}
+
+// handleGitInit handles POST /sync/git/init, turning the data directory
+// into a git repository.
+// Request body: GitSyncSettings
+func (s *Server) handleGitInit(w http.ResponseWriter, r *http.Request) {
+	if !requireFileStorage(w) {
+		return
+	}
+
+	var req GitSyncSettings
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Remote != nil && *req.Remote != "" {
+		if err := s.checkGitRemote(r.Context(), *req.Remote); err != nil {
+			http.Error(w, err.Error(), gitRemoteStatus(err))
+			return
+		}
+	}
+
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+
+	if gitInitialized(r.Context()) {
+		http.Error(w, "data directory is already a git repository", http.StatusConflict)
+		return
+	}
+
+	if err := os.MkdirAll(getDataDir(r.Context()), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := runGit(r.Context(), "init"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ignoreFile := filepath.Join(getDataDir(r.Context()), ".gitignore")
+
+	if _, err := os.Stat(ignoreFile); os.IsNotExist(err) {
+		if err := writeFileAtomic(ignoreFile, []byte(gitIgnore), 0644); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := gitConfigure(r.Context(), req); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := gitCommitAll(r.Context(), "Initialize workspace"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeGitStatus(w, r, http.StatusCreated)
+}
+
+// handleGitClone handles POST /sync/git/clone. The data directory must be
+// empty or missing.
+// Request body: GitCloneRequest
+func (s *Server) handleGitClone(w http.ResponseWriter, r *http.Request) {
+	if !requireFileStorage(w) {
+		return
+	}
+
+	var req GitCloneRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.checkGitRemote(r.Context(), req.URL); err != nil {
+		http.Error(w, err.Error(), gitRemoteStatus(err))
+		return
+	}
+
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+
+	root := getDataDir(r.Context())
+
+	if entries, err := os.ReadDir(root); err == nil && len(entries) > 0 {
+		http.Error(w, "data directory is not empty", http.StatusConflict)
+		return
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := runGit(r.Context(), "clone", "--", req.URL, "."); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	s.publishDataChange(r.Context(), "", "", "reloaded")
+
+	writeGitStatus(w, r, http.StatusCreated)
+}
+
+// handleGitUpdate handles PATCH /sync/git.
+// Request body: GitSyncSettings
+func (s *Server) handleGitUpdate(w http.ResponseWriter, r *http.Request) {
+	var req GitSyncSettings
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Remote != nil && *req.Remote != "" {
+		if err := s.checkGitRemote(r.Context(), *req.Remote); err != nil {
+			http.Error(w, err.Error(), gitRemoteStatus(err))
+			return
+		}
+	}
+
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+
+	if !gitInitialized(r.Context()) {
+		http.Error(w, errGitNotInitialized.Error(), http.StatusConflict)
+		return
+	}
+
+	if err := gitConfigure(r.Context(), req); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeGitStatus(w, r, http.StatusOK)
+}
+
+// handleGitCommit handles POST /sync/git/commit, committing all changes.
+// Request body: GitCommitRequest
+func (s *Server) handleGitCommit(w http.ResponseWriter, r *http.Request) {
+	if !requireFileStorage(w) {
+		return
+	}
+
+	var req GitCommitRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Message == "" {
+		req.Message = "Update workspace"
+	}
+
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+
+	if !gitInitialized(r.Context()) {
+		http.Error(w, errGitNotInitialized.Error(), http.StatusConflict)
+		return
+	}
+
+	if _, err := gitCommitAll(r.Context(), req.Message); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeGitStatus(w, r, http.StatusOK)
+}
+
+// handleGitPull handles POST /sync/git/pull. Local changes are committed
+// first, then the remote branch is merged. A merge conflict responds 409
+// with the status listing the conflicting files, which stay in the merge
+// until resolved and committed or until POST /sync/git/abort.
+func (s *Server) handleGitPull(w http.ResponseWriter, r *http.Request) {
+	if !requireFileStorage(w) {
+		return
+	}
+
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+
+	if !gitInitialized(r.Context()) {
+		http.Error(w, errGitNotInitialized.Error(), http.StatusConflict)
+		return
+	}
+
+	if err := s.checkGitOrigin(r.Context()); err != nil {
+		http.Error(w, err.Error(), gitRemoteStatus(err))
+		return
+	}
+
+	if _, err := gitCommitAll(r.Context(), "Update workspace"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	args := append(gitIdentity(r.Context()), "pull", "--no-rebase", "--no-edit", "--allow-unrelated-histories", "origin")
+
+	// a fresh repository has no upstream yet
+	if _, err := runGit(r.Context(), "rev-parse", "--abbrev-ref", "@{upstream}"); err != nil {
+		if branch, err := runGit(r.Context(), "branch", "--show-current"); err == nil {
+			args = append(args, strings.TrimSpace(branch))
+		}
+	}
+
+	if _, err := runGit(r.Context(), args...); err != nil {
+		status, statusErr := gitStatus(r.Context())
+
+		if statusErr == nil && len(status.Conflicts) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(status)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	s.publishDataChange(r.Context(), "", "", "reloaded")
+
+	writeGitStatus(w, r, http.StatusOK)
+}
+
+// handleGitPush handles POST /sync/git/push, committing local changes and
+// pushing the current branch. A push rejected because the remote moved on
+// responds 409; pull first.
+func (s *Server) handleGitPush(w http.ResponseWriter, r *http.Request) {
+	if !requireFileStorage(w) {
+		return
+	}
+
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+
+	if !gitInitialized(r.Context()) {
+		http.Error(w, errGitNotInitialized.Error(), http.StatusConflict)
+		return
+	}
+
+	if err := s.checkGitOrigin(r.Context()); err != nil {
+		http.Error(w, err.Error(), gitRemoteStatus(err))
+		return
+	}
+
+	if _, err := gitCommitAll(r.Context(), "Update workspace"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := runGit(r.Context(), "push", "--set-upstream", "origin", "HEAD"); err != nil {
+		status := http.StatusBadGateway
+
+		if strings.Contains(err.Error(), "[rejected]") {
+			status = http.StatusConflict
+		}
+
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	writeGitStatus(w, r, http.StatusOK)
+}
+
+// handleGitAbort handles POST /sync/git/abort, abandoning a conflicted
+// merge.
+func (s *Server) handleGitAbort(w http.ResponseWriter, r *http.Request) {
+	s.gitMu.Lock()
+	defer s.gitMu.Unlock()
+
+	if !gitInitialized(r.Context()) {
+		http.Error(w, errGitNotInitialized.Error(), http.StatusConflict)
+		return
+	}
+
+	if _, err := runGit(r.Context(), "merge", "--abort"); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	s.publishDataChange(r.Context(), "", "", "reloaded")
+
+	writeGitStatus(w, r, http.StatusOK)
+}
+
+func writeGitStatus(w http.ResponseWriter, r *http.Request, code int) {
+	status, err := gitStatus(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+func TestParseGitRemote(t *testing.T) {
+	tests := []struct {
+		remote string
+		scheme string
+		host   string
+		valid  bool
+	}{
+		{"https://github.com/org/repo.git", "https", "github.com:443", true},
+		{"https://git.example.com:8443/repo.git", "https", "git.example.com:8443", true},
+		{"ssh://git@github.com/org/repo.git", "ssh", "github.com:22", true},
+		{"ssh://git@[::1]:2222/repo.git", "ssh", "[::1]:2222", true},
+		{"git@github.com:org/repo.git", "ssh", "github.com:22", true},
+		{"github.com:org/repo.git", "ssh", "github.com:22", true},
+		{"/srv/git/repo.git", "file", "", true},
+		{"../repo", "file", "", true},
+		{"file:///srv/git/repo.git", "file", "", true},
+		{"", "", "", false},
+		{"--upload-pack=touch /tmp/x", "", "", false},
+		{"http://github.com/org/repo.git", "", "", false},
+		{"git://github.com/org/repo.git", "", "", false},
+		{"ext::sh -c touch% /tmp/x", "", "", false},
+		{"fd::17", "", "", false},
+		{"ssh://-oProxyCommand=touch/repo", "", "", false},
+		{"-oProxyCommand=touch:repo", "", "", false},
+		{"git@-oProxyCommand=touch:repo", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.remote, func(t *testing.T) {
+			scheme, host, err := parseGitRemote(test.remote)
+
+			if valid := err == nil; valid != test.valid {
+				t.Fatalf("parseGitRemote(%q) = %v, want valid %v", test.remote, err, test.valid)
+			}
+
+			if scheme != test.scheme || host != test.host {
+				t.Errorf("parseGitRemote(%q) = %s %s, want %s %s", test.remote, scheme, host, test.scheme, test.host)
+			}
+		})
+	}
+}
+
+func TestCheckGitRemote(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    *config.Config
+		remote string
+		err    error
+	}{
+		{"local path", &config.Config{}, "/srv/git/repo.git", nil},
+		{"local path remote", &config.Config{Remote: true}, "/srv/git/repo.git", errGitRemote},
+		{"file url multi-user", &config.Config{User: "alice"}, "file:///srv/git/repo.git", errGitRemote},
+		{"public", &config.Config{Remote: true}, "https://93.184.215.14/repo.git", nil},
+		{"private", &config.Config{Remote: true}, "ssh://git@10.0.0.1/repo.git", errTargetDenied},
+		{"denied name", &config.Config{DenyTargets: targetRules(t, "git.internal")}, "git@git.internal:repo.git", errTargetDenied},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := targetServer(test.cfg).checkGitRemote(context.Background(), test.remote)
+
+			if test.err == nil && err != nil || test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("checkGitRemote(%q) = %v, want %v", test.remote, err, test.err)
+			}
+		})
+	}
+}
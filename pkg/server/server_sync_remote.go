@@ -0,0 +1,662 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// remoteSyncFile keeps the remote sync configuration and what was synced
+// last, next to the data stores but never synced itself.
+const remoteSyncFile = ".remote-sync.json"
+
+var errRemoteNotConfigured = errors.New("remote sync is not configured")
+
+type remoteSyncState struct {
+	Config *RemoteSyncConfig `json:"config,omitempty"`
+
+	LastSync *time.Time `json:"lastSync,omitempty"`
+
+	// content hash and remote revision of every file as of the last sync
+	Files map[string]remoteSyncEntry `json:"files"`
+}
+
+type remoteSyncEntry struct {
+	Hash     string `json:"hash"`
+	Revision string `json:"revision"`
+}
+
+func loadRemoteSyncState(ctx context.Context) (*remoteSyncState, error) {
+	state := &remoteSyncState{
+		Files: map[string]remoteSyncEntry{},
+	}
+
+	data, err := os.ReadFile(filepath.Join(getDataDir(ctx), remoteSyncFile))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+
+	if state.Files == nil {
+		state.Files = map[string]remoteSyncEntry{}
+	}
+
+	return state, nil
+}
+
+func saveRemoteSyncState(ctx context.Context, state *remoteSyncState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(getDataDir(ctx), 0755); err != nil {
+		return err
+	}
+
+	// holds literal credentials
+	return writeFileAtomic(filepath.Join(getDataDir(ctx), remoteSyncFile), data, 0600)
+}
+
+// remoteSyncPath reports whether a slash-separated path relative to the
+// data directory is synced: the files of the stores that belong in a
+// workspace, and the (encrypted) secrets. OAuth2 tokens and TLS material
+// stay on the machine.
+func remoteSyncPath(name string) bool {
+	if name == secretsFile {
+		return true
+	}
+
+	store, file, ok := strings.Cut(name, "/")
+
+	if !ok || !validName(store) || store == oauth2Store || store == tlsStore {
+		return false
+	}
+
+	return workspaceFile(file)
+}
+
+// localSyncFiles returns the content hash of every synced file.
+func localSyncFiles(ctx context.Context) (map[string]string, error) {
+	files := map[string]string{}
+
+	root := getDataDir(ctx)
+
+	if data, err := os.ReadFile(filepath.Join(root, secretsFile)); err == nil {
+		files[secretsFile] = contentHash(data)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	stores, err := os.ReadDir(root)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+
+		return nil, err
+	}
+
+	for _, store := range stores {
+		if !store.IsDir() {
+			continue
+		}
+
+		entries, err := os.ReadDir(filepath.Join(root, store.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			name := store.Name() + "/" + entry.Name()
+
+			if entry.IsDir() || !remoteSyncPath(name) {
+				continue
+			}
+
+			data, err := os.ReadFile(filepath.Join(root, store.Name(), entry.Name()))
+
+			if err != nil {
+				return nil, err
+			}
+
+			files[name] = contentHash(data)
+		}
+	}
+
+	return files, nil
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeSyncedFile writes a pulled file, or removes it when data is nil,
+// holding the lock its regular writers hold.
+func (s *Server) writeSyncedFile(ctx context.Context, name string, data []byte) error {
+	target := filepath.Join(getDataDir(ctx), filepath.FromSlash(name))
+
+	switch store, file, _ := strings.Cut(name, "/"); {
+	case name == secretsFile:
+		s.secretsMu.Lock()
+		defer s.secretsMu.Unlock()
+
+	case file == folderIndexFile:
+		s.foldersMu.Lock()
+		defer s.foldersMu.Unlock()
+
+	case file == metaIndexFile:
+		s.metaMu.Lock()
+		defer s.metaMu.Unlock()
+
+	default:
+		unlock := lockEntry(store, strings.TrimSuffix(file, ".json"))
+		defer unlock()
+	}
+
+	if data == nil {
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	perm := os.FileMode(0644)
+
+	if name == secretsFile {
+		perm = 0600
+	}
+
+	return writeFileAtomic(target, data, perm)
+}
+
+// remoteSyncProvider connects to the configured remote, resolving secret
+// references in the credentials.
+func (s *Server) remoteSyncProvider(ctx context.Context, config *RemoteSyncConfig) (syncProvider, error) {
+	username, err := s.resolveSecretRefs(ctx, config.Username, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := s.resolveSecretRefs(ctx, config.Password, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := s.targetClient(s.baseUpstreamOptions(), 0)
+
+	switch config.Provider {
+	case "webdav":
+		return newWebDAVProvider(client, config.URL, username, password)
+
+	case "s3":
+		return newS3Provider(client, config.URL, config.Bucket, config.Region, config.Prefix, username, password)
+	}
+
+	return nil, errors.New("provider must be webdav or s3")
+}
+
+// remoteSyncPush uploads the files changed locally since the last sync and
+// deletes the ones deleted locally. Files also changed remotely are
+// conflicts, unless forced or the contents match. Remote changes of
+// files unchanged locally are left for a pull.
+func (s *Server) remoteSyncPush(r *http.Request, provider syncProvider, state *remoteSyncState, force bool) (*RemoteSyncResult, error) {
+	ctx := r.Context()
+
+	result := newRemoteSyncResult()
+
+	local, err := localSyncFiles(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := provider.list(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range sortedKeys(local) {
+		hash := local[name]
+
+		synced, tracked := state.Files[name]
+		revision, exists := remote[name]
+
+		if tracked && synced.Hash == hash {
+			continue
+		}
+
+		if !force && remoteChanged(synced, tracked, revision, exists) {
+			if !exists {
+				result.conflict(name, "deleted remotely")
+				continue
+			}
+
+			data, err := provider.get(ctx, name)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if contentHash(data) == hash {
+				state.Files[name] = remoteSyncEntry{Hash: hash, Revision: revision}
+				continue
+			}
+
+			result.conflict(name, "changed remotely")
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(getDataDir(ctx), filepath.FromSlash(name)))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := provider.put(ctx, name, data); err != nil {
+			return nil, err
+		}
+
+		state.Files[name] = remoteSyncEntry{Hash: contentHash(data)}
+		result.Uploaded = append(result.Uploaded, name)
+	}
+
+	for _, name := range sortedKeys(state.Files) {
+		if _, ok := local[name]; ok {
+			continue
+		}
+
+		synced := state.Files[name]
+		revision, exists := remote[name]
+
+		if !exists {
+			delete(state.Files, name)
+			continue
+		}
+
+		if !force && revision != synced.Revision {
+			result.conflict(name, "deleted locally, changed remotely")
+			continue
+		}
+
+		if err := provider.delete(ctx, name); err != nil {
+			return nil, err
+		}
+
+		delete(state.Files, name)
+		result.Deleted = append(result.Deleted, name)
+	}
+
+	if len(result.Uploaded) == 0 {
+		return result, nil
+	}
+
+	// the revisions are assigned by the remote
+	remote, err = provider.list(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range result.Uploaded {
+		synced := state.Files[name]
+		synced.Revision = remote[name]
+		state.Files[name] = synced
+	}
+
+	return result, nil
+}
+
+// remoteSyncPull downloads the files changed remotely since the last sync
+// and deletes the ones deleted remotely. Files also changed locally are
+// conflicts, unless forced or the contents match.
+func (s *Server) remoteSyncPull(r *http.Request, provider syncProvider, state *remoteSyncState, force bool) (*RemoteSyncResult, error) {
+	ctx := r.Context()
+
+	result := newRemoteSyncResult()
+
+	local, err := localSyncFiles(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := provider.list(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range sortedKeys(remote) {
+		if !remoteSyncPath(name) {
+			continue
+		}
+
+		revision := remote[name]
+
+		synced, tracked := state.Files[name]
+		hash, exists := local[name]
+
+		if tracked && synced.Revision == revision {
+			continue
+		}
+
+		data, err := provider.get(ctx, name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		remoteHash := contentHash(data)
+
+		if exists && remoteHash == hash {
+			state.Files[name] = remoteSyncEntry{Hash: hash, Revision: revision}
+			continue
+		}
+
+		if !force && localChanged(synced, tracked, hash, exists) {
+			result.conflict(name, "changed locally")
+			continue
+		}
+
+		if !json.Valid(data) {
+			result.conflict(name, "invalid JSON on the remote")
+			continue
+		}
+
+		if err := s.writeSyncedFile(ctx, name, data); err != nil {
+			return nil, err
+		}
+
+		state.Files[name] = remoteSyncEntry{Hash: remoteHash, Revision: revision}
+		result.Downloaded = append(result.Downloaded, name)
+	}
+
+	for _, name := range sortedKeys(state.Files) {
+		if _, ok := remote[name]; ok {
+			continue
+		}
+
+		synced := state.Files[name]
+		hash, exists := local[name]
+
+		if !exists {
+			delete(state.Files, name)
+			continue
+		}
+
+		if !force && hash != synced.Hash {
+			result.conflict(name, "deleted remotely, changed locally")
+			continue
+		}
+
+		if err := s.writeSyncedFile(ctx, name, nil); err != nil {
+			return nil, err
+		}
+
+		delete(state.Files, name)
+		result.Deleted = append(result.Deleted, name)
+	}
+
+	if len(result.Downloaded) > 0 || len(result.Deleted) > 0 {
+		s.scheduleGitCommit(ctx)
+		s.publishDataChange(ctx, "", "", "reloaded")
+	}
+
+	return result, nil
+}
+
+// remoteChanged reports whether a file changed remotely since the last
+// sync.
+func remoteChanged(synced remoteSyncEntry, tracked bool, revision string, exists bool) bool {
+	if !tracked {
+		return exists
+	}
+
+	return !exists || revision != synced.Revision
+}
+
+// localChanged reports whether a file changed locally since the last sync.
+func localChanged(synced remoteSyncEntry, tracked bool, hash string, exists bool) bool {
+	if !tracked {
+		return exists
+	}
+
+	return !exists || hash != synced.Hash
+}
+
+func newRemoteSyncResult() *RemoteSyncResult {
+	return &RemoteSyncResult{
+		Uploaded:   []string{},
+		Downloaded: []string{},
+		Deleted:    []string{},
+
+		Conflicts: []RemoteSyncConflict{},
+	}
+}
+
+func (r *RemoteSyncResult) conflict(path, reason string) {
+	r.Conflicts = append(r.Conflicts, RemoteSyncConflict{Path: path, Reason: reason})
+}
+
+// redactRemoteSyncConfig returns config without literal credentials;
+// secret references are kept.
+func redactRemoteSyncConfig(config *RemoteSyncConfig) *RemoteSyncConfig {
+	result := *config
+
+	if !secretRefRegex.MatchString(result.Username) {
+		result.Username = ""
+	}
+
+	if !secretRefRegex.MatchString(result.Password) {
+		result.Password = ""
+	}
+
+	return &result
+}
+
+// handleRemoteSyncStatus handles GET /sync/remote.
+func (s *Server) handleRemoteSyncStatus(w http.ResponseWriter, r *http.Request) {
+	s.remoteSyncMu.Lock()
+	defer s.remoteSyncMu.Unlock()
+
+	state, err := loadRemoteSyncState(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeRemoteSyncStatus(w, state)
+}
+
+// handleRemoteSyncUpdate handles PUT /sync/remote. Pointing it at another
+// remote forgets what was synced.
+// Request body: RemoteSyncConfig
+func (s *Server) handleRemoteSyncUpdate(w http.ResponseWriter, r *http.Request) {
+	var req RemoteSyncConfig
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Prefix = strings.Trim(req.Prefix, "/")
+
+	switch req.Provider {
+	case "webdav":
+		if _, err := newWebDAVProvider(http.DefaultClient, req.URL, "", ""); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+	case "s3":
+		if _, err := newS3Provider(http.DefaultClient, req.URL, req.Bucket, req.Region, req.Prefix, "", ""); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+	default:
+		http.Error(w, "provider must be webdav or s3", http.StatusBadRequest)
+		return
+	}
+
+	s.remoteSyncMu.Lock()
+	defer s.remoteSyncMu.Unlock()
+
+	state, err := loadRemoteSyncState(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if current := state.Config; current != nil {
+		if req.Username == "" {
+			req.Username = current.Username
+		}
+
+		if req.Password == "" {
+			req.Password = current.Password
+		}
+
+		if req.Provider != current.Provider || req.URL != current.URL || req.Bucket != current.Bucket || req.Prefix != current.Prefix {
+			state.LastSync = nil
+			state.Files = map[string]remoteSyncEntry{}
+		}
+	}
+
+	state.Config = &req
+
+	if err := saveRemoteSyncState(r.Context(), state); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeRemoteSyncStatus(w, state)
+}
+
+// handleRemoteSyncDelete handles DELETE /sync/remote, removing the
+// configuration; the remote itself is left alone.
+func (s *Server) handleRemoteSyncDelete(w http.ResponseWriter, r *http.Request) {
+	s.remoteSyncMu.Lock()
+	defer s.remoteSyncMu.Unlock()
+
+	if err := os.Remove(filepath.Join(getDataDir(r.Context()), remoteSyncFile)); err != nil && !os.IsNotExist(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleRemoteSyncPush handles POST /sync/remote/push[?force=true].
+// Conflicts are answered with 409 and the result.
+func (s *Server) handleRemoteSyncPush(w http.ResponseWriter, r *http.Request) {
+	s.handleRemoteSync(w, r, s.remoteSyncPush)
+}
+
+// handleRemoteSyncPull handles POST /sync/remote/pull[?force=true].
+// Conflicts are answered with 409 and the result.
+func (s *Server) handleRemoteSyncPull(w http.ResponseWriter, r *http.Request) {
+	s.handleRemoteSync(w, r, s.remoteSyncPull)
+}
+
+type remoteSyncFunc func(r *http.Request, provider syncProvider, state *remoteSyncState, force bool) (*RemoteSyncResult, error)
+
+func (s *Server) handleRemoteSync(w http.ResponseWriter, r *http.Request, sync remoteSyncFunc) {
+	if !requireFileStorage(w) {
+		return
+	}
+
+	s.remoteSyncMu.Lock()
+	defer s.remoteSyncMu.Unlock()
+
+	state, err := loadRemoteSyncState(r.Context())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if state.Config == nil {
+		http.Error(w, errRemoteNotConfigured.Error(), http.StatusConflict)
+		return
+	}
+
+	provider, err := s.remoteSyncProvider(r.Context(), state.Config)
+
+	if err != nil {
+		http.Error(w, err.Error(), secretStatus(err))
+		return
+	}
+
+	result, err := sync(r, provider, state, r.URL.Query().Get("force") == "true")
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	// keep what was synced, even with conflicts
+	now := time.Now().UTC()
+	state.LastSync = &now
+
+	if err := saveRemoteSyncState(r.Context(), state); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+
+	if len(result.Conflicts) > 0 {
+		status = http.StatusConflict
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+func writeRemoteSyncStatus(w http.ResponseWriter, state *remoteSyncState) {
+	status := RemoteSyncStatus{
+		Configured: state.Config != nil,
+
+		LastSync: state.LastSync,
+		Files:    len(state.Files),
+	}
+
+	if state.Config != nil {
+		status.Config = redactRemoteSyncConfig(state.Config)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
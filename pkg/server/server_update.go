@@ -0,0 +1,444 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/adrianliechti/prism"
+)
+
+// updateDownloadTimeout bounds the download of a release asset.
+const updateDownloadTimeout = 10 * time.Minute
+
+var errNoUpdate = errors.New("no update available")
+
+// appBundle returns the macOS app bundle the executable exe belongs to,
+// empty when it is no bundle (the CLI).
+func appBundle(exe string) string {
+	if i := strings.Index(exe, ".app/Contents/MacOS/"); i >= 0 {
+		return exe[:i+len(".app")]
+	}
+
+	return ""
+}
+
+// installUpdate downloads the latest release for this build, checks it
+// against the checksums of the release and puts it in place of the
+// running executable, or of the app bundle for the desktop app. The new
+// version takes over with the next start.
+func (s *Server) installUpdate(ctx context.Context) (*UpdateInstall, error) {
+	check, err := s.checkUpdate(ctx, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !check.Available {
+		return nil, errNoUpdate
+	}
+
+	s.updateMu.Lock()
+	release := s.release
+	s.updateMu.Unlock()
+
+	exe, err := os.Executable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, err
+	}
+
+	bundle := appBundle(exe)
+
+	// the CLI archives are prism_<version>_<os>_<arch>, the app
+	// prism-app_<version>_macOS_<arch>; each release flow has its checksums
+	prefix, checksumsName := "prism_", "checksums.txt"
+
+	if bundle != "" {
+		prefix, checksumsName = "prism-app_", "prism-app_checksums.txt"
+	}
+
+	var asset, checksums *releaseAsset
+
+	for i, a := range release.Assets {
+		switch {
+		case a.Name == checksumsName:
+			checksums = &release.Assets[i]
+		case strings.HasPrefix(a.Name, prefix) && platformAsset(a.Name):
+			asset = &release.Assets[i]
+		}
+	}
+
+	if asset == nil || checksums == nil {
+		return nil, fmt.Errorf("release %s has no download for %s/%s", check.Latest, runtime.GOOS, runtime.GOARCH)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateDownloadTimeout)
+	defer cancel()
+
+	var sums bytes.Buffer
+
+	if err := s.downloadAsset(ctx, checksums, &sums); err != nil {
+		return nil, err
+	}
+
+	want, err := releaseChecksum(sums.Bytes(), asset.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := os.CreateTemp("", "prism-update-*")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	hash := sha256.New()
+
+	if err := s.downloadAsset(ctx, asset, io.MultiWriter(archive, hash)); err != nil {
+		return nil, err
+	}
+
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return nil, fmt.Errorf("%s: checksum mismatch", asset.Name)
+	}
+
+	target := exe
+
+	if bundle != "" {
+		target = bundle
+		err = replaceBundle(archive, bundle)
+	} else {
+		err = replaceExecutable(archive, asset.Name, exe)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("update installed, restart to apply", "version", check.Latest, "path", target)
+
+	return &UpdateInstall{
+		Version: check.Latest,
+		Path:    target,
+		Restart: true,
+	}, nil
+}
+
+// downloadAsset writes a release asset to w, refusing more than the size
+// the release lists.
+func (s *Server) downloadAsset(ctx context.Context, asset *releaseAsset, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("User-Agent", "prism/"+prism.Version())
+
+	client := &http.Client{
+		Transport: s.transport(s.baseUpstreamOptions()),
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", asset.Name, resp.Status)
+	}
+
+	n, err := io.Copy(w, io.LimitReader(resp.Body, asset.Size+1))
+
+	if err != nil {
+		return err
+	}
+
+	if n != asset.Size {
+		return fmt.Errorf("%s: got %d bytes, want %d", asset.Name, n, asset.Size)
+	}
+
+	return nil
+}
+
+// releaseChecksum returns the SHA-256 of name from a checksums file of
+// lines "<sha256>  <name>".
+func releaseChecksum(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 2 && fields[1] == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: no checksum", name)
+}
+
+// replaceExecutable puts the prism binary of a CLI release archive
+// (tar.gz, zip on Windows) in place of exe. Running executables cannot be
+// overwritten on Windows, but renamed, so the old one is moved aside there.
+func replaceExecutable(archive *os.File, name, exe string) error {
+	binary := "prism"
+
+	if runtime.GOOS == "windows" {
+		binary = "prism.exe"
+	}
+
+	staged, err := os.CreateTemp(filepath.Dir(exe), ".prism-update-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+
+	if err := extractFile(archive, name, binary, staged); err != nil {
+		return err
+	}
+
+	if err := staged.Chmod(0755); err != nil {
+		return err
+	}
+
+	if err := staged.Close(); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+
+		os.Remove(old)
+
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(staged.Name(), exe)
+}
+
+// extractFile copies the regular file named binary (at any depth) of a
+// tar.gz or zip archive to w.
+func extractFile(archive *os.File, name, binary string, w io.Writer) error {
+	if strings.HasSuffix(name, ".zip") {
+		info, err := archive.Stat()
+
+		if err != nil {
+			return err
+		}
+
+		reader, err := zip.NewReader(archive, info.Size())
+
+		if err != nil {
+			return err
+		}
+
+		for _, f := range reader.File {
+			if path.Base(f.Name) != binary || !f.Mode().IsRegular() {
+				continue
+			}
+
+			rc, err := f.Open()
+
+			if err != nil {
+				return err
+			}
+
+			defer rc.Close()
+
+			_, err = io.Copy(w, rc)
+			return err
+		}
+
+		return fmt.Errorf("%s: no %s", name, binary)
+	}
+
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	gz, err := gzip.NewReader(archive)
+
+	if err != nil {
+		return err
+	}
+
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+
+	for {
+		header, err := tr.Next()
+
+		if err == io.EOF {
+			return fmt.Errorf("%s: no %s", name, binary)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == binary {
+			_, err = io.Copy(w, tr)
+			return err
+		}
+	}
+}
+
+// replaceBundle unpacks the Prism.app of a desktop app release (zip) next
+// to bundle and swaps the two; the running app keeps its files open.
+func replaceBundle(archive *os.File, bundle string) error {
+	info, err := archive.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	reader, err := zip.NewReader(archive, info.Size())
+
+	if err != nil {
+		return err
+	}
+
+	staging, err := os.MkdirTemp(filepath.Dir(bundle), ".prism-update-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(staging)
+
+	for _, f := range reader.File {
+		if !filepath.IsLocal(f.Name) || !strings.HasPrefix(f.Name, "Prism.app/") {
+			continue
+		}
+
+		if err := extractZipEntry(f, filepath.Join(staging, filepath.FromSlash(f.Name))); err != nil {
+			return err
+		}
+	}
+
+	unpacked := filepath.Join(staging, "Prism.app")
+
+	if _, err := os.Stat(filepath.Join(unpacked, "Contents")); err != nil {
+		return errors.New("release has no Prism.app")
+	}
+
+	old := filepath.Join(staging, "Prism.app.old")
+
+	if err := os.Rename(bundle, old); err != nil {
+		return err
+	}
+
+	if err := os.Rename(unpacked, bundle); err != nil {
+		os.Rename(old, bundle)
+		return err
+	}
+
+	return nil
+}
+
+// extractZipEntry writes a file, directory or symlink (frameworks of app
+// bundles have those) of a zip archive to target.
+func extractZipEntry(f *zip.File, target string) error {
+	mode := f.Mode()
+
+	if mode.IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	rc, err := f.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		link, err := io.ReadAll(io.LimitReader(rc, 4096))
+
+		if err != nil {
+			return err
+		}
+
+		return os.Symlink(string(link), target)
+	}
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0200)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// handleUpdateInstall handles POST /version/update, installing the latest
+// release in place of this build; it takes effect with the next start.
+// Servers serving other machines are updated by whoever runs them.
+func (s *Server) handleUpdateInstall(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config.Load()
+
+	if cfg.Remote || cfg.NoUpdateCheck {
+		http.Error(w, "updates are disabled", http.StatusForbidden)
+		return
+	}
+
+	result, err := s.installUpdate(r.Context())
+
+	if err != nil {
+		code := http.StatusInternalServerError
+
+		if errors.Is(err, errNoUpdate) {
+			code = http.StatusConflict
+		}
+
+		http.Error(w, "update failed: "+err.Error(), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// uploadTTL bounds how long staged uploads are kept on disk.
+const uploadTTL = time.Hour
+
+type uploadEntry struct {
+	Path    string
+	Upload  Upload
+	Expires time.Time
+}
+
+// handleUploadCreate handles POST /uploads. The raw request body is streamed
+// into a temp file; the returned ID can then be referenced via the
+// X-Prism-Body-File header on /proxy requests.
+func (s *Server) handleUploadCreate(w http.ResponseWriter, r *http.Request) {
+	s.purgeUploads()
+
+	f, err := createSpoolFile("uploads")
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), r.Body)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload := Upload{
+		ID: rand.Text(),
+
+		Size:        size,
+		ContentType: r.Header.Get("Content-Type"),
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	s.uploads.Store(upload.ID, &uploadEntry{
+		Path:    f.Name(),
+		Upload:  upload,
+		Expires: time.Now().Add(uploadTTL),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(upload)
+}
+
+// handleUploadDelete handles DELETE /uploads/{id}.
+func (s *Server) handleUploadDelete(w http.ResponseWriter, r *http.Request) {
+	value, ok := s.uploads.LoadAndDelete(r.PathValue("id"))
+
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	os.Remove(value.(*uploadEntry).Path)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// applyUploadBody replaces the request body with a staged upload, streamed
+// from disk with a proper Content-Length.
+func (s *Server) applyUploadBody(r *http.Request, id string) error {
+	entry, err := s.lookupUpload(id)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(entry.Path)
+
+	if err != nil {
+		return err
+	}
+
+	r.Body.Close()
+
+	r.Body = f
+	r.ContentLength = entry.Upload.Size
+	r.TransferEncoding = nil
+	r.Header.Del("Transfer-Encoding")
+
+	// allows redirect-following to replay the body (307/308)
+	r.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(entry.Path)
+	}
+
+	if r.Header.Get("Content-Type") == "" && entry.Upload.ContentType != "" {
+		r.Header.Set("Content-Type", entry.Upload.ContentType)
+	}
+
+	return nil
+}
+
+// purgeUploads removes expired uploads from disk.
+func (s *Server) purgeUploads() {
+	now := time.Now()
+
+	s.uploads.Range(func(key, value any) bool {
+		entry := value.(*uploadEntry)
+
+		if now.After(entry.Expires) {
+			s.uploads.Delete(key)
+			os.Remove(entry.Path)
+		}
+
+		return true
+	})
+}
+
+// removeUploads deletes all staged uploads, e.g. on shutdown.
+func (s *Server) removeUploads() {
+	s.uploads.Range(func(key, value any) bool {
+		s.uploads.Delete(key)
+		os.Remove(value.(*uploadEntry).Path)
+		return true
+	})
+}
+
+// lookupUpload returns a staged upload that has not expired yet.
+func (s *Server) lookupUpload(id string) (*uploadEntry, error) {
+	value, ok := s.uploads.Load(id)
+
+	if !ok || time.Now().After(value.(*uploadEntry).Expires) {
+		return nil, fmt.Errorf("upload %s not found", id)
+	}
+
+	return value.(*uploadEntry), nil
+}
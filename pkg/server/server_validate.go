@@ -0,0 +1,358 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// handleValidate handles POST /tools/validate. Contract violations are part
+// of a successful result; only unusable input (no schema, unknown
+// operation) is an error.
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	var req ResponseValidation
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxOpenAPISize+(16<<20))).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result := ResponseValidationResult{
+		Violations: []SchemaViolation{},
+	}
+
+	var root, schema any
+
+	switch {
+	case len(req.Schema) > 0:
+		if err := json.Unmarshal(req.Schema, &schema); err != nil {
+			http.Error(w, "invalid schema: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		root = schema
+
+	case req.OpenAPI != nil:
+		data, _, err := s.openapiSource(r, req.OpenAPI)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		doc, raw, err := parseOpenAPI(data)
+
+		if err != nil {
+			http.Error(w, "openapi: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		operations, err := openapiOperations(doc)
+
+		if err != nil {
+			http.Error(w, "openapi: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		op, err := findOpenAPIOperation(doc, operations, req.Operation)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Status == 0 {
+			http.Error(w, "status is required to select the response definition", http.StatusBadRequest)
+			return
+		}
+
+		result.Operation = op.ID
+
+		response, violation := matchOpenAPIResponse(op, req.Status, req.ContentType)
+
+		if violation != nil {
+			result.Violations = append(result.Violations, *violation)
+			break
+		}
+
+		result.Status = response.Status
+		result.ContentType = response.ContentType
+
+		if response.ContentType == "" {
+			if strings.TrimSpace(req.Body) != "" {
+				result.Violations = append(result.Violations, SchemaViolation{
+					Keyword: "content",
+					Message: fmt.Sprintf("response %s defines no body", response.Status),
+				})
+			}
+
+			break
+		}
+
+		// only JSON bodies can be checked against a schema
+		if !isJSONMediaType(response.ContentType) {
+			break
+		}
+
+		schema = response.Schema
+
+		// unresolved (recursive) $refs point into the raw document, whose
+		// YAML numbers must be brought into the JSON form the validator expects
+		if root, err = jsonNormalize(raw); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "one of schema or openapi is required", http.StatusBadRequest)
+		return
+	}
+
+	if schema != nil {
+		var instance any
+
+		if err := json.Unmarshal([]byte(req.Body), &instance); err != nil {
+			result.Violations = append(result.Violations, SchemaViolation{
+				Keyword: "json",
+				Message: "body is not valid JSON: " + err.Error(),
+			})
+		} else {
+			result.Violations = append(result.Violations, validateSchema(root, schema, instance)...)
+		}
+	}
+
+	result.Valid = len(result.Violations) == 0
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// findOpenAPIOperation looks an operation up by ID or by "METHOD path",
+// where path is either the templated path or a concrete request path or
+// URL. Server base paths are stripped, and literal segments win over
+// templated ones.
+func findOpenAPIOperation(doc *openapiDocument, operations []OpenAPIOperation, name string) (*OpenAPIOperation, error) {
+	if name == "" {
+		return nil, errors.New("operation is required")
+	}
+
+	for i := range operations {
+		if operations[i].ID == name {
+			return &operations[i], nil
+		}
+	}
+
+	method, target, ok := strings.Cut(strings.TrimSpace(name), " ")
+
+	if !ok {
+		return nil, fmt.Errorf("unknown operation %q", name)
+	}
+
+	method = strings.ToUpper(method)
+	target = strings.TrimSpace(target)
+
+	if u, err := url.Parse(target); err == nil {
+		target = u.Path
+	}
+
+	var best *OpenAPIOperation
+	bestParams := -1
+
+	for i := range operations {
+		op := &operations[i]
+
+		if op.Method != method {
+			continue
+		}
+
+		servers := op.Servers
+
+		if len(servers) == 0 {
+			for _, server := range doc.Servers {
+				servers = append(servers, openapiServerURL(server))
+			}
+		}
+
+		for _, path := range candidatePaths(target, servers) {
+			params, ok := matchPathTemplate(op.Path, path)
+
+			if ok && (best == nil || params < bestParams) {
+				best, bestParams = op, params
+			}
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("unknown operation %q", name)
+	}
+
+	return best, nil
+}
+
+// candidatePaths returns path as given and with each server's base path
+// removed.
+func candidatePaths(path string, servers []string) []string {
+	paths := []string{path}
+
+	for _, server := range servers {
+		u, err := url.Parse(server)
+
+		if err != nil {
+			continue
+		}
+
+		base := strings.TrimSuffix(u.Path, "/")
+
+		if base == "" {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(path, base); ok && (rest == "" || rest[0] == '/') {
+			paths = append(paths, rest)
+		}
+	}
+
+	return paths
+}
+
+var pathParamRegex = regexp.MustCompile(`\{[^/{}]+\}`)
+
+// matchPathTemplate matches a concrete path against "/pets/{id}" and returns
+// the number of template parameters.
+func matchPathTemplate(template, path string) (int, bool) {
+	if template == path {
+		return 0, true
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+
+	last := 0
+
+	locations := pathParamRegex.FindAllStringIndex(template, -1)
+
+	for _, loc := range locations {
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		pattern.WriteString("[^/]+")
+		last = loc[1]
+	}
+
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("/?$")
+
+	re, err := regexp.Compile(pattern.String())
+
+	if err != nil || !re.MatchString(path) {
+		return 0, false
+	}
+
+	return len(locations), true
+}
+
+// matchOpenAPIResponse selects the response definition for a status code
+// ("404", then "4XX", then "default") and content type. A missing
+// definition is reported as a violation.
+func matchOpenAPIResponse(op *OpenAPIOperation, status int, contentType string) (*OpenAPIResponse, *SchemaViolation) {
+	code := strconv.Itoa(status)
+
+	var candidates []*OpenAPIResponse
+
+	for _, key := range []string{code, code[:1] + "XX", "default"} {
+		for i := range op.Responses {
+			if strings.EqualFold(op.Responses[i].Status, key) {
+				candidates = append(candidates, &op.Responses[i])
+			}
+		}
+
+		if len(candidates) > 0 {
+			break
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, &SchemaViolation{
+			Keyword: "status",
+			Message: fmt.Sprintf("status %d is not documented for %s", status, op.ID),
+		}
+	}
+
+	// a response without content is a single entry with no content type
+	if len(candidates) == 1 && candidates[0].ContentType == "" {
+		return candidates[0], nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	if mediaType == "" {
+		for _, candidate := range candidates {
+			if isJSONMediaType(candidate.ContentType) {
+				return candidate, nil
+			}
+		}
+
+		return candidates[0], nil
+	}
+
+	var wildcard *OpenAPIResponse
+
+	for _, candidate := range candidates {
+		switch defined := strings.ToLower(candidate.ContentType); {
+		case defined == mediaType:
+			return candidate, nil
+
+		case defined == "*/*",
+			strings.HasSuffix(defined, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(defined, "*")):
+			if wildcard == nil {
+				wildcard = candidate
+			}
+		}
+	}
+
+	if wildcard != nil {
+		return wildcard, nil
+	}
+
+	defined := make([]string, len(candidates))
+
+	for i, candidate := range candidates {
+		defined[i] = candidate.ContentType
+	}
+
+	return nil, &SchemaViolation{
+		Keyword: "contentType",
+		Message: fmt.Sprintf("content type %q is not documented for status %s (expected %s)", mediaType, candidates[0].Status, strings.Join(defined, ", ")),
+	}
+}
+
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	if mediaType == "" {
+		mediaType = strings.ToLower(contentType)
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// jsonNormalize round-trips v through JSON so numbers become float64.
+func jsonNormalize(v any) (any, error) {
+	data, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result any
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrianliechti/prism"
+)
+
+const (
+	// releaseFeed is the latest release of Prism on GitHub.
+	releaseFeed = "https://api.github.com/repos/adrianliechti/prism/releases/latest"
+
+	// updateInterval is how long a check of the feed is reused, and how
+	// often the server looks for updates in the background.
+	updateInterval = 24 * time.Hour
+
+	updateTimeout = 10 * time.Second
+)
+
+// githubRelease is the part of a GitHub release the update check reads.
+type githubRelease struct {
+	TagName   string    `json:"tag_name"`
+	HTMLURL   string    `json:"html_url"`
+	Published time.Time `json:"published_at"`
+
+	Assets []releaseAsset `json:"assets"`
+}
+
+// releaseAsset is a file of a GitHub release.
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// checkUpdate returns the last check of the release feed, checking it
+// again when that is older than updateInterval or refresh is set.
+func (s *Server) checkUpdate(ctx context.Context, refresh bool) (*UpdateCheck, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	if s.update != nil && !refresh && time.Since(*s.update.Checked) < updateInterval {
+		return s.update, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releaseFeed, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "prism/"+prism.Version())
+
+	client := &http.Client{
+		Transport: s.transport(s.baseUpstreamOptions()),
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("release feed: %s", resp.Status)
+	}
+
+	var release githubRelease
+
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("release feed: %w", err)
+	}
+
+	now := time.Now()
+
+	check := &UpdateCheck{
+		Current: prism.Version(),
+		Latest:  strings.TrimPrefix(release.TagName, "v"),
+
+		URL:       release.HTMLURL,
+		Published: &release.Published,
+		Checked:   &now,
+	}
+
+	// builds of no release never claim to be outdated
+	check.Available = check.Current != "dev" && compareVersions(check.Latest, check.Current) > 0
+
+	for _, asset := range release.Assets {
+		if platformAsset(asset.Name) {
+			check.Downloads = append(check.Downloads, UpdateDownload{Name: asset.Name, URL: asset.URL, Size: asset.Size})
+		}
+	}
+
+	s.update = check
+	s.release = &release
+
+	return check, nil
+}
+
+// watchUpdates checks the release feed now and every updateInterval,
+// logging when a newer release is out.
+func (s *Server) watchUpdates(ctx context.Context) {
+	if s.config.Load().NoUpdateCheck || prism.Version() == "dev" {
+		return
+	}
+
+	ticker := time.NewTicker(updateInterval)
+	defer ticker.Stop()
+
+	for {
+		check, err := s.checkUpdate(ctx, true)
+
+		switch {
+		case err != nil:
+			s.logger.Debug("update check failed", "error", err)
+		case check.Available:
+			s.logger.Info("update available", "current", check.Current, "latest", check.Latest, "url", check.URL)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// platformAsset reports whether a release asset is for the platform of
+// this build: the CLI archives are named prism_<version>_<os>_<arch>, the
+// desktop app prism-app_<version>_macOS_<arch>.
+func platformAsset(name string) bool {
+	name = strings.ToLower(name)
+
+	for _, platform := range []string{runtime.GOOS, strings.ReplaceAll(runtime.GOOS, "darwin", "macos")} {
+		if strings.Contains(name, "_"+platform+"_"+runtime.GOARCH+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compareVersions compares two versions like 1.2.3 by their numbers; a
+// pre-release (1.2.3-rc.1) is older than the release.
+func compareVersions(a, b string) int {
+	a, preA, _ := strings.Cut(a, "-")
+	b, preB, _ := strings.Cut(b, "-")
+
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+
+	for i := range max(len(partsA), len(partsB)) {
+		var x, y int
+
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+
+		if c := cmp.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+
+	return strings.Compare(preA, preB)
+}
+
+// handleVersion handles GET /version, identifying this build.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VersionInfo{
+		Version: prism.Version(),
+		Commit:  prism.Commit(),
+		Date:    prism.BuildDate(),
+
+		Go:   runtime.Version(),
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+	})
+}
+
+// handleUpdateCheck handles GET /version/check[?refresh=true], comparing
+// this build with the latest release. Checks of the release feed are
+// reused for a day unless refreshed; with update checks disabled only the
+// current version is reported.
+func (s *Server) handleUpdateCheck(w http.ResponseWriter, r *http.Request) {
+	check := &UpdateCheck{
+		Current: prism.Version(),
+	}
+
+	if !s.config.Load().NoUpdateCheck {
+		var err error
+
+		if check, err = s.checkUpdate(r.Context(), r.URL.Query().Get("refresh") == "true"); err != nil {
+			http.Error(w, "update check failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(check)
+}
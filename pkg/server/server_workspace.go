@@ -0,0 +1,472 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxWorkspaceSize limits the size of an imported workspace archive.
+const maxWorkspaceSize = 256 << 20
+
+// handleExportWorkspace handles GET /export/workspace. It returns a zip
+// archive of all data stores, one {store}/{id}.json file per entry plus the
+// folder index of each store. ?store= (repeatable) limits it to some
+// stores; with a single store, ?folder= (ID or path of names) narrows it to
+// a folder, which becomes a top-level one, and ?id= (repeatable, ID or
+// name) to some entries.
+func (s *Server) handleExportWorkspace(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExportFilter(r.Context(), r.URL.Query())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stores, err := dataStore(r.Context()).Stores()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := "workspace"
+
+	if len(filter.stores) == 1 {
+		name = filter.stores[0]
+	}
+
+	filename := "prism-" + name + "-" + time.Now().Format("20060102") + ".zip"
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	archive := zip.NewWriter(w)
+
+	for _, store := range stores {
+		if !filter.includes(store) {
+			continue
+		}
+
+		entries, err := dataStore(r.Context()).List(store)
+
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			name := entry.ID + ".json"
+
+			if !workspaceFile(name) {
+				continue
+			}
+
+			data, err := dataStore(r.Context()).Get(store, entry.ID)
+
+			if err == nil {
+				data, err = filter.filter(name, data)
+			}
+
+			if err != nil || data == nil {
+				continue
+			}
+
+			header := &zip.FileHeader{
+				Name:     path.Join(store, name),
+				Method:   zip.Deflate,
+				Modified: entry.Updated,
+			}
+
+			// the status line is already sent, so a failure can only cut
+			// the archive short
+			f, err := archive.CreateHeader(header)
+
+			if err != nil {
+				return
+			}
+
+			if _, err := f.Write(data); err != nil {
+				return
+			}
+		}
+	}
+
+	archive.Close()
+}
+
+// exportFilter narrows a workspace export to some stores, or to some
+// entries of a single store.
+type exportFilter struct {
+	// nil for all stores
+	stores []string
+
+	// entries of the store and folders kept in its folder index, root
+	// becoming a top-level folder; nil entries for all, nil folders for
+	// no folder index
+	entries map[string]bool
+	folders []string
+	root    string
+}
+
+func parseExportFilter(ctx context.Context, query url.Values) (*exportFilter, error) {
+	filter := &exportFilter{
+		stores: query["store"],
+	}
+
+	for _, store := range filter.stores {
+		if !validName(store) {
+			return nil, errors.New("invalid store")
+		}
+	}
+
+	folder, ids := query.Get("folder"), query["id"]
+
+	if folder == "" && len(ids) == 0 {
+		return filter, nil
+	}
+
+	if len(filter.stores) != 1 {
+		return nil, errors.New("folder and id require a single store")
+	}
+
+	store := filter.stores[0]
+
+	filter.entries = map[string]bool{}
+
+	for _, ref := range ids {
+		id, err := findEntry(ctx, store, ref)
+
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %w", ref, err)
+		}
+
+		filter.entries[id] = true
+	}
+
+	if folder != "" {
+		id, err := findFolder(ctx, store, folder)
+
+		if err != nil {
+			return nil, err
+		}
+
+		index, err := loadFolderIndex(ctx, store)
+
+		if err != nil {
+			return nil, err
+		}
+
+		filter.folders = index.descendants(id)
+		filter.root = id
+
+		for entry, parent := range index.Entries {
+			if slices.Contains(filter.folders, parent) {
+				filter.entries[entry] = true
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+func (f *exportFilter) includes(store string) bool {
+	return f.stores == nil || slices.Contains(f.stores, store)
+}
+
+// filter returns the data of a store file to archive, nil to leave the
+// file out.
+func (f *exportFilter) filter(name string, data []byte) ([]byte, error) {
+	if f.entries == nil {
+		return data, nil
+	}
+
+	switch name {
+	case folderIndexFile:
+		if f.folders == nil {
+			return nil, nil
+		}
+
+		var index folderIndex
+
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, err
+		}
+
+		index.Folders = slices.DeleteFunc(index.Folders, func(folder DataFolder) bool {
+			return !slices.Contains(f.folders, folder.ID)
+		})
+
+		for i := range index.Folders {
+			if index.Folders[i].ID == f.root {
+				index.Folders[i].Parent = ""
+			}
+		}
+
+		maps.DeleteFunc(index.Entries, func(id, _ string) bool {
+			return !f.entries[id]
+		})
+
+		return json.MarshalIndent(index, "", "  ")
+
+	case metaIndexFile:
+		var index metaIndex
+
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, err
+		}
+
+		maps.DeleteFunc(index.Entries, func(id string, _ DataEntryMeta) bool {
+			return !f.entries[id]
+		})
+
+		return json.MarshalIndent(index, "", "  ")
+	}
+
+	if !f.entries[strings.TrimSuffix(name, ".json")] {
+		return nil, nil
+	}
+
+	return data, nil
+}
+
+// handleImportWorkspace handles POST /import/workspace?strategy=... with a
+// workspace archive as body. With the default "merge" strategy entries
+// that already exist are kept; "overwrite" replaces them.
+func (s *Server) handleImportWorkspace(w http.ResponseWriter, r *http.Request) {
+	strategy := r.URL.Query().Get("strategy")
+
+	switch strategy {
+	case "":
+		strategy = "merge"
+	case "merge", "overwrite":
+	default:
+		http.Error(w, "strategy must be merge or overwrite", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWorkspaceSize))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+
+	if err != nil {
+		http.Error(w, "invalid workspace archive: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := WorkspaceImportResult{
+		Stores: []string{},
+	}
+
+	type workspaceEntry struct {
+		store string
+		name  string
+		data  []byte
+	}
+
+	// read and validate everything first so a broken archive changes nothing
+	var entries []workspaceEntry
+
+	for _, file := range archive.File {
+		store, name, ok := strings.Cut(file.Name, "/")
+
+		if !ok || !validName(store) || !workspaceFile(name) {
+			result.Skipped++
+			continue
+		}
+
+		data, err := readZipFile(file)
+
+		if err == nil && name == folderIndexFile {
+			err = json.Unmarshal(data, &folderIndex{})
+		}
+
+		if err == nil && name == metaIndexFile {
+			err = json.Unmarshal(data, &metaIndex{})
+		}
+
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", file.Name, err), http.StatusBadRequest)
+			return
+		}
+
+		entries = append(entries, workspaceEntry{store, name, data})
+
+		if !slices.Contains(result.Stores, store) {
+			result.Stores = append(result.Stores, store)
+		}
+	}
+
+	overwrite := strategy == "overwrite"
+
+	for _, entry := range entries {
+		if entry.name == folderIndexFile {
+			if err := s.importFolderIndex(r.Context(), entry.store, entry.data, overwrite); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			continue
+		}
+
+		if entry.name == metaIndexFile {
+			if err := s.importMetaIndex(r.Context(), entry.store, entry.data, overwrite); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			continue
+		}
+
+		exists, err := importWorkspaceEntry(r.Context(), entry.store, entry.name, entry.data, overwrite)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		switch {
+		case exists && !overwrite:
+			result.Skipped++
+		case exists:
+			result.Overwritten++
+		default:
+			result.Created++
+		}
+	}
+
+	s.scheduleGitCommit(r.Context())
+	s.publishDataChange(r.Context(), "", "", "reloaded")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// importWorkspaceEntry writes an entry unless it exists and overwrite is
+// not set; it reports whether the entry existed. The entry stays locked
+// between the check and the write.
+func importWorkspaceEntry(ctx context.Context, store, name string, data []byte, overwrite bool) (bool, error) {
+	id := strings.TrimSuffix(name, ".json")
+
+	unlock := lockEntry(store, id)
+	defer unlock()
+
+	_, err := dataStore(ctx).Stat(store, id)
+	exists := err == nil
+
+	if exists && !overwrite {
+		return true, nil
+	}
+
+	return exists, dataStore(ctx).Put(store, id, data)
+}
+
+// workspaceFile reports whether name is a file of a store that belongs in
+// a workspace archive: an entry, the folder or the metadata index.
+func workspaceFile(name string) bool {
+	if name == folderIndexFile || name == metaIndexFile {
+		return true
+	}
+
+	id, ok := strings.CutSuffix(name, ".json")
+	return ok && validName(id)
+}
+
+// readZipFile reads an archived file, which must be valid JSON.
+func readZipFile(file *zip.File) ([]byte, error) {
+	f, err := file.Open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, 64<<20))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(data) {
+		return nil, errors.New("invalid JSON")
+	}
+
+	return data, nil
+}
+
+// importFolderIndex merges an imported folder index into the existing one.
+// On conflicts (same folder or entry ID) the existing folder or assignment
+// is kept unless overwrite is set.
+func (s *Server) importFolderIndex(ctx context.Context, store string, data []byte, overwrite bool) error {
+	var imported folderIndex
+
+	if err := json.Unmarshal(data, &imported); err != nil {
+		return err
+	}
+
+	return s.updateFolderIndex(ctx, store, func(index *folderIndex) error {
+		for _, folder := range imported.Folders {
+			if !validName(folder.ID) {
+				continue
+			}
+
+			if existing := index.folder(folder.ID); existing != nil {
+				if overwrite {
+					*existing = folder
+				}
+
+				continue
+			}
+
+			index.Folders = append(index.Folders, folder)
+		}
+
+		for entry, folder := range imported.Entries {
+			if _, ok := index.Entries[entry]; ok && !overwrite {
+				continue
+			}
+
+			index.Entries[entry] = folder
+		}
+
+		return nil
+	})
+}
+
+// importMetaIndex merges imported entry metadata into the existing one,
+// keeping existing metadata unless overwrite is set.
+func (s *Server) importMetaIndex(ctx context.Context, store string, data []byte, overwrite bool) error {
+	var imported metaIndex
+
+	if err := json.Unmarshal(data, &imported); err != nil {
+		return err
+	}
+
+	return s.updateMetaIndex(ctx, store, func(index *metaIndex) error {
+		for entry, meta := range imported.Entries {
+			if _, ok := index.Entries[entry]; ok && !overwrite {
+				continue
+			}
+
+			index.Entries[entry] = meta
+		}
+
+		return nil
+	})
+}
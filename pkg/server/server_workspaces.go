@@ -0,0 +1,327 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// defaultWorkspace names the data directory itself.
+	defaultWorkspace = "default"
+
+	// workspacesDir holds the other workspaces within the data directory.
+	// The dot keeps it out of the data store names.
+	workspacesDir = ".workspaces"
+)
+
+var (
+	errWorkspaceNotFound = errors.New("workspace not found")
+	errWorkspaceExists   = errors.New("workspace already exists")
+)
+
+// openWorkspace is the name of the workspace of requests that name none,
+// the one opened at startup or by PUT /workspaces/active.
+var openWorkspace atomic.Value
+
+func currentWorkspace() string {
+	if name, _ := openWorkspace.Load().(string); name != "" {
+		return name
+	}
+
+	return defaultWorkspace
+}
+
+// workspaceKey is the context key of the workspace a request works on.
+type workspaceKey struct{}
+
+// workspaceContext returns ctx working on the workspace name.
+func workspaceContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, name)
+}
+
+// contextWorkspace returns the workspace of ctx, or else the open one.
+func contextWorkspace(ctx context.Context) string {
+	if name, _ := ctx.Value(workspaceKey{}).(string); name != "" {
+		return name
+	}
+
+	return currentWorkspace()
+}
+
+// withWorkspace binds a request to the workspace it names with
+// X-Prism-Workspace or else, for the UI, to the workspace parameter of the
+// page it comes from, so a window opened on /?workspace=name stays in that
+// workspace. Other requests work on the open workspace, requests of the
+// server itself on that of the request they are made for.
+func (s *Server) withWorkspace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get("X-Prism-Workspace")
+
+		r.Header.Del("X-Prism-Workspace")
+
+		if name == "" {
+			name = refererWorkspace(r)
+		}
+
+		if name == "" {
+			name = contextWorkspace(r.Context())
+		}
+
+		if !validName(name) || !workspaceExists(name) {
+			setCORSHeaders(w.Header())
+			http.Error(w, errWorkspaceNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(workspaceContext(r.Context(), name)))
+	})
+}
+
+// refererWorkspace returns the workspace parameter of the page of the UI a
+// browser request comes from, empty for other requests.
+func refererWorkspace(r *http.Request) string {
+	if r.Header.Get("Sec-Fetch-Site") != "same-origin" {
+		return ""
+	}
+
+	referer, err := url.Parse(r.Referer())
+
+	if err != nil || referer.Host != r.Host {
+		return ""
+	}
+
+	return referer.Query().Get("workspace")
+}
+
+// workspaceDir returns the data root of the workspace name.
+func workspaceDir(name string) string {
+	if name == defaultWorkspace {
+		return dataRoot()
+	}
+
+	return filepath.Join(dataRoot(), workspacesDir, name)
+}
+
+func workspaceExists(name string) bool {
+	if name == defaultWorkspace {
+		return true
+	}
+
+	info, err := os.Stat(workspaceDir(name))
+	return err == nil && info.IsDir()
+}
+
+// initWorkspace opens the workspace chosen at startup, creating it when
+// it does not exist yet; empty opens the default one.
+func initWorkspace(name string) error {
+	if name == "" {
+		name = defaultWorkspace
+	}
+
+	if !validName(name) {
+		return errors.New("invalid workspace name " + name)
+	}
+
+	if err := os.MkdirAll(workspaceDir(name), 0755); err != nil {
+		return err
+	}
+
+	openWorkspace.Store(name)
+	return nil
+}
+
+// listWorkspaces returns the default workspace and the others by name.
+func listWorkspaces() ([]Workspace, error) {
+	current := currentWorkspace()
+
+	workspaces := []Workspace{
+		{Name: defaultWorkspace, Path: dataRoot(), Active: current == defaultWorkspace},
+	}
+
+	dirs, err := os.ReadDir(filepath.Join(dataRoot(), workspacesDir))
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		name := dir.Name()
+
+		if !dir.IsDir() || !validName(name) || name == defaultWorkspace {
+			continue
+		}
+
+		workspaces = append(workspaces, Workspace{Name: name, Path: workspaceDir(name), Active: current == name})
+	}
+
+	return workspaces, nil
+}
+
+// switchWorkspace opens the workspace name for the windows and clients
+// that name none; the windows reload on the data event. Requests naming a
+// workspace and the state kept per workspace (unlocked secrets, pending
+// commits, monitors) are not affected.
+func (s *Server) switchWorkspace(ctx context.Context, name string) error {
+	if !workspaceExists(name) {
+		return errWorkspaceNotFound
+	}
+
+	if name == currentWorkspace() {
+		return nil
+	}
+
+	openWorkspace.Store(name)
+
+	s.logger.Info("workspace opened", "workspace", name)
+
+	s.publishDataChange(workspaceContext(ctx, name), "", "", "reloaded")
+
+	return nil
+}
+
+// dropWorkspace forgets the state kept for the workspace name: its pending
+// commit, its unlocked secrets, its search index and the schedules of its
+// monitors.
+func (s *Server) dropWorkspace(name string) {
+	s.gitTimerMu.Lock()
+
+	if timer := s.gitTimers[name]; timer != nil {
+		timer.Stop()
+		delete(s.gitTimers, name)
+	}
+
+	s.gitTimerMu.Unlock()
+
+	s.secretsMu.Lock()
+	clear(s.secretKeys[name])
+	delete(s.secretKeys, name)
+	s.secretsMu.Unlock()
+
+	s.dataIndex.drop(name)
+
+	prefix := name + "/"
+
+	s.monitorsMu.Lock()
+	maps.DeleteFunc(s.monitors, func(key string, state *monitorState) bool {
+		return strings.HasPrefix(key, prefix) && !state.running
+	})
+	s.monitorsMu.Unlock()
+}
+
+// handleWorkspaceList handles GET /workspaces.
+func (s *Server) handleWorkspaceList(w http.ResponseWriter, r *http.Request) {
+	workspaces, err := listWorkspaces()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workspaces)
+}
+
+// handleWorkspaceCreate handles POST /workspaces, creating an empty
+// workspace without opening it.
+// Request body: WorkspaceSelection
+func (s *Server) handleWorkspaceCreate(w http.ResponseWriter, r *http.Request) {
+	var req WorkspaceSelection
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !validName(req.Name) {
+		http.Error(w, "invalid workspace name", http.StatusBadRequest)
+		return
+	}
+
+	if workspaceExists(req.Name) {
+		http.Error(w, errWorkspaceExists.Error(), http.StatusConflict)
+		return
+	}
+
+	dir := workspaceDir(req.Name)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Workspace{Name: req.Name, Path: dir})
+}
+
+// handleWorkspaceActivePut handles PUT /workspaces/active, switching every
+// window of the server to another workspace.
+// Request body: WorkspaceSelection
+func (s *Server) handleWorkspaceActivePut(w http.ResponseWriter, r *http.Request) {
+	var req WorkspaceSelection
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !validName(req.Name) {
+		http.Error(w, "invalid workspace name", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.switchWorkspace(r.Context(), req.Name); err != nil {
+		code := http.StatusInternalServerError
+
+		if errors.Is(err, errWorkspaceNotFound) {
+			code = http.StatusNotFound
+		}
+
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Workspace{Name: req.Name, Path: workspaceDir(req.Name), Active: true})
+}
+
+// handleWorkspaceDelete handles DELETE /workspaces/{name}, removing a
+// workspace with all its data. The default and the open workspace cannot
+// be deleted.
+func (s *Server) handleWorkspaceDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if !validName(name) {
+		http.Error(w, "invalid workspace name", http.StatusBadRequest)
+		return
+	}
+
+	if name == defaultWorkspace || name == currentWorkspace() {
+		http.Error(w, "the default and the open workspace cannot be deleted", http.StatusConflict)
+		return
+	}
+
+	if !workspaceExists(name) {
+		http.Error(w, errWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	s.dropWorkspace(name)
+
+	closeDataStore(workspaceDir(name))
+
+	if err := os.RemoveAll(workspaceDir(name)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+// Store keeps the data stores of a workspace: JSON entries by store and
+// ID. IDs with a leading dot are documents of the store itself, such as
+// its folder and metadata indexes.
+type Store interface {
+	// Get returns the data of an entry; the error is an os.ErrNotExist
+	// one when the entry does not exist.
+	Get(store, id string) ([]byte, error)
+
+	// Stat returns the size and modification time of an entry.
+	Stat(store, id string) (StoreEntry, error)
+
+	// Put creates or replaces an entry.
+	Put(store, id string, data []byte) error
+
+	// Delete removes an entry.
+	Delete(store, id string) error
+
+	// Rename moves an entry to another ID and/or store, failing with an
+	// os.ErrExist error when the target exists.
+	Rename(store, id, targetStore, targetID string) error
+
+	// List returns the entries and documents of store ordered by ID, none
+	// when the store does not exist.
+	List(store string) ([]StoreEntry, error)
+
+	// Stores returns the names of the stores.
+	Stores() ([]string, error)
+
+	Close() error
+}
+
+// StoreEntry describes a stored entry.
+type StoreEntry struct {
+	ID      string
+	Size    int64
+	Updated time.Time
+}
+
+// datedStore is a Store taking the modification time of an entry, as
+// migrations keep it.
+type datedStore interface {
+	putDated(store, id string, data []byte, updated time.Time) error
+}
+
+// errInvalidStoreEntry rejects store and entry names that could leave the
+// data directory.
+var errInvalidStoreEntry = errors.New("invalid store or id")
+
+// validStoreEntry tells whether store names a store and id an entry or
+// document of it.
+func validStoreEntry(store, id string) bool {
+	return validName(store) && validName(strings.TrimPrefix(id, "."))
+}
+
+// OpenStore opens the data stores in dir with the backend storage, one of
+// config.StorageFile (the default when empty) or config.StorageSQLite.
+func OpenStore(dir, storage string) (Store, error) {
+	switch storage {
+	case "", config.StorageFile:
+		return &fileStore{dir: dir}, nil
+
+	case config.StorageSQLite:
+		return openSQLiteStore(filepath.Join(dir, sqliteStoreFile))
+	}
+
+	return nil, fmt.Errorf("unknown storage %q", storage)
+}
+
+// dataStorage is the configured backend of the data stores.
+var dataStorage string
+
+// dataStores holds the open Store of each workspace directory.
+var dataStores sync.Map
+
+// initDataStore selects the backend of the data stores and opens that of
+// the open workspace, so a database that cannot be opened fails the start.
+func initDataStore(storage string) error {
+	dataStorage = storage
+
+	if failed, ok := dataStore(context.Background()).(failedStore); ok {
+		return failed.err
+	}
+
+	return nil
+}
+
+// dataStore returns the Store of the workspace of ctx. Opening it fails
+// only for the SQLite backend; the error is then returned by every call
+// until an attempt succeeds.
+func dataStore(ctx context.Context) Store {
+	dir := getDataDir(ctx)
+
+	if value, ok := dataStores.Load(dir); ok {
+		return value.(Store)
+	}
+
+	store, err := OpenStore(dir, dataStorage)
+
+	if err != nil {
+		return failedStore{err}
+	}
+
+	value, loaded := dataStores.LoadOrStore(dir, store)
+
+	if loaded {
+		store.Close()
+	}
+
+	return value.(Store)
+}
+
+// closeDataStore closes the Store of a workspace directory, if open, before
+// the directory is removed.
+func closeDataStore(dir string) {
+	if value, ok := dataStores.LoadAndDelete(dir); ok {
+		value.(Store).Close()
+	}
+}
+
+// fileStores tells whether the data stores are files of the workspace
+// directory, which git and remote sync work on.
+func fileStores() bool {
+	return dataStorage == "" || dataStorage == config.StorageFile
+}
+
+// requireFileStorage responds 409 Conflict unless the data stores are
+// files of the workspace directory, which syncing works on.
+func requireFileStorage(w http.ResponseWriter) bool {
+	if fileStores() {
+		return true
+	}
+
+	http.Error(w, "sync needs the file storage, the data stores are kept in "+sqliteStoreFile, http.StatusConflict)
+	return false
+}
+
+// failedStore is the Store of a workspace that could not be opened.
+type failedStore struct {
+	err error
+}
+
+func (f failedStore) Get(string, string) ([]byte, error)          { return nil, f.err }
+func (f failedStore) Stat(string, string) (StoreEntry, error)     { return StoreEntry{}, f.err }
+func (f failedStore) Put(string, string, []byte) error            { return f.err }
+func (f failedStore) Delete(string, string) error                 { return f.err }
+func (f failedStore) Rename(string, string, string, string) error { return f.err }
+func (f failedStore) List(string) ([]StoreEntry, error)           { return nil, f.err }
+func (f failedStore) Stores() ([]string, error)                   { return nil, f.err }
+func (f failedStore) Close() error                                { return nil }
+
+// MigrateStore copies the stores of every workspace of dataDir from the
+// backend from to the backend to, leaving the source as it is. Entries the
+// target has already are kept unless overwrite is set. It returns the
+// number of entries copied.
+func MigrateStore(dataDir, from, to string, overwrite bool) (int, error) {
+	if from == to {
+		return 0, errors.New("source and target storage are the same")
+	}
+
+	dirs := []string{dataDir}
+
+	workspaces, err := os.ReadDir(filepath.Join(dataDir, workspacesDir))
+
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	for _, workspace := range workspaces {
+		if workspace.IsDir() && validName(workspace.Name()) {
+			dirs = append(dirs, filepath.Join(dataDir, workspacesDir, workspace.Name()))
+		}
+	}
+
+	var count int
+
+	for _, dir := range dirs {
+		n, err := migrateWorkspace(dir, from, to, overwrite)
+
+		count += n
+
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", dir, err)
+		}
+	}
+
+	return count, nil
+}
+
+func migrateWorkspace(dir, from, to string, overwrite bool) (int, error) {
+	source, err := OpenStore(dir, from)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer source.Close()
+
+	target, err := OpenStore(dir, to)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer target.Close()
+
+	stores, err := source.Stores()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+
+	for _, store := range stores {
+		entries, err := source.List(store)
+
+		if err != nil {
+			return count, err
+		}
+
+		for _, entry := range entries {
+			if !overwrite {
+				if _, err := target.Stat(store, entry.ID); err == nil {
+					continue
+				}
+			}
+
+			data, err := source.Get(store, entry.ID)
+
+			if err != nil {
+				return count, err
+			}
+
+			// the modification times order listings and outdate caches
+			if dated, ok := target.(datedStore); ok {
+				err = dated.putDated(store, entry.ID, data, entry.Updated)
+			} else {
+				err = target.Put(store, entry.ID, data)
+			}
+
+			if err != nil {
+				return count, err
+			}
+
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileStore keeps each entry in {dir}/{store}/{id}.json, the layout git
+// and remote sync work on.
+type fileStore struct {
+	dir string
+}
+
+func (f *fileStore) path(store, id string) (string, error) {
+	if !validStoreEntry(store, id) {
+		return "", errInvalidStoreEntry
+	}
+
+	return filepath.Join(f.dir, store, id+".json"), nil
+}
+
+func (f *fileStore) Get(store, id string) ([]byte, error) {
+	path, err := f.path(store, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(path)
+}
+
+func (f *fileStore) Stat(store, id string) (StoreEntry, error) {
+	path, err := f.path(store, id)
+
+	if err != nil {
+		return StoreEntry{}, err
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return StoreEntry{}, err
+	}
+
+	return StoreEntry{ID: id, Size: info.Size(), Updated: info.ModTime()}, nil
+}
+
+func (f *fileStore) Put(store, id string, data []byte) error {
+	path, err := f.path(store, id)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, 0644)
+}
+
+func (f *fileStore) putDated(store, id string, data []byte, updated time.Time) error {
+	if err := f.Put(store, id, data); err != nil {
+		return err
+	}
+
+	path, _ := f.path(store, id)
+
+	return os.Chtimes(path, updated, updated)
+}
+
+func (f *fileStore) Delete(store, id string) error {
+	path, err := f.path(store, id)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func (f *fileStore) Rename(store, id, targetStore, targetID string) error {
+	source, err := f.path(store, id)
+
+	if err != nil {
+		return err
+	}
+
+	target, err := f.path(targetStore, targetID)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(source); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("%s/%s: %w", targetStore, targetID, os.ErrExist)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(source, target); err != nil {
+		return err
+	}
+
+	syncDir(filepath.Dir(source))
+	syncDir(filepath.Dir(target))
+
+	return nil
+}
+
+func (f *fileStore) List(store string) ([]StoreEntry, error) {
+	if !validName(store) {
+		return nil, errInvalidStoreEntry
+	}
+
+	files, err := os.ReadDir(filepath.Join(f.dir, store))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var entries []StoreEntry
+
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".json")
+
+		// skips stray files, such as temporary ones of writes
+		if !ok || !file.Type().IsRegular() || !validStoreEntry(store, id) {
+			continue
+		}
+
+		info, err := file.Info()
+
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, StoreEntry{ID: id, Size: info.Size(), Updated: info.ModTime()})
+	}
+
+	return entries, nil
+}
+
+func (f *fileStore) Stores() ([]string, error) {
+	dirs, err := os.ReadDir(f.dir)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var stores []string
+
+	for _, dir := range dirs {
+		if dir.IsDir() && validName(dir.Name()) {
+			stores = append(stores, dir.Name())
+		}
+	}
+
+	return stores, nil
+}
+
+func (f *fileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStoreFile is the database of the SQLite backend within the data
+// directory.
+const sqliteStoreFile = "prism.db"
+
+// sqliteSchema creates the tables of the SQLite backend. The primary key
+// of the entries serves lookups and the listings of a store, ordered by
+// ID; the other indexes serve sorting and searching the entries of a store
+// by name, size or modification time.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS stores (
+	name TEXT PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS entries (
+	store   TEXT    NOT NULL REFERENCES stores (name),
+	id      TEXT    NOT NULL,
+	data    BLOB    NOT NULL,
+	size    INTEGER NOT NULL,
+	updated INTEGER NOT NULL,
+
+	name TEXT GENERATED ALWAYS AS (
+		CASE WHEN json_valid(CAST(data AS TEXT)) THEN json_extract(CAST(data AS TEXT), '$.name') END
+	) VIRTUAL,
+
+	PRIMARY KEY (store, id)
+);
+
+CREATE INDEX IF NOT EXISTS entries_name ON entries (store, name COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS entries_size ON entries (store, size);
+CREATE INDEX IF NOT EXISTS entries_updated ON entries (store, updated);
+`
+
+// sqliteStore keeps the stores in one SQLite database: a row of stores per
+// store and of entries per entry, its modification time in nanoseconds.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	// writers wait for each other rather than failing; WAL lets reads go on
+	// meanwhile
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+// notExist is the error of a missing entry.
+func (s *sqliteStore) notExist(store, id string) error {
+	return fmt.Errorf("%s/%s: %w", store, id, os.ErrNotExist)
+}
+
+func (s *sqliteStore) Get(store, id string) ([]byte, error) {
+	var data []byte
+
+	err := s.db.QueryRow(`SELECT data FROM entries WHERE store = ? AND id = ?`, store, id).Scan(&data)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, s.notExist(store, id)
+	}
+
+	return data, err
+}
+
+func (s *sqliteStore) Stat(store, id string) (StoreEntry, error) {
+	entry := StoreEntry{ID: id}
+
+	var updated int64
+
+	err := s.db.QueryRow(`SELECT size, updated FROM entries WHERE store = ? AND id = ?`, store, id).Scan(&entry.Size, &updated)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return StoreEntry{}, s.notExist(store, id)
+	}
+
+	if err != nil {
+		return StoreEntry{}, err
+	}
+
+	entry.Updated = time.Unix(0, updated)
+
+	return entry, nil
+}
+
+func (s *sqliteStore) Put(store, id string, data []byte) error {
+	return s.putDated(store, id, data, time.Now())
+}
+
+func (s *sqliteStore) putDated(store, id string, data []byte, updated time.Time) error {
+	if !validStoreEntry(store, id) {
+		return errInvalidStoreEntry
+	}
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO stores (name) VALUES (?)`, store); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO entries (store, id, data, size, updated) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (store, id) DO UPDATE SET data = excluded.data, size = excluded.size, updated = excluded.updated`,
+		store, id, data, len(data), updated.UnixNano())
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Delete(store, id string) error {
+	result, err := s.db.Exec(`DELETE FROM entries WHERE store = ? AND id = ?`, store, id)
+
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return s.notExist(store, id)
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) Rename(store, id, targetStore, targetID string) error {
+	if !validStoreEntry(targetStore, targetID) {
+		return errInvalidStoreEntry
+	}
+
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var exists bool
+
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM entries WHERE store = ? AND id = ?)`, targetStore, targetID).Scan(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return fmt.Errorf("%s/%s: %w", targetStore, targetID, os.ErrExist)
+	}
+
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO stores (name) VALUES (?)`, targetStore); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE entries SET store = ?, id = ? WHERE store = ? AND id = ?`, targetStore, targetID, store, id)
+
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return s.notExist(store, id)
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) List(store string) ([]StoreEntry, error) {
+	rows, err := s.db.Query(`SELECT id, size, updated FROM entries WHERE store = ? ORDER BY id`, store)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []StoreEntry
+
+	for rows.Next() {
+		var entry StoreEntry
+		var updated int64
+
+		if err := rows.Scan(&entry.ID, &entry.Size, &updated); err != nil {
+			return nil, err
+		}
+
+		entry.Updated = time.Unix(0, updated)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *sqliteStore) Stores() ([]string, error) {
+	rows, err := s.db.Query(`SELECT name FROM stores ORDER BY name`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var stores []string
+
+	for rows.Next() {
+		var name string
+
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		stores = append(stores, name)
+	}
+
+	return stores, rows.Err()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
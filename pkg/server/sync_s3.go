@@ -0,0 +1,303 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// s3Provider syncs to an S3-compatible bucket (AWS, MinIO, R2, ...) using
+// path-style requests signed with AWS Signature Version 4.
+type s3Provider struct {
+	client *http.Client
+
+	endpoint *url.URL
+	bucket   string
+	region   string
+	prefix   string
+
+	accessKey string
+	secretKey string
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+	} `xml:"Contents"`
+
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func newS3Provider(client *http.Client, endpoint, bucket, region, prefix, accessKey, secretKey string) (*s3Provider, error) {
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	u, err := url.Parse(endpoint)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+
+	if bucket == "" {
+		return nil, fmt.Errorf("missing S3 bucket")
+	}
+
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+
+	return &s3Provider{
+		client: client,
+
+		endpoint: u,
+		bucket:   bucket,
+		region:   region,
+		prefix:   prefix,
+
+		accessKey: accessKey,
+		secretKey: secretKey,
+	}, nil
+}
+
+func (p *s3Provider) list(ctx context.Context) (map[string]string, error) {
+	files := map[string]string{}
+
+	token := ""
+
+	for {
+		query := map[string]string{
+			"list-type": "2",
+			"prefix":    p.prefix,
+		}
+
+		if token != "" {
+			query["continuation-token"] = token
+		}
+
+		resp, err := p.do(ctx, http.MethodGet, "", query, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListResult
+
+		err = xml.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(&result)
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("s3: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			if name, ok := strings.CutPrefix(object.Key, p.prefix); ok && name != "" {
+				files[name] = object.ETag
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return files, nil
+		}
+
+		token = result.NextContinuationToken
+	}
+}
+
+func (p *s3Provider) get(ctx context.Context, name string) ([]byte, error) {
+	resp, err := p.do(ctx, http.MethodGet, p.prefix+name, nil, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+}
+
+func (p *s3Provider) put(ctx context.Context, name string, data []byte) error {
+	resp, err := p.do(ctx, http.MethodPut, p.prefix+name, nil, data)
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+	return nil
+}
+
+func (p *s3Provider) delete(ctx context.Context, name string) error {
+	resp, err := p.do(ctx, http.MethodDelete, p.prefix+name, nil, nil)
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for key (the bucket itself when empty). Error
+// statuses are returned as errors, 404 wrapping os.ErrNotExist.
+func (p *s3Provider) do(ctx context.Context, method, key string, query map[string]string, body []byte) (*http.Response, error) {
+	u := *p.endpoint
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + p.bucket + "/" + key
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+
+	p.sign(req, u.RawPath, body, time.Now().UTC())
+
+	resp, err := p.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+
+		var s3Error struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+
+		xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&s3Error)
+
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("s3: %s: %w", key, os.ErrNotExist)
+		}
+
+		if s3Error.Message != "" {
+			return nil, fmt.Errorf("s3: %s %s: %s: %s", method, key, s3Error.Code, s3Error.Message)
+		}
+
+		return nil, fmt.Errorf("s3: %s %s: %s", method, key, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 authorization to req; path is the
+// URI-encoded request path.
+func (p *s3Provider) sign(req *http.Request, path string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + p.region + "/s3/aws4_request"
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + p.secretKey)
+
+	for _, part := range []string{date, p.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+p.accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// s3CanonicalQuery encodes query sorted by key as the signature requires.
+func s3CanonicalQuery(query map[string]string) string {
+	keys := make([]string, 0, len(query))
+
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	parts := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		parts = append(parts, s3Escape(key, true)+"="+s3Escape(query[key], true))
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything but unreserved characters (and "/"
+// unless encodeSlash is set).
+func s3Escape(value string, encodeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
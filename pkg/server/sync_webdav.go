@@ -0,0 +1,307 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// syncProvider is a remote mirroring the synced files, addressed by
+// slash-separated paths relative to the data directory. list returns the
+// revision of every file, an opaque version identifier such as an ETag;
+// get of a missing file returns an os.ErrNotExist error.
+type syncProvider interface {
+	list(ctx context.Context) (map[string]string, error)
+	get(ctx context.Context, path string) ([]byte, error)
+	put(ctx context.Context, path string, data []byte) error
+	delete(ctx context.Context, path string) error
+}
+
+// webdavProvider syncs to a WebDAV collection.
+type webdavProvider struct {
+	client *http.Client
+
+	base     *url.URL
+	username string
+	password string
+
+	// collections known to exist
+	collections map[string]bool
+}
+
+const webdavPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop><d:resourcetype/><d:getetag/><d:getcontentlength/><d:getlastmodified/></d:prop>
+</d:propfind>`
+
+type webdavMultistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+
+		Propstats []struct {
+			Status string `xml:"status"`
+
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+
+				ETag          string `xml:"getetag"`
+				ContentLength string `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func newWebDAVProvider(client *http.Client, rawURL, username, password string) (*webdavProvider, error) {
+	base, err := url.Parse(rawURL)
+
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid WebDAV URL %q", rawURL)
+	}
+
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	base.RawPath = ""
+
+	return &webdavProvider{
+		client: client,
+
+		base:     base,
+		username: username,
+		password: password,
+
+		collections: map[string]bool{},
+	}, nil
+}
+
+func (p *webdavProvider) url(name string) string {
+	return p.base.JoinPath(name).String()
+}
+
+func (p *webdavProvider) do(ctx context.Context, method, target string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	if p.username != "" || p.password != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+
+	return p.client.Do(req)
+}
+
+// list walks the collection and the collections in it (the stores).
+func (p *webdavProvider) list(ctx context.Context) (map[string]string, error) {
+	files := map[string]string{}
+
+	collections := []string{""}
+
+	for depth := 0; len(collections) > 0 && depth < 2; depth++ {
+		var next []string
+
+		for _, collection := range collections {
+			children, err := p.propfind(ctx, collection, files)
+
+			if err != nil {
+				return nil, err
+			}
+
+			next = append(next, children...)
+		}
+
+		collections = next
+	}
+
+	return files, nil
+}
+
+// propfind lists a collection, adding its files to files and returning
+// its sub collections.
+func (p *webdavProvider) propfind(ctx context.Context, collection string, files map[string]string) ([]string, error) {
+	target := p.base.String()
+
+	if collection != "" {
+		target = p.url(collection) + "/"
+	}
+
+	header := http.Header{
+		"Depth":        {"1"},
+		"Content-Type": {"application/xml"},
+	}
+
+	resp, err := p.do(ctx, "PROPFIND", target, []byte(webdavPropfind), header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	// the collection is created on the first push
+	if resp.StatusCode == http.StatusNotFound && collection == "" {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("webdav: PROPFIND %s: %s", target, resp.Status)
+	}
+
+	var status webdavMultistatus
+
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(&status); err != nil {
+		return nil, fmt.Errorf("webdav: %w", err)
+	}
+
+	var collections []string
+
+	for _, response := range status.Responses {
+		href, err := url.Parse(response.Href)
+
+		if err != nil {
+			continue
+		}
+
+		name, ok := strings.CutPrefix(p.base.ResolveReference(href).Path, p.base.Path)
+
+		if !ok {
+			continue
+		}
+
+		name = strings.Trim(name, "/")
+
+		// the collection itself
+		if name == collection {
+			continue
+		}
+
+		for _, propstat := range response.Propstats {
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+
+			prop := propstat.Prop
+
+			if prop.ResourceType.Collection != nil {
+				collections = append(collections, name)
+				break
+			}
+
+			revision := prop.ETag
+
+			if revision == "" {
+				revision = prop.LastModified + "/" + prop.ContentLength
+			}
+
+			files[name] = revision
+			break
+		}
+	}
+
+	return collections, nil
+}
+
+func (p *webdavProvider) get(ctx context.Context, name string) ([]byte, error) {
+	resp, err := p.do(ctx, http.MethodGet, p.url(name), nil, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("webdav: %s: %w", name, os.ErrNotExist)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webdav: GET %s: %s", name, resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+}
+
+func (p *webdavProvider) put(ctx context.Context, name string, data []byte) error {
+	if err := p.mkcol(ctx, path.Dir(name)); err != nil {
+		return err
+	}
+
+	resp, err := p.do(ctx, http.MethodPut, p.url(name), data, http.Header{"Content-Type": {"application/json"}})
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("webdav: PUT %s: %s", name, resp.Status)
+	}
+
+	return nil
+}
+
+// mkcol creates the collection dir and its parents, starting with the
+// base collection; existing ones answer 405, which is fine.
+func (p *webdavProvider) mkcol(ctx context.Context, dir string) error {
+	targets := []string{p.base.String()}
+
+	if dir != "." {
+		parent := ""
+
+		for _, segment := range strings.Split(dir, "/") {
+			parent = path.Join(parent, segment)
+			targets = append(targets, p.url(parent)+"/")
+		}
+	}
+
+	for _, target := range targets {
+		if p.collections[target] {
+			continue
+		}
+
+		resp, err := p.do(ctx, "MKCOL", target, nil, nil)
+
+		if err != nil {
+			return err
+		}
+
+		resp.Body.Close()
+
+		p.collections[target] = true
+	}
+
+	return nil
+}
+
+func (p *webdavProvider) delete(ctx context.Context, name string) error {
+	resp, err := p.do(ctx, http.MethodDelete, p.url(name), nil, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("webdav: DELETE %s: %s", name, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+var errTargetDenied = errors.New("target not allowed")
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which some
+// clusters use internally.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// thisNetwork is "this network" (RFC 1122), which Linux dials as the host
+// itself.
+var thisNetwork = netip.MustParsePrefix("0.0.0.0/8")
+
+// checkTarget fails with errTargetDenied when the configured target rules
+// deny host (host:port) of scheme, or the outbound proxy of opts when the
+// client chose it. Names are resolved, after the resolve overrides of opts,
+// to check their addresses; names that do not resolve here are only checked
+// by name, as only an outbound proxy can reach them. The address dialed in
+// the end is checked again, see dialControl.
+func (s *Server) checkTarget(ctx context.Context, scheme, host string, opts upstreamOptions) error {
+	cfg := s.config.Load()
+
+	if len(cfg.AllowTargets) == 0 && len(cfg.DenyTargets) == 0 && !denyPrivateTargets(cfg) {
+		return nil
+	}
+
+	if err := checkTargetHost(ctx, cfg, scheme, host, opts); err != nil {
+		return err
+	}
+
+	// a proxy of the client reaches whatever its address is, like a target
+	if proxyURL := opts.proxyURL(); proxyURL != nil && opts.CheckProxy {
+		return checkTargetHost(ctx, cfg, proxyURL.Scheme, proxyAddr(proxyURL), opts)
+	}
+
+	return nil
+}
+
+// checkTargetHost checks a single host (host:port) of scheme, see checkTarget.
+func checkTargetHost(ctx context.Context, cfg *config.Config, scheme, host string, opts upstreamOptions) error {
+	if _, ok := unixSocketPath(host); ok {
+		if denyPrivateTargets(cfg) || len(cfg.AllowTargets) > 0 {
+			return fmt.Errorf("%w: %s", errTargetDenied, host)
+		}
+
+		return nil
+	}
+
+	name, port, err := net.SplitHostPort(host)
+
+	if err != nil {
+		name, port = strings.Trim(host, "[]"), defaultPort(scheme)
+	}
+
+	name = strings.ToLower(name)
+
+	// resolve overrides decide which address is dialed
+	addr, _, _ := net.SplitHostPort(opts.resolveAddr(net.JoinHostPort(name, port)))
+
+	var addrs []netip.Addr
+
+	if ip, err := netip.ParseAddr(addr); err == nil {
+		addrs = []netip.Addr{ip.Unmap()}
+	} else if ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", addr); err == nil {
+		addrs = ips
+	}
+
+	if targetDenied(cfg, name, addrs) {
+		return fmt.Errorf("%w: %s", errTargetDenied, host)
+	}
+
+	return nil
+}
+
+// denyPrivateTargets tells whether private addresses are denied, by default
+// in remote mode.
+func denyPrivateTargets(cfg *config.Config) bool {
+	if cfg.DenyPrivate != nil {
+		return *cfg.DenyPrivate
+	}
+
+	return cfg.Remote
+}
+
+// targetDenied tells whether the target rules of cfg deny the host name
+// (lower case) with the addresses addrs. Deny rules win; with allow rules,
+// other targets are denied, and private addresses are unless allowed.
+func targetDenied(cfg *config.Config, name string, addrs []netip.Addr) bool {
+	matches := func(rule config.TargetRule) bool {
+		return rule.Matches(name, addrs)
+	}
+
+	if slices.ContainsFunc(cfg.DenyTargets, matches) {
+		return true
+	}
+
+	if slices.ContainsFunc(cfg.AllowTargets, matches) {
+		return false
+	}
+
+	return len(cfg.AllowTargets) > 0 || (denyPrivateTargets(cfg) && slices.ContainsFunc(addrs, privateAddr))
+}
+
+// dialTargetKey is the context key of the dialTarget of a connection.
+type dialTargetKey struct{}
+
+// dialTarget is the upstream a connection is dialed for, after checkTarget
+// passed it, and the outbound proxy of the client, if any.
+type dialTarget struct {
+	server *Server
+	name   string
+	proxy  string
+}
+
+// withDialTarget returns ctx dialing for the host (host:port or host) that
+// s checked the target rules for with opts.
+func (s *Server) withDialTarget(ctx context.Context, host string, opts upstreamOptions) context.Context {
+	target := dialTarget{server: s, name: hostName(host)}
+
+	if proxyURL := opts.proxyURL(); proxyURL != nil && opts.CheckProxy {
+		target.proxy = strings.ToLower(proxyURL.Hostname())
+	}
+
+	return context.WithValue(ctx, dialTargetKey{}, target)
+}
+
+// hostName returns the lower case name of host (host:port or host).
+func hostName(host string) string {
+	name, _, err := net.SplitHostPort(host)
+
+	if err != nil {
+		name = host
+	}
+
+	return strings.ToLower(strings.Trim(name, "[]"))
+}
+
+// dialControl returns the net.Dialer Control checking the address a
+// connection to addr (host:port) is made to against the target rules, so a
+// name resolving to another address by the time it is dialed (DNS
+// rebinding) is denied as well. It is nil unless ctx dials for a checked
+// target or the outbound proxy of the client; configured proxies are not
+// checked.
+func dialControl(ctx context.Context, addr string) func(network, address string, c syscall.RawConn) error {
+	target, ok := ctx.Value(dialTargetKey{}).(dialTarget)
+
+	if !ok {
+		return nil
+	}
+
+	name := hostName(addr)
+
+	if name != target.name && (target.proxy == "" || name != target.proxy) {
+		return nil
+	}
+
+	return func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+
+		if err != nil {
+			return err
+		}
+
+		ip, err := netip.ParseAddr(host)
+
+		if err != nil {
+			return err
+		}
+
+		if targetDenied(target.server.config.Load(), name, []netip.Addr{ip.Unmap()}) {
+			return fmt.Errorf("%w: %s (%s)", errTargetDenied, name, ip)
+		}
+
+		return nil
+	}
+}
+
+// upstreamStatus is the status of a failed upstream call: forbidden for
+// denied targets, gateway timeout for timeouts, else bad gateway.
+func upstreamStatus(err error) int {
+	if errors.Is(err, errTargetDenied) {
+		return http.StatusForbidden
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusBadGateway
+}
+
+// privateAddr tells whether addr is not publicly routable.
+func privateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsUnspecified() || sharedAddressSpace.Contains(addr) || thisNetwork.Contains(addr)
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "https", "grpcs", "wss":
+		return "443"
+	}
+
+	return "80"
+}
+
+// targetClient returns a client of the transport of opts restricted to the
+// allowed targets like the proxy endpoints, for the calls the server makes
+// itself; services of the configuration on private addresses need allow
+// rules, too. A zero timeout sets none.
+func (s *Server) targetClient(opts upstreamOptions, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &targetTransport{base: s.transport(opts), server: s, opts: opts},
+		Timeout:   timeout,
+	}
+}
+
+// targetTransport checks the target of every round trip, redirects
+// included, against the target rules.
+type targetTransport struct {
+	base   http.RoundTripper
+	server *Server
+	opts   upstreamOptions
+}
+
+func (t *targetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.server.checkTarget(req.Context(), req.URL.Scheme, req.URL.Host, t.opts); err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	return t.base.RoundTrip(req.WithContext(t.server.withDialTarget(req.Context(), req.URL.Host, t.opts)))
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+func targetRules(t *testing.T, value string) []config.TargetRule {
+	t.Helper()
+
+	rules, err := config.ParseTargetRules(value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rules
+}
+
+func targetServer(cfg *config.Config) *Server {
+	s := &Server{}
+	s.config.Store(cfg)
+
+	return s
+}
+
+func TestTargetDenied(t *testing.T) {
+	allowPrivate := false
+
+	tests := []struct {
+		name   string
+		cfg    *config.Config
+		host   string
+		addr   string
+		denied bool
+	}{
+		{"no rules", &config.Config{}, "localhost", "127.0.0.1", false},
+		{"remote private", &config.Config{Remote: true}, "localhost", "127.0.0.1", true},
+		{"remote carrier-grade nat", &config.Config{Remote: true}, "cgnat", "100.64.0.1", true},
+		{"remote this network", &config.Config{Remote: true}, "zero", "0.0.0.0", true},
+		{"remote mapped private", &config.Config{Remote: true}, "mapped", "::ffff:10.0.0.1", true},
+		{"remote public", &config.Config{Remote: true}, "example.com", "93.184.215.14", false},
+		{"remote private allowed", &config.Config{Remote: true, DenyPrivate: &allowPrivate}, "localhost", "127.0.0.1", false},
+		{"deny name", &config.Config{DenyTargets: targetRules(t, "*.internal")}, "db.internal", "93.184.215.14", true},
+		{"deny range", &config.Config{DenyTargets: targetRules(t, "93.184.0.0/16")}, "example.com", "93.184.215.14", true},
+		{"deny wins over allow", &config.Config{AllowTargets: targetRules(t, "example.com"), DenyTargets: targetRules(t, "example.com")}, "example.com", "93.184.215.14", true},
+		{"allow name", &config.Config{AllowTargets: targetRules(t, "example.com")}, "example.com", "93.184.215.14", false},
+		{"allow others denied", &config.Config{AllowTargets: targetRules(t, "example.com")}, "example.org", "93.184.215.14", true},
+		{"allow private", &config.Config{Remote: true, AllowTargets: targetRules(t, "10.0.0.0/8")}, "service", "10.0.0.1", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addrs := []netip.Addr{netip.MustParseAddr(test.addr)}
+
+			if denied := targetDenied(test.cfg, test.host, addrs); denied != test.denied {
+				t.Errorf("targetDenied(%s, %s) = %v, want %v", test.host, test.addr, denied, test.denied)
+			}
+		})
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	remote := &config.Config{Remote: true}
+
+	tests := []struct {
+		name   string
+		cfg    *config.Config
+		scheme string
+		host   string
+		opts   upstreamOptions
+		denied bool
+	}{
+		{"no rules", &config.Config{}, "http", "127.0.0.1:8080", upstreamOptions{}, false},
+		{"private", remote, "http", "127.0.0.1:8080", upstreamOptions{}, true},
+		{"private without port", remote, "https", "10.0.0.1", upstreamOptions{}, true},
+		{"private ipv6", remote, "http", "[::1]:8080", upstreamOptions{}, true},
+		{"public", remote, "https", "93.184.215.14", upstreamOptions{}, false},
+		{"resolved to private", remote, "https", "93.184.215.14:443", upstreamOptions{Resolve: "93.184.215.14:443:127.0.0.1"}, true},
+		{"resolved to public", remote, "https", "10.0.0.1:443", upstreamOptions{Resolve: "10.0.0.1:*:93.184.215.14"}, false},
+		{"client proxy private", remote, "https", "93.184.215.14", upstreamOptions{Proxy: "http://127.0.0.1:3128", CheckProxy: true}, true},
+		{"client proxy public", remote, "https", "93.184.215.14", upstreamOptions{Proxy: "http://93.184.215.15:3128", CheckProxy: true}, false},
+		{"configured proxy private", remote, "https", "93.184.215.14", upstreamOptions{Proxy: "http://127.0.0.1:3128"}, false},
+		{"client proxy denied name", &config.Config{DenyTargets: targetRules(t, "proxy.internal")}, "https", "93.184.215.14", upstreamOptions{Proxy: "socks5://proxy.internal", CheckProxy: true}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := targetServer(test.cfg).checkTarget(context.Background(), test.scheme, test.host, test.opts)
+
+			if denied := errors.Is(err, errTargetDenied); denied != test.denied {
+				t.Errorf("checkTarget(%s) = %v, want denied %v", test.host, err, test.denied)
+			}
+		})
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	s := targetServer(&config.Config{Remote: true})
+
+	clientProxy := upstreamOptions{Proxy: "http://proxy.example.com:3128", CheckProxy: true}
+	configuredProxy := upstreamOptions{Proxy: "http://proxy.example.com:3128"}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		addr    string
+		address string
+		checked bool
+		denied  bool
+	}{
+		{"unchecked", context.Background(), "example.com:443", "127.0.0.1:443", false, false},
+		{"target public", s.withDialTarget(context.Background(), "example.com", upstreamOptions{}), "example.com:443", "93.184.215.14:443", true, false},
+		{"target rebound", s.withDialTarget(context.Background(), "Example.com:443", upstreamOptions{}), "example.com:443", "127.0.0.1:443", true, true},
+		{"target ipv6", s.withDialTarget(context.Background(), "[::1]:8080", upstreamOptions{}), "[::1]:8080", "[::1]:8080", true, true},
+		{"other host", s.withDialTarget(context.Background(), "example.com", upstreamOptions{}), "proxy.example.com:3128", "127.0.0.1:3128", false, false},
+		{"client proxy", s.withDialTarget(context.Background(), "example.com", clientProxy), "proxy.example.com:3128", "127.0.0.1:3128", true, true},
+		{"client proxy public", s.withDialTarget(context.Background(), "example.com", clientProxy), "proxy.example.com:3128", "93.184.215.15:3128", true, false},
+		{"configured proxy", s.withDialTarget(context.Background(), "example.com", configuredProxy), "proxy.example.com:3128", "127.0.0.1:3128", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			control := dialControl(test.ctx, test.addr)
+
+			if checked := control != nil; checked != test.checked {
+				t.Fatalf("dialControl(%s) checked = %v, want %v", test.addr, checked, test.checked)
+			}
+
+			if control == nil {
+				return
+			}
+
+			err := control("tcp", test.address, nil)
+
+			if denied := errors.Is(err, errTargetDenied); denied != test.denied {
+				t.Errorf("control(%s) = %v, want denied %v", test.address, err, test.denied)
+			}
+		})
+	}
+}
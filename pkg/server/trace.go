@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTrace records connection and timing details of an upstream request.
+// With redirects followed server-side it reflects the last hop.
+type requestTrace struct {
+	mu sync.Mutex
+
+	start time.Time
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	gotConn, firstByte        time.Time
+
+	reused     bool
+	remoteAddr string
+}
+
+func newRequestTrace() *requestTrace {
+	return &requestTrace{start: time.Now()}
+}
+
+func (t *requestTrace) set(field *time.Time) {
+	t.mu.Lock()
+	*field = time.Now()
+	t.mu.Unlock()
+}
+
+// withContext attaches the trace to ctx.
+func (t *requestTrace) withContext(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.set(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.set(&t.dnsDone) },
+
+		ConnectStart: func(string, string) { t.set(&t.connectStart) },
+		ConnectDone:  func(string, string, error) { t.set(&t.connectDone) },
+
+		TLSHandshakeStart: func() { t.set(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.set(&t.tlsDone) },
+
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			t.gotConn = time.Now()
+			t.reused = info.Reused
+
+			if info.Conn != nil {
+				t.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+
+		GotFirstResponseByte: func() { t.set(&t.firstByte) },
+	})
+}
+
+// writeHeaders reports the trace as X-Prism-Timing (Server-Timing syntax,
+// durations in milliseconds), X-Prism-Connection-Reused and
+// X-Prism-Remote-Addr.
+func (t *requestTrace) writeHeaders(h http.Header) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var metrics []string
+
+	add := func(name string, from, to time.Time) {
+		if from.IsZero() || to.IsZero() {
+			return
+		}
+
+		metrics = append(metrics, fmt.Sprintf("%s;dur=%.3f", name, float64(to.Sub(from).Microseconds())/1000))
+	}
+
+	add("dns", t.dnsStart, t.dnsDone)
+	add("connect", t.connectStart, t.connectDone)
+	add("tls", t.tlsStart, t.tlsDone)
+	add("wait", t.gotConn, t.firstByte)
+	add("ttfb", t.start, t.firstByte)
+
+	if len(metrics) > 0 {
+		h.Set("X-Prism-Timing", strings.Join(metrics, ", "))
+	}
+
+	if !t.gotConn.IsZero() {
+		h.Set("X-Prism-Connection-Reused", strconv.FormatBool(t.reused))
+	}
+
+	if t.remoteAddr != "" {
+		h.Set("X-Prism-Remote-Addr", t.remoteAddr)
+	}
+}
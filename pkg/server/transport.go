@@ -0,0 +1,579 @@
+package server
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/adrianliechti/prism/pkg/config"
+)
+
+// upstreamOptions selects the transport configuration for upstream traffic.
+// It is comparable so it can key the shared transport cache.
+type upstreamOptions struct {
+	Insecure bool
+
+	// Proxy is an outbound proxy URL, "direct" to bypass any proxy, or empty
+	// to fall back to the environment (HTTP_PROXY & co).
+	Proxy string
+
+	// CheckProxy subjects Proxy, chosen by the client (X-Prism-Proxy), to
+	// the target rules; configured proxies are trusted.
+	CheckProxy bool
+
+	// ConnectTimeout bounds dialing the upstream; zero keeps the default.
+	ConnectTimeout time.Duration
+
+	// Resolve holds canonicalized curl-style "host:port:address" overrides,
+	// comma-separated (see parseResolve).
+	Resolve string
+
+	// TLS material of a referenced TLSCredential (X-Prism-TLS). The PEM
+	// text itself keys the cache, so edited credentials take effect.
+	CA          string
+	Certificate string
+	Key         string
+	ServerName  string
+}
+
+// tlsStore is the data store holding named TLS credentials.
+const tlsStore = "tls"
+
+func loadTLSCredential(ctx context.Context, name string) (*TLSCredential, error) {
+	if !validName(name) {
+		return nil, fmt.Errorf("invalid tls credential name")
+	}
+
+	var cred TLSCredential
+
+	if err := loadEntry(ctx, tlsStore, name, &cred); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("tls credential %q not found", name)
+		}
+
+		return nil, err
+	}
+
+	return &cred, nil
+}
+
+// readCACert reads the PEM file of CAs trusted for upstream traffic.
+func readCACert(path string) (string, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM(data) {
+		return "", fmt.Errorf("%s: no certificates found", path)
+	}
+
+	return string(data), nil
+}
+
+// tlsConfig builds the client TLS configuration; nil means the defaults.
+// Custom CAs extend the system roots rather than replacing them.
+func (o upstreamOptions) tlsConfig() (*tls.Config, error) {
+	if !o.Insecure && o.CA == "" && o.Certificate == "" && o.Key == "" && o.ServerName == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: o.Insecure,
+		ServerName:         o.ServerName,
+	}
+
+	if o.CA != "" {
+		pool, err := x509.SystemCertPool()
+
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM([]byte(o.CA)) {
+			return nil, errors.New("tls: no certificates found in CA")
+		}
+
+		config.RootCAs = pool
+	}
+
+	if o.Certificate != "" || o.Key != "" {
+		cert, err := tls.X509KeyPair([]byte(o.Certificate), []byte(o.Key))
+
+		if err != nil {
+			return nil, fmt.Errorf("tls: invalid client certificate: %w", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// parseResolve validates curl --resolve style entries ("host:port:address",
+// port "*" for any) and returns them canonicalized (sorted, deduplicated by
+// host:port, later entries winning) so they can key the transport cache.
+func parseResolve(entries []string) (string, error) {
+	rules := map[string]string{}
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return "", fmt.Errorf("invalid resolve entry %q: expected host:port:address", entry)
+		}
+
+		if parts[1] != "*" {
+			if _, err := strconv.ParseUint(parts[1], 10, 16); err != nil {
+				return "", fmt.Errorf("invalid resolve entry %q: bad port", entry)
+			}
+		}
+
+		rules[strings.ToLower(parts[0])+":"+parts[1]] = parts[2]
+	}
+
+	keys := slices.Sorted(maps.Keys(rules))
+
+	for i, key := range keys {
+		keys[i] = key + ":" + rules[key]
+	}
+
+	return strings.Join(keys, ","), nil
+}
+
+// resolveAddr applies the resolve overrides to a dial address. The address
+// may carry its own port ("10.0.0.1:8443"); otherwise the dialed port is kept.
+func (o upstreamOptions) resolveAddr(addr string) string {
+	if o.Resolve == "" {
+		return addr
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return addr
+	}
+
+	host = strings.ToLower(host)
+
+	var target string
+
+	for _, rule := range strings.Split(o.Resolve, ",") {
+		parts := strings.SplitN(rule, ":", 3)
+
+		if parts[0] != host {
+			continue
+		}
+
+		if parts[1] == port {
+			target = parts[2]
+			break
+		}
+
+		if parts[1] == "*" {
+			target = parts[2]
+		}
+	}
+
+	if target == "" {
+		return addr
+	}
+
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+
+	return net.JoinHostPort(strings.Trim(target, "[]"), port)
+}
+
+// dialContext dials addr after applying resolve overrides, checking the
+// address dialed against the target rules when ctx dials for a checked
+// target (see dialControl).
+func (o upstreamOptions) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+
+		Control: dialControl(ctx, addr),
+	}
+
+	if o.ConnectTimeout > 0 {
+		dialer.Timeout = o.ConnectTimeout
+	}
+
+	return dialer.DialContext(ctx, network, o.resolveAddr(addr))
+}
+
+// maxUpstreamTimeout caps client-requested timeouts so a typo can't pin
+// connections (and goroutines) for hours.
+const maxUpstreamTimeout = 10 * time.Minute
+
+// defaultProxyTimeout bounds proxied requests without X-Prism-Timeout, so
+// an upstream that never answers can't hold them forever either.
+const defaultProxyTimeout = 5 * time.Minute
+
+// parseTimeout reads a millisecond timeout header, clamped to
+// maxUpstreamTimeout. Missing headers yield zero.
+func parseTimeout(r *http.Request, header string) (time.Duration, error) {
+	value := r.Header.Get(header)
+
+	if value == "" {
+		return 0, nil
+	}
+
+	ms, err := strconv.ParseInt(value, 10, 64)
+
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("invalid %s: expected milliseconds", header)
+	}
+
+	return min(time.Duration(ms)*time.Millisecond, maxUpstreamTimeout), nil
+}
+
+// withRequestTimeout applies the total timeout from X-Prism-Timeout, or
+// fallback when the header is absent (zero means no deadline).
+func withRequestTimeout(r *http.Request, fallback time.Duration) (context.Context, context.CancelFunc, error) {
+	timeout, err := parseTimeout(r, "X-Prism-Timeout")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if timeout == 0 {
+		timeout = fallback
+	}
+
+	if timeout == 0 {
+		ctx, cancel := context.WithCancel(r.Context())
+		return ctx, cancel, nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return ctx, cancel, nil
+}
+
+// baseUpstreamOptions returns the configured defaults, the outbound proxy
+// and the trusted CAs, which server-side calls use as they are.
+func (s *Server) baseUpstreamOptions() upstreamOptions {
+	opts := upstreamOptions{
+		CA: s.caCert,
+	}
+
+	if proxyURL := s.config.Load().Proxy; proxyURL != nil {
+		opts.Proxy = proxyURL.String()
+	}
+
+	return opts
+}
+
+// upstreamOptionsFromRequest reads the X-Prism-* control headers, falling
+// back to the configured defaults.
+func (s *Server) upstreamOptionsFromRequest(r *http.Request) (upstreamOptions, error) {
+	opts := s.baseUpstreamOptions()
+	opts.Insecure = r.Header.Get("X-Prism-Insecure") == "true"
+
+	connectTimeout, err := parseTimeout(r, "X-Prism-Connect-Timeout")
+
+	if err != nil {
+		return opts, err
+	}
+
+	opts.ConnectTimeout = connectTimeout
+
+	settings, err := loadWorkspaceSettings(r.Context())
+
+	if err != nil {
+		return opts, err
+	}
+
+	// request overrides come last so they win over workspace rules
+	rules := slices.Clone(settings.Resolve)
+
+	for _, value := range r.Header.Values("X-Prism-Resolve") {
+		rules = append(rules, strings.Split(value, ",")...)
+	}
+
+	resolve, err := parseResolve(rules)
+
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Resolve = resolve
+
+	if name := r.Header.Get("X-Prism-TLS"); name != "" {
+		cred, err := loadTLSCredential(r.Context(), name)
+
+		if err != nil {
+			return opts, err
+		}
+
+		// the configured CAs stay trusted
+		if cred.CA != "" {
+			opts.CA = cred.CA + "\n" + s.caCert
+		}
+
+		opts.Certificate = cred.Certificate
+		opts.Key = cred.Key
+		opts.ServerName = cred.ServerName
+
+		// surface broken PEM here rather than as a handshake failure
+		if _, err := opts.tlsConfig(); err != nil {
+			return opts, err
+		}
+	}
+
+	if value := r.Header.Get("X-Prism-Proxy"); value != "" {
+		if value != "direct" {
+			proxyURL, err := config.ParseProxy(value)
+
+			if err != nil {
+				return opts, fmt.Errorf("invalid proxy: %w", err)
+			}
+
+			value = proxyURL.String()
+		}
+
+		opts.CheckProxy = value != "direct" && value != opts.Proxy
+		opts.Proxy = value
+	}
+
+	return opts, nil
+}
+
+// proxyURL returns the explicit outbound proxy, if any.
+func (o upstreamOptions) proxyURL() *url.URL {
+	if o.Proxy == "" || o.Proxy == "direct" {
+		return nil
+	}
+
+	u, err := url.Parse(o.Proxy)
+
+	if err != nil {
+		return nil
+	}
+
+	return u
+}
+
+// maxTransports bounds the pooled transports. Their options come from
+// request headers, so any client could otherwise grow them, and their idle
+// connections, without limit.
+const maxTransports = 64
+
+// transportCache holds the pooled transports keyed by upstreamOptions. The
+// least recently used one is dropped beyond maxTransports, closing its idle
+// connections; requests still using it finish undisturbed.
+type transportCache struct {
+	mu sync.Mutex
+
+	// most recently used first
+	order   list.List
+	entries map[upstreamOptions]*list.Element
+}
+
+type transportCacheEntry struct {
+	opts      upstreamOptions
+	transport *http.Transport
+}
+
+// get returns the transport of opts, created by create if there is none.
+func (c *transportCache) get(opts upstreamOptions, create func() *http.Transport) *http.Transport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[opts]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*transportCacheEntry).transport
+	}
+
+	if c.entries == nil {
+		c.entries = map[upstreamOptions]*list.Element{}
+	}
+
+	t := create()
+
+	c.entries[opts] = c.order.PushFront(&transportCacheEntry{opts: opts, transport: t})
+
+	for c.order.Len() > maxTransports {
+		entry := c.order.Remove(c.order.Back()).(*transportCacheEntry)
+
+		delete(c.entries, entry.opts)
+		entry.transport.CloseIdleConnections()
+	}
+
+	return t
+}
+
+// transport returns the pooled transport for the given options, so requests
+// with equal options reuse keep-alive connections (and skip DNS, TCP and TLS
+// setup); per-request transports would also leak idle connections.
+func (s *Server) transport(opts upstreamOptions) *http.Transport {
+	return s.transports.get(opts, func() *http.Transport {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+
+		// the default of 2 idle conns per host defeats reuse for parallel calls
+		t.MaxIdleConnsPerHost = 16
+
+		// validated when the options were read
+		t.TLSClientConfig, _ = opts.tlsConfig()
+
+		t.DialContext = opts.dialContext
+
+		if opts.ConnectTimeout > 0 {
+			t.TLSHandshakeTimeout = opts.ConnectTimeout
+		}
+
+		switch opts.Proxy {
+		case "":
+			// keep http.ProxyFromEnvironment
+		case "direct":
+			t.Proxy = nil
+		default:
+			t.Proxy = http.ProxyURL(opts.proxyURL())
+		}
+
+		return t
+	})
+}
+
+// dialProxy opens a tunnel to addr through an HTTP(S) CONNECT or SOCKS5
+// proxy. It is used for gRPC, which does not go through http.Transport.
+func dialProxy(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+
+		Control: dialControl(ctx, proxyAddr(proxyURL)),
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+
+		if u := proxyURL.User; u != nil {
+			password, _ := u.Password()
+			auth = &proxy.Auth{User: u.Username(), Password: password}
+		}
+
+		socks, err := proxy.SOCKS5("tcp", proxyAddr(proxyURL), auth, dialer)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return socks.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr(proxyURL))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT to %s failed: %s", addr, resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+
+	return conn, nil
+}
+
+// proxyAddr returns host:port of the proxy, defaulting the port by scheme.
+func proxyAddr(proxyURL *url.URL) string {
+	if proxyURL.Port() != "" {
+		return proxyURL.Host
+	}
+
+	port := "80"
+
+	switch proxyURL.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// bufferedConn keeps bytes the proxy sent right after its CONNECT response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
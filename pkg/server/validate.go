@@ -0,0 +1,404 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSchemaDepth guards against reference loops that never consume input.
+const maxSchemaDepth = 64
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// schemaValidator checks decoded JSON against JSON Schema (draft 7 / 2020-12
+// core keywords) and OpenAPI 3.0 schema objects, collecting every violation
+// instead of stopping at the first. Local $refs are looked up in root.
+type schemaValidator struct {
+	root any
+
+	violations []SchemaViolation
+}
+
+func validateSchema(root, schema, instance any) []SchemaViolation {
+	v := &schemaValidator{root: root}
+	v.validate(schema, instance, "", 0)
+
+	return v.violations
+}
+
+func (v *schemaValidator) report(path, keyword, format string, args ...any) {
+	v.violations = append(v.violations, SchemaViolation{
+		Path:    path,
+		Keyword: keyword,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// valid reports whether instance satisfies schema without recording
+// violations (for anyOf, oneOf and not).
+func (v *schemaValidator) valid(schema, instance any, path string, depth int) bool {
+	sub := &schemaValidator{root: v.root}
+	sub.validate(schema, instance, path, depth)
+
+	return len(sub.violations) == 0
+}
+
+func (v *schemaValidator) validate(schema, instance any, path string, depth int) {
+	if depth > maxSchemaDepth {
+		v.report(path, "$ref", "schema nesting too deep")
+		return
+	}
+
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			v.report(path, "false", "no value is allowed here")
+		}
+
+		return
+
+	case map[string]any:
+		v.validateObject(s, instance, path, depth)
+	}
+}
+
+func (v *schemaValidator) validateObject(s map[string]any, instance any, path string, depth int) {
+	if ref, ok := s["$ref"].(string); ok {
+		target, found := v.root, ref == "#"
+
+		if !found {
+			target, found = lookupPointer(v.root, ref)
+		}
+
+		if !found {
+			v.report(path, "$ref", "unresolvable reference %q", ref)
+		} else {
+			v.validate(target, instance, path, depth+1)
+		}
+	}
+
+	// OpenAPI 3.0: nullable widens any type to accept null
+	if instance == nil && s["nullable"] == true {
+		return
+	}
+
+	if !v.checkType(s, instance, path) {
+		return
+	}
+
+	if values, ok := s["enum"].([]any); ok {
+		if !slices.ContainsFunc(values, func(e any) bool { return jsonEqual(e, instance) }) {
+			v.report(path, "enum", "value must be one of %s", jsonList(values))
+		}
+	}
+
+	if value, ok := s["const"]; ok && !jsonEqual(value, instance) {
+		v.report(path, "const", "value must be %s", exampleString(value))
+	}
+
+	switch instance := instance.(type) {
+	case float64:
+		v.validateNumber(s, instance, path)
+	case string:
+		v.validateString(s, instance, path)
+	case []any:
+		v.validateArray(s, instance, path, depth)
+	case map[string]any:
+		v.validateProperties(s, instance, path, depth)
+	}
+
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			v.validate(sub, instance, path, depth+1)
+		}
+	}
+
+	if variants, ok := s["anyOf"].([]any); ok {
+		if !slices.ContainsFunc(variants, func(sub any) bool { return v.valid(sub, instance, path, depth+1) }) {
+			v.report(path, "anyOf", "value matches none of the %d allowed schemas", len(variants))
+		}
+	}
+
+	if variants, ok := s["oneOf"].([]any); ok {
+		matches := 0
+
+		for _, sub := range variants {
+			if v.valid(sub, instance, path, depth+1) {
+				matches++
+			}
+		}
+
+		if matches != 1 {
+			v.report(path, "oneOf", "value matches %d of the %d schemas, expected exactly one", matches, len(variants))
+		}
+	}
+
+	if not, ok := s["not"]; ok && v.valid(not, instance, path, depth+1) {
+		v.report(path, "not", "value must not match the schema")
+	}
+}
+
+// checkType reports a type mismatch; keywords for other types are then
+// meaningless, so validation of this schema stops.
+func (v *schemaValidator) checkType(s map[string]any, instance any, path string) bool {
+	var types []string
+
+	switch t := s["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+	default:
+		return true
+	}
+
+	actual := jsonType(instance)
+
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+
+	v.report(path, "type", "expected %s, got %s", strings.Join(types, " or "), actual)
+	return false
+}
+
+func (v *schemaValidator) validateNumber(s map[string]any, n float64, path string) {
+	if minimum, ok := s["minimum"].(float64); ok {
+		// OpenAPI 3.0 expresses exclusive bounds as booleans
+		if s["exclusiveMinimum"] == true && n <= minimum {
+			v.report(path, "exclusiveMinimum", "%s must be greater than %s", formatNumber(n), formatNumber(minimum))
+		} else if n < minimum {
+			v.report(path, "minimum", "%s must be at least %s", formatNumber(n), formatNumber(minimum))
+		}
+	}
+
+	if maximum, ok := s["maximum"].(float64); ok {
+		if s["exclusiveMaximum"] == true && n >= maximum {
+			v.report(path, "exclusiveMaximum", "%s must be less than %s", formatNumber(n), formatNumber(maximum))
+		} else if n > maximum {
+			v.report(path, "maximum", "%s must be at most %s", formatNumber(n), formatNumber(maximum))
+		}
+	}
+
+	if limit, ok := s["exclusiveMinimum"].(float64); ok && n <= limit {
+		v.report(path, "exclusiveMinimum", "%s must be greater than %s", formatNumber(n), formatNumber(limit))
+	}
+
+	if limit, ok := s["exclusiveMaximum"].(float64); ok && n >= limit {
+		v.report(path, "exclusiveMaximum", "%s must be less than %s", formatNumber(n), formatNumber(limit))
+	}
+
+	if factor, ok := s["multipleOf"].(float64); ok && factor > 0 {
+		if q := n / factor; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.report(path, "multipleOf", "%s must be a multiple of %s", formatNumber(n), formatNumber(factor))
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(s map[string]any, str string, path string) {
+	length := utf8.RuneCountInString(str)
+
+	if limit, ok := s["minLength"].(float64); ok && float64(length) < limit {
+		v.report(path, "minLength", "must be at least %s characters, got %d", formatNumber(limit), length)
+	}
+
+	if limit, ok := s["maxLength"].(float64); ok && float64(length) > limit {
+		v.report(path, "maxLength", "must be at most %s characters, got %d", formatNumber(limit), length)
+	}
+
+	if pattern, ok := s["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(str) {
+			v.report(path, "pattern", "%q does not match %q", str, pattern)
+		}
+	}
+
+	if format, ok := s["format"].(string); ok && !validFormat(format, str) {
+		v.report(path, "format", "%q is not a valid %s", str, format)
+	}
+}
+
+func (v *schemaValidator) validateArray(s map[string]any, items []any, path string, depth int) {
+	if limit, ok := s["minItems"].(float64); ok && float64(len(items)) < limit {
+		v.report(path, "minItems", "must have at least %s items, got %d", formatNumber(limit), len(items))
+	}
+
+	if limit, ok := s["maxItems"].(float64); ok && float64(len(items)) > limit {
+		v.report(path, "maxItems", "must have at most %s items, got %d", formatNumber(limit), len(items))
+	}
+
+	if s["uniqueItems"] == true {
+		for i := range items {
+			for j := i + 1; j < len(items); j++ {
+				if jsonEqual(items[i], items[j]) {
+					v.report(path, "uniqueItems", "items %d and %d are equal", i, j)
+				}
+			}
+		}
+	}
+
+	prefix, _ := s["prefixItems"].([]any)
+
+	for i, item := range items {
+		itemPath := path + "/" + strconv.Itoa(i)
+
+		switch {
+		case i < len(prefix):
+			v.validate(prefix[i], item, itemPath, depth+1)
+
+		case s["items"] != nil:
+			v.validate(s["items"], item, itemPath, depth+1)
+		}
+	}
+}
+
+func (v *schemaValidator) validateProperties(s map[string]any, object map[string]any, path string, depth int) {
+	if required, ok := s["required"].([]any); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, present := object[name]; !present {
+					v.report(path, "required", "missing required property %q", name)
+				}
+			}
+		}
+	}
+
+	if limit, ok := s["minProperties"].(float64); ok && float64(len(object)) < limit {
+		v.report(path, "minProperties", "must have at least %s properties, got %d", formatNumber(limit), len(object))
+	}
+
+	if limit, ok := s["maxProperties"].(float64); ok && float64(len(object)) > limit {
+		v.report(path, "maxProperties", "must have at most %s properties, got %d", formatNumber(limit), len(object))
+	}
+
+	properties, _ := s["properties"].(map[string]any)
+	patterns, _ := s["patternProperties"].(map[string]any)
+
+	for _, name := range sortedKeys(object) {
+		value := object[name]
+		propertyPath := path + "/" + escapePointer(name)
+
+		matched := false
+
+		if schema, ok := properties[name]; ok {
+			matched = true
+			v.validate(schema, value, propertyPath, depth+1)
+		}
+
+		for pattern, schema := range patterns {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(name) {
+				matched = true
+				v.validate(schema, value, propertyPath, depth+1)
+			}
+		}
+
+		if matched {
+			continue
+		}
+
+		switch additional := s["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.report(propertyPath, "additionalProperties", "property %q is not allowed", name)
+			}
+
+		case map[string]any:
+			v.validate(additional, value, propertyPath, depth+1)
+		}
+	}
+}
+
+// validFormat checks the common string formats; unknown formats pass.
+func validFormat(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+
+	case "uuid":
+		return uuidRegex.MatchString(value)
+
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && !strings.Contains(value, ":")
+
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ":")
+	}
+
+	return true
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonEqual(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func jsonList(values []any) string {
+	parts := make([]string, len(values))
+
+	for i, value := range values {
+		parts[i] = exampleString(value)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// escapePointer escapes a JSON pointer token.
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
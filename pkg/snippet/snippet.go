@@ -0,0 +1,148 @@
+// Package snippet renders HTTP requests as client code. Each language is a
+// text/template in templates/ plus an entry in the languages table.
+package snippet
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Request is a fully resolved HTTP request: the query is part of URL and
+// the body is one of Body, Form or File.
+type Request struct {
+	Method string
+	URL    string
+
+	Headers []Header
+
+	Body string
+	Form []FormField
+	File string
+
+	Insecure        bool
+	FollowRedirects bool
+}
+
+// HasFiles reports whether any form field uploads a file.
+func (r *Request) HasFiles() bool {
+	for _, f := range r.Form {
+		if f.File != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Header struct {
+	Name  string
+	Value string
+}
+
+// FormField is a multipart field; File names the file to upload instead of
+// a text Value.
+type FormField struct {
+	Name  string
+	Value string
+	File  string
+}
+
+type Language struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	// format post-processes the rendered code (e.g. gofmt)
+	format func([]byte) ([]byte, error)
+}
+
+var languages = []Language{
+	{ID: "curl", Name: "cURL"},
+	{ID: "go", Name: "Go (net/http)", format: format.Source},
+	{ID: "python", Name: "Python (requests)"},
+	{ID: "javascript", Name: "JavaScript (fetch)"},
+	{ID: "httpie", Name: "HTTPie"},
+}
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"sh":    shellQuote,
+	"go":    goQuote,
+	"str":   stringLiteral,
+	"base":  path.Base,
+	"lower": strings.ToLower,
+	"title": func(s string) string {
+		return strings.ToUpper(s[:1]) + strings.ToLower(s[1:])
+	},
+}).ParseFS(templateFS, "templates/*.tmpl"))
+
+// Languages lists the supported languages.
+func Languages() []Language {
+	return languages
+}
+
+// Generate renders r as code in the given language.
+func Generate(language string, r *Request) (string, error) {
+	for _, l := range languages {
+		if l.ID != language {
+			continue
+		}
+
+		var buf bytes.Buffer
+
+		if err := templates.ExecuteTemplate(&buf, l.ID+".tmpl", r); err != nil {
+			return "", err
+		}
+
+		code := buf.Bytes()
+
+		if l.format != nil {
+			formatted, err := l.format(code)
+
+			if err != nil {
+				return "", err
+			}
+
+			code = formatted
+		}
+
+		return string(code), nil
+	}
+
+	return "", fmt.Errorf("unsupported language %q", language)
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// goQuote returns a Go string literal, preferring a raw string for
+// multi-line text.
+func goQuote(s string) string {
+	if strings.Contains(s, "\n") && !strings.ContainsAny(s, "`\r") {
+		return "`" + s + "`"
+	}
+
+	return strconv.Quote(s)
+}
+
+// stringLiteral returns a double-quoted literal valid in JavaScript and
+// Python.
+func stringLiteral(s string) string {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -2,10 +2,17 @@ import { OpenAITextAdapter } from '@tanstack/ai-openai';
 import type { OpenAIChatModel } from '@tanstack/ai-openai';
 import { getConfig } from '../config';
 
-export function createChatAdapter(model: string) {
+// The server translates the Responses API for providers lacking it, so the
+// OpenAI adapter serves all of them.
+export function createChatAdapter(model: string, provider?: string) {
   const baseURL = `${window.location.origin}/openai/v1`;
   return new OpenAITextAdapter(
-    { baseURL, apiKey: 'not-needed', dangerouslyAllowBrowser: true },
+    {
+      baseURL,
+      apiKey: 'not-needed',
+      dangerouslyAllowBrowser: true,
+      defaultHeaders: provider ? { 'X-Prism-AI-Provider': provider } : undefined,
+    },
     model as OpenAIChatModel,
   );
 }
@@ -13,3 +20,7 @@ export function createChatAdapter(model: string) {
 export function getConfiguredModel(): string {
   return getConfig().ai?.model || 'gpt-5.2';
 }
+
+export function getConfiguredProvider(): string | undefined {
+  return getConfig().ai?.provider;
+}
@@ -3,7 +3,7 @@ import { Send, X, Trash2, Square, Loader2, Sparkles } from 'lucide-react';
 import { useChat, stream, type UIMessage } from '@tanstack/ai-react';
 import { chat, maxIterations } from '@tanstack/ai';
 import type { AnyClientTool } from '@tanstack/ai-client';
-import { createChatAdapter, getConfiguredModel } from '../api/chatAdapter';
+import { createChatAdapter, getConfiguredModel, getConfiguredProvider } from '../api/chatAdapter';
 import type { AdapterConfig } from '../api/toolsCommon';
 import type { AllSetters } from '../types/chat';
 import type { Request } from '../types/types';
@@ -96,7 +96,7 @@ export function ChatPanel({ isOpen, onClose, request, setters }: ChatPanelProps)
   // Create connection adapter that wraps the chat() function
   const connection = useMemo(() => {
     const model = getConfiguredModel();
-    const adapter = createChatAdapter(model);
+    const adapter = createChatAdapter(model, getConfiguredProvider());
 
     return stream((messages) =>
       chat({
@@ -1,6 +1,7 @@
 import { useState, useRef, useEffect } from 'react';
 import { useClient } from '../../context/useClient';
 import { noAutoCorrectProps } from '../../utils/inputProps';
+import { readProxyError } from '../../lib/proxy';
 import { ChevronDown, Loader2, Box, Zap } from 'lucide-react';
 
 interface MethodReflection {
@@ -37,8 +38,7 @@ async function fetchReflection(scheme: string, host: string): Promise<GrpcReflec
   }
   const response = await fetch(`/proxy/grpc/${scheme}/${host}`);
   if (!response.ok) {
-    const text = (await response.text()).trim();
-    throw new Error(text || 'Failed to fetch services');
+    throw new Error(await readProxyError(response, 'Failed to fetch services'));
   }
   const data: GrpcReflectResponse = await response.json();
   reflectionCache = { key, data };
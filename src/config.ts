@@ -1,7 +1,19 @@
 // Global configuration loaded from /config.json
 
+export type AIProviderType = 'openai' | 'azure' | 'anthropic' | 'ollama' | 'gemini';
+
+export interface AIProvider {
+  name: string;
+  type: AIProviderType;
+  model: string;
+}
+
 export interface AIConfig {
+  // Model of the default provider
   model?: string;
+  // Name of the default provider
+  provider?: string;
+  providers?: AIProvider[];
 }
 
 export interface AppConfig {
@@ -14,7 +14,7 @@ import {
   type McpCallToolResponse,
   type McpReadResourceResponse,
 } from '../lib/data';
-import { buildOpenAIProxyPath, buildMcpProxyPath } from '../lib/proxy';
+import { buildOpenAIProxyPath, buildMcpProxyPath, readProxyError } from '../lib/proxy';
 import type { McpListFeaturesResponse, OpenAIChatInput, OpenAIEmbeddingsInput, OpenAIRequestData, OpenAIImageFile } from '../types/types';
 import { resolveVariables } from '../utils/variables';
 import { kvToRecord } from '../utils/format';
@@ -435,8 +435,7 @@ export function ClientProvider({ children }: { children: ReactNode }) {
         body: JSON.stringify({ headers: kvToRecord(req.mcp?.headers ?? [], v => resolveVariables(v, req.variables)) }),
       });
       if (!response.ok) {
-        const errorText = await response.text();
-        throw new Error(errorText || `HTTP ${response.status}`);
+        throw new Error(await readProxyError(response));
       }
       const features: McpListFeaturesResponse = await response.json();
       if (features.errors?.length && !features.error) {
@@ -561,6 +560,17 @@ export function ClientProvider({ children }: { children: ReactNode }) {
     if (!response.ok) {
       const trimmed = responseBody.trim();
       error = trimmed ? trimmed : `HTTP ${response.status}`;
+      // failed calls come back as a JSON status (code, message, details)
+      if (response.headers.get('content-type')?.includes('application/json')) {
+        try {
+          const status = JSON.parse(trimmed) as { error?: string; message?: string };
+          if (status.error) error = status.error;
+          // errors of the proxy itself (X-Prism-Error) carry a message
+          else if (response.headers.get('x-prism-error') && status.message) error = status.message;
+        } catch {
+          // keep the raw body
+        }
+      }
     }
 
     return {
@@ -603,7 +613,7 @@ export function ClientProvider({ children }: { children: ReactNode }) {
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ name: req.mcp.tool.name, arguments: args, headers: mcpHeaders }),
       });
-      if (!response.ok) { const t = await response.text(); throw new Error(t || `HTTP ${response.status}`); }
+      if (!response.ok) throw new Error(await readProxyError(response));
       mcpResult = await response.json();
     } else if (req.mcp?.resource) {
       const path = buildMcpProxyPath(serverUrl, 'resource/call');
@@ -614,7 +624,7 @@ export function ClientProvider({ children }: { children: ReactNode }) {
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ uri: req.mcp.resource.uri, headers: mcpHeaders }),
       });
-      if (!response.ok) { const t = await response.text(); throw new Error(t || `HTTP ${response.status}`); }
+      if (!response.ok) throw new Error(await readProxyError(response));
       mcpResult = await response.json();
     } else {
       throw new Error('No tool or resource selected');
@@ -667,7 +677,7 @@ export function ClientProvider({ children }: { children: ReactNode }) {
 
       const proxyUrl = buildOpenAIProxyPath(baseUrl, 'responses');
       const response = await fetch(proxyUrl, { method: 'POST', headers: openaiHeaders, body: JSON.stringify({ model, input }) });
-      if (!response.ok) { const t = await response.text(); throw new Error(t || `HTTP ${response.status}`); }
+      if (!response.ok) throw new Error(await readProxyError(response));
 
       const data = await response.json();
       let chatOutput = '';
@@ -702,14 +712,14 @@ export function ClientProvider({ children }: { children: ReactNode }) {
         }
         const proxyUrl = buildOpenAIProxyPath(baseUrl, 'images/edits');
         const response = await fetch(proxyUrl, { method: 'POST', headers: openaiBaseHeaders, body: formData });
-        if (!response.ok) { const t = await response.text(); throw new Error(t || `HTTP ${response.status}`); }
+        if (!response.ok) throw new Error(await readProxyError(response));
         const data = await response.json();
         const img = (data.data || [])[0] as { b64_json?: string; url?: string } | undefined;
         openaiResponse = { result: { type: 'image', image: img?.b64_json || img?.url || '' }, duration: Math.round(performance.now() - startTime) };
       } else {
         const proxyUrl = buildOpenAIProxyPath(baseUrl, 'images/generations');
         const response = await fetch(proxyUrl, { method: 'POST', headers: openaiHeaders, body: JSON.stringify({ model, prompt, response_format: 'b64_json' }) });
-        if (!response.ok) { const t = await response.text(); throw new Error(t || `HTTP ${response.status}`); }
+        if (!response.ok) throw new Error(await readProxyError(response));
         const data = await response.json();
         const img = (data.data || [])[0] as { b64_json?: string; url?: string } | undefined;
         openaiResponse = { result: { type: 'image', image: img?.b64_json || img?.url || '' }, duration: Math.round(performance.now() - startTime) };
@@ -721,7 +731,7 @@ export function ClientProvider({ children }: { children: ReactNode }) {
 
       const proxyUrl = buildOpenAIProxyPath(baseUrl, 'audio/speech');
       const response = await fetch(proxyUrl, { method: 'POST', headers: openaiHeaders, body: JSON.stringify({ model, input: text, voice }) });
-      if (!response.ok) { const t = await response.text(); throw new Error(t || `HTTP ${response.status}`); }
+      if (!response.ok) throw new Error(await readProxyError(response));
 
       const audioBlob = await response.blob();
       const audioBase64 = await new Promise<string>((resolve, reject) => {
@@ -748,7 +758,7 @@ export function ClientProvider({ children }: { children: ReactNode }) {
 
       const proxyUrl = buildOpenAIProxyPath(baseUrl, 'audio/transcriptions');
       const response = await fetch(proxyUrl, { method: 'POST', headers: openaiBaseHeaders, body: formData });
-      if (!response.ok) { const t = await response.text(); throw new Error(t || `HTTP ${response.status}`); }
+      if (!response.ok) throw new Error(await readProxyError(response));
       const data = await response.json();
       openaiResponse = { result: { type: 'transcription', text: data.text || '' }, duration: Math.round(performance.now() - startTime) };
     } else if (req.openai?.embeddings) {
@@ -757,7 +767,7 @@ export function ClientProvider({ children }: { children: ReactNode }) {
 
       const proxyUrl = buildOpenAIProxyPath(baseUrl, 'embeddings');
       const response = await fetch(proxyUrl, { method: 'POST', headers: openaiHeaders, body: JSON.stringify({ model, input: texts }) });
-      if (!response.ok) { const t = await response.text(); throw new Error(t || `HTTP ${response.status}`); }
+      if (!response.ok) throw new Error(await readProxyError(response));
       const data = await response.json();
       openaiResponse = { result: { type: 'embeddings', embeddings: (data.data || []).map((item: { embedding: number[] }) => item.embedding) }, duration: Math.round(performance.now() - startTime) };
     } else {
@@ -896,6 +906,11 @@ export function ClientProvider({ children }: { children: ReactNode }) {
       method: httpMethod, headers: fetchHeaders,
       body: body && httpMethod !== 'GET' && httpMethod !== 'HEAD' ? body : undefined,
     });
+    // the proxy failed to get a response (DNS, TLS, timeout, ...)
+    if (response.headers.get('x-prism-error')) {
+      throw new Error(await readProxyError(response));
+    }
+
     const responseBody = await response.blob();
     const duration = Math.round(performance.now() - startTime);
 
@@ -921,6 +936,8 @@ export function ClientProvider({ children }: { children: ReactNode }) {
         responseHeaders[lower.slice('x-prism-upstream-'.length)] = value;
         return;
       }
+      // other X-Prism-* headers are proxy metadata (timing, truncation, ...)
+      if (lower.startsWith('x-prism-')) return;
       responseHeaders[key] = value;
     });
 
@@ -352,6 +352,33 @@ function deserializeRequest(serialized: SerializedRequest): Request {
 
 const STORE_NAME = 'requests';
 
+// ETags of the entries as last read or written, sent as If-Match so a
+// change made elsewhere in the meantime isn't overwritten.
+const entryETags = new Map<string, string>();
+
+function rememberETag(id: string, response: Response) {
+  const etag = response.headers.get('ETag');
+  if (etag) {
+    entryETags.set(id, etag);
+  }
+}
+
+// preconditionHeaders makes writes conditional: If-Match with the known
+// ETag, or If-None-Match for entries this window hasn't seen yet.
+function preconditionHeaders(id: string): Record<string, string> {
+  const etag = entryETags.get(id);
+  return etag ? { 'If-Match': etag } : { 'If-None-Match': '*' };
+}
+
+// handleModified offers to reload the requests when an entry was changed
+// elsewhere (412) and fails the write.
+function handleModified(): never {
+  if (window.confirm('This request was changed elsewhere. Reload to get the latest version?')) {
+    queryClient.invalidateQueries({ queryKey: ['requests'] });
+  }
+  throw new Error('Request was changed elsewhere');
+}
+
 async function fetchAllRequests(): Promise<SerializedRequest[]> {
   const response = await fetch(`/data/${STORE_NAME}`);
   if (!response.ok) {
@@ -363,6 +390,7 @@ async function fetchAllRequests(): Promise<SerializedRequest[]> {
     entries.map(async (entry) => {
       const res = await fetch(`/data/${STORE_NAME}/${encodeURIComponent(entry.id)}`);
       if (!res.ok) return null;
+      rememberETag(entry.id, res);
       const data: SerializedRequest = await res.json();
       return data;
     })
@@ -374,21 +402,30 @@ async function fetchAllRequests(): Promise<SerializedRequest[]> {
 async function saveRequestToServer(serialized: SerializedRequest): Promise<void> {
   const response = await fetch(`/data/${STORE_NAME}/${encodeURIComponent(serialized.id)}`, {
     method: 'PUT',
-    headers: { 'Content-Type': 'application/json' },
+    headers: { 'Content-Type': 'application/json', ...preconditionHeaders(serialized.id) },
     body: JSON.stringify(serialized),
   });
+  if (response.status === 412) {
+    handleModified();
+  }
   if (!response.ok) {
     throw new Error(`Failed to save request: ${response.statusText}`);
   }
+  rememberETag(serialized.id, response);
 }
 
 async function deleteRequestFromServer(id: string): Promise<void> {
   const response = await fetch(`/data/${STORE_NAME}/${encodeURIComponent(id)}`, {
     method: 'DELETE',
+    headers: preconditionHeaders(id),
   });
+  if (response.status === 412) {
+    handleModified();
+  }
   if (!response.ok && response.status !== 404) {
     throw new Error(`Failed to delete request: ${response.statusText}`);
   }
+  entryETags.delete(id);
 }
 
 // ============================================================================
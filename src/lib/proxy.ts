@@ -31,3 +31,32 @@ export function buildMcpProxyPath(serverUrl: string, suffix: string): string {
     return '';
   }
 }
+
+/**
+ * Error body of a failed call of the proxy endpoints, marked by the
+ * X-Prism-Error header carrying its code. Category is dns, tls, timeout,
+ * connection, protocol, denied, canceled, request or internal.
+ */
+export interface ProxyError {
+  code: string;
+  message: string;
+  category: string;
+  retriable: boolean;
+}
+
+/**
+ * Read the message of a failed proxy call: that of a ProxyError body, else
+ * the plain text, else the status.
+ */
+export async function readProxyError(response: Response, fallback?: string): Promise<string> {
+  const text = (await response.text()).trim();
+  if (response.headers.get('x-prism-error')) {
+    try {
+      const error = JSON.parse(text) as ProxyError;
+      if (error.message) return error.message;
+    } catch {
+      // keep the raw body
+    }
+  }
+  return text || fallback || `HTTP ${response.status}`;
+}
@@ -10,7 +10,14 @@ export function buildSchemaExample(schema: unknown): unknown {
   if (type === 'object') {
     const result: Record<string, unknown> = {};
     const props = (s.properties || {}) as Record<string, unknown>;
+    // gRPC oneof members (x-oneof) are mutually exclusive; fill the first only
+    const oneofs = new Set<unknown>();
     Object.keys(props).forEach((key) => {
+      const oneof = (props[key] as Record<string, unknown> | undefined)?.['x-oneof'];
+      if (oneof !== undefined) {
+        if (oneofs.has(oneof)) return;
+        oneofs.add(oneof);
+      }
       result[key] = buildSchemaExample(props[key]);
     });
     return result;
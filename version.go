@@ -0,0 +1,82 @@
+package prism
+
+import (
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+// Release builds set the build identification with
+// -ldflags "-X github.com/adrianliechti/prism.version=1.2.3
+// -X github.com/adrianliechti/prism.commit=<sha> -X github.com/adrianliechti/prism.date=<RFC 3339>";
+// other builds fall back to what Go stamped into the build info.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// pseudoVersion matches the versions Go stamps on builds of untagged
+// commits, e.g. v0.0.0-20260101120000-0123456789ab.
+var pseudoVersion = regexp.MustCompile(`\d{14}-[0-9a-f]{12}$`)
+
+// Version returns the release of this build without a leading "v": the one
+// set at link time, or else the module version Go derived from the git tag
+// of the build, or else "dev".
+func Version() string {
+	if version != "" {
+		return strings.TrimPrefix(version, "v")
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		v := info.Main.Version
+
+		if v != "" && v != "(devel)" && !strings.HasSuffix(v, "+dirty") && !pseudoVersion.MatchString(v) {
+			return strings.TrimPrefix(v, "v")
+		}
+	}
+
+	return "dev"
+}
+
+// Commit returns the git commit of this build, suffixed "-dirty" when
+// built from a modified tree, or "" when unknown.
+func Commit() string {
+	if commit != "" {
+		return commit
+	}
+
+	revision := buildSetting("vcs.revision")
+
+	if revision != "" && buildSetting("vcs.modified") == "true" {
+		revision += "-dirty"
+	}
+
+	return revision
+}
+
+// BuildDate returns when this build was made (RFC 3339), or else the time
+// of its commit, or "" when unknown.
+func BuildDate() string {
+	if date != "" {
+		return date
+	}
+
+	return buildSetting("vcs.time")
+}
+
+func buildSetting(key string) string {
+	info, ok := debug.ReadBuildInfo()
+
+	if !ok {
+		return ""
+	}
+
+	for _, setting := range info.Settings {
+		if setting.Key == key {
+			return setting.Value
+		}
+	}
+
+	return ""
+}